@@ -111,7 +111,7 @@ func (a *App) SelectDataDir() (string, error) {
 	return strings.TrimSpace(selectedDir), nil
 }
 
-// SetDataDir 更新应用数据目录，并同步刷新依赖该目录的进度存储配置。
+// SetDataDir 更新应用数据目录，并同步刷新依赖该目录的进度存储与书库索引。
 func (a *App) SetDataDir(dataDir string) (*config.Config, error) {
 	trimmedDir := strings.TrimSpace(dataDir)
 	if trimmedDir == "" {
@@ -131,11 +131,16 @@ func (a *App) SetDataDir(dataDir string) (*config.Config, error) {
 	if err := a.progressService.SetDataDir(absoluteDir); err != nil {
 		return nil, fmt.Errorf("更新阅读进度目录失败: %w", err)
 	}
+	if err := a.searchService.SetDataDir(absoluteDir); err != nil {
+		_ = a.progressService.SetDataDir(previousDir)
+		return nil, fmt.Errorf("更新搜索数据目录失败: %w", err)
+	}
 
 	a.config.DataDir = absoluteDir
 	if err := a.config.Save(); err != nil {
 		a.config.DataDir = previousDir
 		_ = a.progressService.SetDataDir(previousDir)
+		_ = a.searchService.SetDataDir(previousDir)
 		return nil, fmt.Errorf("保存配置失败: %w", err)
 	}
 
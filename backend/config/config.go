@@ -46,7 +46,7 @@ func LoadConfig() (*Config, error) {
 		Version:          "1.0.0",
 		DataDir:          getDefaultDataDir(),
 		LogLevel:         "info",
-		SupportedFormats: []string{"txt", "epub", "pdf", "mobi", "azw3"},
+		SupportedFormats: []string{"txt", "epub", "pdf", "mobi", "azw3", "fb2", "fb2.zip", "cbz"},
 		MaxFileSize:      100, // 100MB
 	}
 
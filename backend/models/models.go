@@ -8,12 +8,20 @@ type Novel struct {
 	Author string `json:"author"`
 	// FilePath 文件路径
 	FilePath string `json:"file_path"`
+	// Series 所属系列
+	Series string `json:"series,omitempty"`
+	// SeriesIndex 系列中的序号，0 表示未知
+	SeriesIndex int `json:"series_index,omitempty"`
+	// Annotation 内容简介
+	Annotation string `json:"annotation,omitempty"`
 	// Cover 封面图（data URL）
 	Cover string `json:"cover"`
 	// Format 文件格式 (.txt, .epub, .pdf, etc.)
 	Format string `json:"format"`
 	// Size 文件大小（字节）
 	Size int64 `json:"size"`
+	// Encoding 文本编码（仅 TXT 等纯文本格式）
+	Encoding string `json:"encoding,omitempty"`
 	// Content 小说内容
 	Content string `json:"content,omitempty"`
 	// ContentLength 正文总长度（按 rune 计）
@@ -26,6 +34,12 @@ type Novel struct {
 	ReadProgress float64 `json:"read_progress"`
 	// LastReadTime 最后阅读时间
 	LastReadTime int64 `json:"last_read_time"`
+	// PDFLayout PDF 文字版式识别结果，仅文字型 PDF
+	PDFLayout *PDFLayout `json:"pdf_layout,omitempty"`
+	// PageOffsets PDF 每页在正文中的起始位置（按 rune 计），下标为从 0 开始的页码
+	PageOffsets []int `json:"page_offsets,omitempty"`
+	// PageLabels PDF 的印刷页码（如 i、ii、1、2），与 PageOffsets 下标对应；与页序一致时为空
+	PageLabels []string `json:"page_labels,omitempty"`
 }
 
 // Chapter 章节模型
@@ -40,6 +54,97 @@ type Chapter struct {
 	EndPos int `json:"end_pos"`
 	// WordCount 字数
 	WordCount int `json:"word_count"`
+	// Level 目录层级，0 为顶层（卷，或没有分卷时的章）
+	Level int `json:"level"`
+	// ParentIndex 上级章节索引，顶层为 -1
+	ParentIndex int `json:"parent_index"`
+}
+
+// ChapterRule 章节标题识别规则
+type ChapterRule struct {
+	// Name 规则名称
+	Name string `json:"name"`
+	// Pattern 匹配章节标题行的正则表达式
+	Pattern string `json:"pattern"`
+	// Enabled 是否启用
+	Enabled bool `json:"enabled"`
+	// IsVolume 是否为分卷标题，分卷下的章节会归入该卷
+	IsVolume bool `json:"is_volume"`
+}
+
+// ChapterRuleSet 章节识别规则集，规则按顺序匹配
+type ChapterRuleSet struct {
+	// Rules 规则列表
+	Rules []ChapterRule `json:"rules"`
+	// MaxTitleLength 标题最大长度（按 rune 计），0 表示不限制
+	MaxTitleLength int `json:"max_title_length"`
+	// MinChapterLength 章节最小长度（按 rune 计），不足时并入上一章，0 表示不限制
+	MinChapterLength int `json:"min_chapter_length"`
+}
+
+// OpenOptions 打开书籍时的附加参数
+type OpenOptions struct {
+	// Password PDF 打开密码
+	Password string `json:"password"`
+	// RememberPassword 加密保存密码，之后从书架打开无需再输入
+	RememberPassword bool `json:"remember_password"`
+}
+
+// ComicOptions 漫画阅读选项
+type ComicOptions struct {
+	// RightToLeft 从右到左阅读（日漫），多页同屏时第一页在右侧
+	RightToLeft bool `json:"right_to_left"`
+	// PagesPerChapter 每章包含的页数，1 为单页，2 为双页同屏
+	PagesPerChapter int `json:"pages_per_chapter"`
+}
+
+// PDFOptions PDF 文本提取选项
+type PDFOptions struct {
+	// RemovePageDecorations 去掉页眉、页脚和页码，误删正文时可关闭
+	RemovePageDecorations bool `json:"remove_page_decorations"`
+	// ReflowParagraphs 把按版面换行的行重新拼成段落
+	ReflowParagraphs bool `json:"reflow_paragraphs"`
+}
+
+// PDFLayout PDF 各页的文字版式
+// 版式取值：horizontal、vertical，多栏时为 horizontal-2-columns 这样的形式，无文字的页面为空字符串
+type PDFLayout struct {
+	// Summary 占多数的版式，各页版式没有明显多数时为 mixed
+	Summary string `json:"summary"`
+	// Pages 每页的版式，下标为从 0 开始的页码
+	Pages []string `json:"pages"`
+}
+
+// TxtOptions TXT 排版选项
+type TxtOptions struct {
+	// ReflowParagraphs 把按固定宽度硬换行的行重新拼成段落
+	ReflowParagraphs bool `json:"reflow_paragraphs"`
+}
+
+// 搜索匹配方式
+const (
+	// SearchModeLiteral 按字面匹配关键字
+	SearchModeLiteral = "literal"
+	// SearchModeRegex 关键字为正则表达式
+	SearchModeRegex = "regex"
+	// SearchModeWholeWord 按字面匹配完整单词，前后不能紧接字母或数字
+	SearchModeWholeWord = "whole_word"
+	// SearchModePinyin 关键字为拼音，每个字可用全拼或开头几个字母，如 "lxy" 匹配 "林潇宇"
+	SearchModePinyin = "pinyin"
+	// SearchModeFuzzy 按编辑距离匹配拼写相近的西文单词
+	SearchModeFuzzy = "fuzzy"
+)
+
+// SearchOptions 搜索参数
+type SearchOptions struct {
+	// Keyword 关键字，正则模式下为正则表达式，拼音模式下为拼音
+	Keyword string `json:"keyword"`
+	// Mode 匹配方式，为空时按字面匹配
+	Mode string `json:"mode"`
+	// CaseSensitive 是否区分大小写，不区分时按 Unicode 大小写折叠比较
+	CaseSensitive bool `json:"case_sensitive"`
+	// MaxResults 最多返回的结果数，0 表示不限制
+	MaxResults int `json:"max_results"`
 }
 
 // SearchResult 搜索结果模型
@@ -52,6 +157,116 @@ type SearchResult struct {
 	Context string `json:"context"`
 	// Keyword 关键字
 	Keyword string `json:"keyword"`
+	// Length 匹配文本的长度（按 rune 计），正则匹配时各结果可能不同
+	Length int `json:"length"`
+	// Page 所在的 PDF 页码（从 1 开始），没有页码信息时为 0
+	Page int `json:"page,omitempty"`
+	// ChapterIndex 所在章节索引，没有章节信息时为 -1
+	ChapterIndex int `json:"chapter_index"`
+	// ChapterTitle 所在章节标题
+	ChapterTitle string `json:"chapter_title"`
+	// ChapterOffset 相对所在章节起始位置的偏移（按 rune 计）
+	ChapterOffset int `json:"chapter_offset"`
+}
+
+// SearchResultGroup 按章节分组的搜索结果
+type SearchResultGroup struct {
+	// ChapterIndex 章节索引，没有章节信息时为 -1
+	ChapterIndex int `json:"chapter_index"`
+	// ChapterTitle 章节标题
+	ChapterTitle string `json:"chapter_title"`
+	// Count 本章命中数
+	Count int `json:"count"`
+	// Results 本章的搜索结果，按位置排序
+	Results []SearchResult `json:"results"`
+}
+
+// SearchBatch 搜索任务推送的一批结果（search:batch 事件）
+type SearchBatch struct {
+	// JobID 搜索任务 ID
+	JobID string `json:"job_id"`
+	// Results 本批结果，按位置排序
+	Results []SearchResult `json:"results"`
+}
+
+// SearchProgress 搜索任务进度（search:progress 事件）
+type SearchProgress struct {
+	// JobID 搜索任务 ID
+	JobID string `json:"job_id"`
+	// Progress 已搜索的正文比例（百分比 0-100）
+	Progress float64 `json:"progress"`
+	// Count 已推送的结果数
+	Count int `json:"count"`
+	// Done 任务是否已结束
+	Done bool `json:"done"`
+	// Cancelled 任务是否被取消
+	Cancelled bool `json:"cancelled"`
+	// Error 搜索失败的原因
+	Error string `json:"error,omitempty"`
+}
+
+// LibrarySearchResult 书库检索结果
+type LibrarySearchResult struct {
+	// FilePath 所在书的文件路径
+	FilePath string `json:"file_path"`
+	// Title 书名
+	Title string `json:"title"`
+	// Author 作者
+	Author string `json:"author"`
+	// ChapterIndex 所在章节索引，第一章之前的正文或没有章节信息时为 -1
+	ChapterIndex int `json:"chapter_index"`
+	// ChapterTitle 所在章节标题
+	ChapterTitle string `json:"chapter_title"`
+	// Position 在全书正文中的位置（按 rune 计）
+	Position int `json:"position"`
+	// ChapterOffset 相对所在章节起始位置的偏移（按 rune 计）
+	ChapterOffset int `json:"chapter_offset"`
+	// Length 匹配文本的长度（按 rune 计）
+	Length int `json:"length"`
+	// Snippet 匹配处前后的正文片段
+	Snippet string `json:"snippet"`
+}
+
+// LibraryIndexStatus 书库索引进度
+type LibraryIndexStatus struct {
+	// Total 书架上的文件数
+	Total int `json:"total"`
+	// Indexed 已建好索引的书数
+	Indexed int `json:"indexed"`
+	// Pending 排队等待建索引的书数
+	Pending int `json:"pending"`
+	// Failed 解析失败的书数
+	Failed int `json:"failed"`
+	// Indexing 正在建索引的文件，空闲时为空
+	Indexing string `json:"indexing"`
+}
+
+// SearchHistoryEntry 一条搜索历史或收藏的搜索
+type SearchHistoryEntry struct {
+	// ID 由检索词、匹配方式与大小写选项决定，同样的搜索 ID 相同
+	ID string `json:"id"`
+	// Keyword 检索词
+	Keyword string `json:"keyword"`
+	// Mode 匹配方式，为空时按字面匹配
+	Mode string `json:"mode"`
+	// CaseSensitive 是否区分大小写
+	CaseSensitive bool `json:"case_sensitive"`
+	// HitCount 最近一次搜索的命中数
+	HitCount int `json:"hit_count"`
+	// LastUsed 最近一次搜索的时间（Unix 秒）
+	LastUsed int64 `json:"last_used"`
+	// Pinned 是否置顶，置顶的记录排在最前且不会被自动淘汰
+	Pinned bool `json:"pinned"`
+}
+
+// ProgressRecovery 进度文件损坏或丢失后的恢复情况
+type ProgressRecovery struct {
+	// Reason 需要恢复的原因
+	Reason string `json:"reason"`
+	// Backup 用来恢复的备份文件名，为空表示没有可用备份、进度已重置
+	Backup string `json:"backup"`
+	// RecoveredAt 恢复时间（Unix 秒）
+	RecoveredAt int64 `json:"recovered_at"`
 }
 
 // ReaderContentBlock 阅读内容块
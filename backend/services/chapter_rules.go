@@ -0,0 +1,189 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/nongchen1223/moyureader/backend/models"
+)
+
+const defaultChapterTitleMaxLength = 50
+
+// defaultChapterRuleSet 内置章节识别规则
+func defaultChapterRuleSet() models.ChapterRuleSet {
+	return models.ChapterRuleSet{
+		Rules: []models.ChapterRule{
+			{Name: "第X卷", Pattern: `^第[0-9零一二三四五六七八九十百千]+[卷部集]`, Enabled: true, IsVolume: true},
+			{Name: "Volume N", Pattern: `(?i)^(Volume|Vol\.)\s*(\d+|[IVXLC]+)\b`, Enabled: true, IsVolume: true},
+			{Name: "第X章/节/回", Pattern: `^第[0-9零一二三四五六七八九十百千]+[章节回]`, Enabled: true},
+			{Name: "Chapter N", Pattern: `^Chapter\s+\d+`, Enabled: true},
+			{Name: "数字序号", Pattern: `^\d+\.\s+`, Enabled: true},
+			{Name: "【第X】", Pattern: `^【第.+?】`, Enabled: true},
+			{Name: "（第X）", Pattern: `^（第.+?）`, Enabled: true},
+			{Name: "[第X]", Pattern: `^\[第.+?\]`, Enabled: true},
+			{Name: "卷X 第X节", Pattern: `^卷[0-9零一二三四五六七八九十百千]+\s*第[0-9零一二三四五六七八九十百千]+[章节回]`, Enabled: true},
+			{Name: "序章/楔子/番外", Pattern: `^(序章|序言|楔子|引子|尾声|后记|番外)`, Enabled: true},
+			{Name: "Part N", Pattern: `(?i)^Part\s+(\d+|One|Two|Three|Four|Five|Six|Seven|Eight|Nine|Ten|[IVXLC]+)\b`, Enabled: true},
+		},
+		MaxTitleLength: defaultChapterTitleMaxLength,
+	}
+}
+
+// compiledChapterRule 预编译后的章节规则
+type compiledChapterRule struct {
+	name     string
+	pattern  *regexp.Regexp
+	isVolume bool
+}
+
+// compileChapterRuleSet 校验并预编译启用的规则
+func compileChapterRuleSet(ruleSet models.ChapterRuleSet) ([]compiledChapterRule, error) {
+	compiled := make([]compiledChapterRule, 0, len(ruleSet.Rules))
+	for index, rule := range ruleSet.Rules {
+		if !rule.Enabled {
+			continue
+		}
+
+		name := strings.TrimSpace(rule.Name)
+		if name == "" {
+			name = fmt.Sprintf("规则%d", index+1)
+		}
+
+		pattern := strings.TrimSpace(rule.Pattern)
+		if pattern == "" {
+			return nil, fmt.Errorf("章节规则「%s」缺少正则表达式", name)
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("章节规则「%s」正则无效: %w", name, err)
+		}
+
+		compiled = append(compiled, compiledChapterRule{name: name, pattern: re, isVolume: rule.IsVolume})
+	}
+
+	if len(compiled) == 0 {
+		return nil, fmt.Errorf("至少需要启用一条章节规则")
+	}
+
+	return compiled, nil
+}
+
+// validateChapterRuleSet 校验规则集是否可用
+func validateChapterRuleSet(ruleSet models.ChapterRuleSet) error {
+	if ruleSet.MaxTitleLength < 0 || ruleSet.MinChapterLength < 0 {
+		return fmt.Errorf("章节规则的长度限制不能为负数")
+	}
+
+	_, err := compileChapterRuleSet(ruleSet)
+	return err
+}
+
+// matchChapterRule 返回第一条匹配标题行的规则，未匹配时返回 nil
+func matchChapterRule(rules []compiledChapterRule, line string) *compiledChapterRule {
+	for index := range rules {
+		if rules[index].pattern.MatchString(line) {
+			return &rules[index]
+		}
+	}
+	return nil
+}
+
+// splitTxtChapters 按规则集切分纯文本章节
+func splitTxtChapters(content string, ruleSet models.ChapterRuleSet) ([]models.Chapter, error) {
+	rules, err := compileChapterRuleSet(ruleSet)
+	if err != nil {
+		return nil, err
+	}
+
+	contentLength := runeLen(content)
+	chapters := []models.Chapter{}
+	currentOffset := 0
+	lastIsVolume := false
+	inVolume := false
+
+	for _, rawLine := range strings.SplitAfter(content, "\n") {
+		lineWithoutBreak := strings.TrimRight(rawLine, "\r\n")
+		trimmedLine := strings.TrimSpace(lineWithoutBreak)
+		lineLength := runeLen(rawLine)
+
+		var rule *compiledChapterRule
+		if trimmedLine != "" && (ruleSet.MaxTitleLength <= 0 || runeLen(trimmedLine) <= ruleSet.MaxTitleLength) {
+			rule = matchChapterRule(rules, trimmedLine)
+		}
+		if rule == nil {
+			currentOffset += lineLength
+			continue
+		}
+
+		startPos := currentOffset + leadingWhitespaceCount(lineWithoutBreak)
+		if len(chapters) > 0 {
+			previous := &chapters[len(chapters)-1]
+			// 上一章过短（常见于书首目录）时不切分，让本行并入上一章；卷标题后紧跟章节属正常情况
+			if ruleSet.MinChapterLength > 0 && !lastIsVolume && startPos-previous.StartPos < ruleSet.MinChapterLength {
+				currentOffset += lineLength
+				continue
+			}
+			previous.EndPos = startPos
+			previous.WordCount = previous.EndPos - previous.StartPos
+		}
+
+		level := 0
+		if rule.isVolume {
+			inVolume = true
+		} else if inVolume {
+			level = 1
+		}
+		lastIsVolume = rule.isVolume
+
+		chapters = append(chapters, models.Chapter{
+			Title:    trimmedLine,
+			StartPos: startPos,
+			EndPos:   contentLength, // 临时设置为全文末尾
+			Index:    len(chapters),
+			Level:    level,
+		})
+
+		currentOffset += lineLength
+	}
+
+	// 如果没有找到章节，则将整个文件作为一个章节
+	if len(chapters) == 0 {
+		return []models.Chapter{{
+			Title:       "正文",
+			StartPos:    0,
+			EndPos:      contentLength,
+			Index:       0,
+			WordCount:   contentLength,
+			ParentIndex: -1,
+		}}, nil
+	}
+
+	// 修正最后一章的结束位置
+	lastChapter := &chapters[len(chapters)-1]
+	lastChapter.EndPos = contentLength
+	lastChapter.WordCount = lastChapter.EndPos - lastChapter.StartPos
+
+	linkChapterHierarchy(chapters)
+	return chapters, nil
+}
+
+// linkChapterHierarchy 根据各章节的 Level 计算 ParentIndex
+// 上级为前面最近一个层级更浅的章节
+func linkChapterHierarchy(chapters []models.Chapter) {
+	ancestors := make([]int, 0, 4)
+	for index := range chapters {
+		level := maxInt(chapters[index].Level, 0)
+		// 层级不允许跳级，避免出现没有上级的深层章节
+		level = minInt(level, len(ancestors))
+		ancestors = ancestors[:level]
+
+		chapters[index].Level = level
+		chapters[index].ParentIndex = -1
+		if level > 0 {
+			chapters[index].ParentIndex = ancestors[level-1]
+		}
+		ancestors = append(ancestors, index)
+	}
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/nongchen1223/moyureader/backend/models"
+)
+
+const maxComicPagesPerChapter = 4
+
+// comicInfo ComicInfo.xml 中用到的字段
+type comicInfo struct {
+	Title   string `xml:"Title"`
+	Series  string `xml:"Series"`
+	Number  string `xml:"Number"`
+	Writer  string `xml:"Writer"`
+	Summary string `xml:"Summary"`
+	Manga   string `xml:"Manga"`
+	Pages   struct {
+		Pages []struct {
+			Image int    `xml:"Image,attr"`
+			Type  string `xml:"Type,attr"`
+		} `xml:"Page"`
+	} `xml:"Pages"`
+}
+
+// comicBook 已打开的漫画压缩包，页面 HTML 按需渲染
+type comicBook struct {
+	pages       []string // 按阅读顺序排列的图片路径
+	coverPage   int
+	rightToLeft bool // ComicInfo 标记的默认阅读方向
+	options     models.ComicOptions
+	chapterHTML []string
+}
+
+// readComicArchive 读取 CBZ 中的图片列表和 ComicInfo.xml 元数据
+func readComicArchive(filePath string) (*comicBook, *comicInfo, error) {
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("打开漫画压缩包失败: %w", err)
+	}
+	defer reader.Close()
+
+	book := &comicBook{}
+	var info *comicInfo
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+
+		name := normalizeZipPath(file.Name)
+		baseName := path.Base(name)
+		if strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(baseName, ".") {
+			continue
+		}
+
+		if strings.EqualFold(baseName, "ComicInfo.xml") {
+			data, err := readZipFileBytes(map[string]*zip.File{name: file}, name)
+			if err != nil {
+				continue
+			}
+			var parsed comicInfo
+			if xml.Unmarshal(data, &parsed) == nil {
+				info = &parsed
+			}
+			continue
+		}
+
+		if isComicPageFile(name) {
+			book.pages = append(book.pages, name)
+		}
+	}
+
+	if len(book.pages) == 0 {
+		return nil, nil, fmt.Errorf("漫画压缩包中没有图片")
+	}
+
+	sort.SliceStable(book.pages, func(left, right int) bool {
+		return naturalLess(book.pages[left], book.pages[right])
+	})
+
+	if info != nil {
+		book.rightToLeft = strings.EqualFold(strings.TrimSpace(info.Manga), "YesAndRightToLeft")
+		for _, page := range info.Pages.Pages {
+			if strings.EqualFold(page.Type, "FrontCover") && page.Image >= 0 && page.Image < len(book.pages) {
+				book.coverPage = page.Image
+				break
+			}
+		}
+	}
+
+	return book, info, nil
+}
+
+func isComicPageFile(name string) bool {
+	switch inferEpubMediaType(name) {
+	case "image/jpeg", "image/png", "image/gif", "image/webp", "image/bmp":
+		return true
+	default:
+		return false
+	}
+}
+
+// naturalLess 自然排序：数字段按数值比较，page2 排在 page10 之前
+func naturalLess(left, right string) bool {
+	leftRunes := []rune(strings.ToLower(left))
+	rightRunes := []rune(strings.ToLower(right))
+	leftIndex, rightIndex := 0, 0
+
+	for leftIndex < len(leftRunes) && rightIndex < len(rightRunes) {
+		leftChar, rightChar := leftRunes[leftIndex], rightRunes[rightIndex]
+		if unicode.IsDigit(leftChar) && unicode.IsDigit(rightChar) {
+			leftEnd := leftIndex
+			for leftEnd < len(leftRunes) && unicode.IsDigit(leftRunes[leftEnd]) {
+				leftEnd++
+			}
+			rightEnd := rightIndex
+			for rightEnd < len(rightRunes) && unicode.IsDigit(rightRunes[rightEnd]) {
+				rightEnd++
+			}
+
+			leftNumber := strings.TrimLeft(string(leftRunes[leftIndex:leftEnd]), "0")
+			rightNumber := strings.TrimLeft(string(rightRunes[rightIndex:rightEnd]), "0")
+			if len(leftNumber) != len(rightNumber) {
+				return len(leftNumber) < len(rightNumber)
+			}
+			if leftNumber != rightNumber {
+				return leftNumber < rightNumber
+			}
+
+			leftIndex, rightIndex = leftEnd, rightEnd
+			continue
+		}
+
+		if leftChar != rightChar {
+			return leftChar < rightChar
+		}
+		leftIndex++
+		rightIndex++
+	}
+
+	return len(leftRunes)-leftIndex < len(rightRunes)-rightIndex
+}
+
+// normalizeComicOptions 补全默认值并限制每章页数
+func normalizeComicOptions(options models.ComicOptions) models.ComicOptions {
+	options.PagesPerChapter = clampInt(options.PagesPerChapter, 1, maxComicPagesPerChapter)
+	return options
+}
+
+// chapterCount 按每章页数分组后的章节数
+func (b *comicBook) chapterCount() int {
+	perChapter := b.options.PagesPerChapter
+	return (len(b.pages) + perChapter - 1) / perChapter
+}
+
+// chapterPages 返回某一章包含的页面序号（阅读顺序）
+func (b *comicBook) chapterPages(chapterIndex int) []int {
+	start := chapterIndex * b.options.PagesPerChapter
+	end := minInt(start+b.options.PagesPerChapter, len(b.pages))
+	pages := make([]int, 0, end-start)
+	for pageIndex := start; pageIndex < end; pageIndex++ {
+		pages = append(pages, pageIndex)
+	}
+	return pages
+}
+
+// buildStructure 生成章节列表，标题为页码或页码范围
+func (b *comicBook) buildStructure() (string, []models.Chapter) {
+	titles := make([]string, 0, b.chapterCount())
+	for chapterIndex := 0; chapterIndex < b.chapterCount(); chapterIndex++ {
+		pages := b.chapterPages(chapterIndex)
+		if len(pages) == 1 {
+			titles = append(titles, fmt.Sprintf("第%d页", pages[0]+1))
+		} else {
+			titles = append(titles, fmt.Sprintf("第%d-%d页", pages[0]+1, pages[len(pages)-1]+1))
+		}
+	}
+	b.chapterHTML = make([]string, len(titles))
+	return buildImagePageStructure(titles)
+}
+
+// renderComicChapterHTML 渲染一章的页面，DOM 始终按阅读顺序排列；
+// 从右到左模式额外标记 comic-rtl，由样式把多页同屏的第一页排在右侧
+func renderComicChapterHTML(filePath string, book *comicBook, chapterIndex int) (string, error) {
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return "", fmt.Errorf("打开漫画压缩包失败: %w", err)
+	}
+	defer reader.Close()
+
+	fileMap := make(map[string]*zip.File, len(reader.File))
+	for _, file := range reader.File {
+		fileMap[normalizeZipPath(file.Name)] = file
+	}
+
+	pages := book.chapterPages(chapterIndex)
+	className := "pdf-image-page comic-page-group"
+	if len(pages) > 1 {
+		className += " comic-spread"
+	}
+	if book.options.RightToLeft {
+		className += " comic-rtl"
+	}
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, `<section class="%s" data-chapter-rich="true">`, className)
+	for _, pageIndex := range pages {
+		dataURL, err := readComicPageDataURL(fileMap, book.pages[pageIndex])
+		if err != nil {
+			return "", fmt.Errorf("读取第 %d 页失败: %w", pageIndex+1, err)
+		}
+
+		pageLabel := fmt.Sprintf("第%d页", pageIndex+1)
+		fmt.Fprintf(
+			&builder,
+			`<figure class="epub-image pdf-image-page"><img src="%s" alt="%s" loading="lazy" /><figcaption>%s</figcaption></figure>`,
+			dataURL,
+			escapeHTMLAttribute(pageLabel),
+			pageLabel,
+		)
+	}
+	builder.WriteString(`</section>`)
+	return builder.String(), nil
+}
+
+func readComicPageDataURL(fileMap map[string]*zip.File, pagePath string) (string, error) {
+	data, err := readZipFileBytes(fileMap, pagePath)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("data:%s;base64,%s", inferEpubMediaType(pagePath), base64.StdEncoding.EncodeToString(data)), nil
+}
+
+// applyComicInfo 将 ComicInfo.xml 元数据写入小说
+func applyComicInfo(novel *models.Novel, info *comicInfo) {
+	if info == nil {
+		return
+	}
+
+	series := strings.TrimSpace(info.Series)
+	number := strings.TrimSpace(info.Number)
+	switch title := strings.TrimSpace(info.Title); {
+	case title != "":
+		novel.Title = title
+	case series != "" && number != "":
+		novel.Title = fmt.Sprintf("%s #%s", series, number)
+	case series != "":
+		novel.Title = series
+	}
+
+	if writer := strings.TrimSpace(info.Writer); writer != "" {
+		novel.Author = writer
+	}
+	novel.Series = series
+	novel.SeriesIndex, _ = strconv.Atoi(number)
+	novel.Annotation = strings.TrimSpace(info.Summary)
+}
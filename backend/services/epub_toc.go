@@ -0,0 +1,515 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"path"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// epubTOCEntry EPUB 目录条目（按文档顺序展开）
+type epubTOCEntry struct {
+	Title    string
+	Path     string // 目标文件在压缩包中的路径
+	Fragment string // 目标锚点，不含 #
+	Level    int
+}
+
+type epubNCX struct {
+	NavMap struct {
+		NavPoints []epubNCXNavPoint `xml:"navPoint"`
+	} `xml:"navMap"`
+}
+
+type epubNCXNavPoint struct {
+	Label   string `xml:"navLabel>text"`
+	Content struct {
+		Src string `xml:"src,attr"`
+	} `xml:"content"`
+	Children []epubNCXNavPoint `xml:"navPoint"`
+}
+
+// readEpubTOC 读取 EPUB 目录，优先使用 EPUB3 nav 文档，其次是 EPUB2 NCX
+func readEpubTOC(
+	fileMap map[string]*zip.File,
+	pkg epubPackage,
+	manifest map[string]epubManifestItem,
+	opfDir string,
+) []epubTOCEntry {
+	for _, item := range pkg.Manifest.Items {
+		if !hasEpubItemProperty(item, "nav") {
+			continue
+		}
+
+		navPath := normalizeZipPath(path.Join(opfDir, item.Href))
+		markup, err := readZipFileText(fileMap, navPath)
+		if err != nil {
+			continue
+		}
+
+		if entries := parseEpubNavDocument(markup, navPath); len(entries) > 0 {
+			return entries
+		}
+	}
+
+	ncxItem, exists := manifest[strings.TrimSpace(pkg.Spine.Toc)]
+	if !exists {
+		for _, item := range pkg.Manifest.Items {
+			if item.MediaType == "application/x-dtbncx+xml" {
+				ncxItem = item
+				exists = true
+				break
+			}
+		}
+	}
+	if !exists {
+		return nil
+	}
+
+	ncxPath := normalizeZipPath(path.Join(opfDir, ncxItem.Href))
+	ncxData, err := readZipFileBytes(fileMap, ncxPath)
+	if err != nil {
+		return nil
+	}
+
+	return parseEpubNCX(ncxData, ncxPath)
+}
+
+func hasEpubItemProperty(item epubManifestItem, property string) bool {
+	for _, value := range strings.Fields(strings.ToLower(item.Properties)) {
+		if value == property {
+			return true
+		}
+	}
+	return false
+}
+
+// parseEpubNCX 解析 EPUB2 toc.ncx
+func parseEpubNCX(data []byte, ncxPath string) []epubTOCEntry {
+	var ncx epubNCX
+	if err := xml.Unmarshal(data, &ncx); err != nil {
+		return nil
+	}
+
+	baseDir := path.Dir(ncxPath)
+	entries := make([]epubTOCEntry, 0, 32)
+	var walk func([]epubNCXNavPoint, int)
+	walk = func(points []epubNCXNavPoint, level int) {
+		for _, point := range points {
+			if entry, ok := newEpubTOCEntry(baseDir, point.Label, point.Content.Src, level); ok {
+				entries = append(entries, entry)
+			}
+			walk(point.Children, level+1)
+		}
+	}
+	walk(ncx.NavMap.NavPoints, 0)
+
+	return entries
+}
+
+// parseEpubNavDocument 解析 EPUB3 nav.xhtml 中 epub:type="toc" 的目录
+func parseEpubNavDocument(markup, navPath string) []epubTOCEntry {
+	doc, err := xhtml.Parse(strings.NewReader(markup))
+	if err != nil {
+		return nil
+	}
+
+	navNodes := findEpubElements(doc, "nav")
+	if len(navNodes) == 0 {
+		return nil
+	}
+
+	tocNav := navNodes[0]
+	for _, navNode := range navNodes {
+		if isEpubTOCNav(navNode) {
+			tocNav = navNode
+			break
+		}
+	}
+
+	list := findEpubChildElement(tocNav, "ol")
+	if list == nil {
+		return nil
+	}
+
+	baseDir := path.Dir(navPath)
+	entries := make([]epubTOCEntry, 0, 32)
+	var walkList func(*xhtml.Node, int)
+	walkList = func(listNode *xhtml.Node, level int) {
+		for item := listNode.FirstChild; item != nil; item = item.NextSibling {
+			if item.Type != xhtml.ElementNode || !strings.EqualFold(item.Data, "li") {
+				continue
+			}
+
+			label := ""
+			href := ""
+			if anchor := findEpubChildElement(item, "a"); anchor != nil {
+				label = extractNodeText(anchor)
+				href = getHTMLAttribute(anchor, "href")
+			} else if span := findEpubChildElement(item, "span"); span != nil {
+				label = extractNodeText(span)
+			}
+
+			if entry, ok := newEpubTOCEntry(baseDir, label, href, level); ok {
+				entries = append(entries, entry)
+			}
+
+			if nested := findEpubChildElement(item, "ol"); nested != nil {
+				walkList(nested, level+1)
+			}
+		}
+	}
+	walkList(list, 0)
+
+	return entries
+}
+
+func newEpubTOCEntry(baseDir, label, href string, level int) (epubTOCEntry, bool) {
+	title := strings.Join(strings.Fields(label), " ")
+	href = strings.TrimSpace(href)
+	if title == "" || href == "" {
+		return epubTOCEntry{}, false
+	}
+
+	fragment := ""
+	if hashIndex := strings.Index(href, "#"); hashIndex >= 0 {
+		fragment = href[hashIndex+1:]
+	}
+
+	targetPath := resolveEpubReference(baseDir, href)
+	if targetPath == "" {
+		return epubTOCEntry{}, false
+	}
+
+	return epubTOCEntry{
+		Title:    title,
+		Path:     targetPath,
+		Fragment: fragment,
+		Level:    level,
+	}, true
+}
+
+func isEpubTOCNav(node *xhtml.Node) bool {
+	for _, attr := range node.Attr {
+		key := strings.ToLower(attr.Key)
+		if attr.Namespace != "" {
+			key = strings.ToLower(attr.Namespace) + ":" + key
+		}
+
+		if (key == "epub:type" || key == "type") && hasEpubToken(attr.Val, "toc") {
+			return true
+		}
+		if key == "role" && hasEpubToken(attr.Val, "doc-toc") {
+			return true
+		}
+	}
+	return false
+}
+
+func hasEpubToken(value, token string) bool {
+	for _, field := range strings.Fields(strings.ToLower(value)) {
+		if field == token {
+			return true
+		}
+	}
+	return false
+}
+
+func findEpubElements(node *xhtml.Node, tag string) []*xhtml.Node {
+	found := []*xhtml.Node{}
+	var walk func(*xhtml.Node)
+	walk = func(current *xhtml.Node) {
+		if current.Type == xhtml.ElementNode && strings.EqualFold(current.Data, tag) {
+			found = append(found, current)
+		}
+		for child := current.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(node)
+	return found
+}
+
+// findEpubChildElement 在直接子节点中查找指定标签，找不到时再向下查找一层包装元素
+func findEpubChildElement(node *xhtml.Node, tag string) *xhtml.Node {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == xhtml.ElementNode && strings.EqualFold(child.Data, tag) {
+			return child
+		}
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != xhtml.ElementNode || strings.EqualFold(child.Data, "ol") {
+			continue
+		}
+		for grandChild := child.FirstChild; grandChild != nil; grandChild = grandChild.NextSibling {
+			if grandChild.Type == xhtml.ElementNode && strings.EqualFold(grandChild.Data, tag) {
+				return grandChild
+			}
+		}
+	}
+
+	return nil
+}
+
+func getHTMLAttribute(node *xhtml.Node, key string) string {
+	for _, attr := range node.Attr {
+		if strings.EqualFold(attr.Key, key) {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// splitEpubMarkupByTOC 按目录锚点切分单个 XHTML 文件
+// 返回切分后的各段标记（第 0 段为第一个锚点之前的内容），以及每个目录条目所在的段号；
+// 没有锚点或锚点不存在的条目视为指向文件开头，即第 0 段。
+func splitEpubMarkupByTOC(markup string, entries []epubTOCEntry) ([]string, []int) {
+	positions := make([]int, len(entries))
+
+	doc, err := xhtml.Parse(strings.NewReader(markup))
+	if err != nil {
+		return []string{markup}, positions
+	}
+
+	body := findEpubBodyNode(doc)
+	if body == nil {
+		return []string{markup}, positions
+	}
+
+	nodesByID := make(map[string]*xhtml.Node)
+	documentOrder := make([]*xhtml.Node, 0, 64)
+	var collect func(*xhtml.Node)
+	collect = func(node *xhtml.Node) {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != xhtml.ElementNode {
+				continue
+			}
+
+			documentOrder = append(documentOrder, child)
+			for _, attr := range child.Attr {
+				key := strings.ToLower(attr.Key)
+				if key != "id" && !(key == "name" && strings.EqualFold(child.Data, "a")) {
+					continue
+				}
+				if _, exists := nodesByID[attr.Val]; !exists {
+					nodesByID[attr.Val] = child
+				}
+			}
+			collect(child)
+		}
+	}
+	collect(body)
+
+	anchorNodes := make(map[*xhtml.Node]int)
+	for _, entry := range entries {
+		if node, exists := nodesByID[entry.Fragment]; exists && entry.Fragment != "" {
+			anchorNodes[node] = 0
+		}
+	}
+	if len(anchorNodes) == 0 {
+		return []string{renderHTMLNodeString(body)}, positions
+	}
+
+	segmentIndex := 0
+	for _, node := range documentOrder {
+		if _, exists := anchorNodes[node]; exists {
+			segmentIndex++
+			anchorNodes[node] = segmentIndex
+		}
+	}
+
+	for index, entry := range entries {
+		if node, exists := nodesByID[entry.Fragment]; exists && entry.Fragment != "" {
+			positions[index] = anchorNodes[node]
+		}
+	}
+
+	roots := splitEpubBodyAtAnchors(body, anchorNodes)
+	segments := make([]string, len(roots))
+	for index, root := range roots {
+		segments[index] = renderHTMLNodeString(root)
+	}
+
+	return segments, positions
+}
+
+// splitEpubBodyAtAnchors 在锚点元素处把 body 切成多棵子树
+// 锚点所在的祖先元素会在新子树中浅拷贝一份，保证每段结构完整
+func splitEpubBodyAtAnchors(body *xhtml.Node, anchorNodes map[*xhtml.Node]int) []*xhtml.Node {
+	roots := []*xhtml.Node{cloneHTMLNodeShallow(body)}
+	srcPath := []*xhtml.Node{body}
+	dstPath := []*xhtml.Node{roots[0]}
+
+	var walk func(*xhtml.Node, int)
+	walk = func(src *xhtml.Node, depth int) {
+		for child := src.FirstChild; child != nil; child = child.NextSibling {
+			if _, isAnchor := anchorNodes[child]; isAnchor {
+				nextPath := make([]*xhtml.Node, depth+1)
+				for level := 0; level <= depth; level++ {
+					nextPath[level] = cloneHTMLNodeShallow(srcPath[level])
+					if level > 0 {
+						nextPath[level-1].AppendChild(nextPath[level])
+					}
+				}
+				roots = append(roots, nextPath[0])
+				dstPath = nextPath
+			}
+
+			clone := cloneHTMLNodeShallow(child)
+			dstPath[depth].AppendChild(clone)
+			if child.Type == xhtml.ElementNode && child.FirstChild != nil {
+				srcPath = append(srcPath[:depth+1], child)
+				dstPath = append(dstPath[:depth+1], clone)
+				walk(child, depth+1)
+			}
+		}
+	}
+	walk(body, 0)
+
+	return roots
+}
+
+func cloneHTMLNodeShallow(node *xhtml.Node) *xhtml.Node {
+	return &xhtml.Node{
+		Type:      node.Type,
+		DataAtom:  node.DataAtom,
+		Data:      node.Data,
+		Namespace: node.Namespace,
+		Attr:      append([]xhtml.Attribute(nil), node.Attr...),
+	}
+}
+
+// epubChapterDraft 尚未计算偏移量的 EPUB 章节
+type epubChapterDraft struct {
+	title         string
+	level         int
+	texts         []string
+	htmls         []string
+	fallbackIndex int
+	fromTOC       bool // 来自目录的条目即使没有正文也保留
+}
+
+func (d *epubChapterDraft) appendContent(text, html string) {
+	if strings.TrimSpace(text) == "" && strings.TrimSpace(html) == "" {
+		return
+	}
+	d.texts = append(d.texts, text)
+	d.htmls = append(d.htmls, html)
+}
+
+// epubDocumentReader 按路径读取章节文档并提取正文
+// MOBI 等格式把重组后的 HTML 片段当作文档，复用同一套分章流程
+type epubDocumentReader interface {
+	readDocument(documentPath string) (string, error)
+	extractContent(markup, documentPath string) (title, text, html string)
+}
+
+// epubZipDocuments 从 EPUB 压缩包中读取文档
+type epubZipDocuments struct {
+	fileMap map[string]*zip.File
+}
+
+func (d epubZipDocuments) readDocument(documentPath string) (string, error) {
+	return readZipFileText(d.fileMap, documentPath)
+}
+
+func (d epubZipDocuments) extractContent(markup, documentPath string) (string, string, string) {
+	return extractEpubChapterContent(d.fileMap, markup, documentPath)
+}
+
+// buildEpubChapterDrafts 以目录为章节来源组织 spine 中的正文
+// 一个文件内的多个目录条目按锚点切分；不在目录中的文件视为上一章的续页；
+// 第一个目录条目之前的文件（封面、扉页等）以及没有可用目录的 EPUB 仍按文件分章。
+func buildEpubChapterDrafts(
+	documents epubDocumentReader,
+	spinePaths []string,
+	tocEntries []epubTOCEntry,
+) []*epubChapterDraft {
+	inSpine := make(map[string]struct{}, len(spinePaths))
+	for _, spinePath := range spinePaths {
+		inSpine[spinePath] = struct{}{}
+	}
+
+	entriesByPath := make(map[string][]epubTOCEntry)
+	for _, entry := range tocEntries {
+		if _, exists := inSpine[entry.Path]; exists {
+			entriesByPath[entry.Path] = append(entriesByPath[entry.Path], entry)
+		}
+	}
+
+	drafts := make([]*epubChapterDraft, 0, len(spinePaths))
+	seenTOCFile := false
+	visited := make(map[string]struct{}, len(spinePaths))
+
+	for index, spinePath := range spinePaths {
+		if _, exists := visited[spinePath]; exists {
+			continue
+		}
+		visited[spinePath] = struct{}{}
+
+		markup, err := documents.readDocument(spinePath)
+		if err != nil {
+			continue
+		}
+
+		entries := entriesByPath[spinePath]
+		if len(entries) == 0 {
+			title, text, html := documents.extractContent(markup, spinePath)
+			if seenTOCFile && len(drafts) > 0 {
+				drafts[len(drafts)-1].appendContent(text, html)
+				continue
+			}
+
+			drafts = append(drafts, &epubChapterDraft{
+				title:         title,
+				texts:         []string{text},
+				htmls:         []string{html},
+				fallbackIndex: index + 1,
+			})
+			continue
+		}
+
+		seenTOCFile = true
+		segments, positions := splitEpubMarkupByTOC(markup, entries)
+		entriesBySegment := make([][]epubTOCEntry, len(segments))
+		for entryIndex, entry := range entries {
+			entriesBySegment[positions[entryIndex]] = append(entriesBySegment[positions[entryIndex]], entry)
+		}
+
+		for segmentIndex, segment := range segments {
+			_, text, html := documents.extractContent(segment, spinePath)
+			segmentEntries := entriesBySegment[segmentIndex]
+			if len(segmentEntries) == 0 {
+				if len(drafts) > 0 {
+					drafts[len(drafts)-1].appendContent(text, html)
+				} else {
+					drafts = append(drafts, &epubChapterDraft{
+						texts:         []string{text},
+						htmls:         []string{html},
+						fallbackIndex: index + 1,
+					})
+				}
+				continue
+			}
+
+			// 指向同一位置的多个条目（如卷和卷内第一章），只有最后一个承载正文
+			for entryIndex, entry := range segmentEntries {
+				draft := &epubChapterDraft{
+					title:         entry.Title,
+					level:         entry.Level,
+					fallbackIndex: len(drafts) + 1,
+					fromTOC:       true,
+				}
+				if entryIndex == len(segmentEntries)-1 {
+					draft.appendContent(text, html)
+				}
+				drafts = append(drafts, draft)
+			}
+		}
+	}
+
+	return drafts
+}
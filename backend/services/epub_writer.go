@@ -0,0 +1,517 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"hash/crc32"
+	stdhtml "html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/nongchen1223/moyureader/backend/models"
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	exportDataURLPattern  = regexp.MustCompile(`src="data:([^;",]+);base64,([^"]+)"`)
+	exportCoverURLPattern = regexp.MustCompile(`^data:([^;,]+);base64,(.+)$`)
+)
+
+// exportChapter 导出用的章节：富文本不含章节标题，由各导出格式自行生成标题
+type exportChapter struct {
+	title       string
+	level       int
+	parentIndex int
+	text        string
+	html        string
+}
+
+// exportAsset 导出时从 data URL 中提取出的图片
+type exportAsset struct {
+	id        string
+	name      string
+	mediaType string
+	data      []byte
+}
+
+// exportAssetCollector 按 data URL 去重收集图片
+type exportAssetCollector struct {
+	assets []exportAsset
+	byURL  map[string]int
+}
+
+func newExportAssetCollector() *exportAssetCollector {
+	return &exportAssetCollector{byURL: make(map[string]int)}
+}
+
+// add 记录一张图片并返回其文件名，不支持的图片类型返回空
+func (c *exportAssetCollector) add(mediaType, encoded string) string {
+	key := mediaType + ";" + encoded
+	if index, exists := c.byURL[key]; exists {
+		return c.assets[index].name
+	}
+
+	extension := exportImageExtension(mediaType)
+	if extension == "" {
+		return ""
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return ""
+	}
+
+	index := len(c.assets)
+	c.assets = append(c.assets, exportAsset{
+		id:        fmt.Sprintf("image-%04d", index+1),
+		name:      fmt.Sprintf("image%04d%s", index+1, extension),
+		mediaType: mediaType,
+		data:      data,
+	})
+	c.byURL[key] = index
+	return c.assets[index].name
+}
+
+// replaceDataURLs 将富文本中的 data URL 图片替换为 prefix+文件名，无法导出的图片移除 src
+func (c *exportAssetCollector) replaceDataURLs(content, prefix string) string {
+	return exportDataURLPattern.ReplaceAllStringFunc(content, func(match string) string {
+		parts := exportDataURLPattern.FindStringSubmatch(match)
+		name := c.add(strings.ToLower(parts[1]), parts[2])
+		if name == "" {
+			return `src=""`
+		}
+		return `src="` + escapeHTMLAttribute(prefix+name) + `"`
+	})
+}
+
+// exportImageExtension EPUB 3 核心媒体类型中的图片，其余类型不导出
+func exportImageExtension(mediaType string) string {
+	switch mediaType {
+	case "image/jpeg", "image/jpg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	case "image/svg+xml":
+		return ".svg"
+	default:
+		return ""
+	}
+}
+
+// collectExportChapters 读取全部章节的正文和富文本
+func (s *NovelService) collectExportChapters(novel *models.Novel) ([]exportChapter, error) {
+	chapters := make([]exportChapter, 0, len(novel.Chapters))
+	for index, chapter := range novel.Chapters {
+		text := trimLeadingExportTitle(sliceByRuneRange(novel.Content, chapter.StartPos, chapter.EndPos), chapter.Title)
+		chapterHTML := buildBasicHTMLFromText(text)
+		if s.hasChapterHTML(novel) {
+			content, err := s.GetChapterContent(novel.FilePath, index)
+			if err != nil {
+				return nil, err
+			}
+			chapterHTML = content
+			// 没有正文的卷标题只有一个标题元素，导出时由各格式统一生成标题
+			if chapterHTML == wrapEpubHTMLTag("h2", stdhtml.EscapeString(chapter.Title)) {
+				chapterHTML = ""
+			}
+		}
+
+		chapters = append(chapters, exportChapter{
+			title:       chapter.Title,
+			level:       chapter.Level,
+			parentIndex: chapter.ParentIndex,
+			text:        text,
+			html:        chapterHTML,
+		})
+	}
+	return chapters, nil
+}
+
+// trimLeadingExportTitle 去掉正文开头与章节标题相同的行，其余行保持原样（含行首缩进）；
+// 正文自带的标题与章节标题空白不一致时，Content 中会连续出现两行标题
+func trimLeadingExportTitle(content, title string) string {
+	content = strings.TrimLeft(content, "\r\n")
+	if strings.TrimSpace(title) == "" {
+		return content
+	}
+	for {
+		firstLine, rest, _ := strings.Cut(content, "\n")
+		if !compareEpubTitle(firstLine, title) {
+			return content
+		}
+		content = strings.TrimLeft(rest, "\r\n")
+	}
+}
+
+// exportFileBaseName 由书名生成可用作文件名的名称
+func exportFileBaseName(novel *models.Novel) string {
+	name := strings.TrimSpace(novel.Title)
+	if name == "" {
+		baseName := filepath.Base(novel.FilePath)
+		name = baseName[:len(baseName)-len(novelFormatFromPath(baseName))]
+	}
+	name = strings.Map(func(char rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, char) || unicode.IsControl(char) {
+			return '_'
+		}
+		return char
+	}, name)
+	return strings.Trim(name, ". ")
+}
+
+// uniqueExportPath 生成不覆盖已有文件的输出路径，重名时追加序号
+func uniqueExportPath(outputDir, baseName, extension string) string {
+	candidate := filepath.Join(outputDir, baseName+extension)
+	for index := 1; ; index++ {
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+		candidate = filepath.Join(outputDir, fmt.Sprintf("%s (%d)%s", baseName, index, extension))
+	}
+}
+
+// writeNovelEpub 将小说写为 EPUB 3：OPF 元数据、nav.xhtml（附带 NCX 兼容旧阅读器）、
+// 每章一个 XHTML 文件，图片从 data URL 中提取为独立文件
+func writeNovelEpub(outputPath string, novel *models.Novel, chapters []exportChapter) error {
+	if len(chapters) == 0 {
+		return fmt.Errorf("没有可导出的章节")
+	}
+
+	language := guessExportLanguage(novel.Content)
+	identifier := newExportUUID()
+	assets := newExportAssetCollector()
+
+	chapterFiles := make([]string, len(chapters))
+	chapterDocuments := make([]string, len(chapters))
+	for index, chapter := range chapters {
+		chapterFiles[index] = fmt.Sprintf("chapter%04d.xhtml", index+1)
+		body := normalizeExportXHTML(assets.replaceDataURLs(chapter.html, "../images/"))
+		chapterDocuments[index] = buildExportChapterXHTML(chapter, body, language)
+	}
+
+	coverName := ""
+	if matches := exportCoverURLPattern.FindStringSubmatch(novel.Cover); matches != nil {
+		coverName = assets.add(strings.ToLower(matches[1]), matches[2])
+	}
+
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+
+	// mimetype 必须是第一个条目，且不压缩、不带扩展字段
+	mimetype := []byte("application/epub+zip")
+	mimetypeWriter, err := writer.CreateRaw(&zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(mimetype),
+		CompressedSize64:   uint64(len(mimetype)),
+		UncompressedSize64: uint64(len(mimetype)),
+	})
+	if err != nil {
+		return fmt.Errorf("写入 EPUB 失败: %w", err)
+	}
+	if _, err := mimetypeWriter.Write(mimetype); err != nil {
+		return fmt.Errorf("写入 EPUB 失败: %w", err)
+	}
+
+	files := []struct {
+		name    string
+		content []byte
+	}{
+		{"META-INF/container.xml", []byte(epubContainerXML)},
+		{"OEBPS/content.opf", []byte(buildExportOPF(novel, chapters, chapterFiles, assets.assets, coverName, identifier, language))},
+		{"OEBPS/nav.xhtml", []byte(buildExportNav(novel, chapters, chapterFiles, language))},
+		{"OEBPS/toc.ncx", []byte(buildExportNCX(novel, chapters, chapterFiles, identifier))},
+		{"OEBPS/styles/book.css", []byte(exportEpubCSS)},
+	}
+	for index, document := range chapterDocuments {
+		files = append(files, struct {
+			name    string
+			content []byte
+		}{"OEBPS/text/" + chapterFiles[index], []byte(document)})
+	}
+	for _, asset := range assets.assets {
+		files = append(files, struct {
+			name    string
+			content []byte
+		}{"OEBPS/images/" + asset.name, asset.data})
+	}
+
+	for _, file := range files {
+		entryWriter, err := writer.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate})
+		if err != nil {
+			return fmt.Errorf("写入 EPUB 失败: %w", err)
+		}
+		if _, err := entryWriter.Write(file.content); err != nil {
+			return fmt.Errorf("写入 EPUB 失败: %w", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("写入 EPUB 失败: %w", err)
+	}
+
+	if err := os.WriteFile(outputPath, buffer.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("保存 EPUB 文件失败: %w", err)
+	}
+	return nil
+}
+
+const epubContainerXML = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+const exportEpubCSS = `body { margin: 0 5%; line-height: 1.7; }
+h1, h2, h3 { text-align: center; margin: 1.2em 0; }
+p { margin: 0 0 0.8em; text-indent: 2em; }
+figure { margin: 1em 0; text-align: center; }
+img { max-width: 100%; height: auto; }
+nav ol { list-style: none; }
+`
+
+func buildExportOPF(
+	novel *models.Novel,
+	chapters []exportChapter,
+	chapterFiles []string,
+	assets []exportAsset,
+	coverName string,
+	identifier string,
+	language string,
+) string {
+	var builder strings.Builder
+	builder.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	builder.WriteString(`<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="bookid" xml:lang="` + language + `">` + "\n")
+	builder.WriteString(`  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">` + "\n")
+	fmt.Fprintf(&builder, "    <dc:identifier id=\"bookid\">urn:uuid:%s</dc:identifier>\n", identifier)
+	fmt.Fprintf(&builder, "    <dc:title>%s</dc:title>\n", stdhtml.EscapeString(exportTitle(novel)))
+	fmt.Fprintf(&builder, "    <dc:language>%s</dc:language>\n", language)
+	if author := strings.TrimSpace(novel.Author); author != "" {
+		fmt.Fprintf(&builder, "    <dc:creator>%s</dc:creator>\n", stdhtml.EscapeString(author))
+	}
+	if annotation := strings.TrimSpace(novel.Annotation); annotation != "" {
+		fmt.Fprintf(&builder, "    <dc:description>%s</dc:description>\n", stdhtml.EscapeString(annotation))
+	}
+	if series := strings.TrimSpace(novel.Series); series != "" {
+		fmt.Fprintf(&builder, "    <meta property=\"belongs-to-collection\" id=\"series\">%s</meta>\n", stdhtml.EscapeString(series))
+		builder.WriteString("    <meta refines=\"#series\" property=\"collection-type\">series</meta>\n")
+		if novel.SeriesIndex > 0 {
+			fmt.Fprintf(&builder, "    <meta refines=\"#series\" property=\"group-position\">%d</meta>\n", novel.SeriesIndex)
+		}
+	}
+	fmt.Fprintf(&builder, "    <meta property=\"dcterms:modified\">%s</meta>\n", time.Now().UTC().Format("2006-01-02T15:04:05Z"))
+	if coverName != "" {
+		// 兼容只识别 EPUB 2 封面声明的阅读器
+		builder.WriteString("    <meta name=\"cover\" content=\"" + exportAssetID(assets, coverName) + "\"/>\n")
+	}
+	builder.WriteString("  </metadata>\n  <manifest>\n")
+	builder.WriteString("    <item id=\"nav\" href=\"nav.xhtml\" media-type=\"application/xhtml+xml\" properties=\"nav\"/>\n")
+	builder.WriteString("    <item id=\"ncx\" href=\"toc.ncx\" media-type=\"application/x-dtbncx+xml\"/>\n")
+	builder.WriteString("    <item id=\"css\" href=\"styles/book.css\" media-type=\"text/css\"/>\n")
+	for index := range chapters {
+		fmt.Fprintf(&builder, "    <item id=\"chapter-%04d\" href=\"text/%s\" media-type=\"application/xhtml+xml\"/>\n", index+1, chapterFiles[index])
+	}
+	for _, asset := range assets {
+		properties := ""
+		if asset.name == coverName {
+			properties = ` properties="cover-image"`
+		}
+		fmt.Fprintf(&builder, "    <item id=\"%s\" href=\"images/%s\" media-type=\"%s\"%s/>\n", asset.id, asset.name, exportManifestMediaType(asset.mediaType), properties)
+	}
+	builder.WriteString("  </manifest>\n  <spine toc=\"ncx\">\n")
+	for index := range chapters {
+		fmt.Fprintf(&builder, "    <itemref idref=\"chapter-%04d\"/>\n", index+1)
+	}
+	builder.WriteString("  </spine>\n</package>\n")
+	return builder.String()
+}
+
+func exportAssetID(assets []exportAsset, name string) string {
+	for _, asset := range assets {
+		if asset.name == name {
+			return asset.id
+		}
+	}
+	return ""
+}
+
+func exportManifestMediaType(mediaType string) string {
+	if mediaType == "image/jpg" {
+		return "image/jpeg"
+	}
+	return mediaType
+}
+
+// buildExportNav 按章节层级生成嵌套的 nav 目录
+func buildExportNav(novel *models.Novel, chapters []exportChapter, chapterFiles []string, language string) string {
+	var builder strings.Builder
+	builder.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n<!DOCTYPE html>\n")
+	fmt.Fprintf(&builder, `<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="%s" lang="%s">`+"\n", language, language)
+	fmt.Fprintf(&builder, "<head><meta charset=\"UTF-8\"/><title>%s</title></head>\n<body>\n", stdhtml.EscapeString(exportTitle(novel)))
+	builder.WriteString("<nav epub:type=\"toc\" id=\"toc\"><h1>目录</h1>\n")
+
+	children := exportChapterChildren(chapters)
+	var writeList func(parent int)
+	writeList = func(parent int) {
+		builder.WriteString("<ol>\n")
+		for _, index := range children[parent] {
+			fmt.Fprintf(&builder, "<li><a href=\"text/%s\">%s</a>", chapterFiles[index], stdhtml.EscapeString(chapters[index].title))
+			if len(children[index]) > 0 {
+				builder.WriteString("\n")
+				writeList(index)
+			}
+			builder.WriteString("</li>\n")
+		}
+		builder.WriteString("</ol>\n")
+	}
+	writeList(-1)
+
+	builder.WriteString("</nav>\n</body>\n</html>\n")
+	return builder.String()
+}
+
+// buildExportNCX 生成 EPUB 2 的 NCX 目录，供不支持 nav 的旧阅读器使用
+func buildExportNCX(novel *models.Novel, chapters []exportChapter, chapterFiles []string, identifier string) string {
+	var builder strings.Builder
+	builder.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	builder.WriteString(`<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">` + "\n")
+	fmt.Fprintf(&builder, "<head><meta name=\"dtb:uid\" content=\"urn:uuid:%s\"/></head>\n", identifier)
+	fmt.Fprintf(&builder, "<docTitle><text>%s</text></docTitle>\n<navMap>\n", stdhtml.EscapeString(exportTitle(novel)))
+
+	children := exportChapterChildren(chapters)
+	var writePoints func(parent int)
+	writePoints = func(parent int) {
+		for _, index := range children[parent] {
+			fmt.Fprintf(
+				&builder,
+				"<navPoint id=\"nav-%04d\" playOrder=\"%d\"><navLabel><text>%s</text></navLabel><content src=\"text/%s\"/>\n",
+				index+1,
+				index+1,
+				stdhtml.EscapeString(chapters[index].title),
+				chapterFiles[index],
+			)
+			writePoints(index)
+			builder.WriteString("</navPoint>\n")
+		}
+	}
+	writePoints(-1)
+
+	builder.WriteString("</navMap>\n</ncx>\n")
+	return builder.String()
+}
+
+// exportChapterChildren 按 ParentIndex 分组，key -1 为顶层
+func exportChapterChildren(chapters []exportChapter) map[int][]int {
+	children := make(map[int][]int)
+	for index, chapter := range chapters {
+		parent := chapter.parentIndex
+		if parent < 0 || parent >= index {
+			parent = -1
+		}
+		children[parent] = append(children[parent], index)
+	}
+	return children
+}
+
+func buildExportChapterXHTML(chapter exportChapter, body, language string) string {
+	headingLevel := clampInt(chapter.level+1, 1, 6)
+	title := stdhtml.EscapeString(chapter.title)
+
+	var builder strings.Builder
+	builder.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n<!DOCTYPE html>\n")
+	fmt.Fprintf(&builder, `<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="%s" lang="%s">`+"\n", language, language)
+	fmt.Fprintf(&builder, "<head><meta charset=\"UTF-8\"/><title>%s</title><link rel=\"stylesheet\" type=\"text/css\" href=\"../styles/book.css\"/></head>\n", title)
+	fmt.Fprintf(&builder, "<body>\n<section epub:type=\"chapter\">\n<h%d>%s</h%d>\n%s\n</section>\n</body>\n</html>\n", headingLevel, title, headingLevel, body)
+	return builder.String()
+}
+
+// normalizeExportXHTML 重新解析富文本片段并输出为格式良好的 XHTML
+func normalizeExportXHTML(content string) string {
+	nodes, err := xhtml.ParseFragment(strings.NewReader(content), &xhtml.Node{
+		Type:     xhtml.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+	if err != nil {
+		return stdhtml.EscapeString(stripHTMLTags(content))
+	}
+
+	var builder strings.Builder
+	for _, node := range nodes {
+		removeExportUnsupportedAttributes(node)
+		builder.WriteString(renderHTMLNodeString(node))
+	}
+	return builder.String()
+}
+
+// removeExportUnsupportedAttributes 去掉 XHTML 中无效的属性，src 为空的图片改为替代文字
+func removeExportUnsupportedAttributes(node *xhtml.Node) {
+	for child := node.FirstChild; child != nil; {
+		next := child.NextSibling
+		if child.Type == xhtml.ElementNode && child.Data == "img" && getHTMLAttribute(child, "src") == "" {
+			if alt := getHTMLAttribute(child, "alt"); alt != "" {
+				node.InsertBefore(&xhtml.Node{Type: xhtml.TextNode, Data: alt}, child)
+			}
+			node.RemoveChild(child)
+		} else {
+			removeExportUnsupportedAttributes(child)
+		}
+		child = next
+	}
+
+	if node.Type != xhtml.ElementNode {
+		return
+	}
+	attrs := node.Attr[:0]
+	for _, attr := range node.Attr {
+		// loading 与 data-* 只对阅读器前端有意义
+		if attr.Key == "loading" || strings.HasPrefix(attr.Key, "data-") {
+			continue
+		}
+		attrs = append(attrs, attr)
+	}
+	node.Attr = attrs
+}
+
+func exportTitle(novel *models.Novel) string {
+	if title := strings.TrimSpace(novel.Title); title != "" {
+		return title
+	}
+	return exportFileBaseName(novel)
+}
+
+// guessExportLanguage 根据正文开头的文字粗略判断语言
+func guessExportLanguage(content string) string {
+	checked := 0
+	for _, char := range content {
+		if unicode.Is(unicode.Han, char) {
+			return "zh"
+		}
+		if checked++; checked > 2000 {
+			break
+		}
+	}
+	return "en"
+}
+
+func newExportUUID() string {
+	var value [16]byte
+	if _, err := rand.Read(value[:]); err != nil {
+		return fmt.Sprintf("00000000-0000-4000-8000-%012x", time.Now().UnixNano()&0xFFFFFFFFFFFF)
+	}
+	value[6] = value[6]&0x0F | 0x40
+	value[8] = value[8]&0x3F | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", value[0:4], value[4:6], value[6:8], value[8:10], value[10:16])
+}
@@ -0,0 +1,423 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	stdhtml "html"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// fb2Node FictionBook 文档树节点，name 为空表示文本节点
+type fb2Node struct {
+	name     string
+	attrs    map[string]string
+	children []*fb2Node
+	text     string
+}
+
+func (n *fb2Node) child(name string) *fb2Node {
+	for _, child := range n.children {
+		if child.name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+func (n *fb2Node) childrenNamed(name string) []*fb2Node {
+	matched := []*fb2Node{}
+	for _, child := range n.children {
+		if child.name == name {
+			matched = append(matched, child)
+		}
+	}
+	return matched
+}
+
+// textContent 拼接节点下的全部文本，块级子节点之间以空格分隔
+func (n *fb2Node) textContent() string {
+	if n == nil {
+		return ""
+	}
+	if n.name == "" {
+		return n.text
+	}
+
+	parts := make([]string, 0, len(n.children))
+	for _, child := range n.children {
+		if text := strings.TrimSpace(child.textContent()); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+}
+
+// fb2Binary <binary> 中内嵌的图片
+type fb2Binary struct {
+	contentType string
+	data        string
+}
+
+// fb2Chapter 按 section 嵌套切分出的章节
+type fb2Chapter struct {
+	title string
+	level int
+	nodes []*fb2Node
+}
+
+// fb2Book 解析后的 FictionBook 书籍
+type fb2Book struct {
+	title       string
+	authors     []string
+	series      string
+	seriesIndex int
+	annotation  string
+	coverHref   string
+	binaries    map[string]fb2Binary
+	chapters    []fb2Chapter
+}
+
+// readFb2File 读取 .fb2 文件，.fb2.zip 则读取压缩包中的第一个 .fb2 文件
+func readFb2File(filePath string) ([]byte, error) {
+	if !strings.HasSuffix(strings.ToLower(filePath), ".zip") {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("读取 FB2 文件失败: %w", err)
+		}
+		return data, nil
+	}
+
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("打开 FB2 压缩包失败: %w", err)
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() || !strings.EqualFold(path.Ext(file.Name), ".fb2") {
+			continue
+		}
+
+		entry, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("读取 FB2 压缩包失败: %w", err)
+		}
+		defer entry.Close()
+
+		data, err := io.ReadAll(entry)
+		if err != nil {
+			return nil, fmt.Errorf("读取 FB2 压缩包失败: %w", err)
+		}
+		return data, nil
+	}
+
+	return nil, fmt.Errorf("压缩包中没有找到 FB2 文件")
+}
+
+// parseFb2Tree 将 FB2 文档解析为节点树，XML 声明中的 windows-1251 等编码会自动转换
+func parseFb2Tree(data []byte) (*fb2Node, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = charset.NewReaderLabel
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+
+	root := &fb2Node{name: "#document"}
+	stack := []*fb2Node{root}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("解析 FB2 文档失败: %w", err)
+		}
+
+		parent := stack[len(stack)-1]
+		switch typed := token.(type) {
+		case xml.StartElement:
+			node := &fb2Node{name: strings.ToLower(typed.Name.Local), attrs: make(map[string]string, len(typed.Attr))}
+			for _, attr := range typed.Attr {
+				node.attrs[strings.ToLower(attr.Name.Local)] = attr.Value
+			}
+			parent.children = append(parent.children, node)
+			stack = append(stack, node)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			parent.children = append(parent.children, &fb2Node{text: string(typed)})
+		}
+	}
+
+	document := root.child("fictionbook")
+	if document == nil {
+		return nil, fmt.Errorf("不是有效的 FB2 文件")
+	}
+	return document, nil
+}
+
+// parseFb2Book 解析 FB2 元数据、内嵌图片和章节结构
+func parseFb2Book(data []byte) (*fb2Book, error) {
+	document, err := parseFb2Tree(data)
+	if err != nil {
+		return nil, err
+	}
+
+	book := &fb2Book{binaries: make(map[string]fb2Binary)}
+	if description := document.child("description"); description != nil {
+		readFb2Description(book, description)
+	}
+
+	for _, binary := range document.childrenNamed("binary") {
+		if id := strings.TrimSpace(binary.attrs["id"]); id != "" {
+			book.binaries[id] = fb2Binary{
+				contentType: strings.TrimSpace(binary.attrs["content-type"]),
+				data:        binary.textContent(),
+			}
+		}
+	}
+
+	for _, body := range document.childrenNamed("body") {
+		if bodyName := strings.ToLower(body.attrs["name"]); bodyName == "notes" || bodyName == "comments" {
+			// 注释正文整体作为一章，附在书末
+			title := body.child("title").textContent()
+			if title == "" {
+				title = "注释"
+			}
+			book.chapters = append(book.chapters, fb2Chapter{title: title, nodes: withoutFb2Title(body.children)})
+			continue
+		}
+
+		frontNodes := []*fb2Node{}
+		for _, child := range body.children {
+			if child.name != "title" && child.name != "section" && child.name != "" {
+				frontNodes = append(frontNodes, child)
+			}
+		}
+		if len(frontNodes) > 0 {
+			title := body.child("title").textContent()
+			if title == "" {
+				title = book.title
+			}
+			book.chapters = append(book.chapters, fb2Chapter{title: title, nodes: frontNodes})
+		}
+
+		for _, section := range body.childrenNamed("section") {
+			collectFb2Chapters(section, 0, &book.chapters)
+		}
+	}
+
+	return book, nil
+}
+
+func readFb2Description(book *fb2Book, description *fb2Node) {
+	titleInfo := description.child("title-info")
+	if titleInfo == nil {
+		return
+	}
+
+	book.title = titleInfo.child("book-title").textContent()
+	for _, author := range titleInfo.childrenNamed("author") {
+		nameParts := []string{}
+		for _, field := range []string{"first-name", "middle-name", "last-name"} {
+			if value := author.child(field).textContent(); value != "" {
+				nameParts = append(nameParts, value)
+			}
+		}
+		name := strings.Join(nameParts, " ")
+		if name == "" {
+			name = author.child("nickname").textContent()
+		}
+		if name != "" {
+			book.authors = append(book.authors, name)
+		}
+	}
+
+	sequence := titleInfo.child("sequence")
+	if sequence == nil {
+		if publishInfo := description.child("publish-info"); publishInfo != nil {
+			sequence = publishInfo.child("sequence")
+		}
+	}
+	if sequence != nil {
+		book.series = strings.TrimSpace(sequence.attrs["name"])
+		book.seriesIndex, _ = strconv.Atoi(strings.TrimSpace(sequence.attrs["number"]))
+	}
+
+	if annotation := titleInfo.child("annotation"); annotation != nil {
+		paragraphs := []string{}
+		for _, child := range annotation.children {
+			if text := child.textContent(); strings.TrimSpace(text) != "" {
+				paragraphs = append(paragraphs, strings.TrimSpace(text))
+			}
+		}
+		book.annotation = strings.Join(paragraphs, "\n")
+	}
+
+	if coverPage := titleInfo.child("coverpage"); coverPage != nil {
+		if image := coverPage.child("image"); image != nil {
+			book.coverHref = image.attrs["href"]
+		}
+	}
+}
+
+// collectFb2Chapters 每个 section 为一章；包含子 section 的作为上级章节，
+// 自身只保留子 section 之前的题记、图片等内容
+func collectFb2Chapters(section *fb2Node, level int, chapters *[]fb2Chapter) {
+	title := section.child("title").textContent()
+	childSections := section.childrenNamed("section")
+
+	nodes := []*fb2Node{}
+	for _, child := range section.children {
+		if child.name != "title" && child.name != "section" {
+			nodes = append(nodes, child)
+		}
+	}
+	*chapters = append(*chapters, fb2Chapter{title: title, level: level, nodes: nodes})
+
+	for _, childSection := range childSections {
+		collectFb2Chapters(childSection, level+1, chapters)
+	}
+}
+
+func withoutFb2Title(nodes []*fb2Node) []*fb2Node {
+	filtered := make([]*fb2Node, 0, len(nodes))
+	for _, node := range nodes {
+		if node.name != "title" {
+			filtered = append(filtered, node)
+		}
+	}
+	return filtered
+}
+
+// chapterMarkup 将章节转换为 XHTML，交给 EPUB 的富文本净化流程
+func (b *fb2Book) chapterMarkup(chapter fb2Chapter) string {
+	var builder strings.Builder
+	builder.WriteString("<html><body>")
+	if chapter.title != "" {
+		builder.WriteString(wrapEpubHTMLTag("h2", stdhtml.EscapeString(chapter.title)))
+	}
+	for _, node := range chapter.nodes {
+		renderFb2Node(&builder, node)
+	}
+	builder.WriteString("</body></html>")
+	return builder.String()
+}
+
+// renderFb2Node 将 FB2 元素映射为对应的 HTML 元素
+func renderFb2Node(builder *strings.Builder, node *fb2Node) {
+	if node.name == "" {
+		builder.WriteString(stdhtml.EscapeString(node.text))
+		return
+	}
+
+	renderChildren := func() {
+		for _, child := range node.children {
+			renderFb2Node(builder, child)
+		}
+	}
+	wrap := func(tag string) {
+		builder.WriteString("<" + tag + ">")
+		renderChildren()
+		builder.WriteString("</" + tag + ">")
+	}
+
+	switch node.name {
+	case "p", "v", "text-author":
+		wrap("p")
+	case "emphasis":
+		wrap("em")
+	case "strong", "sub", "sup", "code", "table", "tr", "td", "th":
+		wrap(node.name)
+	case "strikethrough":
+		wrap("del")
+	case "subtitle":
+		wrap("h4")
+	case "title":
+		// 注释正文中的小节标题
+		builder.WriteString(wrapEpubHTMLTag("h3", stdhtml.EscapeString(node.textContent())))
+	case "epigraph", "cite":
+		wrap("blockquote")
+	case "poem", "stanza", "section":
+		wrap("div")
+	case "a":
+		if node.attrs["type"] == "note" {
+			wrap("sup")
+		} else {
+			renderChildren()
+		}
+	case "empty-line":
+		builder.WriteString("<br />")
+	case "image":
+		fmt.Fprintf(
+			builder,
+			`<img src="%s" alt="%s" />`,
+			escapeHTMLAttribute(node.attrs["href"]),
+			escapeHTMLAttribute(node.attrs["alt"]),
+		)
+	default:
+		renderChildren()
+	}
+}
+
+// resolveAsset 将 #id 形式的图片引用转换为 <binary> 内容的 data URL
+func (b *fb2Book) resolveAsset(reference string) (string, error) {
+	id := strings.TrimPrefix(strings.TrimSpace(reference), "#")
+	binary, exists := b.binaries[id]
+	if !exists {
+		return "", nil
+	}
+
+	mediaType := strings.ToLower(binary.contentType)
+	if !isSupportedEpubCoverMediaType(mediaType) {
+		mediaType = inferEpubMediaType(id)
+	}
+	if !isSupportedEpubCoverMediaType(mediaType) {
+		return "", nil
+	}
+
+	// 去掉 base64 中的换行和缩进后校验一次，损坏的图片直接忽略
+	encoded := strings.Join(strings.Fields(binary.data), "")
+	if _, err := base64.StdEncoding.DecodeString(encoded); err != nil {
+		return "", fmt.Errorf("FB2 图片数据损坏: %s", id)
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mediaType, encoded), nil
+}
+
+func (b *fb2Book) coverDataURL() string {
+	if b.coverHref == "" {
+		return ""
+	}
+	dataURL, err := b.resolveAsset(b.coverHref)
+	if err != nil {
+		return ""
+	}
+	return dataURL
+}
+
+// buildDrafts 生成章节草稿，标题为空的章节沿用 EPUB 的“第N章”兜底
+func (b *fb2Book) buildDrafts() []*epubChapterDraft {
+	drafts := make([]*epubChapterDraft, 0, len(b.chapters))
+	for index, chapter := range b.chapters {
+		_, text, html := extractRichChapterContent(b.chapterMarkup(chapter), b.resolveAsset)
+		draft := &epubChapterDraft{
+			title:         chapter.title,
+			level:         chapter.level,
+			fallbackIndex: index + 1,
+			fromTOC:       chapter.title != "",
+		}
+		draft.appendContent(text, html)
+		drafts = append(drafts, draft)
+	}
+	return drafts
+}
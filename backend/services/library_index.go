@@ -0,0 +1,869 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/nongchen1223/moyureader/backend/models"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// 书库全文索引：后台逐本解析书架上的书，中日文按单字和相邻两字、西文按单词切分，
+// 记录每个词出现在哪些书、每本书的哪些章节。检索时先用索引求出候选章节，再在章节正文中精确匹配。
+// 索引存放在数据目录的 library_index 下：index.gob 为书目与词到书的倒排表，
+// 每本书另有一个 <ID>.seg 保存词到章节的倒排表和各章正文。
+//
+// .seg 保存整章正文而不是词的位置：EPUB、MOBI、PDF 需要整本解析才能得到正文，
+// 检索时为每本候选书重新解析要数秒，只存位置就得这样做；正文经 gzip 压缩，
+// 通常不到原书文字的一半，书移出书架或文件变化时随之删除或重建，
+// 数据目录与 progress.json 一样只属于当前用户
+
+const (
+	libraryIndexDirName  = "library_index"
+	libraryIndexFileName = "index.gob"
+	libraryIndexVersion  = 1
+	// libraryIndexMaxWordRunes 超过该长度的西文词（多为网址、编码串）不进索引
+	libraryIndexMaxWordRunes = 64
+	// librarySearchBookLimit 每本书最多返回的结果数
+	librarySearchBookLimit = 20
+	// librarySearchTotalLimit 一次检索最多返回的结果数
+	librarySearchTotalLimit = 200
+)
+
+// libraryIndexBook 书库索引中的一本书
+type libraryIndexBook struct {
+	FilePath string
+	// ID 章节索引文件的编号，0 表示没有可检索的文字或解析失败
+	ID      int
+	Title   string
+	Author  string
+	Format  string
+	Size    int64
+	ModTime int64
+	// Settings 解析偏好（编码、章节规则等）的摘要，偏好变化后章节可能不同，需要重建
+	Settings string
+	// Error 解析失败的原因，文件或偏好变化前不再重试
+	Error string
+}
+
+// libraryIndexData 书库索引文件：书目，以及每个词所在的书（书的 ID 按 varint 差值编码）
+type libraryIndexData struct {
+	Version  int
+	NextID   int
+	Books    []libraryIndexBook
+	Postings map[string][]byte
+}
+
+// libraryIndexChapter 章节索引文件中的一章，Index 为 -1 表示第一章之前的正文
+type libraryIndexChapter struct {
+	Index    int
+	Title    string
+	StartPos int
+	Text     string
+}
+
+// libraryIndexSegment 单本书的章节索引：每个词所在的章节（Chapters 下标按 varint 差值编码）与各章正文
+type libraryIndexSegment struct {
+	Chapters []libraryIndexChapter
+	Postings map[string][]byte
+}
+
+// libraryIndex 书库索引，书架变化时增量更新，由后台任务逐本重建
+type libraryIndex struct {
+	mu              sync.Mutex
+	progressService *ProgressService
+	dir             string
+	loaded          bool
+	books           map[string]libraryIndexBook
+	postings        map[string][]byte
+	// lastIDs 倒排表中每个词最后一个书籍 ID，追加时免去解码整个列表；缺失时按需从列表算出
+	lastIDs map[string]int
+	nextID  int
+	// dirty 内存中的书目或倒排表尚未写入 index.gob
+	dirty bool
+
+	// shelf 最近一次同步的书架，切换数据目录后按它重建
+	shelf   []string
+	wanted  map[string]bool
+	pending []string
+	queued  map[string]bool
+	// indexing 后台任务正在解析的文件
+	indexing string
+	// generation 切换数据目录或关闭时递增，旧任务的解析结果作废
+	generation int
+	// done 后台任务运行期间非空，任务结束时关闭
+	done   chan struct{}
+	notify func(models.LibraryIndexStatus)
+}
+
+func newLibraryIndex(dataDir string, progressService *ProgressService) *libraryIndex {
+	return &libraryIndex{
+		progressService: progressService,
+		dir:             filepath.Join(dataDir, libraryIndexDirName),
+		wanted:          make(map[string]bool),
+		queued:          make(map[string]bool),
+	}
+}
+
+// ensureLoaded 首次使用时读取索引文件，文件缺失或损坏时从空索引开始重建；调用方需持有锁
+func (l *libraryIndex) ensureLoaded() {
+	if l.loaded {
+		return
+	}
+	l.loaded = true
+	l.books = make(map[string]libraryIndexBook)
+	l.postings = make(map[string][]byte)
+	l.lastIDs = make(map[string]int)
+	l.nextID = 1
+
+	var data libraryIndexData
+	if err := readLibraryIndexFile(filepath.Join(l.dir, libraryIndexFileName), &data); err == nil && data.Version == libraryIndexVersion {
+		for _, book := range data.Books {
+			l.books[book.FilePath] = book
+		}
+		if data.Postings != nil {
+			l.postings = data.Postings
+		}
+		l.nextID = max(data.NextID, 1)
+	}
+
+	// 上次退出前没来得及写入书目的章节索引文件已无从引用
+	ids := make(map[int]bool, len(l.books))
+	for _, book := range l.books {
+		ids[book.ID] = true
+	}
+	segments, _ := filepath.Glob(filepath.Join(l.dir, "*.seg"))
+	for _, segmentPath := range segments {
+		id, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(segmentPath), ".seg"))
+		if err != nil || !ids[id] {
+			os.Remove(segmentPath)
+		}
+	}
+}
+
+// sync 按书架文件列表更新索引：移出书架或已删除的书从索引中去掉，新书和有变化的书排队重建
+func (l *libraryIndex) sync(filePaths []string) error {
+	l.mu.Lock()
+	l.ensureLoaded()
+
+	l.shelf = l.shelf[:0]
+	l.wanted = make(map[string]bool, len(filePaths))
+	for _, filePath := range filePaths {
+		if filePath = strings.TrimSpace(filePath); filePath != "" && !l.wanted[filePath] {
+			l.wanted[filePath] = true
+			l.shelf = append(l.shelf, filePath)
+		}
+	}
+
+	for filePath := range l.books {
+		if !l.wanted[filePath] {
+			l.removeBook(filePath)
+		}
+	}
+	for _, filePath := range l.shelf {
+		info, err := os.Stat(filePath)
+		if err != nil {
+			l.removeBook(filePath)
+			continue
+		}
+		if book, exists := l.books[filePath]; exists && !l.isStale(book, info) {
+			continue
+		}
+		l.enqueue(filePath)
+	}
+
+	err := l.startWorker()
+	l.mu.Unlock()
+	l.emitStatus()
+	return err
+}
+
+// isStale 文件大小、修改时间或解析偏好与建索引时不同；调用方需持有锁
+func (l *libraryIndex) isStale(book libraryIndexBook, info os.FileInfo) bool {
+	return book.Size != info.Size() ||
+		book.ModTime != info.ModTime().UnixNano() ||
+		book.Settings != l.settingsDigest(book.FilePath)
+}
+
+// settingsDigest 影响解析结果的偏好摘要
+func (l *libraryIndex) settingsDigest(filePath string) string {
+	if l.progressService == nil {
+		return ""
+	}
+
+	data, _ := json.Marshal(struct {
+		Book  *BookSettings
+		Rules *models.ChapterRuleSet
+	}{l.progressService.GetBookSettings(filePath), l.progressService.GetGlobalChapterRules()})
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+func (l *libraryIndex) enqueue(filePath string) {
+	if !l.queued[filePath] {
+		l.queued[filePath] = true
+		l.pending = append(l.pending, filePath)
+	}
+}
+
+// startWorker 有待建索引的书且后台任务未运行时启动任务；没有任务时顺带写入索引文件。调用方需持有锁
+func (l *libraryIndex) startWorker() error {
+	if l.done != nil {
+		return nil
+	}
+	if len(l.pending) == 0 {
+		return l.save()
+	}
+
+	l.done = make(chan struct{})
+	go l.run(l.done)
+	return nil
+}
+
+// run 后台任务：逐本解析排队的书，队列清空后写入索引文件并退出
+func (l *libraryIndex) run(done chan struct{}) {
+	for {
+		l.mu.Lock()
+		if len(l.pending) == 0 {
+			l.save()
+			l.indexing = ""
+			l.done = nil
+			l.mu.Unlock()
+			close(done)
+			l.emitStatus()
+			return
+		}
+
+		filePath := l.pending[0]
+		l.pending = l.pending[1:]
+		delete(l.queued, filePath)
+		l.indexing = filePath
+		generation := l.generation
+		settings := l.settingsDigest(filePath)
+		l.mu.Unlock()
+		l.emitStatus()
+
+		book, segment := buildLibraryIndexEntry(filePath, settings, l.progressService)
+
+		l.mu.Lock()
+		if generation == l.generation && l.wanted[filePath] {
+			l.applyEntry(book, segment)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// buildLibraryIndexEntry 解析一本书并切分章节索引；漫画与扫描版 PDF 没有可检索的文字，只记录书目
+func buildLibraryIndexEntry(filePath, settings string, progressService *ProgressService) (book libraryIndexBook, segment *libraryIndexSegment) {
+	book = libraryIndexBook{FilePath: filePath, Settings: settings}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		book.Error = fmt.Sprintf("读取文件失败: %v", err)
+		return book, nil
+	}
+	book.Size = info.Size()
+	book.ModTime = info.ModTime().UnixNano()
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			book.Error = fmt.Sprintf("解析小说内容失败: %v", recovered)
+			segment = nil
+		}
+	}()
+
+	// 使用独立的解析实例，不影响阅读页当前打开的书
+	parser := NewNovelService(progressService)
+	if _, err := parser.loadNovel(filePath, parser.preferredEncoding(filePath)); err != nil {
+		book.Error = err.Error()
+		return book, nil
+	}
+	novel := parser.novels[filePath]
+	book.Title = novel.Title
+	book.Author = novel.Author
+	book.Format = novel.Format
+
+	if _, isImageBased := parser.pdfChapterHTML[filePath]; isImageBased || novel.Format == ".cbz" {
+		return book, nil
+	}
+	return book, buildLibraryIndexSegment(novel.Content, novel.Chapters)
+}
+
+// buildLibraryIndexSegment 按章节起始位置切分正文并建立词到章节的倒排表
+func buildLibraryIndexSegment(content string, chapters []models.Chapter) *libraryIndexSegment {
+	runes := []rune(content)
+	segment := &libraryIndexSegment{Postings: make(map[string][]byte)}
+	addChapter := func(index int, title string, start, end int) {
+		start = clampInt(start, 0, len(runes))
+		end = clampInt(end, start, len(runes))
+		if start < end {
+			segment.Chapters = append(segment.Chapters, libraryIndexChapter{
+				Index:    index,
+				Title:    title,
+				StartPos: start,
+				Text:     string(runes[start:end]),
+			})
+		}
+	}
+
+	if len(chapters) == 0 {
+		addChapter(-1, "", 0, len(runes))
+	} else {
+		addChapter(-1, "", 0, chapters[0].StartPos)
+	}
+	for index, chapter := range chapters {
+		end := len(runes)
+		if index+1 < len(chapters) {
+			end = chapters[index+1].StartPos
+		}
+		addChapter(index, chapter.Title, chapter.StartPos, end)
+	}
+
+	// lastChapter 记录每个词上一次出现的章节下标加一，同一章只记一次
+	lastChapter := make(map[string]int)
+	for chapterIndex, chapter := range segment.Chapters {
+		forEachLibraryToken(chapter.Text, false, func(token string) {
+			last, exists := lastChapter[token]
+			if exists && last == chapterIndex+1 {
+				return
+			}
+			previous := 0
+			if exists {
+				previous = last - 1
+			}
+			segment.Postings[token] = binary.AppendUvarint(segment.Postings[token], uint64(chapterIndex-previous))
+			lastChapter[token] = chapterIndex + 1
+		})
+	}
+	return segment
+}
+
+// applyEntry 用新解析的结果替换书库中的旧记录；调用方需持有锁
+func (l *libraryIndex) applyEntry(book libraryIndexBook, segment *libraryIndexSegment) {
+	l.removeBook(book.FilePath)
+	l.dirty = true
+
+	if segment != nil && len(segment.Postings) > 0 {
+		id := l.nextID
+		if err := writeLibraryIndexFile(l.segmentPath(id), segment); err != nil {
+			book.Error = err.Error()
+		} else {
+			l.nextID++
+			book.ID = id
+			for token := range segment.Postings {
+				l.appendPosting(token, id)
+			}
+		}
+	}
+	l.books[book.FilePath] = book
+}
+
+// removeBook 从书目和倒排表中去掉一本书；调用方需持有锁
+func (l *libraryIndex) removeBook(filePath string) {
+	book, exists := l.books[filePath]
+	if !exists {
+		return
+	}
+	delete(l.books, filePath)
+	l.dirty = true
+	if book.ID == 0 {
+		return
+	}
+
+	// 章节索引中的词就是这本书出现过的全部词，读不到时只能遍历整个倒排表
+	tokens := l.postings
+	if segment, err := readLibraryIndexSegment(l.segmentPath(book.ID)); err == nil {
+		tokens = segment.Postings
+	}
+	for token := range tokens {
+		list, exists := l.postings[token]
+		if !exists {
+			continue
+		}
+		delete(l.lastIDs, token)
+		if list = removeLibraryPosting(list, book.ID); len(list) == 0 {
+			delete(l.postings, token)
+		} else {
+			l.postings[token] = list
+		}
+	}
+	os.Remove(l.segmentPath(book.ID))
+}
+
+// save 索引有变化时写入 index.gob；调用方需持有锁
+func (l *libraryIndex) save() error {
+	if !l.loaded || !l.dirty {
+		return nil
+	}
+
+	data := libraryIndexData{
+		Version:  libraryIndexVersion,
+		NextID:   l.nextID,
+		Books:    make([]libraryIndexBook, 0, len(l.books)),
+		Postings: l.postings,
+	}
+	for _, book := range l.books {
+		data.Books = append(data.Books, book)
+	}
+	sort.Slice(data.Books, func(i, j int) bool {
+		return data.Books[i].FilePath < data.Books[j].FilePath
+	})
+
+	if err := writeLibraryIndexFile(filepath.Join(l.dir, libraryIndexFileName), data); err != nil {
+		return err
+	}
+	l.dirty = false
+	return nil
+}
+
+// close 清空队列并等待后台任务结束，写入索引文件
+func (l *libraryIndex) close() error {
+	l.mu.Lock()
+	l.pending = nil
+	l.queued = make(map[string]bool)
+	l.generation++
+	done := l.done
+	l.mu.Unlock()
+
+	if done != nil {
+		<-done
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.save()
+}
+
+// wait 等待当前排队的书全部建完索引
+func (l *libraryIndex) wait() {
+	for {
+		l.mu.Lock()
+		done := l.done
+		l.mu.Unlock()
+		if done == nil {
+			return
+		}
+		<-done
+	}
+}
+
+// setDataDir 切换数据目录：保存旧目录的索引，读取新目录的索引后按当前书架补建
+func (l *libraryIndex) setDataDir(dataDir string) error {
+	if err := l.close(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.dir = filepath.Join(dataDir, libraryIndexDirName)
+	l.loaded = false
+	l.dirty = false
+	shelf := append([]string(nil), l.shelf...)
+	l.mu.Unlock()
+
+	return l.sync(shelf)
+}
+
+func (l *libraryIndex) setNotify(notify func(models.LibraryIndexStatus)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.notify = notify
+}
+
+func (l *libraryIndex) status() models.LibraryIndexStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.statusLocked()
+}
+
+func (l *libraryIndex) statusLocked() models.LibraryIndexStatus {
+	status := models.LibraryIndexStatus{
+		Total:    len(l.shelf),
+		Pending:  len(l.pending),
+		Indexing: l.indexing,
+	}
+	for _, book := range l.books {
+		if book.Error != "" {
+			status.Failed++
+		} else {
+			status.Indexed++
+		}
+	}
+	return status
+}
+
+// emitStatus 通知前端索引进度，在锁外回调
+func (l *libraryIndex) emitStatus() {
+	l.mu.Lock()
+	notify := l.notify
+	status := l.statusLocked()
+	l.mu.Unlock()
+
+	if notify != nil {
+		notify(status)
+	}
+}
+
+// search 在书库中检索：先按索引求出包含全部检索词的书和章节，再在章节正文中匹配，
+// 含中日文时按字面匹配，否则按整词匹配，均不区分大小写
+func (l *libraryIndex) search(query string) ([]models.LibrarySearchResult, error) {
+	results := []models.LibrarySearchResult{}
+	query = strings.TrimSpace(query)
+
+	var tokens []string
+	forEachLibraryToken(query, true, func(token string) {
+		tokens = append(tokens, token)
+	})
+	if len(tokens) == 0 {
+		return results, nil
+	}
+
+	options := models.SearchOptions{Keyword: query, Mode: models.SearchModeWholeWord}
+	if strings.IndexFunc(query, isLibraryCJKRune) >= 0 {
+		options.Mode = models.SearchModeLiteral
+	}
+
+	l.mu.Lock()
+	l.ensureLoaded()
+	var candidateIDs []int
+	for index, token := range tokens {
+		ids := decodeLibraryPostings(l.postings[token])
+		if index == 0 {
+			candidateIDs = ids
+		} else {
+			candidateIDs = intersectLibraryPostings(candidateIDs, ids)
+		}
+	}
+	candidates := l.candidateBooks(candidateIDs)
+	l.mu.Unlock()
+
+	changed := false
+	for _, book := range candidates {
+		if len(results) >= librarySearchTotalLimit {
+			break
+		}
+
+		// 索引只在同步书架时更新，检索前再确认文件没有变化，变化的书排队重建、本次跳过
+		info, statErr := os.Stat(book.FilePath)
+		l.mu.Lock()
+		current, exists := l.books[book.FilePath]
+		usable := exists && current.ID == book.ID
+		if usable && statErr != nil {
+			l.removeBook(book.FilePath)
+			usable, changed = false, true
+		} else if usable && l.isStale(book, info) {
+			l.enqueue(book.FilePath)
+			usable, changed = false, true
+		}
+		segmentPath := l.segmentPath(book.ID)
+		l.mu.Unlock()
+		if !usable {
+			continue
+		}
+
+		segment, err := readLibraryIndexSegment(segmentPath)
+		if err != nil {
+			continue
+		}
+		results = append(results, searchLibrarySegment(book, segment, tokens, options, librarySearchTotalLimit-len(results))...)
+	}
+
+	if changed {
+		l.mu.Lock()
+		err := l.startWorker()
+		l.mu.Unlock()
+		l.emitStatus()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// candidateBooks 列出候选书，按书架顺序排列；启动后书架尚未同步时按文件路径排列。调用方需持有锁
+func (l *libraryIndex) candidateBooks(ids []int) []libraryIndexBook {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	idSet := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		idSet[id] = true
+	}
+	var books []libraryIndexBook
+	for _, book := range l.books {
+		if idSet[book.ID] {
+			books = append(books, book)
+		}
+	}
+
+	shelfOrder := make(map[string]int, len(l.shelf))
+	for index, filePath := range l.shelf {
+		shelfOrder[filePath] = index
+	}
+	sort.Slice(books, func(i, j int) bool {
+		left, leftOnShelf := shelfOrder[books[i].FilePath]
+		right, rightOnShelf := shelfOrder[books[j].FilePath]
+		if leftOnShelf != rightOnShelf {
+			return leftOnShelf
+		}
+		if left != right {
+			return left < right
+		}
+		return books[i].FilePath < books[j].FilePath
+	})
+	return books
+}
+
+// searchLibrarySegment 在一本书的候选章节中匹配检索词
+func searchLibrarySegment(book libraryIndexBook, segment *libraryIndexSegment, tokens []string, options models.SearchOptions, limit int) []models.LibrarySearchResult {
+	var chapterIndexes []int
+	for index, token := range tokens {
+		indexes := decodeLibraryPostings(segment.Postings[token])
+		if index == 0 {
+			chapterIndexes = indexes
+		} else {
+			chapterIndexes = intersectLibraryPostings(chapterIndexes, indexes)
+		}
+	}
+
+	results := []models.LibrarySearchResult{}
+	limit = min(limit, librarySearchBookLimit)
+	for _, chapterIndex := range chapterIndexes {
+		if chapterIndex >= len(segment.Chapters) || len(results) >= limit {
+			break
+		}
+
+		chapter := segment.Chapters[chapterIndex]
+		options.MaxResults = limit - len(results)
+		matches, err := searchInText(chapter.Text, options)
+		if err != nil {
+			break
+		}
+		for _, match := range matches {
+			results = append(results, models.LibrarySearchResult{
+				FilePath:      book.FilePath,
+				Title:         book.Title,
+				Author:        book.Author,
+				ChapterIndex:  chapter.Index,
+				ChapterTitle:  chapter.Title,
+				Position:      chapter.StartPos + match.Position,
+				ChapterOffset: match.Position,
+				Length:        match.Length,
+				Snippet:       match.Context,
+			})
+		}
+	}
+	return results
+}
+
+func (l *libraryIndex) segmentPath(id int) string {
+	return filepath.Join(l.dir, strconv.Itoa(id)+".seg")
+}
+
+func readLibraryIndexSegment(segmentPath string) (*libraryIndexSegment, error) {
+	var segment libraryIndexSegment
+	if err := readLibraryIndexFile(segmentPath, &segment); err != nil {
+		return nil, err
+	}
+	return &segment, nil
+}
+
+// forEachLibraryToken 把文本切分为索引词：中日文连续的一段文字产生每个单字和相邻两字，
+// 其余字母数字按单词切分并转为小写，标点与空白只作分隔。
+// 检索词中连续的中日文只取相邻两字，只有一个字时取单字
+func forEachLibraryToken(text string, query bool, emit func(token string)) {
+	var cjkRun, word []rune
+	flushCJK := func() {
+		if !query || len(cjkRun) == 1 {
+			for _, char := range cjkRun {
+				emit(string(char))
+			}
+		}
+		for index := 1; index < len(cjkRun); index++ {
+			emit(string(cjkRun[index-1 : index+1]))
+		}
+		cjkRun = cjkRun[:0]
+	}
+	flushWord := func() {
+		if len(word) > 0 && len(word) <= libraryIndexMaxWordRunes {
+			emit(string(word))
+		}
+		word = word[:0]
+	}
+
+	for _, char := range text {
+		switch {
+		case isLibraryCJKRune(char):
+			flushWord()
+			cjkRun = append(cjkRun, char)
+		case isSearchWordRune(char):
+			flushCJK()
+			word = append(word, unicode.ToLower(char))
+		default:
+			flushCJK()
+			flushWord()
+		}
+	}
+	flushCJK()
+	flushWord()
+}
+
+func isLibraryCJKRune(char rune) bool {
+	return unicode.In(char, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
+
+// appendPosting 在词的倒排表末尾追加书籍 ID，id 需大于列表中已有的值；调用方需持有锁
+func (l *libraryIndex) appendPosting(token string, id int) {
+	list := l.postings[token]
+	previous, exists := l.lastIDs[token]
+	if !exists {
+		previous = lastLibraryPosting(list)
+	}
+	l.postings[token] = binary.AppendUvarint(list, uint64(id-previous))
+	l.lastIDs[token] = id
+}
+
+// lastLibraryPosting 按差值编码的升序列表中的最后一个值，空列表为 0
+func lastLibraryPosting(list []byte) int {
+	previous := 0
+	for len(list) > 0 {
+		delta, size := binary.Uvarint(list)
+		if size <= 0 {
+			break
+		}
+		previous += int(delta)
+		list = list[size:]
+	}
+	return previous
+}
+
+func removeLibraryPosting(list []byte, value int) []byte {
+	values := decodeLibraryPostings(list)
+	kept := values[:0]
+	for _, current := range values {
+		if current != value {
+			kept = append(kept, current)
+		}
+	}
+	return encodeLibraryPostings(kept)
+}
+
+func encodeLibraryPostings(values []int) []byte {
+	var list []byte
+	previous := 0
+	for _, value := range values {
+		list = binary.AppendUvarint(list, uint64(value-previous))
+		previous = value
+	}
+	return list
+}
+
+func decodeLibraryPostings(list []byte) []int {
+	var values []int
+	previous := 0
+	for len(list) > 0 {
+		delta, size := binary.Uvarint(list)
+		if size <= 0 {
+			break
+		}
+		previous += int(delta)
+		values = append(values, previous)
+		list = list[size:]
+	}
+	return values
+}
+
+// intersectLibraryPostings 求两个升序列表的交集
+func intersectLibraryPostings(left, right []int) []int {
+	var result []int
+	for i, j := 0, 0; i < len(left) && j < len(right); {
+		switch {
+		case left[i] < right[j]:
+			i++
+		case left[i] > right[j]:
+			j++
+		default:
+			result = append(result, left[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// writeLibraryIndexFile 以 gzip 压缩的 gob 格式写入索引文件
+func writeLibraryIndexFile(filePath string, value any) error {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if err := gob.NewEncoder(writer).Encode(value); err != nil {
+		return fmt.Errorf("序列化书库索引失败: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("压缩书库索引失败: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("创建书库索引目录失败: %w", err)
+	}
+	// 覆盖写入时中断会留下半个文件，下次启动只能整库重建
+	if err := writeFileAtomic(filePath, buffer.Bytes(), 0644); err != nil {
+		return fmt.Errorf("写入书库索引失败: %w", err)
+	}
+	return nil
+}
+
+func readLibraryIndexFile(filePath string, value any) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return gob.NewDecoder(reader).Decode(value)
+}
+
+// SyncLibraryIndex 按书架上的文件列表更新书库索引，新书与有变化的书在后台建索引
+func (s *SearchService) SyncLibraryIndex(filePaths []string) error {
+	return s.libraryIndex.sync(filePaths)
+}
+
+// SearchLibrary 在书架上的所有书中检索，返回书、章节与上下文片段
+func (s *SearchService) SearchLibrary(query string) ([]models.LibrarySearchResult, error) {
+	return s.libraryIndex.search(query)
+}
+
+// GetLibraryIndexStatus 获取书库索引进度
+func (s *SearchService) GetLibraryIndexStatus() models.LibraryIndexStatus {
+	return s.libraryIndex.status()
+}
+
+// SetDataDir 切换书库索引与搜索历史的存储目录
+func (s *SearchService) SetDataDir(dataDir string) error {
+	resolvedDataDir := resolveProgressDataDir(dataDir)
+	if err := s.history.setDataDir(resolvedDataDir); err != nil {
+		return err
+	}
+	return s.libraryIndex.setDataDir(resolvedDataDir)
+}
+
+// emitLibraryIndexStatus 把索引进度推送给前端
+func (s *SearchService) emitLibraryIndexStatus(status models.LibraryIndexStatus) {
+	runtime.EventsEmit(s.ctx, "library:indexProgress", status)
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nongchen1223/moyureader/backend/models"
+)
+
+func TestSearchLibraryIndexesShelfIncrementally(t *testing.T) {
+	bookDir := t.TempDir()
+	chinesePath := filepath.Join(bookDir, "红楼.txt")
+	englishPath := filepath.Join(bookDir, "fox.txt")
+	if err := os.WriteFile(chinesePath, []byte("第一章 进府\n林黛玉进了贾府。\n第二章 相见\n宝玉笑道：Hello World。"), 0644); err != nil {
+		t.Fatalf("write chinese txt: %v", err)
+	}
+	if err := os.WriteFile(englishPath, []byte("The quick brown fox jumps."), 0644); err != nil {
+		t.Fatalf("write english txt: %v", err)
+	}
+
+	progressService := NewProgressService(t.TempDir())
+	service := NewSearchService(progressService)
+	if err := service.SyncLibraryIndex([]string{chinesePath, englishPath}); err != nil {
+		t.Fatalf("SyncLibraryIndex returned error: %v", err)
+	}
+	service.libraryIndex.wait()
+	if status := service.GetLibraryIndexStatus(); status.Total != 2 || status.Indexed != 2 || status.Pending != 0 {
+		t.Fatalf("unexpected index status: %+v", status)
+	}
+
+	search := func(query string) []models.LibrarySearchResult {
+		t.Helper()
+		results, err := service.SearchLibrary(query)
+		if err != nil {
+			t.Fatalf("SearchLibrary(%q) returned error: %v", query, err)
+		}
+		return results
+	}
+
+	results := search("黛玉")
+	if len(results) != 1 || results[0].FilePath != chinesePath || results[0].ChapterIndex != 0 ||
+		results[0].ChapterTitle != "第一章 进府" || !strings.Contains(results[0].Snippet, "林黛玉进了贾府") {
+		t.Fatalf("unexpected CJK results: %+v", results)
+	}
+	if results := search("林"); len(results) != 1 || results[0].Length != 1 {
+		t.Fatalf("single CJK character should be searchable, got %+v", results)
+	}
+	if results := search("hello"); len(results) != 1 || results[0].ChapterIndex != 1 || results[0].ChapterTitle != "第二章 相见" {
+		t.Fatalf("unexpected latin word results: %+v", results)
+	}
+	if results := search("QUICK brown"); len(results) != 1 || results[0].FilePath != englishPath {
+		t.Fatalf("unexpected multi-word results: %+v", results)
+	}
+	if results := search("qui"); len(results) != 0 {
+		t.Fatalf("latin words should match whole words only, got %+v", results)
+	}
+	if _, err := os.Stat(filepath.Join(progressService.currentDataDir(), libraryIndexDirName, libraryIndexFileName)); err != nil {
+		t.Fatalf("index file should be written under the data dir: %v", err)
+	}
+
+	// 修改与删除文件后，同步书架或检索时增量更新
+	if err := os.WriteFile(englishPath, []byte("A lazy dog sleeps all day long."), 0644); err != nil {
+		t.Fatalf("rewrite english txt: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(englishPath, later, later); err != nil {
+		t.Fatalf("touch english txt: %v", err)
+	}
+	if err := service.SyncLibraryIndex([]string{chinesePath, englishPath}); err != nil {
+		t.Fatalf("SyncLibraryIndex returned error: %v", err)
+	}
+	service.libraryIndex.wait()
+	if results := search("quick"); len(results) != 0 {
+		t.Fatalf("stale words should be dropped after reindexing, got %+v", results)
+	}
+	if results := search("lazy"); len(results) != 1 || results[0].FilePath != englishPath {
+		t.Fatalf("changed file should be reindexed, got %+v", results)
+	}
+
+	if err := os.Remove(chinesePath); err != nil {
+		t.Fatalf("remove chinese txt: %v", err)
+	}
+	if results := search("黛玉"); len(results) != 0 {
+		t.Fatalf("removed file should not be returned, got %+v", results)
+	}
+	if status := service.GetLibraryIndexStatus(); status.Indexed != 1 {
+		t.Fatalf("removed file should be dropped from the index, got %+v", status)
+	}
+	if err := service.libraryIndex.close(); err != nil {
+		t.Fatalf("close library index: %v", err)
+	}
+
+	// 重新启动后直接读取已保存的索引
+	reopened := NewSearchService(progressService)
+	results, err := reopened.SearchLibrary("lazy")
+	if err != nil || len(results) != 1 || results[0].FilePath != englishPath {
+		t.Fatalf("saved index should be reused, got %+v, %v", results, err)
+	}
+}
+
+func TestWriteLibraryIndexFileReplacesInsteadOfOverwriting(t *testing.T) {
+	indexPath := filepath.Join(t.TempDir(), libraryIndexFileName)
+	if err := writeLibraryIndexFile(indexPath, libraryIndexData{Version: libraryIndexVersion, NextID: 1}); err != nil {
+		t.Fatalf("writeLibraryIndexFile returned error: %v", err)
+	}
+	// 原地覆盖写入会改动同一个文件，硬链接能看出旧文件是否被改写
+	keptPath := indexPath + ".kept"
+	if err := os.Link(indexPath, keptPath); err != nil {
+		t.Skipf("hard links unsupported: %v", err)
+	}
+
+	if err := writeLibraryIndexFile(indexPath, libraryIndexData{Version: libraryIndexVersion, NextID: 7}); err != nil {
+		t.Fatalf("writeLibraryIndexFile returned error: %v", err)
+	}
+	var kept, current libraryIndexData
+	if err := readLibraryIndexFile(keptPath, &kept); err != nil || kept.NextID != 1 {
+		t.Fatalf("expected the previous file to stay intact, got %+v, %v", kept, err)
+	}
+	if err := readLibraryIndexFile(indexPath, &current); err != nil || current.NextID != 7 {
+		t.Fatalf("expected the new index to be in place, got %+v, %v", current, err)
+	}
+	if leftovers, _ := filepath.Glob(indexPath + ".tmp-*"); len(leftovers) != 0 {
+		t.Fatalf("expected no temp files to be left behind, got %v", leftovers)
+	}
+}
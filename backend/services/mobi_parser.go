@@ -0,0 +1,1245 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	stdhtml "html"
+	"math/bits"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// MOBI / AZW3 解析流程：
+// PalmDB 记录表 → 记录 0 中的 PalmDOC、MOBI、EXTH 头 → 解压文本记录 →
+// KF8 按骨架（SKEL）和片段（FRAG）索引重组为多个 HTML 文件，MOBI6 则是单个 HTML 文档。
+// 目录来自 NCX 索引，定位到的原始偏移处插入锚点后交给 EPUB 的分章流程。
+
+const (
+	mobiNoIndex = 0xFFFFFFFF
+
+	mobiCompressionNone     = 1
+	mobiCompressionPalmDOC  = 2
+	mobiCompressionHuffCDIC = 17480
+
+	mobiTextEncodingCP1252 = 1252
+
+	mobiEXTHAuthor      = 100
+	mobiEXTHCoverOffset = 201
+	mobiEXTHKF8Boundary = 121
+	mobiEXTHTitle       = 503
+
+	mobiHuffMaxDepth  = 32
+	mobiTOCAnchorName = "moyu-mobi-toc-%d"
+)
+
+var errMobiDRMProtected = errors.New("该电子书受 DRM 保护，无法打开，请先使用 Kindle 官方工具或原购买渠道获取无 DRM 版本")
+
+var (
+	mobiRecindexPattern  = regexp.MustCompile(`(?i)recindex\s*=\s*["']?0*(\d+)["']?`)
+	mobiGuideTOCPattern  = regexp.MustCompile(`(?is)<reference[^>]*type\s*=\s*["']?toc["']?[^>]*>`)
+	mobiFileposPattern   = regexp.MustCompile(`(?i)filepos\s*=\s*["']?0*(\d+)`)
+	mobiFileposLinkRegex = regexp.MustCompile(`(?is)<a[^>]*filepos\s*=\s*["']?0*(\d+)["']?[^>]*>(.*?)</a>`)
+	mobiPagebreakPattern = regexp.MustCompile(`(?i)<mbp:pagebreak[^>]*>`)
+)
+
+// palmDatabase PalmDB 容器，MOBI 文件的所有内容都按记录存放
+type palmDatabase struct {
+	data    []byte
+	offsets []int
+}
+
+func readPalmDatabase(data []byte) (*palmDatabase, error) {
+	if len(data) < 78 {
+		return nil, fmt.Errorf("文件过小，不是有效的 MOBI 文件")
+	}
+	if bytes.HasPrefix(data, []byte("TPZ")) {
+		return nil, fmt.Errorf("暂不支持 Topaz 格式的 AZW 文件")
+	}
+
+	fileType := string(data[60:68])
+	if fileType != "BOOKMOBI" && fileType != "TEXtREAd" {
+		return nil, fmt.Errorf("不是有效的 MOBI 文件: 未知类型 %q", fileType)
+	}
+
+	recordCount := int(binary.BigEndian.Uint16(data[76:78]))
+	if recordCount == 0 || len(data) < 78+recordCount*8 {
+		return nil, fmt.Errorf("MOBI 记录表损坏")
+	}
+
+	offsets := make([]int, recordCount)
+	for index := range offsets {
+		offsets[index] = int(binary.BigEndian.Uint32(data[78+index*8:]))
+		if offsets[index] > len(data) || (index > 0 && offsets[index] < offsets[index-1]) {
+			return nil, fmt.Errorf("MOBI 记录表损坏")
+		}
+	}
+
+	return &palmDatabase{data: data, offsets: offsets}, nil
+}
+
+func (db *palmDatabase) recordCount() int {
+	return len(db.offsets)
+}
+
+// record 返回指定记录的内容，索引无效时返回 nil
+func (db *palmDatabase) record(index int) []byte {
+	if index < 0 || index >= len(db.offsets) {
+		return nil
+	}
+
+	end := len(db.data)
+	if index+1 < len(db.offsets) {
+		end = db.offsets[index+1]
+	}
+	return db.data[db.offsets[index]:end]
+}
+
+// mobiHeader 记录 0 中与解析相关的 PalmDOC / MOBI 头字段
+// 各索引均已换算为 PalmDB 中的绝对记录号
+type mobiHeader struct {
+	base             int
+	compression      int
+	textLength       int
+	textRecordCount  int
+	encryption       int
+	hasMOBIHeader    bool
+	textEncoding     int
+	fileVersion      int
+	fullName         string
+	firstImageIndex  int
+	huffRecordIndex  int
+	huffRecordCount  int
+	hasEXTH          bool
+	exthOffset       int
+	extraDataFlags   int
+	fdstIndex        int
+	ncxIndex         int
+	fragmentIndex    int
+	skeletonIndex    int
+	fullNameOffset   int
+	fullNameLength   int
+	mobiHeaderLength int
+}
+
+func readMobiHeader(record []byte, base int) (*mobiHeader, error) {
+	if len(record) < 16 {
+		return nil, fmt.Errorf("MOBI 头信息损坏")
+	}
+
+	header := &mobiHeader{
+		base:            base,
+		compression:     int(readMobiUint16(record, 0)),
+		textLength:      int(readMobiUint32(record, 4)),
+		textRecordCount: int(readMobiUint16(record, 8)),
+		encryption:      int(readMobiUint16(record, 12)),
+		textEncoding:    mobiTextEncodingCP1252,
+		firstImageIndex: -1,
+		huffRecordIndex: -1,
+		fdstIndex:       -1,
+		ncxIndex:        -1,
+		fragmentIndex:   -1,
+		skeletonIndex:   -1,
+	}
+
+	if len(record) < 24 || string(record[16:20]) != "MOBI" {
+		return header, nil
+	}
+
+	header.hasMOBIHeader = true
+	header.mobiHeaderLength = int(readMobiUint32(record, 20))
+	headerEnd := minInt(16+header.mobiHeaderLength, len(record))
+	field := func(offset int) (uint32, bool) {
+		if offset+4 > headerEnd {
+			return 0, false
+		}
+		return readMobiUint32(record, offset), true
+	}
+	// 记录号字段相对本头所在记录，KF8 合并文件中需加上分界偏移
+	recordField := func(offset int) int {
+		value, ok := field(offset)
+		if !ok || value == mobiNoIndex {
+			return -1
+		}
+		return base + int(value)
+	}
+
+	if value, ok := field(0x1C); ok {
+		header.textEncoding = int(value)
+	}
+	if value, ok := field(0x24); ok {
+		header.fileVersion = int(value)
+	}
+	if value, ok := field(0x54); ok {
+		header.fullNameOffset = int(value)
+	}
+	if value, ok := field(0x58); ok {
+		header.fullNameLength = int(value)
+	}
+	if value, ok := field(0x6C); ok && value != mobiNoIndex {
+		header.firstImageIndex = base + int(value)
+	}
+	header.huffRecordIndex = recordField(0x70)
+	if value, ok := field(0x74); ok {
+		header.huffRecordCount = int(value)
+	}
+	if value, ok := field(0x80); ok {
+		header.hasEXTH = value&0x40 != 0
+		header.exthOffset = 16 + header.mobiHeaderLength
+	}
+	if 0xF4 <= headerEnd {
+		header.extraDataFlags = int(readMobiUint16(record, 0xF2))
+	}
+	header.ncxIndex = recordField(0xF4)
+	if header.fileVersion >= 8 {
+		header.fdstIndex = recordField(0xC0)
+		header.fragmentIndex = recordField(0xF8)
+		header.skeletonIndex = recordField(0xFC)
+	}
+
+	if header.fullNameLength > 0 && header.fullNameOffset+header.fullNameLength <= len(record) {
+		nameBytes := record[header.fullNameOffset : header.fullNameOffset+header.fullNameLength]
+		header.fullName = strings.TrimSpace(decodeMobiText(nameBytes, header.textEncoding))
+	}
+
+	return header, nil
+}
+
+func (h *mobiHeader) isKF8() bool {
+	return h.fileVersion >= 8 && h.skeletonIndex >= 0
+}
+
+// mobiEXTH EXTH 扩展头中的书籍元数据
+type mobiEXTH struct {
+	title       string
+	authors     []string
+	coverOffset int
+	kf8Boundary int
+}
+
+func readMobiEXTH(record []byte, header *mobiHeader) mobiEXTH {
+	exth := mobiEXTH{coverOffset: -1, kf8Boundary: -1}
+	if !header.hasEXTH || header.exthOffset+12 > len(record) {
+		return exth
+	}
+	if string(record[header.exthOffset:header.exthOffset+4]) != "EXTH" {
+		return exth
+	}
+
+	count := int(readMobiUint32(record, header.exthOffset+8))
+	position := header.exthOffset + 12
+	for index := 0; index < count && position+8 <= len(record); index++ {
+		recordType := readMobiUint32(record, position)
+		size := int(readMobiUint32(record, position+4))
+		if size < 8 || position+size > len(record) {
+			break
+		}
+		value := record[position+8 : position+size]
+		position += size
+
+		switch recordType {
+		case mobiEXTHAuthor:
+			if author := strings.TrimSpace(decodeMobiText(value, header.textEncoding)); author != "" {
+				exth.authors = append(exth.authors, author)
+			}
+		case mobiEXTHTitle:
+			exth.title = strings.TrimSpace(decodeMobiText(value, header.textEncoding))
+		case mobiEXTHCoverOffset:
+			if len(value) >= 4 && binary.BigEndian.Uint32(value) != mobiNoIndex {
+				exth.coverOffset = int(binary.BigEndian.Uint32(value))
+			}
+		case mobiEXTHKF8Boundary:
+			if len(value) >= 4 && binary.BigEndian.Uint32(value) != mobiNoIndex {
+				exth.kf8Boundary = int(binary.BigEndian.Uint32(value))
+			}
+		}
+	}
+
+	return exth
+}
+
+// mobiBook 解析后的 MOBI 书籍，documentNames 为阅读顺序
+type mobiBook struct {
+	title           string
+	author          string
+	db              *palmDatabase
+	firstImageIndex int
+	coverOffset     int
+	documentNames   []string
+	documents       map[string]string
+	tocEntries      []epubTOCEntry
+}
+
+// parseMobiBook 解析 MOBI / AZW3 文件内容
+func parseMobiBook(data []byte) (*mobiBook, error) {
+	db, err := readPalmDatabase(data)
+	if err != nil {
+		return nil, err
+	}
+
+	record0 := db.record(0)
+	header, err := readMobiHeader(record0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if header.encryption != 0 {
+		return nil, errMobiDRMProtected
+	}
+
+	exth := readMobiEXTH(record0, header)
+	book := &mobiBook{
+		title:           exth.title,
+		author:          strings.Join(exth.authors, "、"),
+		db:              db,
+		firstImageIndex: header.firstImageIndex,
+		coverOffset:     exth.coverOffset,
+		documents:       make(map[string]string),
+	}
+	if book.title == "" {
+		book.title = header.fullName
+	}
+	if book.title == "" {
+		book.title = strings.TrimSpace(strings.TrimRight(string(data[:32]), "\x00"))
+	}
+
+	// MOBI6 + KF8 合并文件优先使用 KF8 部分，图片等资源两部分共用
+	textHeader := header
+	if !header.isKF8() && exth.kf8Boundary > 0 && exth.kf8Boundary < db.recordCount() {
+		kf8Header, err := readMobiHeader(db.record(exth.kf8Boundary), exth.kf8Boundary)
+		if err == nil && kf8Header.isKF8() {
+			if kf8Header.encryption != 0 {
+				return nil, errMobiDRMProtected
+			}
+			textHeader = kf8Header
+		}
+	}
+
+	text, err := readMobiText(db, textHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []mobiPart
+	if textHeader.isKF8() {
+		parts, err = readKF8Parts(db, textHeader, text)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		parts = []mobiPart{{markup: text, segments: []mobiSegment{{rawStart: 0, length: len(text)}}}}
+	}
+
+	entries := readMobiNCX(db, textHeader)
+	if len(entries) == 0 && !textHeader.isKF8() {
+		entries = readMobiGuideTOC(text, textHeader.textEncoding)
+	}
+	if len(entries) == 0 && !textHeader.isKF8() {
+		parts = splitMobiPartAtPagebreaks(parts[0])
+	}
+
+	tocPositions := make([][]mobiTOCAnchor, len(parts))
+	for index, entry := range entries {
+		partIndex, offset, ok := locateMobiRawPosition(parts, entry.pos)
+		if !ok {
+			continue
+		}
+		tocPositions[partIndex] = append(tocPositions[partIndex], mobiTOCAnchor{
+			id:     fmt.Sprintf(mobiTOCAnchorName, index),
+			offset: offset,
+			entry:  entry,
+		})
+	}
+
+	for partIndex, part := range parts {
+		name := fmt.Sprintf("part%04d.html", partIndex)
+		markup := insertMobiTOCAnchors(part.markup, tocPositions[partIndex])
+		if !textHeader.isKF8() {
+			markup = mobiRecindexPattern.ReplaceAll(markup, []byte(`src="recindex:$1"`))
+		}
+
+		book.documentNames = append(book.documentNames, name)
+		book.documents[name] = decodeMobiText(markup, textHeader.textEncoding)
+		for _, anchor := range tocPositions[partIndex] {
+			book.tocEntries = append(book.tocEntries, epubTOCEntry{
+				Title:    anchor.entry.title,
+				Path:     name,
+				Fragment: anchor.fragment,
+				Level:    anchor.entry.level,
+			})
+		}
+	}
+
+	return book, nil
+}
+
+// readDocument 与 extractContent 让 mobiBook 可直接交给 EPUB 分章流程
+func (b *mobiBook) readDocument(documentPath string) (string, error) {
+	markup, exists := b.documents[documentPath]
+	if !exists {
+		return "", fmt.Errorf("文件不存在: %s", documentPath)
+	}
+	return markup, nil
+}
+
+func (b *mobiBook) extractContent(markup, documentPath string) (string, string, string) {
+	return extractRichChapterContent(markup, b.resolveAsset)
+}
+
+// resolveAsset 将 MOBI6 的 recindex 和 KF8 的 kindle:embed 引用转换为 data URL
+func (b *mobiBook) resolveAsset(reference string) (string, error) {
+	resourceNumber := parseMobiResourceReference(reference)
+	if resourceNumber <= 0 {
+		return "", nil
+	}
+	return b.resourceDataURL(resourceNumber - 1)
+}
+
+func (b *mobiBook) coverDataURL() string {
+	if b.coverOffset < 0 {
+		return ""
+	}
+	dataURL, err := b.resourceDataURL(b.coverOffset)
+	if err != nil {
+		return ""
+	}
+	return dataURL
+}
+
+func (b *mobiBook) resourceDataURL(offset int) (string, error) {
+	if b.firstImageIndex < 0 || offset < 0 {
+		return "", nil
+	}
+
+	data := b.db.record(b.firstImageIndex + offset)
+	mediaType := detectMobiImageType(data)
+	if mediaType == "" {
+		return "", nil
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mediaType, base64.StdEncoding.EncodeToString(data)), nil
+}
+
+// parseMobiResourceReference 解析图片引用中的资源序号（从 1 开始）
+// kindle:embed 使用 0-9A-V 的 32 进制编号
+func parseMobiResourceReference(reference string) int {
+	reference = strings.TrimSpace(reference)
+	lowerReference := strings.ToLower(reference)
+	switch {
+	case strings.HasPrefix(lowerReference, "recindex:"):
+		value, err := strconv.Atoi(reference[len("recindex:"):])
+		if err != nil {
+			return 0
+		}
+		return value
+	case strings.HasPrefix(lowerReference, "kindle:embed:"):
+		code := reference[len("kindle:embed:"):]
+		if end := strings.IndexAny(code, "?#"); end >= 0 {
+			code = code[:end]
+		}
+		value, err := strconv.ParseInt(code, 32, 32)
+		if err != nil {
+			return 0
+		}
+		return int(value)
+	default:
+		return 0
+	}
+}
+
+func detectMobiImageType(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return "image/jpeg"
+	case bytes.HasPrefix(data, []byte("\x89PNG")):
+		return "image/png"
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		return "image/gif"
+	case bytes.HasPrefix(data, []byte("BM")) && len(data) > 14:
+		return "image/bmp"
+	default:
+		return ""
+	}
+}
+
+func decodeMobiText(data []byte, textEncoding int) string {
+	if textEncoding == mobiTextEncodingCP1252 {
+		decoded, err := charmap.Windows1252.NewDecoder().Bytes(data)
+		if err == nil {
+			return string(decoded)
+		}
+	}
+	return strings.ToValidUTF8(string(data), "�")
+}
+
+// readMobiText 依次解压全部文本记录
+func readMobiText(db *palmDatabase, header *mobiHeader) ([]byte, error) {
+	var huff *mobiHuffCDIC
+	switch header.compression {
+	case mobiCompressionNone, mobiCompressionPalmDOC:
+	case mobiCompressionHuffCDIC:
+		records := make([][]byte, 0, header.huffRecordCount)
+		for index := 0; index < header.huffRecordCount; index++ {
+			records = append(records, db.record(header.huffRecordIndex+index))
+		}
+		var err error
+		huff, err = newMobiHuffCDIC(records)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("不支持的 MOBI 压缩方式: %d", header.compression)
+	}
+
+	var text bytes.Buffer
+	for index := 1; index <= header.textRecordCount; index++ {
+		record := db.record(header.base + index)
+		if record == nil {
+			return nil, fmt.Errorf("MOBI 文本记录缺失: %d", header.base+index)
+		}
+		trailingSize, err := mobiTrailingEntriesSize(record, header.extraDataFlags)
+		if err != nil {
+			return nil, fmt.Errorf("读取 MOBI 文本记录 %d 失败: %w", header.base+index, err)
+		}
+		record = record[:len(record)-trailingSize]
+
+		switch header.compression {
+		case mobiCompressionNone:
+			text.Write(record)
+		case mobiCompressionPalmDOC:
+			text.Write(decompressPalmDOC(record))
+		case mobiCompressionHuffCDIC:
+			decompressed, err := huff.decompress(record, 0)
+			if err != nil {
+				return nil, err
+			}
+			text.Write(decompressed)
+		}
+	}
+
+	result := text.Bytes()
+	if header.textLength > 0 && len(result) > header.textLength {
+		result = result[:header.textLength]
+	}
+	return result, nil
+}
+
+// mobiTrailingEntriesSize 计算文本记录末尾附加数据的长度，解压前需要去掉；
+// 长度超出记录剩余部分时说明记录已损坏
+func mobiTrailingEntriesSize(record []byte, flags int) (int, error) {
+	size := 0
+	for entryFlags := flags >> 1; entryFlags != 0; entryFlags >>= 1 {
+		if entryFlags&1 == 0 {
+			continue
+		}
+		if size >= len(record) {
+			return 0, fmt.Errorf("MOBI 文本记录末尾数据损坏")
+		}
+		// 长度值包含其自身所占的字节，至少为 1
+		entrySize := readMobiBackwardVarint(record[:len(record)-size])
+		if entrySize <= 0 || entrySize > len(record)-size {
+			return 0, fmt.Errorf("MOBI 文本记录末尾数据损坏")
+		}
+		size += entrySize
+	}
+	if flags&1 != 0 {
+		if size >= len(record) {
+			return 0, fmt.Errorf("MOBI 文本记录末尾数据损坏")
+		}
+		multibyteSize := int(record[len(record)-size-1]&0x3) + 1
+		if multibyteSize > len(record)-size {
+			return 0, fmt.Errorf("MOBI 文本记录末尾数据损坏")
+		}
+		size += multibyteSize
+	}
+	return size, nil
+}
+
+func readMobiBackwardVarint(data []byte) int {
+	value := 0
+	shift := 0
+	for index := len(data) - 1; index >= 0; index-- {
+		current := data[index]
+		value |= int(current&0x7F) << shift
+		shift += 7
+		if current&0x80 != 0 || shift >= 28 {
+			break
+		}
+	}
+	return value
+}
+
+func readMobiForwardVarint(data []byte, offset int) (uint32, int) {
+	value := uint32(0)
+	consumed := 0
+	for offset+consumed < len(data) {
+		current := data[offset+consumed]
+		consumed++
+		value = value<<7 | uint32(current&0x7F)
+		if current&0x80 != 0 {
+			break
+		}
+	}
+	return value, consumed
+}
+
+// decompressPalmDOC 解压 PalmDOC（LZ77 变体）压缩的文本记录
+func decompressPalmDOC(data []byte) []byte {
+	output := make([]byte, 0, len(data)*2)
+	for index := 0; index < len(data); {
+		current := data[index]
+		index++
+
+		switch {
+		case current == 0 || (current >= 0x09 && current <= 0x7F):
+			output = append(output, current)
+		case current <= 0x08:
+			end := minInt(index+int(current), len(data))
+			output = append(output, data[index:end]...)
+			index = end
+		case current <= 0xBF:
+			if index >= len(data) {
+				return output
+			}
+			pair := int(current)<<8 | int(data[index])
+			index++
+			distance := (pair >> 3) & 0x7FF
+			length := pair&0x07 + 3
+			if distance == 0 || distance > len(output) {
+				continue
+			}
+			// 回溯区间可能与输出重叠，需要逐字节复制
+			for copied := 0; copied < length; copied++ {
+				output = append(output, output[len(output)-distance])
+			}
+		default:
+			output = append(output, ' ', current^0x80)
+		}
+	}
+	return output
+}
+
+type mobiHuffCode struct {
+	codeLength int
+	terminal   bool
+	maxCode    uint64
+}
+
+type mobiHuffPhrase struct {
+	data     []byte
+	resolved bool
+	pending  bool
+}
+
+// mobiHuffCDIC HUFF/CDIC 压缩的码表和短语字典
+type mobiHuffCDIC struct {
+	codes      [256]mobiHuffCode
+	minCodes   [33]uint64
+	maxCodes   [33]uint64
+	dictionary []mobiHuffPhrase
+}
+
+func newMobiHuffCDIC(records [][]byte) (*mobiHuffCDIC, error) {
+	if len(records) == 0 || len(records[0]) < 24 || string(records[0][:8]) != "HUFF\x00\x00\x00\x18" {
+		return nil, fmt.Errorf("MOBI 的 HUFF 码表损坏")
+	}
+
+	huff := records[0]
+	codeTableOffset := int(readMobiUint32(huff, 8))
+	rangeTableOffset := int(readMobiUint32(huff, 12))
+	if codeTableOffset+256*4 > len(huff) || rangeTableOffset+64*4 > len(huff) {
+		return nil, fmt.Errorf("MOBI 的 HUFF 码表损坏")
+	}
+
+	decoder := &mobiHuffCDIC{}
+	for index := range decoder.codes {
+		value := readMobiUint32(huff, codeTableOffset+index*4)
+		codeLength := int(value & 0x1F)
+		if codeLength == 0 {
+			return nil, fmt.Errorf("MOBI 的 HUFF 码表损坏")
+		}
+		decoder.codes[index] = mobiHuffCode{
+			codeLength: codeLength,
+			terminal:   value&0x80 != 0,
+			maxCode:    ((uint64(value>>8) + 1) << (32 - codeLength)) - 1,
+		}
+	}
+
+	decoder.maxCodes[0] = (1 << 32) - 1
+	for codeLength := 1; codeLength <= 32; codeLength++ {
+		minCode := uint64(readMobiUint32(huff, rangeTableOffset+(codeLength-1)*8))
+		maxCode := uint64(readMobiUint32(huff, rangeTableOffset+(codeLength-1)*8+4))
+		decoder.minCodes[codeLength] = minCode << (32 - codeLength)
+		decoder.maxCodes[codeLength] = ((maxCode + 1) << (32 - codeLength)) - 1
+	}
+
+	for _, cdic := range records[1:] {
+		if len(cdic) < 16 || string(cdic[:8]) != "CDIC\x00\x00\x00\x10" {
+			return nil, fmt.Errorf("MOBI 的 CDIC 字典损坏")
+		}
+
+		phraseCount := int(readMobiUint32(cdic, 8))
+		bitCount := int(readMobiUint32(cdic, 12))
+		count := minInt(1<<minInt(bitCount, 16), phraseCount-len(decoder.dictionary))
+		for index := 0; index < count; index++ {
+			offset := 16 + int(readMobiUint16(cdic, 16+index*2))
+			if offset+2 > len(cdic) {
+				return nil, fmt.Errorf("MOBI 的 CDIC 字典损坏")
+			}
+			phraseHeader := int(readMobiUint16(cdic, offset))
+			end := minInt(offset+2+phraseHeader&0x7FFF, len(cdic))
+			decoder.dictionary = append(decoder.dictionary, mobiHuffPhrase{
+				data:     cdic[offset+2 : end],
+				resolved: phraseHeader&0x8000 != 0,
+			})
+		}
+	}
+
+	return decoder, nil
+}
+
+// decompress 解码一段 HUFF/CDIC 数据，短语本身可能仍是压缩数据，需要递归展开
+func (d *mobiHuffCDIC) decompress(data []byte, depth int) ([]byte, error) {
+	if depth > mobiHuffMaxDepth {
+		return nil, fmt.Errorf("MOBI 的 HUFF 数据嵌套过深")
+	}
+
+	bitsLeft := len(data) * 8
+	padded := append(append([]byte(nil), data...), make([]byte, 8)...)
+	position := 0
+	buffer := binary.BigEndian.Uint64(padded)
+	available := 32
+	var output []byte
+
+	for {
+		if available <= 0 {
+			position += 4
+			buffer = binary.BigEndian.Uint64(padded[position:])
+			available += 32
+		}
+
+		code := (buffer >> uint(available)) & 0xFFFFFFFF
+		entry := d.codes[code>>24]
+		codeLength := entry.codeLength
+		maxCode := entry.maxCode
+		if !entry.terminal {
+			for codeLength < 32 && code < d.minCodes[codeLength] {
+				codeLength++
+			}
+			maxCode = d.maxCodes[codeLength]
+		}
+
+		available -= codeLength
+		bitsLeft -= codeLength
+		if bitsLeft < 0 {
+			break
+		}
+
+		phraseIndex := int((maxCode - code) >> (32 - codeLength))
+		if phraseIndex < 0 || phraseIndex >= len(d.dictionary) {
+			return nil, fmt.Errorf("MOBI 的 HUFF 数据损坏")
+		}
+
+		phrase := &d.dictionary[phraseIndex]
+		if !phrase.resolved {
+			if phrase.pending {
+				return nil, fmt.Errorf("MOBI 的 HUFF 数据损坏")
+			}
+			phrase.pending = true
+			expanded, err := d.decompress(phrase.data, depth+1)
+			phrase.pending = false
+			if err != nil {
+				return nil, err
+			}
+			phrase.data = expanded
+			phrase.resolved = true
+		}
+		output = append(output, phrase.data...)
+	}
+
+	return output, nil
+}
+
+// mobiIndexEntry INDX 索引中的一条记录
+type mobiIndexEntry struct {
+	label string
+	tags  map[byte][]uint32
+}
+
+type mobiTagDefinition struct {
+	tag            byte
+	valuesPerEntry int
+	mask           byte
+	endFlag        byte
+}
+
+// readMobiIndex 读取 INDX 索引，返回条目和 CTOC 字符串表（按偏移索引）
+func readMobiIndex(db *palmDatabase, indexRecord int) ([]mobiIndexEntry, map[int]string, error) {
+	mainRecord := db.record(indexRecord)
+	if len(mainRecord) < 56 || string(mainRecord[:4]) != "INDX" {
+		return nil, nil, fmt.Errorf("MOBI 索引损坏")
+	}
+
+	headerLength := int(readMobiUint32(mainRecord, 4))
+	dataRecordCount := int(readMobiUint32(mainRecord, 24))
+	ctocRecordCount := int(readMobiUint32(mainRecord, 52))
+
+	ctoc := make(map[int]string)
+	for index := 0; index < ctocRecordCount; index++ {
+		for offset, text := range readMobiCTOC(db.record(indexRecord + dataRecordCount + 1 + index)) {
+			ctoc[offset+index*0x10000] = text
+		}
+	}
+
+	controlByteCount, tagTable := readMobiTagSection(mainRecord, headerLength)
+	entries := []mobiIndexEntry{}
+	for recordIndex := indexRecord + 1; recordIndex <= indexRecord+dataRecordCount; recordIndex++ {
+		data := db.record(recordIndex)
+		if len(data) < 28 || string(data[:4]) != "INDX" {
+			return nil, nil, fmt.Errorf("MOBI 索引损坏")
+		}
+
+		idxtOffset := int(readMobiUint32(data, 20))
+		entryCount := int(readMobiUint32(data, 24))
+		if idxtOffset+4+entryCount*2 > len(data) {
+			return nil, nil, fmt.Errorf("MOBI 索引损坏")
+		}
+
+		positions := make([]int, 0, entryCount+1)
+		for index := 0; index < entryCount; index++ {
+			positions = append(positions, int(readMobiUint16(data, idxtOffset+4+index*2)))
+		}
+		positions = append(positions, idxtOffset)
+
+		for index := 0; index < entryCount; index++ {
+			start, end := positions[index], positions[index+1]
+			if start >= end || end > len(data) {
+				continue
+			}
+			labelLength := int(data[start])
+			labelEnd := minInt(start+1+labelLength, end)
+			entries = append(entries, mobiIndexEntry{
+				label: string(data[start+1 : labelEnd]),
+				tags:  readMobiTagMap(controlByteCount, tagTable, data, labelEnd, end),
+			})
+		}
+	}
+
+	return entries, ctoc, nil
+}
+
+func readMobiCTOC(data []byte) map[int]string {
+	texts := make(map[int]string)
+	for offset := 0; offset < len(data) && data[offset] != 0; {
+		length, consumed := readMobiForwardVarint(data, offset)
+		start := offset + consumed
+		end := minInt(start+int(length), len(data))
+		texts[offset] = string(data[start:end])
+		offset = end
+	}
+	return texts
+}
+
+func readMobiTagSection(data []byte, start int) (int, []mobiTagDefinition) {
+	if start+12 > len(data) || string(data[start:start+4]) != "TAGX" {
+		return 0, nil
+	}
+
+	sectionLength := int(readMobiUint32(data, start+4))
+	controlByteCount := int(readMobiUint32(data, start+8))
+	definitions := []mobiTagDefinition{}
+	for offset := start + 12; offset+4 <= start+sectionLength && offset+4 <= len(data); offset += 4 {
+		definitions = append(definitions, mobiTagDefinition{
+			tag:            data[offset],
+			valuesPerEntry: int(data[offset+1]),
+			mask:           data[offset+2],
+			endFlag:        data[offset+3],
+		})
+	}
+	return controlByteCount, definitions
+}
+
+// readMobiTagMap 按 TAGX 定义解析条目的控制字节和变长整数值
+func readMobiTagMap(
+	controlByteCount int,
+	tagTable []mobiTagDefinition,
+	data []byte,
+	start int,
+	end int,
+) map[byte][]uint32 {
+	type pendingTag struct {
+		tag            byte
+		valueCount     int
+		valueBytes     int
+		valuesPerEntry int
+	}
+
+	pending := []pendingTag{}
+	controlByteIndex := 0
+	dataStart := start + controlByteCount
+	for _, definition := range tagTable {
+		if definition.endFlag == 0x01 {
+			controlByteIndex++
+			continue
+		}
+		if start+controlByteIndex >= end {
+			break
+		}
+
+		mask := definition.mask
+		value := data[start+controlByteIndex] & mask
+		if value == 0 {
+			continue
+		}
+
+		if value == mask {
+			if bits.OnesCount8(mask) > 1 {
+				// 掩码各位全部置位时，实际值的字节数以变长整数形式跟在控制字节之后
+				valueBytes, consumed := readMobiForwardVarint(data[:end], dataStart)
+				dataStart += consumed
+				pending = append(pending, pendingTag{tag: definition.tag, valueCount: -1, valueBytes: int(valueBytes), valuesPerEntry: definition.valuesPerEntry})
+			} else {
+				pending = append(pending, pendingTag{tag: definition.tag, valueCount: 1, valuesPerEntry: definition.valuesPerEntry})
+			}
+			continue
+		}
+
+		for mask&0x01 == 0 {
+			mask >>= 1
+			value >>= 1
+		}
+		pending = append(pending, pendingTag{tag: definition.tag, valueCount: int(value), valuesPerEntry: definition.valuesPerEntry})
+	}
+
+	tags := make(map[byte][]uint32, len(pending))
+	for _, item := range pending {
+		values := []uint32{}
+		if item.valueCount >= 0 {
+			for index := 0; index < item.valueCount*item.valuesPerEntry && dataStart < end; index++ {
+				value, consumed := readMobiForwardVarint(data[:end], dataStart)
+				dataStart += consumed
+				values = append(values, value)
+			}
+		} else {
+			for consumedTotal := 0; consumedTotal < item.valueBytes && dataStart < end; {
+				value, consumed := readMobiForwardVarint(data[:end], dataStart)
+				dataStart += consumed
+				consumedTotal += consumed
+				values = append(values, value)
+			}
+		}
+		tags[item.tag] = values
+	}
+	return tags
+}
+
+// mobiSegment 原始文本中的一段在重组后 HTML 文件里的位置
+type mobiSegment struct {
+	rawStart int
+	length   int
+	offset   int
+}
+
+// mobiPart 重组后的一个 HTML 文件
+type mobiPart struct {
+	markup   []byte
+	segments []mobiSegment
+}
+
+type kf8Skeleton struct {
+	fragmentCount int
+	start         int
+	length        int
+}
+
+type kf8Fragment struct {
+	insertPos int
+	length    int
+}
+
+// readKF8Parts 读取 FDST、骨架和片段索引，将主文本流重组为 HTML 文件
+func readKF8Parts(db *palmDatabase, header *mobiHeader, text []byte) ([]mobiPart, error) {
+	flow := text
+	if fdst := db.record(header.fdstIndex); len(fdst) >= 12 && string(fdst[:4]) == "FDST" {
+		if flowCount := int(readMobiUint32(fdst, 8)); flowCount > 1 {
+			flowEnd := int(readMobiUint32(fdst, 12+8))
+			if flowEnd > 0 && flowEnd <= len(text) {
+				flow = text[:flowEnd]
+			}
+		}
+	}
+
+	skeletonEntries, _, err := readMobiIndex(db, header.skeletonIndex)
+	if err != nil {
+		return nil, fmt.Errorf("读取 KF8 骨架索引失败: %w", err)
+	}
+	skeletons := make([]kf8Skeleton, 0, len(skeletonEntries))
+	for _, entry := range skeletonEntries {
+		fragmentCount := entry.tags[1]
+		position := entry.tags[6]
+		if len(fragmentCount) < 1 || len(position) < 2 {
+			return nil, fmt.Errorf("KF8 骨架索引损坏")
+		}
+		skeletons = append(skeletons, kf8Skeleton{
+			fragmentCount: int(fragmentCount[0]),
+			start:         int(position[0]),
+			length:        int(position[1]),
+		})
+	}
+
+	fragments := []kf8Fragment{}
+	if header.fragmentIndex >= 0 {
+		fragmentEntries, _, err := readMobiIndex(db, header.fragmentIndex)
+		if err != nil {
+			return nil, fmt.Errorf("读取 KF8 片段索引失败: %w", err)
+		}
+		for _, entry := range fragmentEntries {
+			insertPos, err := strconv.Atoi(strings.TrimSpace(entry.label))
+			position := entry.tags[6]
+			if err != nil || len(position) < 2 {
+				return nil, fmt.Errorf("KF8 片段索引损坏")
+			}
+			fragments = append(fragments, kf8Fragment{insertPos: insertPos, length: int(position[1])})
+		}
+	}
+
+	return assembleKF8Parts(flow, skeletons, fragments), nil
+}
+
+// assembleKF8Parts 将片段依次插入骨架，片段正文紧跟在所属骨架之后
+// 同时记录每段原始文本在结果中的位置，供目录偏移换算使用
+func assembleKF8Parts(text []byte, skeletons []kf8Skeleton, fragments []kf8Fragment) []mobiPart {
+	parts := make([]mobiPart, 0, len(skeletons))
+	fragmentIndex := 0
+	for _, skeleton := range skeletons {
+		start := clampInt(skeleton.start, 0, len(text))
+		end := clampInt(skeleton.start+skeleton.length, start, len(text))
+		markup := append([]byte(nil), text[start:end]...)
+		segments := []mobiSegment{{rawStart: start, length: end - start}}
+
+		cursor := end
+		for count := 0; count < skeleton.fragmentCount && fragmentIndex < len(fragments); count++ {
+			fragment := fragments[fragmentIndex]
+			fragmentIndex++
+
+			fragmentEnd := clampInt(cursor+fragment.length, cursor, len(text))
+			insertAt := clampInt(fragment.insertPos-skeleton.start, 0, len(markup))
+			slice := text[cursor:fragmentEnd]
+
+			merged := make([]byte, 0, len(markup)+len(slice))
+			merged = append(merged, markup[:insertAt]...)
+			merged = append(merged, slice...)
+			merged = append(merged, markup[insertAt:]...)
+			markup = merged
+
+			segments = insertMobiSegment(segments, mobiSegment{rawStart: cursor, length: len(slice), offset: insertAt})
+			cursor = fragmentEnd
+		}
+
+		parts = append(parts, mobiPart{markup: markup, segments: segments})
+	}
+	return parts
+}
+
+// insertMobiSegment 插入新片段，并移动或拆分受影响的已有片段
+func insertMobiSegment(segments []mobiSegment, inserted mobiSegment) []mobiSegment {
+	result := make([]mobiSegment, 0, len(segments)+2)
+	for _, segment := range segments {
+		switch {
+		case segment.offset >= inserted.offset:
+			segment.offset += inserted.length
+			result = append(result, segment)
+		case segment.offset+segment.length > inserted.offset:
+			headLength := inserted.offset - segment.offset
+			result = append(result,
+				mobiSegment{rawStart: segment.rawStart, length: headLength, offset: segment.offset},
+				mobiSegment{
+					rawStart: segment.rawStart + headLength,
+					length:   segment.length - headLength,
+					offset:   inserted.offset + inserted.length,
+				},
+			)
+		default:
+			result = append(result, segment)
+		}
+	}
+	return append(result, inserted)
+}
+
+// locateMobiRawPosition 将原始文本偏移换算为所在文件及文件内偏移
+func locateMobiRawPosition(parts []mobiPart, position int) (int, int, bool) {
+	for partIndex, part := range parts {
+		for _, segment := range part.segments {
+			if position >= segment.rawStart && position < segment.rawStart+segment.length {
+				return partIndex, segment.offset + position - segment.rawStart, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// splitMobiPartAtPagebreaks 没有目录的 MOBI6 按分页标记拆成多个文件，每个文件一章
+func splitMobiPartAtPagebreaks(part mobiPart) []mobiPart {
+	matches := mobiPagebreakPattern.FindAllIndex(part.markup, -1)
+	if len(matches) == 0 {
+		return []mobiPart{part}
+	}
+
+	parts := make([]mobiPart, 0, len(matches)+1)
+	start := 0
+	for _, match := range append(matches, []int{len(part.markup), len(part.markup)}) {
+		if match[0] > start {
+			parts = append(parts, mobiPart{
+				markup:   part.markup[start:match[0]],
+				segments: []mobiSegment{{rawStart: start, length: match[0] - start}},
+			})
+		}
+		start = match[1]
+	}
+	return parts
+}
+
+// mobiNCXEntry NCX 目录条目，pos 为原始文本中的偏移
+type mobiNCXEntry struct {
+	title string
+	pos   int
+	level int
+}
+
+func readMobiNCX(db *palmDatabase, header *mobiHeader) []mobiNCXEntry {
+	if header.ncxIndex < 0 {
+		return nil
+	}
+
+	indexEntries, ctoc, err := readMobiIndex(db, header.ncxIndex)
+	if err != nil {
+		return nil
+	}
+
+	entries := make([]mobiNCXEntry, 0, len(indexEntries))
+	for _, indexEntry := range indexEntries {
+		position := indexEntry.tags[1]
+		labelOffset := indexEntry.tags[3]
+		if len(position) == 0 || len(labelOffset) == 0 {
+			continue
+		}
+
+		title := strings.TrimSpace(decodeMobiText([]byte(ctoc[int(labelOffset[0])]), header.textEncoding))
+		if title == "" {
+			continue
+		}
+
+		level := 0
+		if depth := indexEntry.tags[4]; len(depth) > 0 {
+			level = int(depth[0])
+		}
+		entries = append(entries, mobiNCXEntry{title: title, pos: int(position[0]), level: level})
+	}
+	return entries
+}
+
+// readMobiGuideTOC 没有 NCX 的 MOBI6 从 guide 指向的目录页中收集 filepos 链接
+func readMobiGuideTOC(text []byte, textEncoding int) []mobiNCXEntry {
+	reference := mobiGuideTOCPattern.Find(text)
+	if reference == nil {
+		return nil
+	}
+	position := mobiFileposPattern.FindSubmatch(reference)
+	if position == nil {
+		return nil
+	}
+	tocStart, err := strconv.Atoi(string(position[1]))
+	if err != nil || tocStart < 0 || tocStart >= len(text) {
+		return nil
+	}
+
+	tocPage := text[tocStart:]
+	if pagebreak := mobiPagebreakPattern.FindIndex(tocPage); pagebreak != nil && pagebreak[0] > 0 {
+		tocPage = tocPage[:pagebreak[0]]
+	}
+
+	entries := []mobiNCXEntry{}
+	for _, match := range mobiFileposLinkRegex.FindAllSubmatch(tocPage, -1) {
+		target, err := strconv.Atoi(string(match[1]))
+		if err != nil || target == tocStart {
+			continue
+		}
+		title := strings.TrimSpace(stdhtml.UnescapeString(stripHTMLTags(decodeMobiText(match[2], textEncoding))))
+		if title == "" {
+			continue
+		}
+		entries = append(entries, mobiNCXEntry{title: title, pos: target})
+	}
+	return entries
+}
+
+type mobiTOCAnchor struct {
+	id       string
+	offset   int
+	fragment string
+	entry    mobiNCXEntry
+}
+
+// insertMobiTOCAnchors 在目录条目指向的位置插入空锚点，位于标签内部时前移到标签开头
+// 指向 body 之前的条目视为指向文件开头，不插入锚点
+func insertMobiTOCAnchors(markup []byte, anchors []mobiTOCAnchor) []byte {
+	if len(anchors) == 0 {
+		return markup
+	}
+
+	bodyStart := 0
+	if bodyIndex := bytes.Index(bytes.ToLower(markup), []byte("<body")); bodyIndex >= 0 {
+		if closeIndex := bytes.IndexByte(markup[bodyIndex:], '>'); closeIndex >= 0 {
+			bodyStart = bodyIndex + closeIndex + 1
+		}
+	}
+
+	for index := range anchors {
+		offset := clampInt(anchors[index].offset, 0, len(markup))
+		if lastOpen := bytes.LastIndexByte(markup[:offset], '<'); lastOpen > bytes.LastIndexByte(markup[:offset], '>') {
+			offset = lastOpen
+		}
+		anchors[index].offset = offset
+		if offset > bodyStart {
+			anchors[index].fragment = anchors[index].id
+		}
+	}
+
+	// 从后往前插入；同一位置的多个锚点先插入目录中靠后的，保证结果仍按目录顺序排列
+	ordered := make([]mobiTOCAnchor, 0, len(anchors))
+	for index := len(anchors) - 1; index >= 0; index-- {
+		ordered = append(ordered, anchors[index])
+	}
+	sort.SliceStable(ordered, func(left, right int) bool {
+		return ordered[left].offset > ordered[right].offset
+	})
+
+	result := append([]byte(nil), markup...)
+	for index := range ordered {
+		anchor := ordered[index]
+		if anchor.fragment == "" {
+			continue
+		}
+		tag := []byte(fmt.Sprintf(`<a id="%s"></a>`, anchor.id))
+		result = append(result[:anchor.offset], append(tag, result[anchor.offset:]...)...)
+	}
+	return result
+}
+
+func readMobiUint16(data []byte, offset int) uint16 {
+	if offset < 0 || offset+2 > len(data) {
+		return 0
+	}
+	return binary.BigEndian.Uint16(data[offset:])
+}
+
+func readMobiUint32(data []byte, offset int) uint32 {
+	if offset < 0 || offset+4 > len(data) {
+		return 0
+	}
+	return binary.BigEndian.Uint32(data[offset:])
+}
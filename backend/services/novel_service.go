@@ -10,13 +10,19 @@ import (
 	"fmt"
 	stdhtml "html"
 	"io"
+	"math"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
+	"unicode/utf8"
 
 	pdf "github.com/ledongthuc/pdf"
 	"github.com/nongchen1223/moyureader/backend/models"
@@ -28,10 +34,20 @@ import (
 type NovelService struct {
 	ctx             context.Context
 	novels          map[string]*models.Novel // 小说缓存，key 为文件路径
-	epubChapterHTML map[string][]string      // EPUB 章节富文本缓存
+	epubChapterHTML map[string][]string      // EPUB、MOBI 等 HTML 正文格式的章节富文本缓存
 	pdfChapterHTML  map[string][]string      // 图片型 PDF 页面富文本缓存
+	comicBooks      map[string]*comicBook    // 漫画页面列表和按需渲染的页面缓存
+	pdfOutlineBooks map[string]bool          // 章节来自 PDF 书签的文件
+	pdfPasswords    map[string]string        // 本次运行中输入过的 PDF 打开密码
+	textOffsets     map[string]*textOffsets  // 正文行首与字符位置对照表，首次搜索时建立
 	currentNovel    *models.Novel            // 当前打开的小说
 	progressService *ProgressService
+
+	searchMu   sync.Mutex
+	searchJobs map[string]context.CancelFunc // 进行中的搜索任务
+	searchSeq  int
+	// emitEvent 推送事件给前端，为空时使用 Wails 运行时
+	emitEvent func(name string, data interface{})
 }
 
 const (
@@ -59,6 +75,11 @@ func NewNovelService(progressService *ProgressService) *NovelService {
 		novels:          make(map[string]*models.Novel),
 		epubChapterHTML: make(map[string][]string),
 		pdfChapterHTML:  make(map[string][]string),
+		comicBooks:      make(map[string]*comicBook),
+		pdfOutlineBooks: make(map[string]bool),
+		pdfPasswords:    make(map[string]string),
+		textOffsets:     make(map[string]*textOffsets),
+		searchJobs:      make(map[string]context.CancelFunc),
 		progressService: progressService,
 	}
 }
@@ -74,6 +95,11 @@ func (s *NovelService) Cleanup() {
 	s.novels = make(map[string]*models.Novel)
 	s.epubChapterHTML = make(map[string][]string)
 	s.pdfChapterHTML = make(map[string][]string)
+	s.comicBooks = make(map[string]*comicBook)
+	s.pdfOutlineBooks = make(map[string]bool)
+	s.pdfPasswords = make(map[string]string)
+	s.textOffsets = make(map[string]*textOffsets)
+	s.cancelSearchJobs()
 	s.currentNovel = nil
 }
 
@@ -87,7 +113,7 @@ func (s *NovelService) OpenNovel(filePath string) (*models.Novel, error) {
 			Filters: []runtime.FileFilter{
 				{
 					DisplayName: "支持的文件",
-					Pattern:     "*.txt;*.epub;*.pdf;*.mobi;*.azw3",
+					Pattern:     "*.txt;*.epub;*.pdf;*.mobi;*.azw3;*.fb2;*.fb2.zip;*.cbz",
 				},
 			},
 		})
@@ -112,6 +138,262 @@ func (s *NovelService) OpenNovel(filePath string) (*models.Novel, error) {
 		return cloneNovelForClient(novel), nil
 	}
 
+	return s.loadNovel(filePath, s.preferredEncoding(filePath))
+}
+
+// OpenNovelWithOptions 带附加参数打开小说，目前用于提供加密 PDF 的密码
+// 打开 PDF 时返回 errPDFPasswordRequired 或 errPDFPasswordIncorrect，前端据此提示输入密码后再调用本方法
+// @param filePath 文件路径
+// @param options 打开参数
+// @return 小说信息和错误
+func (s *NovelService) OpenNovelWithOptions(filePath string, options models.OpenOptions) (*models.Novel, error) {
+	if strings.TrimSpace(filePath) == "" {
+		return nil, fmt.Errorf("文件路径不能为空")
+	}
+
+	if options.Password == "" {
+		return s.OpenNovel(filePath)
+	}
+	if novelFormatFromPath(filePath) != ".pdf" {
+		return nil, fmt.Errorf("只有 PDF 文件支持打开密码")
+	}
+
+	// 书可能已在缓存中，OpenNovel 不会再解析文件，因此先单独校验密码
+	required, err := checkPDFPassword(filePath, options.Password)
+	if err != nil {
+		return nil, err
+	}
+	if !required {
+		return s.OpenNovel(filePath)
+	}
+
+	previousPassword, hadPassword := s.pdfPasswords[filePath]
+	s.pdfPasswords[filePath] = options.Password
+	novel, err := s.OpenNovel(filePath)
+	if err != nil {
+		if hadPassword {
+			s.pdfPasswords[filePath] = previousPassword
+		} else {
+			delete(s.pdfPasswords, filePath)
+		}
+		return nil, err
+	}
+
+	if options.RememberPassword && s.progressService != nil {
+		if err := s.progressService.SaveBookPassword(filePath, options.Password); err != nil {
+			return nil, err
+		}
+	}
+	return novel, nil
+}
+
+// ForgetPassword 删除某本书已保存的打开密码
+func (s *NovelService) ForgetPassword(filePath string) error {
+	delete(s.pdfPasswords, filePath)
+	if s.progressService == nil {
+		return nil
+	}
+	return s.progressService.ForgetBookPassword(filePath)
+}
+
+// pdfPassword 获取打开 PDF 所用的密码：优先本次输入的密码，其次已保存的密码
+func (s *NovelService) pdfPassword(filePath string) (string, bool) {
+	if password, exists := s.pdfPasswords[filePath]; exists {
+		return password, false
+	}
+	if s.progressService != nil {
+		if password := s.progressService.GetBookPassword(filePath); password != "" {
+			return password, true
+		}
+	}
+	return "", false
+}
+
+// ReopenNovelWithEncoding 使用手动指定的编码重新打开小说
+// 自动识别出错时由用户选择编码，选择结果会随书保存，之后打开沿用该编码
+// @param filePath 文件路径
+// @param encoding 文本编码，传空或 auto 恢复自动识别
+// @return 小说信息和错误
+func (s *NovelService) ReopenNovelWithEncoding(filePath, encoding string) (*models.Novel, error) {
+	encodingName, err := normalizeTextEncodingName(encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("文件不存在，可能是你移动了原文件或修改了目录名称，请重新导入该书籍: %s", filePath)
+	}
+
+	s.releaseNovel(filePath)
+	novel, err := s.loadNovel(filePath, encodingName)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.progressService != nil {
+		settings := BookSettings{FilePath: filePath}
+		if saved := s.progressService.GetBookSettings(filePath); saved != nil {
+			settings = *saved
+		}
+		settings.Encoding = encodingName
+		if err := s.progressService.SaveBookSettings(settings); err != nil {
+			return nil, err
+		}
+	}
+
+	return novel, nil
+}
+
+// GetDefaultChapterRules 获取内置章节识别规则
+func (s *NovelService) GetDefaultChapterRules() models.ChapterRuleSet {
+	return defaultChapterRuleSet()
+}
+
+// GetChapterRules 获取该书当前生效的章节识别规则
+// 优先使用随书保存的规则，其次是全局规则，最后是内置规则
+func (s *NovelService) GetChapterRules(filePath string) models.ChapterRuleSet {
+	return s.resolveChapterRules(filePath)
+}
+
+// SetGlobalChapterRules 保存全局章节识别规则，传空规则列表恢复内置规则
+func (s *NovelService) SetGlobalChapterRules(ruleSet models.ChapterRuleSet) error {
+	if len(ruleSet.Rules) > 0 {
+		if err := validateChapterRuleSet(ruleSet); err != nil {
+			return err
+		}
+	}
+
+	if s.progressService == nil {
+		return fmt.Errorf("进度服务未初始化")
+	}
+
+	if len(ruleSet.Rules) == 0 {
+		return s.progressService.SaveGlobalChapterRules(nil)
+	}
+	return s.progressService.SaveGlobalChapterRules(&ruleSet)
+}
+
+// PreviewChapterRules 按给定规则预览章节列表，不修改已打开的小说
+func (s *NovelService) PreviewChapterRules(filePath string, ruleSet models.ChapterRuleSet) ([]models.Chapter, error) {
+	novel, exists := s.novels[filePath]
+	if !exists {
+		return nil, fmt.Errorf("小说未打开")
+	}
+	if !s.supportsChapterRules(novel) {
+		return nil, fmt.Errorf("该格式的章节来自书籍目录，不支持自定义章节规则")
+	}
+
+	return splitTxtChapters(novel.Content, ruleSet)
+}
+
+// ApplyChapterRules 按给定规则重新切分章节，并将规则随书保存
+// 传空规则列表时清除该书的规则，恢复使用全局规则
+func (s *NovelService) ApplyChapterRules(filePath string, ruleSet models.ChapterRuleSet) (*models.Novel, error) {
+	novel, exists := s.novels[filePath]
+	if !exists {
+		return nil, fmt.Errorf("小说未打开")
+	}
+	if !s.supportsChapterRules(novel) {
+		return nil, fmt.Errorf("该格式的章节来自书籍目录，不支持自定义章节规则")
+	}
+
+	var bookRules *models.ChapterRuleSet
+	effectiveRules := s.globalChapterRules()
+	if len(ruleSet.Rules) > 0 {
+		if err := validateChapterRuleSet(ruleSet); err != nil {
+			return nil, err
+		}
+		bookRules = &ruleSet
+		effectiveRules = ruleSet
+	}
+
+	chapters, err := splitTxtChapters(novel.Content, effectiveRules)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.progressService != nil {
+		settings := BookSettings{FilePath: filePath}
+		if saved := s.progressService.GetBookSettings(filePath); saved != nil {
+			settings = *saved
+		}
+		settings.ChapterRules = bookRules
+		if err := s.progressService.SaveBookSettings(settings); err != nil {
+			return nil, err
+		}
+
+		// 正文按旧规则重排过，需要从原文件按新规则重新生成
+		if s.chapterRulesShapeContent(novel) {
+			s.releaseNovel(filePath)
+			return s.loadNovel(filePath, s.preferredEncoding(filePath))
+		}
+	}
+
+	novel.Chapters = chapters
+	novel.CurrentChapter = clampInt(novel.CurrentChapter, 0, maxInt(len(chapters)-1, 0))
+	return cloneNovelForClient(novel), nil
+}
+
+// chapterRulesShapeContent 正文本身是否依赖章节规则：段落重排和 PDF 去页眉都按规则保留标题行
+func (s *NovelService) chapterRulesShapeContent(novel *models.Novel) bool {
+	if novel.Format == ".pdf" {
+		options := s.resolvePDFOptions(novel.FilePath)
+		return options.RemovePageDecorations || options.ReflowParagraphs
+	}
+	return isPlainTextNovel(novel) && s.resolveTxtOptions(novel.FilePath).ReflowParagraphs
+}
+
+// resolveChapterRules 获取该书生效的章节规则
+func (s *NovelService) resolveChapterRules(filePath string) models.ChapterRuleSet {
+	if s.progressService != nil {
+		if settings := s.progressService.GetBookSettings(filePath); settings != nil && settings.ChapterRules != nil {
+			return *settings.ChapterRules
+		}
+	}
+
+	return s.globalChapterRules()
+}
+
+func (s *NovelService) globalChapterRules() models.ChapterRuleSet {
+	if s.progressService != nil {
+		if ruleSet := s.progressService.GetGlobalChapterRules(); ruleSet != nil {
+			return *ruleSet
+		}
+	}
+
+	return defaultChapterRuleSet()
+}
+
+// supportsChapterRules 章节由正文识别（而非书籍自带目录）时才支持自定义规则
+func (s *NovelService) supportsChapterRules(novel *models.Novel) bool {
+	switch novel.Format {
+	case ".epub", ".mobi", ".azw3", ".fb2", ".fb2.zip", ".cbz":
+		return false
+	case ".pdf":
+		_, isImageBased := s.pdfChapterHTML[novel.FilePath]
+		return !isImageBased && !s.pdfOutlineBooks[novel.FilePath]
+	default:
+		return true
+	}
+}
+
+// isPlainTextNovel 按纯文本解析的书籍：TXT 及未识别的格式
+func isPlainTextNovel(novel *models.Novel) bool {
+	switch novel.Format {
+	case ".epub", ".mobi", ".azw3", ".fb2", ".fb2.zip", ".cbz", ".pdf":
+		return false
+	default:
+		return true
+	}
+}
+
+// GetSupportedEncodings 获取可手动指定的文本编码列表
+func (s *NovelService) GetSupportedEncodings() []string {
+	return append([]string(nil), supportedTextEncodings...)
+}
+
+// loadNovel 读取并解析小说文件，解析成功后写入缓存
+func (s *NovelService) loadNovel(filePath, encoding string) (*models.Novel, error) {
 	// 读取文件内容
 	content, err := os.ReadFile(filePath)
 	if err != nil {
@@ -120,14 +402,16 @@ func (s *NovelService) OpenNovel(filePath string) (*models.Novel, error) {
 
 	// 获取文件信息
 	fileInfo, _ := os.Stat(filePath)
-	ext := strings.ToLower(filepath.Ext(filePath))
+	ext := novelFormatFromPath(filePath)
+	baseName := filepath.Base(filePath)
 
 	// 创建小说对象
 	novel := &models.Novel{
-		Title:         strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath)),
+		Title:         baseName[:len(baseName)-len(ext)],
 		FilePath:      filePath,
 		Format:        ext,
 		Size:          fileInfo.Size(),
+		Encoding:      encoding,
 		Content:       string(content),
 		ContentLength: runeLen(string(content)),
 	}
@@ -141,27 +425,64 @@ func (s *NovelService) OpenNovel(filePath string) (*models.Novel, error) {
 
 	// 缓存小说
 	s.novels[filePath] = novel
+	delete(s.textOffsets, filePath)
 	s.currentNovel = novel
 
 	return cloneNovelForClient(novel), nil
 }
 
+// novelFormatFromPath 根据文件名获取格式，.fb2.zip 这类双扩展名整体作为格式
+func novelFormatFromPath(filePath string) string {
+	if strings.HasSuffix(strings.ToLower(filePath), ".fb2.zip") {
+		return ".fb2.zip"
+	}
+	return strings.ToLower(filepath.Ext(filePath))
+}
+
+// preferredEncoding 获取用户为该书保存的编码，未保存时返回空表示自动识别
+func (s *NovelService) preferredEncoding(filePath string) string {
+	if s.progressService == nil {
+		return ""
+	}
+
+	if settings := s.progressService.GetBookSettings(filePath); settings != nil {
+		return settings.Encoding
+	}
+	return ""
+}
+
 // GetCurrentNovel 获取当前打开的小说
 func (s *NovelService) GetCurrentNovel() *models.Novel {
 	return cloneNovelForClient(s.currentNovel)
 }
 
-// CloseNovel 关闭小说
-func (s *NovelService) CloseNovel(filePath string) {
+// CloseNovel 关闭小说，并写入延迟保存的阅读进度。写入失败时进度仍标记为待写，
+// 留待下次写盘重试，错误返回给前端提示
+func (s *NovelService) CloseNovel(filePath string) error {
+	s.releaseNovel(filePath)
+	if s.progressService != nil {
+		if err := s.progressService.Flush(); err != nil {
+			return fmt.Errorf("保存阅读进度失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// releaseNovel 丢弃已打开小说的解析结果与缓存，重新解析前调用
+func (s *NovelService) releaseNovel(filePath string) {
 	delete(s.novels, filePath)
+	delete(s.textOffsets, filePath)
 	delete(s.epubChapterHTML, filePath)
 	delete(s.pdfChapterHTML, filePath)
+	delete(s.comicBooks, filePath)
+	delete(s.pdfOutlineBooks, filePath)
 	if s.currentNovel != nil && s.currentNovel.FilePath == filePath {
 		s.currentNovel = nil
 	}
 }
 
 // GetNovelChapters 获取小说章节列表
+// 返回按阅读顺序排列的扁平列表，通过 Level 和 ParentIndex 描述卷、章层级
 func (s *NovelService) GetNovelChapters(filePath string) ([]models.Chapter, error) {
 	novel, exists := s.novels[filePath]
 	if !exists {
@@ -172,12 +493,125 @@ func (s *NovelService) GetNovelChapters(filePath string) ([]models.Chapter, erro
 
 // SearchNovel 在指定小说中搜索关键字
 func (s *NovelService) SearchNovel(filePath, keyword string, caseSensitive bool) []models.SearchResult {
+	results, err := s.SearchNovelWithOptions(filePath, models.SearchOptions{Keyword: keyword, CaseSensitive: caseSensitive})
+	if err != nil {
+		return []models.SearchResult{}
+	}
+	return results
+}
+
+// SearchNovelWithOptions 按搜索参数在指定小说中搜索，支持正则、整词匹配与结果数量限制
+func (s *NovelService) SearchNovelWithOptions(filePath string, options models.SearchOptions) ([]models.SearchResult, error) {
 	novel, exists := s.novels[filePath]
 	if !exists || novel == nil {
-		return []models.SearchResult{}
+		return nil, fmt.Errorf("小说未打开")
 	}
 
-	return searchInText(novel.Content, keyword, caseSensitive)
+	results, err := searchTextRange(novel.Content, s.novelTextOffsets(filePath, novel), 0, len(novel.Content), options)
+	if err != nil {
+		return nil, err
+	}
+	annotateNovelSearchResults(results, novel.Chapters, novel.PageOffsets)
+	return results, nil
+}
+
+// annotateNovelSearchResults 为搜索结果补充章节与 PDF 页码
+func annotateNovelSearchResults(results []models.SearchResult, chapters []models.Chapter, pageOffsets []int) {
+	annotateSearchResults(results, chapters)
+	if len(pageOffsets) > 0 {
+		for index := range results {
+			results[index].Page = pageForPosition(pageOffsets, results[index].Position)
+		}
+	}
+}
+
+// novelTextOffsets 获取已打开小说的正文位置对照表，首次使用时建立
+func (s *NovelService) novelTextOffsets(filePath string, novel *models.Novel) *textOffsets {
+	if offsets, exists := s.textOffsets[filePath]; exists {
+		return offsets
+	}
+	offsets := newTextOffsets(novel.Content)
+	s.textOffsets[filePath] = offsets
+	return offsets
+}
+
+// SearchNovelGrouped 按搜索参数在指定小说中搜索，结果按章节分组并附带每章命中数；
+// 设置了结果数量限制时只统计返回的结果
+func (s *NovelService) SearchNovelGrouped(filePath string, options models.SearchOptions) ([]models.SearchResultGroup, error) {
+	results, err := s.SearchNovelWithOptions(filePath, options)
+	if err != nil {
+		return nil, err
+	}
+	return groupSearchResults(results), nil
+}
+
+// GetPositionForPage 获取 PDF 第 page 页（按页序从 1 开始，不是印刷页码）在正文中的起始位置
+func (s *NovelService) GetPositionForPage(filePath string, page int) (int, error) {
+	novel, exists := s.novels[filePath]
+	if !exists {
+		return 0, fmt.Errorf("小说未打开")
+	}
+	if len(novel.PageOffsets) == 0 {
+		return 0, fmt.Errorf("该书没有页码信息")
+	}
+	if page < 1 || page > len(novel.PageOffsets) {
+		return 0, fmt.Errorf("页码越界")
+	}
+	return novel.PageOffsets[page-1], nil
+}
+
+// GetPositionForPageLabel 获取印刷页码（如 iv、137）所在页在正文中的起始位置，用于按书上的页码跳转；
+// 没有 /PageLabels 的 PDF 印刷页码即页序
+func (s *NovelService) GetPositionForPageLabel(filePath string, label string) (int, error) {
+	novel, exists := s.novels[filePath]
+	if !exists {
+		return 0, fmt.Errorf("小说未打开")
+	}
+	if len(novel.PageOffsets) == 0 {
+		return 0, fmt.Errorf("该书没有页码信息")
+	}
+
+	label = strings.TrimSpace(label)
+	if len(novel.PageLabels) == 0 {
+		page, err := strconv.Atoi(label)
+		if err != nil || page < 1 || page > len(novel.PageOffsets) {
+			return 0, fmt.Errorf("页码不存在: %s", label)
+		}
+		return novel.PageOffsets[page-1], nil
+	}
+	for pageIndex, pageLabel := range novel.PageLabels {
+		if pageLabel == label {
+			return novel.PageOffsets[pageIndex], nil
+		}
+	}
+	// 罗马数字页码大小写不敏感
+	for pageIndex, pageLabel := range novel.PageLabels {
+		if strings.EqualFold(pageLabel, label) {
+			return novel.PageOffsets[pageIndex], nil
+		}
+	}
+	return 0, fmt.Errorf("页码不存在: %s", label)
+}
+
+// GetPageForPosition 获取正文位置所在的 PDF 页码（从 1 开始）
+func (s *NovelService) GetPageForPosition(filePath string, position int) (int, error) {
+	novel, exists := s.novels[filePath]
+	if !exists {
+		return 0, fmt.Errorf("小说未打开")
+	}
+	if len(novel.PageOffsets) == 0 {
+		return 0, fmt.Errorf("该书没有页码信息")
+	}
+	return pageForPosition(novel.PageOffsets, position), nil
+}
+
+// pageForPosition 在页面起始位置表中查找位置所在的页码（从 1 开始）；
+// 空白页与下一页起始位置相同，取其中最后一页，即真正包含该位置的页面
+func pageForPosition(pageOffsets []int, position int) int {
+	page := sort.Search(len(pageOffsets), func(index int) bool {
+		return pageOffsets[index] > position
+	})
+	return max(page, 1)
 }
 
 // GetChapterContent 获取指定章节内容
@@ -191,7 +625,7 @@ func (s *NovelService) GetChapterContent(filePath string, chapterIndex int) (str
 		return "", fmt.Errorf("章节索引越界")
 	}
 
-	if novel.Format == ".epub" {
+	if isEpubStyleFormat(novel.Format) {
 		if chapterHTML := s.getEpubChapterHTML(filePath, chapterIndex); chapterHTML != "" {
 			return chapterHTML, nil
 		}
@@ -205,6 +639,10 @@ func (s *NovelService) GetChapterContent(filePath string, chapterIndex int) (str
 		}
 	}
 
+	if novel.Format == ".cbz" {
+		return s.getComicChapterHTML(filePath, chapterIndex)
+	}
+
 	chapter := novel.Chapters[chapterIndex]
 	return sliceByRuneRange(novel.Content, chapter.StartPos, chapter.EndPos), nil
 }
@@ -224,7 +662,7 @@ func (s *NovelService) GetChapterContentPayload(
 		return nil, fmt.Errorf("小说未打开")
 	}
 
-	isRichContent := novel.Format == ".epub" || novel.Format == ".pdf"
+	isRichContent := isEpubStyleFormat(novel.Format) || novel.Format == ".pdf" || novel.Format == ".cbz"
 
 	return &models.ChapterContentPayload{
 		Content:       chapterContent,
@@ -246,7 +684,7 @@ func (s *NovelService) SetCurrentChapter(filePath string, chapterIndex int) erro
 
 	novel.CurrentChapter = chapterIndex
 	if s.progressService != nil {
-		return s.progressService.SaveProgress(filePath, chapterIndex, 0, novel.ReadProgress)
+		return s.progressService.saveProgress(filePath, chapterIndex, 0, progressPage(novel, chapterIndex, 0), novel.ReadProgress)
 	}
 	return nil
 }
@@ -263,12 +701,22 @@ func (s *NovelService) SaveReadingProgress(filePath string, chapterIndex int, po
 	novel.LastReadTime = getCurrentTimestamp()
 
 	if s.progressService != nil {
-		return s.progressService.SaveProgress(filePath, chapterIndex, position, progress)
+		return s.progressService.saveProgress(filePath, chapterIndex, position, progressPage(novel, chapterIndex, position), progress)
 	}
 
 	return nil
 }
 
+// progressPage 阅读进度所在的 PDF 页码，position 为章内偏移；没有页码信息时为 0
+func progressPage(novel *models.Novel, chapterIndex, position int) int {
+	if len(novel.PageOffsets) == 0 || chapterIndex < 0 || chapterIndex >= len(novel.Chapters) {
+		return 0
+	}
+	chapter := novel.Chapters[chapterIndex]
+	position = clampInt(chapter.StartPos+position, chapter.StartPos, maxInt(chapter.EndPos-1, chapter.StartPos))
+	return pageForPosition(novel.PageOffsets, position)
+}
+
 // GetReadingProgress 获取阅读进度
 func (s *NovelService) GetReadingProgress(filePath string) (int, int, float64, error) {
 	novel, exists := s.novels[filePath]
@@ -291,92 +739,59 @@ func (s *NovelService) GetReadingProgress(filePath string) (int, int, float64, e
 func (s *NovelService) parseNovelContent(novel *models.Novel) error {
 	switch novel.Format {
 	case ".txt":
+		if err := decodeTxtNovelContent(novel); err != nil {
+			return err
+		}
+		s.reflowTxtNovel(novel)
 		return s.parseTxtNovel(novel)
 	case ".epub":
 		return s.parseEpubNovel(novel)
+	case ".mobi", ".azw3":
+		return s.parseMobiNovel(novel)
+	case ".fb2", ".fb2.zip":
+		return s.parseFb2Novel(novel)
+	case ".cbz":
+		return s.parseComicNovel(novel)
 	case ".pdf":
 		return s.parsePdfNovel(novel)
 	default:
 		// 默认按 txt 格式处理
+		if err := decodeTxtNovelContent(novel); err != nil {
+			return err
+		}
+		s.reflowTxtNovel(novel)
 		return s.parseTxtNovel(novel)
 	}
 }
 
-// parseTxtNovel 解析 TXT 格式小说
-// 使用常见的章节标题模式进行识别
-func (s *NovelService) parseTxtNovel(novel *models.Novel) error {
-	// 多种章节标题匹配模式
-	patterns := []string{
-		`^第[0-9零一二三四五六七八九十百千]+[章节回]`,
-		`^Chapter\s+\d+`,
-		`^\d+\.\s+`,
-		`^【第.+?】`,
-		`^（第.+?）`,
-		`^\[第.+?\]`,
-	}
-
-	// 预编译正则表达式
-	regexps := make([]*regexp.Regexp, len(patterns))
-	for i, pattern := range patterns {
-		regexps[i] = regexp.MustCompile(pattern)
+// reflowTxtNovel 开启段落重排时，把硬换行的 TXT 重新拼成段落，章节随后按新正文切分
+func (s *NovelService) reflowTxtNovel(novel *models.Novel) {
+	if !s.resolveTxtOptions(novel.FilePath).ReflowParagraphs {
+		return
 	}
 
-	chapters := []models.Chapter{}
-	currentOffset := 0
-	chapterIndex := 0
-
-	for _, rawLine := range strings.SplitAfter(novel.Content, "\n") {
-		lineWithoutBreak := strings.TrimRight(rawLine, "\r\n")
-		trimmedLine := strings.TrimSpace(lineWithoutBreak)
-		lineLength := runeLen(rawLine)
-
-		if trimmedLine == "" {
-			currentOffset += lineLength
-			continue
-		}
-
-		// 检查是否是章节标题
-		isChapter := false
-		for _, re := range regexps {
-			if re.MatchString(trimmedLine) {
-				isChapter = true
-				break
-			}
-		}
-
-		if isChapter {
-			startPos := currentOffset + leadingWhitespaceCount(lineWithoutBreak)
-			if len(chapters) > 0 {
-				chapters[len(chapters)-1].EndPos = startPos
-				chapters[len(chapters)-1].WordCount = chapters[len(chapters)-1].EndPos - chapters[len(chapters)-1].StartPos
-			}
-
-			chapters = append(chapters, models.Chapter{
-				Title:    trimmedLine,
-				StartPos: startPos,
-				EndPos:   runeLen(novel.Content), // 临时设置为全文末尾
-				Index:    chapterIndex,
-			})
-			chapterIndex++
-		}
+	chapterRules, _ := compileChapterRuleSet(s.resolveChapterRules(novel.FilePath))
+	novel.Content = reflowTxtContent(novel.Content, chapterRules)
+}
 
-		currentOffset += lineLength
+// decodeTxtNovelContent 将原始字节内容转码为 UTF-8，并记录实际使用的编码
+func decodeTxtNovelContent(novel *models.Novel) error {
+	content, encodingName, err := decodeNovelText([]byte(novel.Content), novel.Encoding)
+	if err != nil {
+		return err
 	}
 
-	// 如果没有找到章节，则将整个文件作为一个章节
-	if len(chapters) == 0 {
-		chapters = append(chapters, models.Chapter{
-			Title:     "正文",
-			StartPos:  0,
-			EndPos:    runeLen(novel.Content),
-			Index:     0,
-			WordCount: runeLen(novel.Content),
-		})
-	} else {
-		// 修正最后一章的结束位置
-		lastChapter := &chapters[len(chapters)-1]
-		lastChapter.EndPos = runeLen(novel.Content)
-		lastChapter.WordCount = lastChapter.EndPos - lastChapter.StartPos
+	novel.Content = content
+	novel.Encoding = encodingName
+	return nil
+}
+
+// parseTxtNovel 解析 TXT 格式小说
+// 按该书生效的章节规则集识别章节标题
+func (s *NovelService) parseTxtNovel(novel *models.Novel) error {
+	chapters, err := splitTxtChapters(novel.Content, s.resolveChapterRules(novel.FilePath))
+	if err != nil {
+		return err
 	}
 
 	novel.Chapters = chapters
@@ -434,102 +849,216 @@ func (s *NovelService) parseEpubNovel(novel *models.Novel) error {
 		novel.Cover = coverDataURL
 	}
 
-	var contentBuilder strings.Builder
-	chapters := make([]models.Chapter, 0, len(pkg.Spine.ItemRefs))
-	chapterHTMLs := make([]string, 0, len(pkg.Spine.ItemRefs))
-	currentOffset := 0
+	builder := newEpubBookBuilder(len(pkg.Spine.ItemRefs))
 
-	appendChapter := func(rawTitle, rawText, rawHTML string, fallbackIndex int) {
-		chapterText := normalizeEpubText(rawText)
-		chapterHTML := strings.TrimSpace(rawHTML)
-		if chapterText == "" && chapterHTML == "" {
-			return
+	spinePaths := make([]string, 0, len(pkg.Spine.ItemRefs))
+	for _, itemRef := range pkg.Spine.ItemRefs {
+		item, exists := manifest[itemRef.IDRef]
+		if !exists || !isSupportedEpubItem(item.MediaType) {
+			continue
 		}
+		spinePaths = append(spinePaths, normalizeZipPath(path.Join(opfDir, item.Href)))
+	}
 
-		chapterTitle := strings.TrimSpace(rawTitle)
-		if chapterTitle == "" {
-			chapterTitle = fmt.Sprintf("第%d章", fallbackIndex)
-		}
-		chapterText = trimLeadingEpubTitle(chapterText, chapterTitle)
-		if chapterHTML == "" {
-			chapterHTML = buildBasicHTMLFromText(chapterText)
-		}
-		if chapterText == "" && strings.Contains(chapterHTML, "<img") {
-			chapterText = "[图片]"
-		}
+	tocEntries := readEpubTOC(fileMap, pkg, manifest, opfDir)
+	for _, draft := range buildEpubChapterDrafts(epubZipDocuments{fileMap: fileMap}, spinePaths, tocEntries) {
+		builder.appendDraft(draft)
+	}
 
-		if contentBuilder.Len() > 0 {
-			contentBuilder.WriteString("\n\n")
-			currentOffset += runeLen("\n\n")
+	// 有些 EPUB 的 spine 不规范，这里退回到 manifest 级别兜底提取正文。
+	if builder.chapterCount() == 0 {
+		for _, item := range pkg.Manifest.Items {
+			if !isSupportedEpubItem(item.MediaType) {
+				continue
+			}
+
+			chapterPath := normalizeZipPath(path.Join(opfDir, item.Href))
+			chapterMarkup, err := readZipFileText(fileMap, chapterPath)
+			if err != nil {
+				continue
+			}
+
+			chapterTitle, chapterText, chapterHTML := extractEpubChapterContent(fileMap, chapterMarkup, chapterPath)
+			builder.appendDraft(&epubChapterDraft{
+				title:         chapterTitle,
+				texts:         []string{chapterText},
+				htmls:         []string{chapterHTML},
+				fallbackIndex: builder.chapterCount() + 1,
+			})
 		}
+	}
+
+	if builder.chapterCount() == 0 {
+		return fmt.Errorf("未从 EPUB 中提取到可阅读正文")
+	}
+
+	s.epubChapterHTML[novel.FilePath] = builder.finish(novel)
+	return nil
+}
+
+// epubBookBuilder 将章节草稿依次拼接为全文，并记录每章的偏移量和富文本
+// EPUB 之外以 HTML 为正文的格式（如 MOBI）也通过它生成章节
+type epubBookBuilder struct {
+	content       strings.Builder
+	chapters      []models.Chapter
+	chapterHTMLs  []string
+	currentOffset int
+}
+
+func newEpubBookBuilder(capacity int) *epubBookBuilder {
+	return &epubBookBuilder{
+		chapters:     make([]models.Chapter, 0, capacity),
+		chapterHTMLs: make([]string, 0, capacity),
+	}
+}
+
+func (b *epubBookBuilder) chapterCount() int {
+	return len(b.chapters)
+}
+
+func (b *epubBookBuilder) appendDraft(draft *epubChapterDraft) {
+	chapterText := normalizeEpubText(strings.Join(draft.texts, "\n\n"))
+	chapterHTML := strings.TrimSpace(strings.Join(draft.htmls, ""))
+	if chapterText == "" && chapterHTML == "" && !draft.fromTOC {
+		return
+	}
+
+	chapterTitle := strings.TrimSpace(draft.title)
+	if chapterTitle == "" {
+		chapterTitle = fmt.Sprintf("第%d章", draft.fallbackIndex)
+	}
+	chapterText = trimLeadingEpubTitle(chapterText, chapterTitle)
+	if chapterHTML == "" {
+		chapterHTML = buildBasicHTMLFromText(chapterText)
+	}
+	if chapterHTML == "" {
+		// 目录中的卷标题等条目可能没有独立正文，只展示标题
+		chapterHTML = wrapEpubHTMLTag("h2", stdhtml.EscapeString(chapterTitle))
+	}
+	if chapterText == "" && strings.Contains(chapterHTML, "<img") {
+		chapterText = "[图片]"
+	}
 
-		chapterBody := chapterText
-		if chapterBody == "" || !strings.HasPrefix(strings.TrimSpace(chapterBody), chapterTitle) {
-			if chapterBody == "" {
-				chapterBody = chapterTitle
-			} else {
-				chapterBody = chapterTitle + "\n\n" + chapterBody
-			}
+	if b.content.Len() > 0 {
+		b.content.WriteString("\n\n")
+		b.currentOffset += runeLen("\n\n")
+	}
+
+	chapterBody := chapterText
+	if chapterBody == "" || !strings.HasPrefix(strings.TrimSpace(chapterBody), chapterTitle) {
+		if chapterBody == "" {
+			chapterBody = chapterTitle
+		} else {
+			chapterBody = chapterTitle + "\n\n" + chapterBody
 		}
-		startPos := currentOffset
-		contentBuilder.WriteString(chapterBody)
-		currentOffset += runeLen(chapterBody)
+	}
+	startPos := b.currentOffset
+	b.content.WriteString(chapterBody)
+	b.currentOffset += runeLen(chapterBody)
 
-		chapters = append(chapters, models.Chapter{
-			Index:     len(chapters),
-			Title:     chapterTitle,
-			StartPos:  startPos,
-			EndPos:    currentOffset,
-			WordCount: runeLen(chapterBody),
-		})
-		chapterHTMLs = append(chapterHTMLs, chapterHTML)
+	b.chapters = append(b.chapters, models.Chapter{
+		Index:     len(b.chapters),
+		Title:     chapterTitle,
+		StartPos:  startPos,
+		EndPos:    b.currentOffset,
+		WordCount: runeLen(chapterBody),
+		Level:     draft.level,
+	})
+	b.chapterHTMLs = append(b.chapterHTMLs, chapterHTML)
+}
+
+// finish 将拼接结果写入小说并返回各章富文本
+func (b *epubBookBuilder) finish(novel *models.Novel) []string {
+	linkChapterHierarchy(b.chapters)
+	novel.Content = b.content.String()
+	novel.ContentLength = runeLen(novel.Content)
+	novel.Chapters = b.chapters
+	return b.chapterHTMLs
+}
+
+// parseMobiNovel 解析 MOBI / AZW3 格式小说
+// 重组出的 HTML 与 EPUB 共用分章和富文本流程
+func (s *NovelService) parseMobiNovel(novel *models.Novel) error {
+	data, err := os.ReadFile(novel.FilePath)
+	if err != nil {
+		return fmt.Errorf("读取 MOBI 文件失败: %w", err)
 	}
 
-	for index, itemRef := range pkg.Spine.ItemRefs {
-		item, exists := manifest[itemRef.IDRef]
-		if !exists || !isSupportedEpubItem(item.MediaType) {
-			continue
-		}
+	book, err := parseMobiBook(data)
+	if err != nil {
+		return err
+	}
 
-		chapterPath := normalizeZipPath(path.Join(opfDir, item.Href))
-		chapterMarkup, err := readZipFileText(fileMap, chapterPath)
-		if err != nil {
-			continue
-		}
+	if book.title != "" {
+		novel.Title = book.title
+	}
+	if book.author != "" {
+		novel.Author = book.author
+	}
+	if coverDataURL := book.coverDataURL(); coverDataURL != "" {
+		novel.Cover = coverDataURL
+	}
 
-		chapterTitle, chapterText, chapterHTML := extractEpubChapterContent(fileMap, chapterMarkup, chapterPath)
-		appendChapter(chapterTitle, chapterText, chapterHTML, index+1)
+	builder := newEpubBookBuilder(len(book.documentNames))
+	for _, draft := range buildEpubChapterDrafts(book, book.documentNames, book.tocEntries) {
+		builder.appendDraft(draft)
+	}
+	if builder.chapterCount() == 0 {
+		return fmt.Errorf("未从 MOBI 中提取到可阅读正文")
 	}
 
-	// 有些 EPUB 的 spine 不规范，这里退回到 manifest 级别兜底提取正文。
-	if len(chapters) == 0 {
-		for _, item := range pkg.Manifest.Items {
-			if !isSupportedEpubItem(item.MediaType) {
-				continue
-			}
+	s.epubChapterHTML[novel.FilePath] = builder.finish(novel)
+	return nil
+}
 
-			chapterPath := normalizeZipPath(path.Join(opfDir, item.Href))
-			chapterMarkup, err := readZipFileText(fileMap, chapterPath)
-			if err != nil {
-				continue
-			}
+// parseFb2Novel 解析 FB2 / FB2.ZIP 格式小说
+// section 嵌套对应章节层级，<binary> 图片内嵌为 data URL
+func (s *NovelService) parseFb2Novel(novel *models.Novel) error {
+	data, err := readFb2File(novel.FilePath)
+	if err != nil {
+		return err
+	}
 
-			chapterTitle, chapterText, chapterHTML := extractEpubChapterContent(fileMap, chapterMarkup, chapterPath)
-			appendChapter(chapterTitle, chapterText, chapterHTML, len(chapters)+1)
-		}
+	book, err := parseFb2Book(data)
+	if err != nil {
+		return err
 	}
 
-	if len(chapters) == 0 {
-		return fmt.Errorf("未从 EPUB 中提取到可阅读正文")
+	if book.title != "" {
+		novel.Title = book.title
+	}
+	if len(book.authors) > 0 {
+		novel.Author = strings.Join(book.authors, "、")
+	}
+	novel.Series = book.series
+	novel.SeriesIndex = book.seriesIndex
+	novel.Annotation = book.annotation
+	if coverDataURL := book.coverDataURL(); coverDataURL != "" {
+		novel.Cover = coverDataURL
 	}
 
-	novel.Content = contentBuilder.String()
-	novel.ContentLength = runeLen(novel.Content)
-	novel.Chapters = chapters
-	s.epubChapterHTML[novel.FilePath] = chapterHTMLs
+	builder := newEpubBookBuilder(len(book.chapters))
+	for _, draft := range book.buildDrafts() {
+		builder.appendDraft(draft)
+	}
+	if builder.chapterCount() == 0 {
+		return fmt.Errorf("未从 FB2 中提取到可阅读正文")
+	}
+
+	s.epubChapterHTML[novel.FilePath] = builder.finish(novel)
 	return nil
 }
 
+// isEpubStyleFormat 章节正文为 HTML、走 EPUB 富文本流程的格式
+func isEpubStyleFormat(format string) bool {
+	switch format {
+	case ".epub", ".mobi", ".azw3", ".fb2", ".fb2.zip":
+		return true
+	default:
+		return false
+	}
+}
+
 func (s *NovelService) getEpubChapterHTML(filePath string, chapterIndex int) string {
 	chapterHTMLs, exists := s.epubChapterHTML[filePath]
 	if !exists || chapterIndex < 0 || chapterIndex >= len(chapterHTMLs) {
@@ -541,12 +1070,22 @@ func (s *NovelService) getEpubChapterHTML(filePath string, chapterIndex int) str
 
 // parsePdfNovel 解析 PDF 格式小说
 func (s *NovelService) parsePdfNovel(novel *models.Novel) error {
-	file, reader, err := pdf.Open(novel.FilePath)
+	password, isSaved := s.pdfPassword(novel.FilePath)
+	file, reader, err := openPDFReader(novel.FilePath, password)
 	if err != nil {
-		if errors.Is(err, pdf.ErrInvalidPassword) {
-			return fmt.Errorf("暂不支持受密码保护的 PDF")
+		if !errors.Is(err, pdf.ErrInvalidPassword) {
+			return err
 		}
-		return fmt.Errorf("打开 PDF 文件失败: %w", err)
+		// 错误信息附带文件路径，通过文件选择器打开时前端据此带密码重新打开
+		if isSaved {
+			// 文件可能已更换密码，已保存的密码作废，重新向用户询问
+			_ = s.progressService.ForgetBookPassword(novel.FilePath)
+			return fmt.Errorf("%w: %s", errPDFPasswordRequired, novel.FilePath)
+		}
+		if password == "" {
+			return fmt.Errorf("%w: %s", errPDFPasswordRequired, novel.FilePath)
+		}
+		return fmt.Errorf("%w: %s", errPDFPasswordIncorrect, novel.FilePath)
 	}
 	defer file.Close()
 
@@ -557,21 +1096,34 @@ func (s *NovelService) parsePdfNovel(novel *models.Novel) error {
 		novel.Author = author
 	}
 
-	content, err := extractPDFPlainText(reader)
-	if err != nil {
-		return fmt.Errorf("解析 PDF 文本失败: %w", err)
-	}
+	novel.PageLabels = readPDFPageLabels(reader)
+	chapterRules, _ := compileChapterRuleSet(s.resolveChapterRules(novel.FilePath))
+	pageLines, pageLayouts := extractPDFPageLines(reader)
+	pageTexts, continued := buildPDFPageTexts(pageLines, s.resolvePDFOptions(novel.FilePath), chapterRules)
+	content, pageOffsets := joinPDFPageTexts(pageTexts, continued)
 	if content == "" {
-		return s.parseImageBasedPDFNovel(novel)
+		return s.parseImageBasedPDFNovel(novel, password)
 	}
 
 	novel.Content = content
 	novel.ContentLength = runeLen(content)
+	novel.PageOffsets = pageOffsets
+	summary, layouts := summarizePDFLayouts(pageLayouts)
+	novel.PDFLayout = &models.PDFLayout{Summary: summary, Pages: layouts}
+
+	// 有书签时按书签切分章节，否则沿用 TXT 的章节识别规则
+	if chapters := buildPDFOutlineChapters(content, pageOffsets, readPDFOutline(reader)); len(chapters) > 0 {
+		novel.Chapters = chapters
+		s.pdfOutlineBooks[novel.FilePath] = true
+		return nil
+	}
+	delete(s.pdfOutlineBooks, novel.FilePath)
 	return s.parseTxtNovel(novel)
 }
 
-func (s *NovelService) parseImageBasedPDFNovel(novel *models.Novel) error {
-	pageCount, err := getPDFPageCount(novel.FilePath)
+// parseImageBasedPDFNovel 按页渲染没有文本层的 PDF，password 为已验证过的打开密码
+func (s *NovelService) parseImageBasedPDFNovel(novel *models.Novel, password string) error {
+	pageCount, err := getPDFPageCount(novel.FilePath, password)
 	if err != nil {
 		return fmt.Errorf("未从 PDF 中提取到可阅读文本，且无法按页渲染 PDF: %w", err)
 	}
@@ -580,7 +1132,7 @@ func (s *NovelService) parseImageBasedPDFNovel(novel *models.Novel) error {
 	}
 
 	chapterHTMLs := make([]string, pageCount)
-	firstPageHTML, err := renderPDFChapterHTML(novel.FilePath, 0)
+	firstPageHTML, err := renderPDFChapterHTML(novel.FilePath, password, 0)
 	if err != nil {
 		return fmt.Errorf("未从 PDF 中提取到可阅读文本，且无法渲染 PDF 页面: %w", err)
 	}
@@ -590,17 +1142,265 @@ func (s *NovelService) parseImageBasedPDFNovel(novel *models.Novel) error {
 	novel.Content = content
 	novel.ContentLength = runeLen(content)
 	novel.Chapters = chapters
+	novel.PageOffsets = make([]int, len(chapters))
+	for index, chapter := range chapters {
+		novel.PageOffsets[index] = chapter.StartPos
+	}
+	if len(novel.PageLabels) != pageCount {
+		novel.PageLabels = nil
+	}
 	s.pdfChapterHTML[novel.FilePath] = chapterHTMLs
 	return nil
 }
 
+// parseComicNovel 解析 CBZ 漫画压缩包
+// 与图片型 PDF 一样按页生成章节，页面图片在阅读到时才读取
+func (s *NovelService) parseComicNovel(novel *models.Novel) error {
+	book, info, err := readComicArchive(novel.FilePath)
+	if err != nil {
+		return err
+	}
+
+	applyComicInfo(novel, info)
+	book.options = s.resolveComicOptions(novel.FilePath, book)
+	if coverDataURL, err := readComicCoverDataURL(novel.FilePath, book); err == nil {
+		novel.Cover = coverDataURL
+	}
+
+	content, chapters := book.buildStructure()
+	novel.Content = content
+	novel.ContentLength = runeLen(content)
+	novel.Chapters = chapters
+	s.comicBooks[novel.FilePath] = book
+	return nil
+}
+
+func readComicCoverDataURL(filePath string, book *comicBook) (string, error) {
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	fileMap := make(map[string]*zip.File, len(reader.File))
+	for _, file := range reader.File {
+		fileMap[normalizeZipPath(file.Name)] = file
+	}
+	return readComicPageDataURL(fileMap, book.pages[book.coverPage])
+}
+
+func (s *NovelService) getComicChapterHTML(filePath string, chapterIndex int) (string, error) {
+	book, exists := s.comicBooks[filePath]
+	if !exists || chapterIndex < 0 || chapterIndex >= len(book.chapterHTML) {
+		return "", fmt.Errorf("章节索引越界")
+	}
+
+	if book.chapterHTML[chapterIndex] != "" {
+		return book.chapterHTML[chapterIndex], nil
+	}
+
+	chapterHTML, err := renderComicChapterHTML(filePath, book, chapterIndex)
+	if err != nil {
+		return "", err
+	}
+
+	book.chapterHTML[chapterIndex] = chapterHTML
+	return chapterHTML, nil
+}
+
+// resolveComicOptions 获取漫画阅读选项，未保存时按 ComicInfo 的阅读方向、每章一页
+func (s *NovelService) resolveComicOptions(filePath string, book *comicBook) models.ComicOptions {
+	if s.progressService != nil {
+		if settings := s.progressService.GetBookSettings(filePath); settings != nil && settings.Comic != nil {
+			return normalizeComicOptions(*settings.Comic)
+		}
+	}
+
+	return normalizeComicOptions(models.ComicOptions{RightToLeft: book.rightToLeft, PagesPerChapter: 1})
+}
+
+// GetComicOptions 获取漫画的阅读选项
+func (s *NovelService) GetComicOptions(filePath string) (models.ComicOptions, error) {
+	book, exists := s.comicBooks[filePath]
+	if !exists {
+		return models.ComicOptions{}, fmt.Errorf("漫画未打开")
+	}
+	return book.options, nil
+}
+
+// SetComicOptions 设置漫画阅读方向和每章页数，并随书保存
+// 修改每章页数会重新生成章节，当前章节换算到包含原页面的新章节
+func (s *NovelService) SetComicOptions(filePath string, options models.ComicOptions) (*models.Novel, error) {
+	novel, exists := s.novels[filePath]
+	book, isComic := s.comicBooks[filePath]
+	if !exists || !isComic {
+		return nil, fmt.Errorf("漫画未打开")
+	}
+
+	options = normalizeComicOptions(options)
+	if s.progressService != nil {
+		settings := BookSettings{FilePath: filePath}
+		if saved := s.progressService.GetBookSettings(filePath); saved != nil {
+			settings = *saved
+		}
+		settings.Comic = &options
+		if err := s.progressService.SaveBookSettings(settings); err != nil {
+			return nil, err
+		}
+	}
+
+	currentPage := novel.CurrentChapter * book.options.PagesPerChapter
+	book.options = options
+	content, chapters := book.buildStructure()
+	novel.Content = content
+	novel.ContentLength = runeLen(content)
+	novel.Chapters = chapters
+	delete(s.textOffsets, filePath)
+	novel.CurrentChapter = clampInt(currentPage/options.PagesPerChapter, 0, maxInt(len(chapters)-1, 0))
+	return cloneNovelForClient(novel), nil
+}
+
+func defaultPDFOptions() models.PDFOptions {
+	return models.PDFOptions{RemovePageDecorations: true, ReflowParagraphs: true}
+}
+
+func (s *NovelService) resolvePDFOptions(filePath string) models.PDFOptions {
+	if s.progressService != nil {
+		if settings := s.progressService.GetBookSettings(filePath); settings != nil && settings.PDF != nil {
+			return *settings.PDF
+		}
+	}
+	return defaultPDFOptions()
+}
+
+// GetPDFOptions 获取 PDF 的文本提取选项
+func (s *NovelService) GetPDFOptions(filePath string) (models.PDFOptions, error) {
+	novel, exists := s.novels[filePath]
+	if !exists || novel.Format != ".pdf" {
+		return models.PDFOptions{}, fmt.Errorf("PDF 未打开")
+	}
+	return s.resolvePDFOptions(filePath), nil
+}
+
+// SetPDFOptions 设置 PDF 的文本提取选项并随书保存，设置后重新解析该书
+func (s *NovelService) SetPDFOptions(filePath string, options models.PDFOptions) (*models.Novel, error) {
+	novel, exists := s.novels[filePath]
+	if !exists || novel.Format != ".pdf" {
+		return nil, fmt.Errorf("PDF 未打开")
+	}
+
+	if s.progressService != nil {
+		settings := BookSettings{FilePath: filePath}
+		if saved := s.progressService.GetBookSettings(filePath); saved != nil {
+			settings = *saved
+		}
+		settings.PDF = &options
+		if err := s.progressService.SaveBookSettings(settings); err != nil {
+			return nil, err
+		}
+	}
+
+	s.releaseNovel(filePath)
+	return s.loadNovel(filePath, s.preferredEncoding(filePath))
+}
+
+func (s *NovelService) resolveTxtOptions(filePath string) models.TxtOptions {
+	if s.progressService != nil {
+		if settings := s.progressService.GetBookSettings(filePath); settings != nil && settings.Txt != nil {
+			return *settings.Txt
+		}
+	}
+	return models.TxtOptions{}
+}
+
+// GetTxtOptions 获取 TXT 的排版选项
+func (s *NovelService) GetTxtOptions(filePath string) (models.TxtOptions, error) {
+	novel, exists := s.novels[filePath]
+	if !exists || !isPlainTextNovel(novel) {
+		return models.TxtOptions{}, fmt.Errorf("TXT 未打开")
+	}
+	return s.resolveTxtOptions(filePath), nil
+}
+
+// SetTxtOptions 设置 TXT 的排版选项并随书保存，设置后重新解析该书
+func (s *NovelService) SetTxtOptions(filePath string, options models.TxtOptions) (*models.Novel, error) {
+	novel, exists := s.novels[filePath]
+	if !exists || !isPlainTextNovel(novel) {
+		return nil, fmt.Errorf("TXT 未打开")
+	}
+
+	if s.progressService != nil {
+		settings := BookSettings{FilePath: filePath}
+		if saved := s.progressService.GetBookSettings(filePath); saved != nil {
+			settings = *saved
+		}
+		settings.Txt = &options
+		if err := s.progressService.SaveBookSettings(settings); err != nil {
+			return nil, err
+		}
+	}
+
+	s.releaseNovel(filePath)
+	return s.loadNovel(filePath, s.preferredEncoding(filePath))
+}
+
 // ConvertFormat 格式转换
-// @param sourcePath 源文件路径
-// @param targetFormat 目标格式
+// @param sourcePath 源文件路径（需已打开）
+// @param targetFormat 目标格式：epub、txt、md（markdown）
+// @param outputDir 输出目录，为空时输出到源文件所在目录
 // @return 转换后的文件路径和错误
-func (s *NovelService) ConvertFormat(sourcePath, targetFormat string) (string, error) {
-	// TODO: 实现格式转换逻辑
-	return "", fmt.Errorf("格式转换功能即将支持")
+func (s *NovelService) ConvertFormat(sourcePath, targetFormat, outputDir string) (string, error) {
+	novel, exists := s.novels[sourcePath]
+	if !exists {
+		return "", fmt.Errorf("小说未打开")
+	}
+
+	if strings.TrimSpace(outputDir) == "" {
+		outputDir = filepath.Dir(sourcePath)
+	}
+	if info, err := os.Stat(outputDir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("输出目录不存在: %s", outputDir)
+	}
+
+	writers := map[string]func(string, *models.Novel, []exportChapter) error{
+		"epub": writeNovelEpub,
+		"txt":  writeNovelText,
+		"md":   writeNovelMarkdown,
+	}
+	extension := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(targetFormat)), ".")
+	if extension == "markdown" {
+		extension = "md"
+	}
+	writeNovel, supported := writers[extension]
+	if !supported {
+		return "", fmt.Errorf("暂不支持转换为 %s 格式", targetFormat)
+	}
+
+	chapters, err := s.collectExportChapters(novel)
+	if err != nil {
+		return "", err
+	}
+	outputPath := uniqueExportPath(outputDir, exportFileBaseName(novel), "."+extension)
+	if err := writeNovel(outputPath, novel, chapters); err != nil {
+		return "", err
+	}
+	return outputPath, nil
+}
+
+// hasChapterHTML 章节正文是否由 GetChapterContent 以 HTML 形式提供
+func (s *NovelService) hasChapterHTML(novel *models.Novel) bool {
+	switch {
+	case isEpubStyleFormat(novel.Format):
+		_, exists := s.epubChapterHTML[novel.FilePath]
+		return exists
+	case novel.Format == ".pdf":
+		_, exists := s.pdfChapterHTML[novel.FilePath]
+		return exists
+	case novel.Format == ".cbz":
+		return true
+	default:
+		return false
+	}
 }
 
 // getCurrentTimestamp 获取当前时间戳
@@ -608,62 +1408,115 @@ func getCurrentTimestamp() int64 {
 	return time.Now().Unix()
 }
 
-func extractPDFPlainText(reader *pdf.Reader) (string, error) {
-	totalPages := reader.NumPage()
-	if totalPages <= 0 {
-		return "", nil
+// buildPDFPageTexts 生成每页文本，返回值下标为从 0 开始的页码，无文本的页面为空字符串
+// 按选项先去掉页眉、页脚和页码，再规范化每行文本并重排段落；
+// continued 标记该页开头是否接续上一页的段落
+func buildPDFPageTexts(pageLines [][]pdfPageLine, options models.PDFOptions, chapterRules []compiledChapterRule) ([]string, []bool) {
+	if options.RemovePageDecorations {
+		pageLines = stripPDFPageDecorations(pageLines, chapterRules)
 	}
 
-	pages := make([]string, 0, totalPages)
-
-	for pageIndex := 1; pageIndex <= totalPages; pageIndex++ {
-		page := reader.Page(pageIndex)
-		if page.V.IsNull() || page.V.Key("Contents").Kind() == pdf.Null {
-			continue
+	pages := make([][]reflowLine, len(pageLines))
+	for pageIndex, lines := range pageLines {
+		left := math.Inf(1)
+		for _, line := range lines {
+			left = math.Min(left, line.x)
+		}
+		for _, line := range lines {
+			if text := normalizePDFText(line.text); text != "" {
+				pages[pageIndex] = append(pages[pageIndex], reflowLine{text: text, indent: line.x-left >= pdfIndentMinOffset})
+			}
 		}
+	}
 
-		rows, err := page.GetTextByRow()
-		if err != nil {
-			return "", err
+	var reflower *paragraphReflower
+	if options.ReflowParagraphs {
+		reflower = newParagraphReflower(slices.Concat(pages...), chapterRules)
+	}
+
+	texts := make([]string, len(pages))
+	continued := make([]bool, len(pages))
+	var previous reflowLine
+	for pageIndex, lines := range pages {
+		if len(lines) == 0 {
+			continue
 		}
 
-		pageLines := make([]string, 0, len(rows))
-		for _, row := range rows {
-			fragments := make([]string, 0, len(row.Content))
-			flushLine := func() {
-				line := joinPDFFragments(fragments)
-				line = normalizePDFText(line)
-				if line != "" {
-					pageLines = append(pageLines, line)
-				}
-				fragments = fragments[:0]
+		if reflower == nil {
+			lineTexts := make([]string, len(lines))
+			for index, line := range lines {
+				lineTexts[index] = line.text
 			}
+			texts[pageIndex] = strings.Join(lineTexts, "\n")
+		} else {
+			texts[pageIndex] = strings.Join(reflower.reflowLines(lines), "\n")
+			continued[pageIndex] = previous.text != "" && reflower.shouldJoin(previous, lines[0])
+		}
+		previous = lines[len(lines)-1]
+	}
 
-			for _, text := range row.Content {
-				fragment := normalizePDFText(text.S)
-				if fragment == "" {
-					if len(fragments) > 0 {
-						flushLine()
-					}
-					continue
-				}
+	return texts, continued
+}
 
-				fragments = append(fragments, fragment)
-			}
+// extractPDFPageLines 按字形坐标提取每页文本行，行序为判断分栏与书写方向后的阅读顺序
+func extractPDFPageLines(reader *pdf.Reader) ([][]pdfPageLine, []pdfPageLayout) {
+	totalPages := reader.NumPage()
+	if totalPages <= 0 {
+		return nil, nil
+	}
 
-			if len(fragments) > 0 {
-				flushLine()
-			}
+	pages := make([][]pdfPageLine, totalPages)
+	layouts := make([]pdfPageLayout, totalPages)
+	for pageIndex := 1; pageIndex <= totalPages; pageIndex++ {
+		page := reader.Page(pageIndex)
+		if page.V.IsNull() {
+			continue
 		}
+		pages[pageIndex-1], layouts[pageIndex-1] = arrangePDFPageLines(collectPDFTextRuns(page))
+	}
+
+	return pages, layouts
+}
 
-		if len(pageLines) == 0 {
+// joinPDFPageTexts 以空行连接各页文本，接续上一页段落的页面直接接在上一页末尾；
+// 同时返回每页在正文中的起始位置（rune），无文本的页面起始位置与下一个有文本的页面相同
+func joinPDFPageTexts(pageTexts []string, continued []bool) (string, []int) {
+	var buffer []byte
+	pageOffsets := make([]int, len(pageTexts))
+	currentOffset := 0
+
+	for pageIndex, pageText := range pageTexts {
+		if pageText == "" {
+			pageOffsets[pageIndex] = -1
 			continue
 		}
+		if len(buffer) > 0 {
+			if pageIndex < len(continued) && continued[pageIndex] {
+				// 只需要末尾的两个字符判断如何拼接
+				trim, separator := reflowJoint(string(buffer[max(0, len(buffer)-16):]), pageText)
+				currentOffset -= utf8.RuneCount(buffer[len(buffer)-trim:])
+				buffer = append(buffer[:len(buffer)-trim], separator...)
+				currentOffset += runeLen(separator)
+			} else {
+				buffer = append(buffer, "\n\n"...)
+				currentOffset += 2
+			}
+		}
+		pageOffsets[pageIndex] = currentOffset
+		buffer = append(buffer, pageText...)
+		currentOffset += runeLen(pageText)
+	}
 
-		pages = append(pages, strings.Join(pageLines, "\n"))
+	nextOffset := currentOffset
+	for pageIndex := len(pageOffsets) - 1; pageIndex >= 0; pageIndex-- {
+		if pageOffsets[pageIndex] < 0 {
+			pageOffsets[pageIndex] = nextOffset
+		} else {
+			nextOffset = pageOffsets[pageIndex]
+		}
 	}
 
-	return strings.TrimSpace(strings.Join(pages, "\n\n")), nil
+	return string(buffer), pageOffsets
 }
 
 func normalizePDFText(content string) string {
@@ -694,12 +1547,20 @@ func normalizePDFText(content string) string {
 }
 
 func buildImagePDFStructure(pageCount int) (string, []models.Chapter) {
+	titles := make([]string, 0, pageCount)
+	for pageIndex := 0; pageIndex < pageCount; pageIndex++ {
+		titles = append(titles, fmt.Sprintf("第%d页", pageIndex+1))
+	}
+	return buildImagePageStructure(titles)
+}
+
+// buildImagePageStructure 为按页阅读的图片型内容生成占位正文和章节，正文只包含各章标题
+func buildImagePageStructure(titles []string) (string, []models.Chapter) {
 	var contentBuilder strings.Builder
-	chapters := make([]models.Chapter, 0, pageCount)
+	chapters := make([]models.Chapter, 0, len(titles))
 	currentOffset := 0
 
-	for pageIndex := 0; pageIndex < pageCount; pageIndex++ {
-		title := fmt.Sprintf("第%d页", pageIndex+1)
+	for chapterIndex, title := range titles {
 		if contentBuilder.Len() > 0 {
 			contentBuilder.WriteString("\n\n")
 			currentOffset += runeLen("\n\n")
@@ -710,33 +1571,18 @@ func buildImagePDFStructure(pageCount int) (string, []models.Chapter) {
 		currentOffset += runeLen(title)
 
 		chapters = append(chapters, models.Chapter{
-			Index:     pageIndex,
-			Title:     title,
-			StartPos:  startPos,
-			EndPos:    currentOffset,
-			WordCount: runeLen(title),
+			Index:       chapterIndex,
+			Title:       title,
+			StartPos:    startPos,
+			EndPos:      currentOffset,
+			WordCount:   runeLen(title),
+			ParentIndex: -1,
 		})
 	}
 
 	return contentBuilder.String(), chapters
 }
 
-func joinPDFFragments(fragments []string) string {
-	if len(fragments) == 0 {
-		return ""
-	}
-
-	var builder strings.Builder
-	for index, fragment := range fragments {
-		if index > 0 && shouldInsertSpaceBetweenPDFFragments(fragments[index-1], fragment) {
-			builder.WriteByte(' ')
-		}
-		builder.WriteString(fragment)
-	}
-
-	return builder.String()
-}
-
 func shouldInsertSpaceBetweenPDFFragments(left, right string) bool {
 	if left == "" || right == "" {
 		return false
@@ -768,7 +1614,8 @@ func (s *NovelService) getPDFChapterHTML(filePath string, chapterIndex int) (str
 		return chapterHTMLs[chapterIndex], nil
 	}
 
-	chapterHTML, err := renderPDFChapterHTML(filePath, chapterIndex)
+	password, _ := s.pdfPassword(filePath)
+	chapterHTML, err := renderPDFChapterHTML(filePath, password, chapterIndex)
 	if err != nil {
 		return "", err
 	}
@@ -778,8 +1625,8 @@ func (s *NovelService) getPDFChapterHTML(filePath string, chapterIndex int) (str
 	return chapterHTML, nil
 }
 
-func renderPDFChapterHTML(filePath string, chapterIndex int) (string, error) {
-	dataURL, err := renderPDFPageDataURL(filePath, chapterIndex)
+func renderPDFChapterHTML(filePath, password string, chapterIndex int) (string, error) {
+	dataURL, err := renderPDFPageDataURL(filePath, password, chapterIndex)
 	if err != nil {
 		return "", fmt.Errorf("渲染第 %d 页失败: %w", chapterIndex+1, err)
 	}
@@ -970,6 +1817,7 @@ type epubPackage struct {
 		Items []epubManifestItem `xml:"item"`
 	} `xml:"manifest"`
 	Spine struct {
+		Toc      string `xml:"toc,attr"`
 		ItemRefs []struct {
 			IDRef string `xml:"idref,attr"`
 		} `xml:"itemref"`
@@ -1119,6 +1967,18 @@ func extractEpubChapterContent(
 	fileMap map[string]*zip.File,
 	markup string,
 	markupPath string,
+) (string, string, string) {
+	baseDir := normalizeZipPath(path.Dir(markupPath))
+	return extractRichChapterContent(markup, func(reference string) (string, error) {
+		return resolveEpubAssetDataURL(fileMap, baseDir, reference)
+	})
+}
+
+// extractRichChapterContent 从 HTML 文档中提取标题、纯文本和净化后的富文本
+// resolveAsset 负责把图片引用转换为 data URL，不同格式的图片来源不同
+func extractRichChapterContent(
+	markup string,
+	resolveAsset func(reference string) (string, error),
 ) (string, string, string) {
 	title, text := extractEpubChapterText(markup)
 	text = trimLeadingEpubTitle(text, title)
@@ -1134,8 +1994,7 @@ func extractEpubChapterContent(
 	}
 
 	renderer := &epubHTMLRenderer{
-		fileMap:      fileMap,
-		baseDir:      normalizeZipPath(path.Dir(markupPath)),
+		resolveAsset: resolveAsset,
 		chapterTitle: title,
 	}
 	htmlContent := strings.TrimSpace(renderer.renderChildren(body))
@@ -1180,8 +2039,7 @@ func findEpubBodyNode(node *xhtml.Node) *xhtml.Node {
 }
 
 type epubHTMLRenderer struct {
-	fileMap             map[string]*zip.File
-	baseDir             string
+	resolveAsset        func(reference string) (string, error)
 	chapterTitle        string
 	skippedTitleHeading bool
 }
@@ -1288,7 +2146,10 @@ func (r *epubHTMLRenderer) renderImageNode(node *xhtml.Node) string {
 		}
 	}
 
-	dataURL, err := resolveEpubAssetDataURL(r.fileMap, r.baseDir, src)
+	if r.resolveAsset == nil {
+		return ""
+	}
+	dataURL, err := r.resolveAsset(src)
 	if err != nil || dataURL == "" {
 		return ""
 	}
@@ -3,16 +3,49 @@ package services
 import (
 	"archive/zip"
 	"bytes"
+	"compress/zlib"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rc4"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"unicode/utf16"
 
 	"github.com/nongchen1223/moyureader/backend/models"
+	"golang.org/x/text/encoding/simplifiedchinese"
 )
 
+// TestMain 把加密已保存密码的本机密钥放到临时目录，测试不触碰真实的用户配置目录
+func TestMain(m *testing.M) {
+	keyDir, err := os.MkdirTemp("", "moyureader-secret-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	secretKeyDir = func() (string, error) { return keyDir, nil }
+
+	code := m.Run()
+	os.RemoveAll(keyDir)
+	os.Exit(code)
+}
+
 func TestParseEpubNovelExtractsDirectCoverImage(t *testing.T) {
 	epubPath := createTestEPUB(t, map[string][]byte{
 		"META-INF/container.xml": []byte(`<?xml version="1.0" encoding="UTF-8"?>
@@ -233,6 +266,293 @@ func TestParsePdfNovelExtractsMetadataTextAndChapters(t *testing.T) {
 	}
 }
 
+func TestParsePdfNovelBuildsChaptersFromOutline(t *testing.T) {
+	pdfPath := createTestPDFWithOptions(t, testPDFOptions{
+		title:  "Outline Sample",
+		author: "PDF Author",
+		pages: []string{
+			"Cover page",
+			"Part One\nOpening Scene\nThe story begins.",
+			"More of the opening.\nSecond Scene\nIt continues.",
+			"",
+			"Part Two\nThe end.",
+		},
+		outline: []testPDFOutline{
+			{title: "Part One", page: 1, children: []testPDFOutline{
+				{title: "Opening Scene", page: 1},
+				{title: "Second Scene", page: 2, named: true},
+			}},
+			{title: "Part Two", page: 4},
+		},
+	})
+
+	service := NewNovelService(nil)
+	novel := &models.Novel{FilePath: pdfPath, Format: ".pdf"}
+	if err := service.parsePdfNovel(novel); err != nil {
+		t.Fatalf("parsePdfNovel returned error: %v", err)
+	}
+
+	expected := []struct {
+		title  string
+		level  int
+		parent int
+		starts string
+	}{
+		{"Part One", 0, -1, "Part One\n"},
+		{"Opening Scene", 1, 0, "Opening Scene\nThe story begins."},
+		{"Second Scene", 1, 0, "Second Scene\nIt continues."},
+		{"Part Two", 0, -1, "Part Two\nThe end."},
+	}
+	if len(novel.Chapters) != len(expected) {
+		t.Fatalf("expected %d outline chapters, got %+v", len(expected), novel.Chapters)
+	}
+	for index, want := range expected {
+		chapter := novel.Chapters[index]
+		text := sliceByRuneRange(novel.Content, chapter.StartPos, chapter.EndPos)
+		if chapter.Title != want.title || chapter.Level != want.level || chapter.ParentIndex != want.parent || !strings.HasPrefix(text, want.starts) {
+			t.Fatalf("chapter %d: expected %+v, got %+v with text %q", index, want, chapter, text)
+		}
+	}
+	if !strings.Contains(sliceByRuneRange(novel.Content, novel.Chapters[1].StartPos, novel.Chapters[1].EndPos), "More of the opening.") {
+		t.Fatalf("expected page text before the next bookmark to stay in the previous chapter")
+	}
+
+	service.novels[pdfPath] = novel
+	if _, err := service.ApplyChapterRules(pdfPath, models.ChapterRuleSet{}); err == nil {
+		t.Fatalf("expected chapter rules to be rejected for outline-based PDF")
+	}
+}
+
+func TestReadPDFOutlineDistinguishesIdenticalPageDicts(t *testing.T) {
+	pdfPath := createTestPDFWithOptions(t, testPDFOptions{
+		title: "Identical Pages",
+		pages: []string{"Cover page", "Blank", "Blank", "Epilogue"},
+		outline: []testPDFOutline{
+			{title: "Cover", page: 0},
+			{title: "Interlude", page: 2},
+			{title: "Epilogue", page: 3},
+		},
+		// 第 2、3 页字典逐字相同，只能靠间接引用区分
+		sharedContents: map[int]int{2: 1},
+	})
+
+	file, reader, err := openPDFReader(pdfPath, "")
+	if err != nil {
+		t.Fatalf("openPDFReader returned error: %v", err)
+	}
+	defer file.Close()
+
+	entries := readPDFOutline(reader)
+	if len(entries) != 3 || entries[1].page != 2 || entries[2].page != 3 {
+		t.Fatalf("expected bookmarks to resolve to their own pages, got %+v", entries)
+	}
+}
+
+func TestOpenNovelWithOptionsDecryptsAndRemembersPDFPassword(t *testing.T) {
+	pdfPath := createTestPDFWithOptions(t, testPDFOptions{
+		title:    "Secret Sample",
+		author:   "PDF Author",
+		pages:    []string{"Chapter 1 Locked\nHidden text."},
+		password: "open-sesame",
+	})
+	progressService := NewProgressService(t.TempDir())
+
+	service := NewNovelService(progressService)
+	if _, err := service.OpenNovel(pdfPath); !errors.Is(err, errPDFPasswordRequired) {
+		t.Fatalf("expected password required error, got %v", err)
+	}
+	if _, err := service.OpenNovelWithOptions(pdfPath, models.OpenOptions{Password: "wrong"}); !errors.Is(err, errPDFPasswordIncorrect) {
+		t.Fatalf("expected incorrect password error, got %v", err)
+	}
+
+	novel, err := service.OpenNovelWithOptions(pdfPath, models.OpenOptions{Password: "open-sesame", RememberPassword: true})
+	if err != nil {
+		t.Fatalf("OpenNovelWithOptions returned error: %v", err)
+	}
+	if novel.Title != "Secret Sample" || !strings.Contains(service.novels[pdfPath].Content, "Hidden text.") {
+		t.Fatalf("expected decrypted metadata and text, got %q %q", novel.Title, service.novels[pdfPath].Content)
+	}
+
+	progressData, err := os.ReadFile(progressService.filePath)
+	if err != nil {
+		t.Fatalf("read progress file: %v", err)
+	}
+	if strings.Contains(string(progressData), "open-sesame") {
+		t.Fatalf("expected remembered password to be stored encrypted")
+	}
+
+	reopened := NewNovelService(progressService)
+	if _, err := reopened.OpenNovel(pdfPath); err != nil {
+		t.Fatalf("expected remembered password to open the PDF, got %v", err)
+	}
+
+	if err := reopened.ForgetPassword(pdfPath); err != nil {
+		t.Fatalf("ForgetPassword returned error: %v", err)
+	}
+	if _, err := NewNovelService(progressService).OpenNovel(pdfPath); !errors.Is(err, errPDFPasswordRequired) {
+		t.Fatalf("expected password to be forgotten, got %v", err)
+	}
+}
+
+func TestOpenNovelWithOptionsValidatesPasswordForCachedBook(t *testing.T) {
+	pdfPath := createTestPDFWithOptions(t, testPDFOptions{
+		title:    "Secret Sample",
+		pages:    []string{"Chapter 1 Locked\nHidden text."},
+		password: "open-sesame",
+	})
+	plainPDFPath := createTestPDF(t, "Plain Sample", "PDF Author", []string{"Chapter 1\nOpen text."})
+	txtPath := filepath.Join(t.TempDir(), "plain.txt")
+	if err := os.WriteFile(txtPath, []byte("第一章 开始\n正文"), 0644); err != nil {
+		t.Fatalf("write txt file: %v", err)
+	}
+	progressService := NewProgressService(t.TempDir())
+	service := NewNovelService(progressService)
+
+	if _, err := service.OpenNovelWithOptions(pdfPath, models.OpenOptions{Password: "open-sesame"}); err != nil {
+		t.Fatalf("OpenNovelWithOptions returned error: %v", err)
+	}
+	// 书已在缓存中，错误的密码仍需被拒绝且不能被保存
+	if _, err := service.OpenNovelWithOptions(pdfPath, models.OpenOptions{Password: "wrong", RememberPassword: true}); !errors.Is(err, errPDFPasswordIncorrect) {
+		t.Fatalf("expected incorrect password error for cached book, got %v", err)
+	}
+	if password := progressService.GetBookPassword(pdfPath); password != "" {
+		t.Fatalf("expected wrong password not to be remembered, got %q", password)
+	}
+	if password, _ := service.pdfPassword(pdfPath); password != "open-sesame" {
+		t.Fatalf("expected session password to stay unchanged, got %q", password)
+	}
+
+	if _, err := service.OpenNovelWithOptions(txtPath, models.OpenOptions{Password: "secret", RememberPassword: true}); err == nil {
+		t.Fatal("expected password for a TXT file to be rejected")
+	}
+	if _, err := service.OpenNovelWithOptions(plainPDFPath, models.OpenOptions{Password: "secret", RememberPassword: true}); err != nil {
+		t.Fatalf("expected unencrypted PDF to open, got %v", err)
+	}
+	for _, path := range []string{txtPath, plainPDFPath} {
+		if password := progressService.GetBookPassword(path); password != "" {
+			t.Fatalf("expected no password to be remembered for %s, got %q", path, password)
+		}
+	}
+}
+
+func TestSavedPasswordKeyStaysOutOfDataDir(t *testing.T) {
+	keyDir := t.TempDir()
+	previousKeyDir := secretKeyDir
+	secretKeyDir = func() (string, error) { return keyDir, nil }
+	t.Cleanup(func() { secretKeyDir = previousKeyDir })
+
+	dataDir := t.TempDir()
+	progressService := NewProgressService(dataDir)
+
+	// 并发的首次保存只能生成一把密钥，否则先保存的密码无法解密
+	const bookCount = 8
+	var wg sync.WaitGroup
+	for index := 0; index < bookCount; index++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			if err := progressService.SaveBookPassword(fmt.Sprintf("/books/%d.pdf", index), fmt.Sprintf("pw-%d", index)); err != nil {
+				t.Errorf("SaveBookPassword returned error: %v", err)
+			}
+		}(index)
+	}
+	wg.Wait()
+	for index := 0; index < bookCount; index++ {
+		if password := progressService.GetBookPassword(fmt.Sprintf("/books/%d.pdf", index)); password != fmt.Sprintf("pw-%d", index) {
+			t.Fatalf("expected password of book %d to decrypt, got %q", index, password)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dataDir, secretKeyFileName)); !os.IsNotExist(err) {
+		t.Fatalf("expected no key in the data dir, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(keyDir, secretKeyFileName)); err != nil {
+		t.Fatalf("expected key in the per-user dir: %v", err)
+	}
+
+	// 切换数据目录后密钥不被复制过去，已保存的密码仍可解密
+	nextDataDir := t.TempDir()
+	if err := progressService.SetDataDir(nextDataDir); err != nil {
+		t.Fatalf("SetDataDir returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(nextDataDir, secretKeyFileName)); !os.IsNotExist(err) {
+		t.Fatalf("expected key not to follow the data dir, got %v", err)
+	}
+	if password := progressService.GetBookPassword("/books/0.pdf"); password != "pw-0" {
+		t.Fatalf("expected password to decrypt after switching data dir, got %q", password)
+	}
+}
+
+func TestSavedPasswordAdoptsLegacyKeyFromDataDir(t *testing.T) {
+	legacyDataDir := t.TempDir()
+	previousKeyDir := secretKeyDir
+	secretKeyDir = func() (string, error) { return legacyDataDir, nil }
+	legacy := NewProgressService(legacyDataDir)
+	if err := legacy.SaveBookPassword("/books/old.pdf", "legacy-pw"); err != nil {
+		t.Fatalf("SaveBookPassword returned error: %v", err)
+	}
+
+	// 模拟旧版本：密钥位于数据目录，本机配置目录还没有密钥
+	keyDir := t.TempDir()
+	secretKeyDir = func() (string, error) { return keyDir, nil }
+	t.Cleanup(func() { secretKeyDir = previousKeyDir })
+
+	progressService := NewProgressService(legacyDataDir)
+	progressService.load()
+	if password := progressService.GetBookPassword("/books/old.pdf"); password != "legacy-pw" {
+		t.Fatalf("expected legacy password to decrypt, got %q", password)
+	}
+	if _, err := os.Stat(filepath.Join(legacyDataDir, secretKeyFileName)); !os.IsNotExist(err) {
+		t.Fatalf("expected legacy key to be moved out of the data dir, got %v", err)
+	}
+}
+
+func TestParsePdfNovelStripsRunningHeadersAndPageNumbers(t *testing.T) {
+	pages := make([]string, 5)
+	for index := range pages {
+		pages[index] = fmt.Sprintf("The Sample Book\nChapter %d\nScene %d goes on quietly.\n%d", index+1, index+1, index+1)
+	}
+	pdfPath := createTestPDF(t, "Running Header Sample", "PDF Author", pages)
+
+	service := NewNovelService(NewProgressService(t.TempDir()))
+	novel, err := service.OpenNovel(pdfPath)
+	if err != nil {
+		t.Fatalf("OpenNovel returned error: %v", err)
+	}
+
+	content := service.novels[pdfPath].Content
+	if strings.Contains(content, "The Sample Book") {
+		t.Fatalf("expected running header to be removed, got %q", content)
+	}
+	for _, line := range strings.Split(content, "\n") {
+		if regexp.MustCompile(`^\d+$`).MatchString(line) {
+			t.Fatalf("expected page numbers to be removed, got %q", content)
+		}
+	}
+	if len(novel.Chapters) != 5 || novel.Chapters[4].Title != "Chapter 5" {
+		t.Fatalf("expected chapter headings to survive, got %+v", novel.Chapters)
+	}
+
+	options, err := service.GetPDFOptions(pdfPath)
+	if err != nil || !options.RemovePageDecorations {
+		t.Fatalf("expected header removal to be enabled by default, got %+v, %v", options, err)
+	}
+	if _, err := service.SetPDFOptions(pdfPath, models.PDFOptions{RemovePageDecorations: false}); err != nil {
+		t.Fatalf("SetPDFOptions returned error: %v", err)
+	}
+	if content := service.novels[pdfPath].Content; !strings.Contains(content, "The Sample Book") || !strings.HasSuffix(content, "\n5") {
+		t.Fatalf("expected page decorations to be kept after disabling removal, got %q", content)
+	}
+
+	reopened := NewNovelService(service.progressService)
+	if _, err := reopened.OpenNovel(pdfPath); err != nil {
+		t.Fatalf("reopen returned error: %v", err)
+	}
+	if !strings.Contains(reopened.novels[pdfPath].Content, "The Sample Book") {
+		t.Fatal("expected the per-book option to be remembered")
+	}
+}
+
 func TestParsePdfNovelFallsBackToRenderedPagesWhenNoReadableText(t *testing.T) {
 	if runtime.GOOS != "darwin" {
 		t.Skip("image-based PDF fallback currently relies on macOS PDF rendering")
@@ -272,121 +592,1614 @@ func TestParsePdfNovelFallsBackToRenderedPagesWhenNoReadableText(t *testing.T) {
 	}
 }
 
-func createTestEPUB(t *testing.T, files map[string][]byte) string {
-	t.Helper()
+func TestParsePdfNovelExtractsEmbeddedPageImages(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("macOS renders image-based PDF pages with the system renderer")
+	}
 
-	tempDir := t.TempDir()
-	epubPath := filepath.Join(tempDir, "sample.epub")
-	outputFile, err := os.Create(epubPath)
+	var jpegData bytes.Buffer
+	photo := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	draw.Draw(photo, photo.Bounds(), image.NewUniform(color.RGBA{R: 200, A: 255}), image.Point{}, draw.Src)
+	if err := jpeg.Encode(&jpegData, photo, nil); err != nil {
+		t.Fatalf("encode jpeg: %v", err)
+	}
+
+	// 上下两条灰度条带拼成一页，Flate 压缩并使用 PNG Up 预测
+	buildStrip := func(value byte) []byte {
+		var compressed bytes.Buffer
+		writer := zlib.NewWriter(&compressed)
+		for row := 0; row < 10; row++ {
+			line := make([]byte, 21)
+			line[0] = 2
+			if row == 0 {
+				for column := 1; column < len(line); column++ {
+					line[column] = value
+				}
+			}
+			writer.Write(line)
+		}
+		writer.Close()
+		return compressed.Bytes()
+	}
+	stripDict := "/Width 20 /Height 10 /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode /DecodeParms << /Predictor 15 /Colors 1 /Columns 20 >>"
+
+	pdfPath := createTestPDFWithOptions(t, testPDFOptions{
+		title: "Scanned PDF",
+		pages: []string{"", ""},
+		images: [][]testPDFImage{
+			{
+				{dict: "/Width 16 /Height 8 /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode", data: jpegData.Bytes(), width: 612, height: 792},
+			},
+			{
+				{dict: stripDict, data: buildStrip(200), y: 396, width: 612, height: 396},
+				{dict: stripDict, data: buildStrip(40), width: 612, height: 396},
+			},
+		},
+	})
+
+	service := NewNovelService(nil)
+	novel := &models.Novel{
+		FilePath: pdfPath,
+		Format:   ".pdf",
+	}
+	if err := service.parsePdfNovel(novel); err != nil {
+		t.Fatalf("expected image-based PDF to parse, got %v", err)
+	}
+	if len(novel.Chapters) != 2 {
+		t.Fatalf("expected 2 page chapters, got %d", len(novel.Chapters))
+	}
+
+	html, err := service.getPDFChapterHTML(pdfPath, 0)
 	if err != nil {
-		t.Fatalf("create epub file: %v", err)
+		t.Fatalf("expected first page html, got %v", err)
+	}
+	if !strings.Contains(html, "data:image/jpeg;base64,"+base64.StdEncoding.EncodeToString(jpegData.Bytes())) {
+		t.Fatalf("expected JPEG image to be passed through, got %q", html)
 	}
-	defer outputFile.Close()
 
-	writer := zip.NewWriter(outputFile)
-	for name, content := range files {
-		entryWriter, err := writer.Create(name)
+	html, err = service.getPDFChapterHTML(pdfPath, 1)
+	if err != nil {
+		t.Fatalf("expected second page html, got %v", err)
+	}
+	match := regexp.MustCompile(`data:image/png;base64,([^"]+)`).FindStringSubmatch(html)
+	if match == nil {
+		t.Fatalf("expected composed png data url, got %q", html)
+	}
+	data, err := base64.StdEncoding.DecodeString(match[1])
+	if err != nil {
+		t.Fatalf("decode data url: %v", err)
+	}
+	page, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode png: %v", err)
+	}
+
+	bounds := page.Bounds()
+	top := color.GrayModel.Convert(page.At(bounds.Dx()/2, bounds.Dy()/4)).(color.Gray).Y
+	bottom := color.GrayModel.Convert(page.At(bounds.Dx()/2, bounds.Dy()*3/4)).(color.Gray).Y
+	if top != 200 || bottom != 40 {
+		t.Fatalf("expected strips to be stacked top 200 / bottom 40, got %d / %d", top, bottom)
+	}
+}
+
+func TestOpenNovelWithOptionsRendersEncryptedImageBasedPDF(t *testing.T) {
+	var jpegData bytes.Buffer
+	photo := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	draw.Draw(photo, photo.Bounds(), image.NewUniform(color.RGBA{G: 180, A: 255}), image.Point{}, draw.Src)
+	if err := jpeg.Encode(&jpegData, photo, nil); err != nil {
+		t.Fatalf("encode jpeg: %v", err)
+	}
+	// PNG Up 预测的 Flate 灰度图
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	for row := 0; row < 10; row++ {
+		line := make([]byte, 21)
+		line[0] = 2
+		if row == 0 {
+			for column := 1; column < len(line); column++ {
+				line[column] = 120
+			}
+		}
+		writer.Write(line)
+	}
+	writer.Close()
+	images := [][]testPDFImage{
+		{{dict: "/Width 16 /Height 8 /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode", data: jpegData.Bytes(), width: 612, height: 792}},
+		{{dict: "/Width 20 /Height 10 /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode /DecodeParms << /Predictor 15 /Colors 1 /Columns 20 >>", data: compressed.Bytes(), width: 612, height: 792}},
+	}
+
+	for _, useAES := range []bool{false, true} {
+		pdfPath := createTestPDFWithOptions(t, testPDFOptions{
+			pages:    []string{"", ""},
+			images:   images,
+			password: "open-sesame",
+			aes:      useAES,
+		})
+
+		service := NewNovelService(nil)
+		novel, err := service.OpenNovelWithOptions(pdfPath, models.OpenOptions{Password: "open-sesame"})
 		if err != nil {
-			t.Fatalf("create zip entry %s: %v", name, err)
+			t.Fatalf("aes=%v: expected encrypted image-based PDF to open, got %v", useAES, err)
+		}
+		if len(novel.Chapters) != 2 {
+			t.Fatalf("aes=%v: expected 2 page chapters, got %d", useAES, len(novel.Chapters))
 		}
 
-		if _, err := entryWriter.Write(content); err != nil {
-			t.Fatalf("write zip entry %s: %v", name, err)
+		// 第二页在翻到时才渲染，需要沿用本次会话输入的密码
+		html, err := service.getPDFChapterHTML(pdfPath, 0)
+		if err != nil {
+			t.Fatalf("aes=%v: expected page 1 html, got %v", useAES, err)
+		}
+		if runtime.GOOS != "darwin" && !strings.Contains(html, "data:image/jpeg;base64,"+base64.StdEncoding.EncodeToString(jpegData.Bytes())) {
+			t.Fatalf("aes=%v: expected decrypted JPEG to be passed through, got %q", useAES, html)
+		}
+		html, err = service.getPDFChapterHTML(pdfPath, 1)
+		if err != nil {
+			t.Fatalf("aes=%v: expected page 2 html, got %v", useAES, err)
+		}
+		if !strings.Contains(html, "data:image/") {
+			t.Fatalf("aes=%v: expected page 2 to be rendered as an image, got %q", useAES, html)
 		}
 	}
+}
 
-	if err := writer.Close(); err != nil {
-		t.Fatalf("close zip writer: %v", err)
+func TestPDFImageStreamLimits(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("macOS renders image-based PDF pages with the system renderer")
 	}
 
-	return epubPath
-}
+	pixels := bytes.Repeat([]byte{90}, 20*10)
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	writer.Write(pixels)
+	writer.Close()
 
-func createTestPDF(t *testing.T, title, author string, pageTexts []string) string {
-	t.Helper()
+	// /Length 远大于文件本身时按文件剩余部分读取，不按声明的长度分配内存
+	pdfPath := createTestPDFWithOptions(t, testPDFOptions{
+		pages: []string{""},
+		images: [][]testPDFImage{{
+			{dict: "/Width 20 /Height 10 /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode /Pad 0000000000", data: compressed.Bytes(), width: 612, height: 792},
+		}},
+	})
+	data, err := os.ReadFile(pdfPath)
+	if err != nil {
+		t.Fatalf("read pdf: %v", err)
+	}
+	// 等长替换，交叉引用表中的偏移保持不变
+	declared := fmt.Sprintf("/Pad 0000000000 /Length %d", compressed.Len())
+	oversized := fmt.Sprintf("%-*s", len(declared), "/Length 999999999999")
+	if !bytes.Contains(data, []byte(declared)) {
+		t.Fatalf("expected image dictionary %q in the test PDF", declared)
+	}
+	data = bytes.Replace(data, []byte(declared), []byte(oversized), 1)
+	if err := os.WriteFile(pdfPath, data, 0644); err != nil {
+		t.Fatalf("write pdf: %v", err)
+	}
+	html, err := renderPDFChapterHTML(pdfPath, "", 0)
+	if err != nil || !strings.Contains(html, "data:image/png;base64,") {
+		t.Fatalf("expected oversized /Length to be clamped, got %q, %v", html, err)
+	}
 
-	if len(pageTexts) == 0 {
-		pageTexts = []string{""}
+	if _, err := inflatePDFStream(compressed.Bytes(), int64(len(pixels)-1)); err == nil {
+		t.Fatal("expected inflated data over the limit to be rejected")
+	}
+	if inflated, err := inflatePDFStream(compressed.Bytes(), int64(len(pixels))); err != nil || len(inflated) != len(pixels) {
+		t.Fatalf("expected data within the limit to inflate, got %d bytes, %v", len(inflated), err)
 	}
 
-	tempDir := t.TempDir()
-	pdfPath := filepath.Join(tempDir, "sample.pdf")
+	hugeColumns := createTestPDFWithOptions(t, testPDFOptions{
+		pages: []string{""},
+		images: [][]testPDFImage{{
+			{dict: "/Width 20 /Height 10 /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode /DecodeParms << /Predictor 15 /Columns 1099511627776 >>", data: compressed.Bytes(), width: 612, height: 792},
+		}},
+	})
+	if _, err := renderPDFChapterHTML(hugeColumns, "", 0); err == nil || !strings.Contains(err.Error(), "预测参数无效") {
+		t.Fatalf("expected oversized /Columns to be rejected, got %v", err)
+	}
+}
 
-	pageObjectStart := 3
-	contentObjectStart := pageObjectStart + len(pageTexts)
-	fontObjectNumber := contentObjectStart + len(pageTexts)
-	infoObjectNumber := fontObjectNumber + 1
-	objectCount := infoObjectNumber
+func TestParsePdfNovelKeepsHeadingsMatchedByCustomChapterRules(t *testing.T) {
+	pages := make([]string, 4)
+	for index := range pages {
+		pages[index] = fmt.Sprintf("Episode %d\nThe quiet scene number %d unfolds.", index+1, index+1)
+	}
+	pdfPath := createTestPDF(t, "Episodes", "PDF Author", pages)
 
-	objects := make([]string, objectCount+1)
-	pageRefs := make([]string, 0, len(pageTexts))
+	progressService := NewProgressService(t.TempDir())
+	// 内置规则不认识 "Episode N"，去页眉时会按数字归一后当成重复的页眉删掉
+	if err := progressService.SaveGlobalChapterRules(&models.ChapterRuleSet{
+		Rules: []models.ChapterRule{{Name: "Episode N", Pattern: `^Episode\s+\d+`, Enabled: true}},
+	}); err != nil {
+		t.Fatalf("SaveGlobalChapterRules returned error: %v", err)
+	}
 
-	for index, pageText := range pageTexts {
-		pageObjectNumber := pageObjectStart + index
-		contentObjectNumber := contentObjectStart + index
-		pageRefs = append(pageRefs, fmt.Sprintf("%d 0 R", pageObjectNumber))
+	service := NewNovelService(progressService)
+	novel, err := service.OpenNovel(pdfPath)
+	if err != nil {
+		t.Fatalf("OpenNovel returned error: %v", err)
+	}
+	if len(novel.Chapters) != 4 || novel.Chapters[3].Title != "Episode 4" {
+		t.Fatalf("expected episode headings to survive header removal, got %+v", novel.Chapters)
+	}
+}
 
-		objects[pageObjectNumber] = fmt.Sprintf(
-			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents %d 0 R /Resources << /Font << /F1 %d 0 R >> >> >>",
-			contentObjectNumber,
-			fontObjectNumber,
-		)
+func TestParsePdfNovelReflowsWrappedLinesAcrossPages(t *testing.T) {
+	pdfPath := createTestPDF(t, "Reflow Sample", "PDF Author", []string{
+		"Chapter 1\nThe rain had been falling since the early\nmorning and the streets were empty of\npeople. Nobody wanted to leave the warm\nrooms by the river.\nLater that night a stranger knocked on\nthe door and asked for a room and a hot\nmeal before the long road to the north-",
+		"ern hills. He paid in silver coins.\nChapter 2\nMorning came slowly over the valley and\nthe stranger was gone before anyone woke.",
+	})
 
-		stream := buildTestPDFContentStream(pageText)
-		objects[contentObjectNumber] = fmt.Sprintf(
-			"<< /Length %d >>\nstream\n%s\nendstream",
-			len(stream),
-			stream,
-		)
+	service := NewNovelService(NewProgressService(t.TempDir()))
+	novel, err := service.OpenNovel(pdfPath)
+	if err != nil {
+		t.Fatalf("OpenNovel returned error: %v", err)
 	}
 
-	objects[1] = "<< /Type /Catalog /Pages 2 0 R >>"
-	objects[2] = fmt.Sprintf(
-		"<< /Type /Pages /Kids [%s] /Count %d >>",
-		strings.Join(pageRefs, " "),
-		len(pageTexts),
-	)
-	objects[fontObjectNumber] = "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>"
-	objects[infoObjectNumber] = fmt.Sprintf(
-		"<< /Title (%s) /Author (%s) >>",
-		escapeTestPDFString(title),
-		escapeTestPDFString(author),
-	)
+	expected := "Chapter 1\n" +
+		"The rain had been falling since the early morning and the streets were empty of people. Nobody wanted to leave the warm rooms by the river.\n" +
+		"Later that night a stranger knocked on the door and asked for a room and a hot meal before the long road to the northern hills. He paid in silver coins.\n" +
+		"Chapter 2\n" +
+		"Morning came slowly over the valley and the stranger was gone before anyone woke."
+	content := service.novels[pdfPath].Content
+	if content != expected {
+		t.Fatalf("unexpected reflowed content:\n%s", content)
+	}
 
-	var buffer bytes.Buffer
-	buffer.WriteString("%PDF-1.4\n")
+	if len(novel.Chapters) != 2 {
+		t.Fatalf("expected 2 chapters, got %+v", novel.Chapters)
+	}
+	runes := []rune(content)
+	for _, chapter := range novel.Chapters {
+		if !strings.HasPrefix(string(runes[chapter.StartPos:chapter.EndPos]), chapter.Title) {
+			t.Fatalf("chapter %q does not start at its position: %+v", chapter.Title, chapter)
+		}
+	}
 
-	offsets := make([]int, objectCount+1)
-	for objectNumber := 1; objectNumber <= objectCount; objectNumber++ {
-		offsets[objectNumber] = buffer.Len()
-		fmt.Fprintf(&buffer, "%d 0 obj\n%s\nendobj\n", objectNumber, objects[objectNumber])
+	if _, err := service.SetPDFOptions(pdfPath, models.PDFOptions{RemovePageDecorations: true}); err != nil {
+		t.Fatalf("SetPDFOptions returned error: %v", err)
+	}
+	if content := service.novels[pdfPath].Content; !strings.Contains(content, "north-\n\nern hills") {
+		t.Fatalf("expected original line breaks when reflow is disabled, got %q", content)
 	}
+}
 
-	xrefOffset := buffer.Len()
-	fmt.Fprintf(&buffer, "xref\n0 %d\n", objectCount+1)
-	buffer.WriteString("0000000000 65535 f \n")
-	for objectNumber := 1; objectNumber <= objectCount; objectNumber++ {
-		fmt.Fprintf(&buffer, "%010d 00000 n \n", offsets[objectNumber])
+func TestParsePdfNovelOrdersColumnsAndVerticalText(t *testing.T) {
+	left := []string{"Left column opens the tale right here.", "Left column keeps the story moving on.", "Left column closes its part of the tale."}
+	right := []string{"Right column picks the thread up again.", "Right column carries the story forward.", "Right column brings the tale to its end."}
+	// 两栏的行交错写入内容流，阅读顺序只能从坐标推断
+	var twoColumns strings.Builder
+	twoColumns.WriteString("BT /F1 16 Tf 1 0 0 1 220 740 Tm (A Tale in Two Columns) Tj ET\n")
+	for index := range left {
+		y := 700 - index*20
+		fmt.Fprintf(&twoColumns, "BT /F1 12 Tf 1 0 0 1 72 %d Tm (%s) Tj ET\n", y, left[index])
+		fmt.Fprintf(&twoColumns, "BT /F1 12 Tf 1 0 0 1 330 %d Tm (%s) Tj ET\n", y, right[index])
 	}
 
-	fmt.Fprintf(
-		&buffer,
-		"trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
-		objectCount+1,
-		infoObjectNumber,
-		xrefOffset,
-	)
+	// 竖排的列从右往左读，内容流中按从左往右的顺序写入
+	columns := []string{"春眠不觉晓", "处处闻啼鸟", "夜来风雨声", "花落知多少"}
+	var vertical strings.Builder
+	for index := len(columns) - 1; index >= 0; index-- {
+		var codes strings.Builder
+		for _, char := range columns[index] {
+			fmt.Fprintf(&codes, "%04X", char)
+		}
+		fmt.Fprintf(&vertical, "BT /F2 20 Tf 1 0 0 1 %d 700 Tm <%s> Tj ET\n", 500-index*30, codes.String())
+	}
 
-	if err := os.WriteFile(pdfPath, buffer.Bytes(), 0644); err != nil {
-		t.Fatalf("write pdf file: %v", err)
+	pdfPath := createTestPDFWithOptions(t, testPDFOptions{
+		title:         "Layout Sample",
+		author:        "PDF Author",
+		pages:         []string{"", ""},
+		contents:      []string{twoColumns.String(), vertical.String()},
+		verticalChars: strings.Join(columns, ""),
+	})
+
+	service := NewNovelService(NewProgressService(t.TempDir()))
+	novel, err := service.OpenNovel(pdfPath)
+	if err != nil {
+		t.Fatalf("OpenNovel returned error: %v", err)
 	}
 
-	return pdfPath
+	content := service.novels[pdfPath].Content
+	expectedOrder := append(append([]string{"A Tale in Two Columns"}, append(left, right...)...), columns...)
+	previous := -1
+	for _, text := range expectedOrder {
+		position := strings.Index(content, text)
+		if position <= previous {
+			t.Fatalf("expected %q to follow the previous text in reading order, got %q", text, content)
+		}
+		previous = position
+	}
+
+	if novel.PDFLayout == nil {
+		t.Fatal("expected detected PDF layout in metadata")
+	}
+	if novel.PDFLayout.Summary != "mixed" || !slices.Equal(novel.PDFLayout.Pages, []string{"horizontal-2-columns", "vertical"}) {
+		t.Fatalf("unexpected PDF layout: %+v", novel.PDFLayout)
+	}
 }
 
-func buildTestPDFContentStream(pageText string) string {
-	lines := strings.Split(pageText, "\n")
-	var builder strings.Builder
+func TestPDFPagePositionMapping(t *testing.T) {
+	pdfPath := createTestPDFWithOptions(t, testPDFOptions{
+		title:      "Paged Sample",
+		author:     "PDF Author",
+		pages:      []string{"Preface of the sample.", "", "The story starts on this page.", "The lantern is found here."},
+		pageLabels: "<< /Nums [0 << /S /r >> 2 << /S /D >>] >>",
+	})
+
+	service := NewNovelService(NewProgressService(t.TempDir()))
+	novel, err := service.OpenNovel(pdfPath)
+	if err != nil {
+		t.Fatalf("OpenNovel returned error: %v", err)
+	}
+
+	content := service.novels[pdfPath].Content
+	storyStart := runeLen(content[:strings.Index(content, "The story")])
+	if !slices.Equal(novel.PageOffsets, []int{0, storyStart, storyStart, runeLen(content[:strings.Index(content, "The lantern")])}) {
+		t.Fatalf("unexpected page offsets %v for content %q", novel.PageOffsets, content)
+	}
+	if !slices.Equal(novel.PageLabels, []string{"i", "ii", "1", "2"}) {
+		t.Fatalf("unexpected page labels: %v", novel.PageLabels)
+	}
+
+	position, err := service.GetPositionForPage(pdfPath, 3)
+	if err != nil || position != storyStart {
+		t.Fatalf("expected page 3 to start at %d, got %d, %v", storyStart, position, err)
+	}
+	// 空白的第 2 页与第 3 页起始位置相同，正文位置应归到第 3 页
+	if page, err := service.GetPageForPosition(pdfPath, storyStart+3); err != nil || page != 3 {
+		t.Fatalf("expected position to map to page 3, got %d, %v", page, err)
+	}
+	if page, _ := service.GetPageForPosition(pdfPath, 0); page != 1 {
+		t.Fatalf("expected start of book on page 1, got %d", page)
+	}
+	if _, err := service.GetPositionForPage(pdfPath, 5); err == nil {
+		t.Fatal("expected out-of-range page to return an error")
+	}
+
+	results := service.SearchNovel(pdfPath, "lantern", false)
+	if len(results) != 1 || results[0].Page != 4 {
+		t.Fatalf("expected search result on page 4, got %+v", results)
+	}
+
+	// 印刷页码 1 是第 3 页
+	if position, err := service.GetPositionForPageLabel(pdfPath, "1"); err != nil || position != storyStart {
+		t.Fatalf("expected printed page 1 to start at %d, got %d, %v", storyStart, position, err)
+	}
+	if position, err := service.GetPositionForPageLabel(pdfPath, "I"); err != nil || position != 0 {
+		t.Fatalf("expected printed page I to start the book, got %d, %v", position, err)
+	}
+	if _, err := service.GetPositionForPageLabel(pdfPath, "3"); err == nil {
+		t.Fatal("expected unknown printed page to return an error")
+	}
+
+	lastChapter := len(novel.Chapters) - 1
+	if err := service.SaveReadingProgress(pdfPath, lastChapter, len(content), 0.9); err != nil {
+		t.Fatalf("SaveReadingProgress returned error: %v", err)
+	}
+	if entry := service.progressService.GetProgress(pdfPath); entry == nil || entry.Page != 4 {
+		t.Fatalf("expected saved progress on page 4, got %+v", entry)
+	}
+}
+
+func TestReadPDFPageLabelsLimitsHugeStartNumbers(t *testing.T) {
+	pdfPath := createTestPDFWithOptions(t, testPDFOptions{
+		title:      "Huge Labels",
+		pages:      []string{"First page text.", "Second page text."},
+		pageLabels: "<< /Nums [0 << /S /R /St 9000000000000 >> 1 << /S /A /St 27 >>] >>",
+	})
+
+	_, reader, err := openPDFReader(pdfPath, "")
+	if err != nil {
+		t.Fatalf("openPDFReader returned error: %v", err)
+	}
+	labels := readPDFPageLabels(reader)
+	if !slices.Equal(labels, []string{"100000", "AA"}) {
+		t.Fatalf("unexpected page labels: %v", labels)
+	}
+}
+
+func TestSetTxtOptionsReflowsHardWrappedText(t *testing.T) {
+	paragraph := strings.Repeat("山风吹过村口的老槐树，", 5) + "大家都停下了脚步。"
+	wrap := func(text string) string {
+		runes := []rune("　　" + text)
+		var lines []string
+		for len(runes) > 20 {
+			lines = append(lines, string(runes[:20]))
+			runes = runes[20:]
+		}
+		return strings.Join(append(lines, string(runes)), "\n")
+	}
+
+	var builder strings.Builder
+	for _, title := range []string{"第一章 出发", "第二章 归来"} {
+		builder.WriteString(title + "\n")
+		for index := 0; index < 4; index++ {
+			builder.WriteString(wrap(paragraph) + "\n")
+		}
+	}
+	txtPath := filepath.Join(t.TempDir(), "wrapped.txt")
+	if err := os.WriteFile(txtPath, []byte(builder.String()), 0644); err != nil {
+		t.Fatalf("write txt file: %v", err)
+	}
+
+	service := NewNovelService(NewProgressService(t.TempDir()))
+	if _, err := service.OpenNovel(txtPath); err != nil {
+		t.Fatalf("OpenNovel returned error: %v", err)
+	}
+	if service.novels[txtPath].Content != builder.String() {
+		t.Fatal("expected TXT to keep its line breaks unless reflow is enabled")
+	}
+
+	novel, err := service.SetTxtOptions(txtPath, models.TxtOptions{ReflowParagraphs: true})
+	if err != nil {
+		t.Fatalf("SetTxtOptions returned error: %v", err)
+	}
+
+	content := service.novels[txtPath].Content
+	lines := strings.Split(strings.TrimSpace(content), "\n")
+	if len(lines) != 10 || lines[1] != "　　"+paragraph {
+		t.Fatalf("expected 2 titles and 8 joined paragraphs, got %q", lines)
+	}
+	if len(novel.Chapters) != 2 {
+		t.Fatalf("expected 2 chapters, got %+v", novel.Chapters)
+	}
+	runes := []rune(content)
+	for _, chapter := range novel.Chapters {
+		if !strings.HasPrefix(string(runes[chapter.StartPos:chapter.EndPos]), chapter.Title) {
+			t.Fatalf("chapter %q does not start at its position: %+v", chapter.Title, chapter)
+		}
+	}
+	if last := novel.Chapters[1]; last.EndPos != runeLen(content) {
+		t.Fatalf("expected last chapter to end at the reflowed content length %d, got %d", runeLen(content), last.EndPos)
+	}
+}
+
+func TestApplyChapterRulesRedoesParagraphReflow(t *testing.T) {
+	// 没有缩进、末行是未完句子的满行，标题行只能靠章节规则识别，否则会被并入上一段
+	paragraph := strings.Repeat("山风吹过村口的老槐树", 6)
+	wrap := func(text string) string {
+		runes := []rune(text)
+		var lines []string
+		for len(runes) > 20 {
+			lines = append(lines, string(runes[:20]))
+			runes = runes[20:]
+		}
+		return strings.Join(append(lines, string(runes)), "\n")
+	}
+	var builder strings.Builder
+	for _, title := range []string{"幕一 出发", "幕二 归来", "幕三 远行"} {
+		builder.WriteString(title + "\n")
+		for index := 0; index < 3; index++ {
+			builder.WriteString(wrap(paragraph) + "\n")
+		}
+	}
+	txtPath := filepath.Join(t.TempDir(), "acts.txt")
+	if err := os.WriteFile(txtPath, []byte(builder.String()), 0644); err != nil {
+		t.Fatalf("write txt file: %v", err)
+	}
+
+	service := NewNovelService(NewProgressService(t.TempDir()))
+	if _, err := service.OpenNovel(txtPath); err != nil {
+		t.Fatalf("OpenNovel returned error: %v", err)
+	}
+	if _, err := service.SetTxtOptions(txtPath, models.TxtOptions{ReflowParagraphs: true}); err != nil {
+		t.Fatalf("SetTxtOptions returned error: %v", err)
+	}
+	if strings.Contains(service.novels[txtPath].Content, "\n幕二 归来\n") {
+		t.Fatal("expected built-in rules to miss the act headings")
+	}
+
+	novel, err := service.ApplyChapterRules(txtPath, models.ChapterRuleSet{Rules: []models.ChapterRule{{Name: "幕", Pattern: `^幕[一二三四五六七八九十]+`, Enabled: true}}})
+	if err != nil {
+		t.Fatalf("ApplyChapterRules returned error: %v", err)
+	}
+	content := service.novels[txtPath].Content
+	if !strings.Contains(content, "\n幕二 归来\n") || !strings.Contains(content, "\n幕三 远行\n") {
+		t.Fatalf("expected reflow to keep the headings matched by the new rules, got %q", content)
+	}
+	if len(novel.Chapters) != 3 || novel.Chapters[2].Title != "幕三 远行" {
+		t.Fatalf("expected 3 act chapters, got %+v", novel.Chapters)
+	}
+}
+
+func TestOpenNovelDetectsGBKEncodedTxt(t *testing.T) {
+	source := "第一章 开始\n他说这是一个很好的开始，我们都在等着看。\n\n第二章 继续\n她也来到了这里，大家一起出发。\n"
+	encoded, err := simplifiedchinese.GBK.NewEncoder().String(source)
+	if err != nil {
+		t.Fatalf("encode gbk: %v", err)
+	}
+
+	txtPath := filepath.Join(t.TempDir(), "gbk.txt")
+	if err := os.WriteFile(txtPath, []byte(encoded), 0644); err != nil {
+		t.Fatalf("write txt file: %v", err)
+	}
+
+	service := NewNovelService(nil)
+	novel, err := service.OpenNovel(txtPath)
+	if err != nil {
+		t.Fatalf("OpenNovel returned error: %v", err)
+	}
+
+	if novel.Encoding != "GBK" {
+		t.Fatalf("expected GBK encoding, got %q", novel.Encoding)
+	}
+
+	if len(novel.Chapters) != 2 || novel.Chapters[1].Title != "第二章 继续" {
+		t.Fatalf("expected 2 decoded chapters, got %+v", novel.Chapters)
+	}
+}
+
+func TestReopenNovelWithEncodingPersistsManualChoice(t *testing.T) {
+	content := append([]byte{0xFF, 0xFE}, encodeTestUTF16LE("第一章 测试\n正文内容。\n")...)
+	txtPath := filepath.Join(t.TempDir(), "utf16.txt")
+	if err := os.WriteFile(txtPath, content, 0644); err != nil {
+		t.Fatalf("write txt file: %v", err)
+	}
+
+	progressService := NewProgressService(t.TempDir())
+	service := NewNovelService(progressService)
+	novel, err := service.OpenNovel(txtPath)
+	if err != nil {
+		t.Fatalf("OpenNovel returned error: %v", err)
+	}
+	if novel.Encoding != "UTF-16LE" || novel.Chapters[0].Title != "第一章 测试" {
+		t.Fatalf("expected UTF-16LE BOM to be detected, got %q %+v", novel.Encoding, novel.Chapters)
+	}
+
+	if _, err := service.ReopenNovelWithEncoding(txtPath, "gbk"); err != nil {
+		t.Fatalf("ReopenNovelWithEncoding returned error: %v", err)
+	}
+
+	settings := progressService.GetBookSettings(txtPath)
+	if settings == nil || settings.Encoding != "GBK" {
+		t.Fatalf("expected manual encoding to be saved, got %+v", settings)
+	}
+
+	if _, err := service.ReopenNovelWithEncoding(txtPath, "latin-9"); err == nil {
+		t.Fatal("expected unsupported encoding error")
+	}
+}
+
+func TestApplyChapterRulesPersistsPerBookRules(t *testing.T) {
+	txtPath := filepath.Join(t.TempDir(), "rules.txt")
+	content := "目录\n卷一 第一节\n卷一 第二节\n\n卷一 第一节\n正文一。\n\n卷一 第二节\n正文二。\n\n外传 其一\n外传内容。\n"
+	if err := os.WriteFile(txtPath, []byte(content), 0644); err != nil {
+		t.Fatalf("write txt file: %v", err)
+	}
+
+	progressService := NewProgressService(t.TempDir())
+	service := NewNovelService(progressService)
+	if _, err := service.OpenNovel(txtPath); err != nil {
+		t.Fatalf("OpenNovel returned error: %v", err)
+	}
+
+	ruleSet := service.GetDefaultChapterRules()
+	ruleSet.Rules = append(ruleSet.Rules, models.ChapterRule{Name: "外传", Pattern: `^外传`, Enabled: true})
+	ruleSet.MinChapterLength = 12
+
+	preview, err := service.PreviewChapterRules(txtPath, ruleSet)
+	if err != nil {
+		t.Fatalf("PreviewChapterRules returned error: %v", err)
+	}
+	// 书首目录中过短的条目被合并，只留下一个目录章节
+	if len(preview) != 4 || preview[1].StartPos != 18 || preview[3].Title != "外传 其一" {
+		t.Fatalf("expected 4 preview chapters ending with 外传, got %+v", preview)
+	}
+	if chapters, _ := service.GetNovelChapters(txtPath); chapters[len(chapters)-1].Title == "外传 其一" {
+		t.Fatalf("expected preview not to modify opened novel, got %+v", chapters)
+	}
+
+	if _, err := service.ApplyChapterRules(txtPath, ruleSet); err != nil {
+		t.Fatalf("ApplyChapterRules returned error: %v", err)
+	}
+
+	reopened := NewNovelService(progressService)
+	novel, err := reopened.OpenNovel(txtPath)
+	if err != nil {
+		t.Fatalf("OpenNovel returned error: %v", err)
+	}
+	if len(novel.Chapters) != 4 || novel.Chapters[3].Title != "外传 其一" {
+		t.Fatalf("expected saved rules to be reused on reopen, got %+v", novel.Chapters)
+	}
+
+	invalid := models.ChapterRuleSet{Rules: []models.ChapterRule{{Name: "坏规则", Pattern: `(`, Enabled: true}}}
+	if _, err := service.PreviewChapterRules(txtPath, invalid); err == nil {
+		t.Fatal("expected invalid regex error")
+	}
+
+	negative := ruleSet
+	negative.MaxTitleLength = -1
+	if _, err := service.ApplyChapterRules(txtPath, negative); err == nil {
+		t.Fatal("expected negative length limits to be rejected")
+	}
+	if saved := progressService.GetBookSettings(txtPath); saved == nil || saved.ChapterRules.MaxTitleLength < 0 {
+		t.Fatalf("invalid rules should not be persisted, got %+v", saved)
+	}
+}
+
+func TestParseTxtNovelBuildsVolumeHierarchy(t *testing.T) {
+	service := NewNovelService(nil)
+	novel := &models.Novel{
+		FilePath: "volumes.txt",
+		Format:   ".txt",
+		Content:  "楔子\n引言。\n第一卷 风起\n第一章 开始\n正文。\n第二章 继续\n正文。\n第二卷 云涌\n第三章 转折\n正文。\n",
+	}
+
+	if err := service.parseTxtNovel(novel); err != nil {
+		t.Fatalf("parseTxtNovel returned error: %v", err)
+	}
+
+	expected := []struct {
+		title  string
+		level  int
+		parent int
+	}{
+		{"楔子", 0, -1},
+		{"第一卷 风起", 0, -1},
+		{"第一章 开始", 1, 1},
+		{"第二章 继续", 1, 1},
+		{"第二卷 云涌", 0, -1},
+		{"第三章 转折", 1, 4},
+	}
+	if len(novel.Chapters) != len(expected) {
+		t.Fatalf("expected %d chapters, got %+v", len(expected), novel.Chapters)
+	}
+	for index, want := range expected {
+		chapter := novel.Chapters[index]
+		if chapter.Title != want.title || chapter.Level != want.level || chapter.ParentIndex != want.parent {
+			t.Fatalf("chapter %d: expected %+v, got %+v", index, want, chapter)
+		}
+	}
+}
+
+func TestParseEpubNovelKeepsNavNesting(t *testing.T) {
+	epubPath := createTestEPUB(t, map[string][]byte{
+		"META-INF/container.xml": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`),
+		"OEBPS/content.opf": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<package version="3.0" xmlns="http://www.idpf.org/2007/opf" unique-identifier="BookId">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>目录层级</dc:title></metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="vol-1" href="Text/vol1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="chapter-1" href="Text/chapter1.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine>
+    <itemref idref="vol-1"/>
+    <itemref idref="chapter-1"/>
+  </spine>
+</package>`),
+		"OEBPS/nav.xhtml": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+  <body>
+    <nav epub:type="toc"><ol>
+      <li><a href="Text/vol1.xhtml">第一卷 目录标题</a>
+        <ol><li><a href="Text/chapter1.xhtml">第一章 目录标题</a></li></ol>
+      </li>
+    </ol></nav>
+  </body>
+</html>`),
+		"OEBPS/Text/vol1.xhtml":     []byte(`<html xmlns="http://www.w3.org/1999/xhtml"><head><title>卷</title></head><body><h1>第一卷</h1><p>卷首语。</p></body></html>`),
+		"OEBPS/Text/chapter1.xhtml": []byte(`<html xmlns="http://www.w3.org/1999/xhtml"><head><title>章</title></head><body><h1>第一章</h1><p>正文内容。</p></body></html>`),
+	})
+
+	service := NewNovelService(nil)
+	novel := &models.Novel{FilePath: epubPath, Format: ".epub"}
+	if err := service.parseEpubNovel(novel); err != nil {
+		t.Fatalf("parseEpubNovel returned error: %v", err)
+	}
+
+	if len(novel.Chapters) != 2 {
+		t.Fatalf("expected 2 chapters, got %+v", novel.Chapters)
+	}
+	if novel.Chapters[0].Title != "第一卷 目录标题" || novel.Chapters[0].Level != 0 {
+		t.Fatalf("expected volume from nav, got %+v", novel.Chapters[0])
+	}
+	if novel.Chapters[1].Title != "第一章 目录标题" || novel.Chapters[1].Level != 1 || novel.Chapters[1].ParentIndex != 0 {
+		t.Fatalf("expected nested chapter from nav, got %+v", novel.Chapters[1])
+	}
+}
+
+func TestParseEpubNovelSplitsChaptersByNavFragments(t *testing.T) {
+	epubPath := createTestEPUB(t, map[string][]byte{
+		"META-INF/container.xml": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`),
+		"OEBPS/content.opf": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<package version="2.0" xmlns="http://www.idpf.org/2007/opf" unique-identifier="BookId">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>锚点目录</dc:title></metadata>
+  <manifest>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    <item id="part-1" href="Text/part1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="part-2" href="Text/part2.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine toc="ncx">
+    <itemref idref="part-1"/>
+    <itemref idref="part-2"/>
+  </spine>
+</package>`),
+		"OEBPS/toc.ncx": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <navMap>
+    <navPoint id="n1"><navLabel><text>第一章</text></navLabel><content src="Text/part1.xhtml#c1"/></navPoint>
+    <navPoint id="n2"><navLabel><text>第二章</text></navLabel><content src="Text/part1.xhtml#c2"/></navPoint>
+  </navMap>
+</ncx>`),
+		"OEBPS/Text/part1.xhtml": []byte(`<html xmlns="http://www.w3.org/1999/xhtml"><body>
+  <div class="wrap">
+    <h2 id="c1">第一章</h2><p>第一章正文。</p>
+    <h2 id="c2">第二章</h2><p>第二章前半。</p>
+  </div>
+</body></html>`),
+		"OEBPS/Text/part2.xhtml": []byte(`<html xmlns="http://www.w3.org/1999/xhtml"><body><p>第二章后半。</p></body></html>`),
+	})
+
+	service := NewNovelService(nil)
+	novel := &models.Novel{FilePath: epubPath, Format: ".epub"}
+	if err := service.parseEpubNovel(novel); err != nil {
+		t.Fatalf("parseEpubNovel returned error: %v", err)
+	}
+
+	if len(novel.Chapters) != 2 {
+		t.Fatalf("expected chapters to follow the NCX, got %+v", novel.Chapters)
+	}
+
+	first := sliceByRuneRange(novel.Content, novel.Chapters[0].StartPos, novel.Chapters[0].EndPos)
+	second := sliceByRuneRange(novel.Content, novel.Chapters[1].StartPos, novel.Chapters[1].EndPos)
+	if !strings.Contains(first, "第一章正文。") || strings.Contains(first, "第二章前半。") {
+		t.Fatalf("expected first chapter to stop at #c2, got %q", first)
+	}
+	if !strings.Contains(second, "第二章前半。") || !strings.Contains(second, "第二章后半。") {
+		t.Fatalf("expected second chapter to include its continuation file, got %q", second)
+	}
+
+	secondHTML := service.getEpubChapterHTML(epubPath, 1)
+	if strings.Contains(secondHTML, "第一章正文") || !strings.Contains(secondHTML, "第二章后半。") {
+		t.Fatalf("expected second chapter html to be split at the anchor, got %q", secondHTML)
+	}
+}
+
+func TestParseMobiNovelReadsPalmDOCTextAndMetadata(t *testing.T) {
+	pngBytes := []byte("\x89PNG\r\n\x1a\nmobi-image")
+	mobiPath := createTestMOBI(t, testMOBIOptions{
+		text: `<html><head><guide></guide></head><body>` +
+			`<h1>第一章 出发</h1><p>第一章正文。</p><mbp:pagebreak/>` +
+			`<h1>第二章 归来</h1><p>第二章正文。</p><img recindex="00001" />` +
+			`</body></html>`,
+		title:      "MOBI 样书",
+		author:     "MOBI 作者",
+		images:     [][]byte{pngBytes},
+		coverIndex: 0,
+	})
+
+	service := NewNovelService(nil)
+	novel := &models.Novel{FilePath: mobiPath, Format: ".mobi"}
+	if err := service.parseMobiNovel(novel); err != nil {
+		t.Fatalf("parseMobiNovel returned error: %v", err)
+	}
+
+	if novel.Title != "MOBI 样书" || novel.Author != "MOBI 作者" {
+		t.Fatalf("expected EXTH metadata, got title=%q author=%q", novel.Title, novel.Author)
+	}
+	if !strings.HasPrefix(novel.Cover, "data:image/png;base64,") {
+		t.Fatalf("expected cover from EXTH cover offset, got %q", novel.Cover)
+	}
+
+	if len(novel.Chapters) != 2 {
+		t.Fatalf("expected chapters split at page breaks, got %+v", novel.Chapters)
+	}
+	if novel.Chapters[0].Title != "第一章 出发" || novel.Chapters[1].Title != "第二章 归来" {
+		t.Fatalf("expected chapter titles from headings, got %q and %q", novel.Chapters[0].Title, novel.Chapters[1].Title)
+	}
+	if !strings.Contains(novel.Content, "第一章正文。") || !strings.Contains(novel.Content, "第二章正文。") {
+		t.Fatalf("expected decompressed text in content, got %q", novel.Content)
+	}
+
+	secondHTML := service.getEpubChapterHTML(mobiPath, 1)
+	if !strings.Contains(secondHTML, `<img src="data:image/png;base64,`) {
+		t.Fatalf("expected recindex image to be inlined, got %q", secondHTML)
+	}
+}
+
+func TestParseMobiNovelRejectsDRMProtectedFiles(t *testing.T) {
+	mobiPath := createTestMOBI(t, testMOBIOptions{
+		text:       "<html><body><p>encrypted</p></body></html>",
+		encryption: 2,
+		coverIndex: -1,
+	})
+
+	service := NewNovelService(nil)
+	novel := &models.Novel{FilePath: mobiPath, Format: ".azw3"}
+	if err := service.parseMobiNovel(novel); !errors.Is(err, errMobiDRMProtected) {
+		t.Fatalf("expected DRM error, got %v", err)
+	}
+}
+
+func TestDecompressPalmDOCExpandsBackReferences(t *testing.T) {
+	// "abc"，回溯 3 字节复制 3 字节，再加空格+字符的合并编码
+	compressed := []byte{'a', 'b', 'c', 0x80, 0x18, 'x' | 0x80, 0x02, 0xE4, 0xB8}
+	if got := string(decompressPalmDOC(compressed)); got != "abcabc x\xe4\xb8" {
+		t.Fatalf("unexpected PalmDOC output %q", got)
+	}
+}
+
+func TestReadMobiTextRejectsCorruptTrailingEntries(t *testing.T) {
+	// 末尾附加数据长度超出记录本身，截断前须先拒绝，不能按负数下标切片
+	record := []byte{0x01, 0x02, 0xFF}
+	if _, err := mobiTrailingEntriesSize(record, 0b110); err == nil {
+		t.Fatalf("expected corrupt trailing entries error")
+	}
+	if _, err := mobiTrailingEntriesSize([]byte{0x01}, 0b11); err == nil {
+		t.Fatalf("expected error when trailing entries consume the whole record")
+	}
+	if size, err := mobiTrailingEntriesSize([]byte{'a', 0x00, 0x00, 0x82}, 0b11); err != nil || size != 3 {
+		t.Fatalf("expected 3 bytes of trailing data, got %d, %v", size, err)
+	}
+
+	db := &palmDatabase{data: append([]byte{0}, record...), offsets: []int{0, 1}}
+	header := &mobiHeader{compression: mobiCompressionNone, textRecordCount: 1, extraDataFlags: 0b110}
+	if _, err := readMobiText(db, header); err == nil {
+		t.Fatalf("expected readMobiText to reject the truncated record")
+	}
+}
+
+func TestAssembleKF8PartsTracksFragmentPositions(t *testing.T) {
+	skeleton := "<html><body></body></html>"
+	first := "<p>A</p>"
+	second := "<p>B</p>"
+	text := []byte(skeleton + first + second)
+	insertAt := strings.Index(skeleton, "</body>")
+
+	parts := assembleKF8Parts(text, []kf8Skeleton{{fragmentCount: 2, start: 0, length: len(skeleton)}}, []kf8Fragment{
+		{insertPos: insertAt, length: len(first)},
+		{insertPos: insertAt + len(first), length: len(second)},
+	})
+
+	if len(parts) != 1 || string(parts[0].markup) != "<html><body><p>A</p><p>B</p></body></html>" {
+		t.Fatalf("unexpected assembled parts %+v", parts)
+	}
+
+	partIndex, offset, ok := locateMobiRawPosition(parts, len(skeleton)+len(first))
+	if !ok || partIndex != 0 || !strings.HasPrefix(string(parts[0].markup[offset:]), "<p>B</p>") {
+		t.Fatalf("expected raw position of second fragment to map into the part, got %d %d %v", partIndex, offset, ok)
+	}
+
+	_, offset, ok = locateMobiRawPosition(parts, strings.Index(skeleton, "</body>"))
+	if !ok || !strings.HasPrefix(string(parts[0].markup[offset:]), "</body>") {
+		t.Fatalf("expected skeleton tail to shift after fragment insertion, got %d %v", offset, ok)
+	}
+}
+
+func TestOpenNovelParsesZippedFB2Sections(t *testing.T) {
+	pngData := base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\nfb2-image"))
+	fb2 := `<?xml version="1.0" encoding="utf-8"?>
+<FictionBook xmlns="http://www.gribuser.ru/xml/fictionbook/2.0" xmlns:l="http://www.w3.org/1999/xlink">
+  <description>
+    <title-info>
+      <author><first-name>潇宇</first-name><last-name>林</last-name></author>
+      <book-title>星海</book-title>
+      <annotation><p>一段简介。</p></annotation>
+      <coverpage><image l:href="#cover.png"/></coverpage>
+      <sequence name="星海三部曲" number="2"/>
+    </title-info>
+  </description>
+  <body>
+    <title><p>星海</p></title>
+    <section>
+      <title><p>第一卷</p></title>
+      <epigraph><p>卷首语。</p></epigraph>
+      <section>
+        <title><p>第一章</p></title>
+        <p>第一章<emphasis>正文</emphasis>。</p>
+        <image l:href="#cover.png"/>
+      </section>
+      <section>
+        <title><p>第二章</p></title>
+        <p>第二章正文。</p>
+      </section>
+    </section>
+  </body>
+  <binary id="cover.png" content-type="image/png">` + pngData + `</binary>
+</FictionBook>`
+
+	zipPath := filepath.Join(t.TempDir(), "sample.fb2.zip")
+	zipFile, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatalf("create fb2 zip: %v", err)
+	}
+	writer := zip.NewWriter(zipFile)
+	entryWriter, err := writer.Create("sample.fb2")
+	if err != nil {
+		t.Fatalf("create zip entry: %v", err)
+	}
+	if _, err := entryWriter.Write([]byte(fb2)); err != nil {
+		t.Fatalf("write zip entry: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close zip writer: %v", err)
+	}
+	zipFile.Close()
+
+	service := NewNovelService(nil)
+	novel, err := service.OpenNovel(zipPath)
+	if err != nil {
+		t.Fatalf("OpenNovel returned error: %v", err)
+	}
+
+	if novel.Format != ".fb2.zip" || novel.Title != "星海" || novel.Author != "潇宇 林" {
+		t.Fatalf("unexpected metadata: format=%q title=%q author=%q", novel.Format, novel.Title, novel.Author)
+	}
+	if novel.Series != "星海三部曲" || novel.SeriesIndex != 2 || novel.Annotation != "一段简介。" {
+		t.Fatalf("unexpected series or annotation: %q %d %q", novel.Series, novel.SeriesIndex, novel.Annotation)
+	}
+	if !strings.HasPrefix(novel.Cover, "data:image/png;base64,") {
+		t.Fatalf("expected cover from coverpage binary, got %q", novel.Cover)
+	}
+
+	if len(novel.Chapters) != 3 {
+		t.Fatalf("expected volume and two chapters, got %+v", novel.Chapters)
+	}
+	if novel.Chapters[0].Title != "第一卷" || novel.Chapters[1].ParentIndex != 0 || novel.Chapters[2].Level != 1 {
+		t.Fatalf("expected section nesting to become hierarchy, got %+v", novel.Chapters)
+	}
+
+	firstHTML, err := service.GetChapterContent(zipPath, 1)
+	if err != nil {
+		t.Fatalf("GetChapterContent returned error: %v", err)
+	}
+	if !strings.Contains(firstHTML, "<em>正文</em>") || !strings.Contains(firstHTML, `<img src="data:image/png;base64,`) {
+		t.Fatalf("expected sanitized rich html with inline image, got %q", firstHTML)
+	}
+}
+
+func TestOpenNovelReadsComicArchiveInNaturalOrder(t *testing.T) {
+	pngPage := []byte("\x89PNG\r\n\x1a\ncomic-page")
+	cbzPath := filepath.Join(t.TempDir(), "sample.cbz")
+	cbzFile, err := os.Create(cbzPath)
+	if err != nil {
+		t.Fatalf("create cbz file: %v", err)
+	}
+	writer := zip.NewWriter(cbzFile)
+	entries := []struct {
+		name    string
+		content []byte
+	}{
+		{"page10.png", pngPage},
+		{"page2.png", pngPage},
+		{"page1.png", pngPage},
+		{"__MACOSX/._page1.png", []byte("junk")},
+		{"ComicInfo.xml", []byte(`<?xml version="1.0"?>
+<ComicInfo><Series>星海</Series><Number>3</Number><Writer>林潇宇</Writer><Summary>第三卷简介</Summary><Manga>YesAndRightToLeft</Manga></ComicInfo>`)},
+	}
+	for _, entry := range entries {
+		entryWriter, err := writer.Create(entry.name)
+		if err != nil {
+			t.Fatalf("create zip entry %s: %v", entry.name, err)
+		}
+		if _, err := entryWriter.Write(entry.content); err != nil {
+			t.Fatalf("write zip entry %s: %v", entry.name, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close zip writer: %v", err)
+	}
+	cbzFile.Close()
+
+	service := NewNovelService(nil)
+	novel, err := service.OpenNovel(cbzPath)
+	if err != nil {
+		t.Fatalf("OpenNovel returned error: %v", err)
+	}
+
+	if novel.Title != "星海 #3" || novel.Author != "林潇宇" || novel.SeriesIndex != 3 || novel.Annotation != "第三卷简介" {
+		t.Fatalf("unexpected ComicInfo metadata: %+v", novel)
+	}
+	if len(novel.Chapters) != 3 || !strings.HasPrefix(novel.Cover, "data:image/png;base64,") {
+		t.Fatalf("expected one chapter per page and a cover, got %d chapters", len(novel.Chapters))
+	}
+	if pages := service.comicBooks[cbzPath].pages; strings.Join(pages, ",") != "page1.png,page2.png,page10.png" {
+		t.Fatalf("expected natural page order, got %v", pages)
+	}
+
+	options, err := service.GetComicOptions(cbzPath)
+	if err != nil || !options.RightToLeft || options.PagesPerChapter != 1 {
+		t.Fatalf("expected manga default to right-to-left single pages, got %+v %v", options, err)
+	}
+
+	if results := service.SearchNovel(cbzPath, "第3页", false); len(results) != 1 {
+		t.Fatalf("expected page title to be searchable, got %+v", results)
+	}
+
+	service.novels[cbzPath].CurrentChapter = 2
+	spread, err := service.SetComicOptions(cbzPath, models.ComicOptions{RightToLeft: true, PagesPerChapter: 2})
+	if err != nil {
+		t.Fatalf("SetComicOptions returned error: %v", err)
+	}
+	if len(spread.Chapters) != 2 || spread.Chapters[0].Title != "第1-2页" || spread.CurrentChapter != 1 {
+		t.Fatalf("expected two-page spreads keeping the current page, got %+v", spread)
+	}
+	// 正文已重新生成，位置对照表需要重建
+	if _, exists := service.textOffsets[cbzPath]; exists {
+		t.Fatal("expected text offsets of the old content to be dropped")
+	}
+
+	payload, err := service.GetChapterContentPayload(cbzPath, 0)
+	if err != nil {
+		t.Fatalf("GetChapterContentPayload returned error: %v", err)
+	}
+	if !payload.IsRichContent || !strings.Contains(payload.Content, `comic-spread comic-rtl`) || strings.Count(payload.Content, "<img") != 2 {
+		t.Fatalf("expected right-to-left spread html, got %q", payload.Content)
+	}
+}
+
+func TestConvertFormatWritesEpubWithImagesAndNestedNav(t *testing.T) {
+	epubPath := createTestEPUB(t, map[string][]byte{
+		"META-INF/container.xml": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`),
+		"OEBPS/content.opf": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<package version="2.0" xmlns="http://www.idpf.org/2007/opf" unique-identifier="BookId">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>测试小说</dc:title>
+    <dc:creator>测试作者</dc:creator>
+    <meta name="cover" content="cover-image"/>
+  </metadata>
+  <manifest>
+    <item id="cover-image" href="Images/cover.png" media-type="image/png"/>
+    <item id="chapter-1" href="Text/chapter1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="chapter-2" href="Text/chapter2.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine>
+    <itemref idref="chapter-1"/>
+    <itemref idref="chapter-2"/>
+  </spine>
+</package>`),
+		"OEBPS/Images/cover.png":    []byte("png-cover-bytes"),
+		"OEBPS/Images/figure.png":   []byte("png-figure-bytes"),
+		"OEBPS/Text/chapter1.xhtml": []byte(`<html xmlns="http://www.w3.org/1999/xhtml"><head><title>第一章</title></head><body><h1>第一章</h1><p>正文<br>内容。</p><img src="../Images/figure.png" alt="插图"/></body></html>`),
+		"OEBPS/Text/chapter2.xhtml": []byte(`<html xmlns="http://www.w3.org/1999/xhtml"><head><title>第二章</title></head><body><h1>第二章</h1><p>再次出现：</p><img src="../Images/figure.png" alt="插图"/></body></html>`),
+	})
+
+	service := NewNovelService(nil)
+	if _, err := service.OpenNovel(epubPath); err != nil {
+		t.Fatalf("OpenNovel returned error: %v", err)
+	}
+
+	outputDir := t.TempDir()
+	outputPath, err := service.ConvertFormat(epubPath, "EPUB", outputDir)
+	if err != nil {
+		t.Fatalf("ConvertFormat returned error: %v", err)
+	}
+	if filepath.Dir(outputPath) != outputDir || filepath.Base(outputPath) != "测试小说.epub" {
+		t.Fatalf("unexpected output path %q", outputPath)
+	}
+
+	reader, err := zip.OpenReader(outputPath)
+	if err != nil {
+		t.Fatalf("open converted epub: %v", err)
+	}
+	defer reader.Close()
+
+	first := reader.File[0]
+	if first.Name != "mimetype" || first.Method != zip.Store || len(first.Extra) != 0 {
+		t.Fatalf("mimetype must be the first stored entry, got %q method %d", first.Name, first.Method)
+	}
+	fileMap := make(map[string]*zip.File, len(reader.File))
+	for _, file := range reader.File {
+		fileMap[file.Name] = file
+	}
+
+	opf, err := readZipFileText(fileMap, "OEBPS/content.opf")
+	if err != nil {
+		t.Fatalf("read content.opf: %v", err)
+	}
+	for _, want := range []string{`version="3.0"`, "<dc:title>测试小说</dc:title>", "<dc:creator>测试作者</dc:creator>", "<dc:language>zh</dc:language>", `properties="nav"`, `properties="cover-image"`, `property="dcterms:modified"`} {
+		if !strings.Contains(opf, want) {
+			t.Fatalf("content.opf missing %q:\n%s", want, opf)
+		}
+	}
+	// 两章共用的插图只导出一次，加上封面共两张图片
+	if strings.Count(opf, `href="images/`) != 2 {
+		t.Fatalf("expected deduplicated images in manifest:\n%s", opf)
+	}
+
+	chapter, err := readZipFileText(fileMap, "OEBPS/text/chapter0001.xhtml")
+	if err != nil {
+		t.Fatalf("read chapter: %v", err)
+	}
+	if !strings.Contains(chapter, `src="../images/image0001.png"`) || !strings.Contains(chapter, "<br/>") || strings.Contains(chapter, "data:") {
+		t.Fatalf("unexpected chapter xhtml:\n%s", chapter)
+	}
+
+	reopened := NewNovelService(nil)
+	novel, err := reopened.OpenNovel(outputPath)
+	if err != nil {
+		t.Fatalf("reopen converted epub: %v", err)
+	}
+	if novel.Title != "测试小说" || len(novel.Chapters) != 2 || novel.Chapters[1].Title != "第二章" {
+		t.Fatalf("unexpected reopened novel: %q %+v", novel.Title, novel.Chapters)
+	}
+	if !strings.HasPrefix(novel.Cover, "data:image/png;base64,") {
+		t.Fatalf("expected cover to survive conversion, got %q", novel.Cover)
+	}
+
+	if second, err := service.ConvertFormat(epubPath, ".epub", outputDir); err != nil || second == outputPath {
+		t.Fatalf("expected a new file name on repeated conversion, got %q, %v", second, err)
+	}
+}
+
+func TestConvertFormatKeepsTxtVolumeHierarchy(t *testing.T) {
+	txtPath := filepath.Join(t.TempDir(), "分卷.txt")
+	content := "第一卷 风起\n第一章 开始\n正文<一>。\n第二章 继续\n正文。\n"
+	if err := os.WriteFile(txtPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("write txt: %v", err)
+	}
+
+	service := NewNovelService(nil)
+	if _, err := service.OpenNovel(txtPath); err != nil {
+		t.Fatalf("OpenNovel returned error: %v", err)
+	}
+	if _, err := service.ConvertFormat(txtPath, "docx", ""); err == nil {
+		t.Fatalf("expected unsupported target format error")
+	}
+
+	outputPath, err := service.ConvertFormat(txtPath, "epub", "")
+	if err != nil {
+		t.Fatalf("ConvertFormat returned error: %v", err)
+	}
+	if filepath.Dir(outputPath) != filepath.Dir(txtPath) {
+		t.Fatalf("expected output next to source, got %q", outputPath)
+	}
+
+	reopened := NewNovelService(nil)
+	novel, err := reopened.OpenNovel(outputPath)
+	if err != nil {
+		t.Fatalf("reopen converted epub: %v", err)
+	}
+	if len(novel.Chapters) != 3 || novel.Chapters[1].ParentIndex != 0 || novel.Chapters[2].Level != 1 {
+		t.Fatalf("expected nested nav to survive conversion, got %+v", novel.Chapters)
+	}
+	if content := reopened.novels[outputPath].Content; !strings.Contains(content, "正文<一>。") {
+		t.Fatalf("expected escaped text to round-trip, got %q", content)
+	}
+}
+
+func TestConvertFormatExportsTextAndMarkdown(t *testing.T) {
+	epubPath := createTestEPUB(t, map[string][]byte{
+		"META-INF/container.xml": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`),
+		"OEBPS/content.opf": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<package version="2.0" xmlns="http://www.idpf.org/2007/opf" unique-identifier="BookId">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>导出测试</dc:title>
+    <dc:creator>测试作者</dc:creator>
+  </metadata>
+  <manifest>
+    <item id="chapter-1" href="Text/chapter1.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine>
+    <itemref idref="chapter-1"/>
+  </spine>
+</package>`),
+		"OEBPS/Images/figure.png": []byte("png-figure-bytes"),
+		"OEBPS/Text/chapter1.xhtml": []byte(`<html xmlns="http://www.w3.org/1999/xhtml"><head><title>第一章   开始</title></head><body>
+<h1>第一章   开始</h1>
+<p>这是<strong>重点</strong>和<em>强调</em>，星号*需要转义。</p>
+<h3>小节</h3>
+<ul><li>甲<ul><li>乙</li></ul></li><li>丙</li></ul>
+<blockquote><p>引用一</p><p>引用二</p></blockquote>
+<p><img src="../Images/figure.png" alt="插图"/></p>
+</body></html>`),
+	})
+
+	service := NewNovelService(nil)
+	if _, err := service.OpenNovel(epubPath); err != nil {
+		t.Fatalf("OpenNovel returned error: %v", err)
+	}
+	outputDir := t.TempDir()
+
+	txtPath, err := service.ConvertFormat(epubPath, "txt", outputDir)
+	if err != nil {
+		t.Fatalf("ConvertFormat txt returned error: %v", err)
+	}
+	txt, err := os.ReadFile(txtPath)
+	if err != nil {
+		t.Fatalf("read txt: %v", err)
+	}
+	if !strings.HasPrefix(string(txt), "导出测试\n作者：测试作者\n\n\n第一章 开始\n\n这是重点和强调") {
+		t.Fatalf("unexpected txt export:\n%s", txt)
+	}
+
+	mdPath, err := service.ConvertFormat(epubPath, "markdown", outputDir)
+	if err != nil {
+		t.Fatalf("ConvertFormat markdown returned error: %v", err)
+	}
+	if filepath.Ext(mdPath) != ".md" {
+		t.Fatalf("expected .md output, got %q", mdPath)
+	}
+	markdown, err := os.ReadFile(mdPath)
+	if err != nil {
+		t.Fatalf("read markdown: %v", err)
+	}
+	for _, want := range []string{
+		"# 导出测试\n",
+		"## 第一章 开始\n",
+		"这是**重点**和*强调*，星号\\*需要转义。",
+		"### 小节",
+		"- 甲\n  - 乙\n- 丙",
+		"> 引用一\n>\n> 引用二",
+		"![插图](导出测试.assets/image0001.png)",
+	} {
+		if !strings.Contains(string(markdown), want) {
+			t.Fatalf("markdown missing %q:\n%s", want, markdown)
+		}
+	}
+	image, err := os.ReadFile(filepath.Join(outputDir, "导出测试.assets", "image0001.png"))
+	if err != nil || string(image) != "png-figure-bytes" {
+		t.Fatalf("expected extracted image asset, got %q, %v", image, err)
+	}
+}
+
+func createTestEPUB(t *testing.T, files map[string][]byte) string {
+	t.Helper()
+
+	tempDir := t.TempDir()
+	epubPath := filepath.Join(tempDir, "sample.epub")
+	outputFile, err := os.Create(epubPath)
+	if err != nil {
+		t.Fatalf("create epub file: %v", err)
+	}
+	defer outputFile.Close()
+
+	writer := zip.NewWriter(outputFile)
+	for name, content := range files {
+		entryWriter, err := writer.Create(name)
+		if err != nil {
+			t.Fatalf("create zip entry %s: %v", name, err)
+		}
+
+		if _, err := entryWriter.Write(content); err != nil {
+			t.Fatalf("write zip entry %s: %v", name, err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close zip writer: %v", err)
+	}
+
+	return epubPath
+}
+
+// testPDFOutline 测试 PDF 的书签，named 为 true 时通过 /Names 名称树跳转
+type testPDFOutline struct {
+	title    string
+	page     int
+	named    bool
+	children []testPDFOutline
+}
+
+type testPDFOptions struct {
+	title   string
+	author  string
+	pages   []string
+	outline []testPDFOutline
+	// password 非空时使用 RC4 128 位（R3）标准安全处理器加密
+	password string
+	// aes 为 true 时改用 AES-128（V4 / R4）加密
+	aes bool
+	// images 每页绘制的图片 XObject，下标与 pages 对应
+	images [][]testPDFImage
+	// contents 每页的原始内容流，非空时代替按 pages 逐行生成的内容
+	contents []string
+	// verticalChars 非空时提供竖排字体 /F2（Identity-V），字符编码为 Unicode 码位，ToUnicode 覆盖这些字符
+	verticalChars string
+	// pageLabels 非空时作为目录的 /PageLabels 数字树
+	pageLabels string
+	// sharedContents 键为页下标，该页复用值所指页的内容流，用于构造完全相同的页面字典
+	sharedContents map[int]int
+}
+
+type testPDFImage struct {
+	// dict 图片字典中除 /Length 外的条目
+	dict string
+	data []byte
+	// x, y, width, height 图片在页面上的位置
+	x, y, width, height float64
+}
+
+func createTestPDF(t *testing.T, title, author string, pageTexts []string) string {
+	t.Helper()
+	return createTestPDFWithOptions(t, testPDFOptions{title: title, author: author, pages: pageTexts})
+}
+
+func createTestPDFWithOptions(t *testing.T, options testPDFOptions) string {
+	t.Helper()
+
+	title, author, pageTexts := options.title, options.author, options.pages
+	if len(pageTexts) == 0 {
+		pageTexts = []string{""}
+	}
+
+	tempDir := t.TempDir()
+	pdfPath := filepath.Join(tempDir, "sample.pdf")
+
+	pageObjectStart := 3
+	contentObjectStart := pageObjectStart + len(pageTexts)
+	fontObjectNumber := contentObjectStart + len(pageTexts)
+	infoObjectNumber := fontObjectNumber + 1
+	objectCount := infoObjectNumber
+
+	objects := make([]string, objectCount+1)
+	pageRefs := make([]string, 0, len(pageTexts))
+	catalogExtras := ""
+
+	if len(options.outline) > 0 {
+		var namedDests []string
+		var addItems func(items []testPDFOutline, parent int) (int, int)
+		addItems = func(items []testPDFOutline, parent int) (int, int) {
+			numbers := make([]int, len(items))
+			for index := range items {
+				objects = append(objects, "")
+				objectCount++
+				numbers[index] = objectCount
+			}
+			for index, item := range items {
+				destination := fmt.Sprintf("/Dest [%d 0 R /XYZ 0 792 0]", pageObjectStart+item.page)
+				if item.named {
+					name := fmt.Sprintf("dest-%d", numbers[index])
+					destination = fmt.Sprintf("/A << /S /GoTo /D (%s) >>", name)
+					namedDests = append(namedDests, fmt.Sprintf("(%s) [%d 0 R /Fit]", name, pageObjectStart+item.page))
+				}
+				fields := fmt.Sprintf("/Title (%s) /Parent %d 0 R %s", escapeTestPDFString(item.title), parent, destination)
+				if index > 0 {
+					fields += fmt.Sprintf(" /Prev %d 0 R", numbers[index-1])
+				}
+				if index+1 < len(items) {
+					fields += fmt.Sprintf(" /Next %d 0 R", numbers[index+1])
+				}
+				if len(item.children) > 0 {
+					first, last := addItems(item.children, numbers[index])
+					fields += fmt.Sprintf(" /First %d 0 R /Last %d 0 R /Count %d", first, last, len(item.children))
+				}
+				objects[numbers[index]] = "<< " + fields + " >>"
+			}
+			return numbers[0], numbers[len(numbers)-1]
+		}
+
+		objects = append(objects, "")
+		objectCount++
+		outlineRoot := objectCount
+		first, last := addItems(options.outline, outlineRoot)
+		objects[outlineRoot] = fmt.Sprintf("<< /Type /Outlines /First %d 0 R /Last %d 0 R /Count %d >>", first, last, len(options.outline))
+		catalogExtras = fmt.Sprintf(" /Outlines %d 0 R", outlineRoot)
+		if len(namedDests) > 0 {
+			catalogExtras += fmt.Sprintf(" /Names << /Dests << /Names [%s] >> >>", strings.Join(namedDests, " "))
+		}
+	}
+
+	if options.pageLabels != "" {
+		catalogExtras += " /PageLabels " + options.pageLabels
+	}
+
+	fontResources := fmt.Sprintf("/F1 %d 0 R", fontObjectNumber)
+	if options.verticalChars != "" {
+		var mappings []string
+		for _, char := range options.verticalChars {
+			mappings = append(mappings, fmt.Sprintf("<%04X> <%04X>", char, char))
+		}
+		cmap := fmt.Sprintf("begincmap\n%d beginbfchar\n%s\nendbfchar\nendcmap", len(mappings), strings.Join(mappings, "\n"))
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /SimSun /Encoding /Identity-V /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>", objectCount+2, objectCount+3),
+			"<< /Type /Font /Subtype /CIDFontType2 /BaseFont /SimSun /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /DW 1000 >>",
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(cmap), cmap),
+		)
+		fontResources += fmt.Sprintf(" /F2 %d 0 R", objectCount+1)
+		objectCount += 3
+	}
+
+	for index, pageText := range pageTexts {
+		pageObjectNumber := pageObjectStart + index
+		contentObjectNumber := contentObjectStart + index
+		pageRefs = append(pageRefs, fmt.Sprintf("%d 0 R", pageObjectNumber))
+
+		stream := buildTestPDFContentStream(pageText)
+		if index < len(options.contents) && options.contents[index] != "" {
+			stream = options.contents[index]
+		}
+		xobjects := ""
+		if index < len(options.images) {
+			for imageIndex, pageImage := range options.images[index] {
+				objects = append(objects, fmt.Sprintf(
+					"<< /Type /XObject /Subtype /Image %s /Length %d >>\nstream\n%s\nendstream",
+					pageImage.dict,
+					len(pageImage.data),
+					pageImage.data,
+				))
+				objectCount++
+				xobjects += fmt.Sprintf(" /Im%d %d 0 R", imageIndex, objectCount)
+				stream += fmt.Sprintf("\nq %g 0 0 %g %g %g cm /Im%d Do Q", pageImage.width, pageImage.height, pageImage.x, pageImage.y, imageIndex)
+			}
+		}
+
+		pageContentNumber := contentObjectNumber
+		if source, shared := options.sharedContents[index]; shared {
+			pageContentNumber = contentObjectStart + source
+		}
+		objects[pageObjectNumber] = fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents %d 0 R /Resources << /Font << %s >> /XObject <<%s >> >> >>",
+			pageContentNumber,
+			fontResources,
+			xobjects,
+		)
+
+		objects[contentObjectNumber] = fmt.Sprintf(
+			"<< /Length %d >>\nstream\n%s\nendstream",
+			len(stream),
+			stream,
+		)
+	}
+
+	objects[1] = "<< /Type /Catalog /Pages 2 0 R" + catalogExtras + " >>"
+	objects[2] = fmt.Sprintf(
+		"<< /Type /Pages /Kids [%s] /Count %d >>",
+		strings.Join(pageRefs, " "),
+		len(pageTexts),
+	)
+	objects[fontObjectNumber] = "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>"
+	objects[infoObjectNumber] = fmt.Sprintf(
+		"<< /Title (%s) /Author (%s) >>",
+		escapeTestPDFString(title),
+		escapeTestPDFString(author),
+	)
+
+	trailerExtras := ""
+	if options.password != "" {
+		trailerExtras = encryptTestPDFObjects(objects, options.password, options.aes)
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString("%PDF-1.4\n")
+
+	offsets := make([]int, objectCount+1)
+	for objectNumber := 1; objectNumber <= objectCount; objectNumber++ {
+		offsets[objectNumber] = buffer.Len()
+		fmt.Fprintf(&buffer, "%d 0 obj\n%s\nendobj\n", objectNumber, objects[objectNumber])
+	}
+
+	xrefOffset := buffer.Len()
+	fmt.Fprintf(&buffer, "xref\n0 %d\n", objectCount+1)
+	buffer.WriteString("0000000000 65535 f \n")
+	for objectNumber := 1; objectNumber <= objectCount; objectNumber++ {
+		fmt.Fprintf(&buffer, "%010d 00000 n \n", offsets[objectNumber])
+	}
+
+	fmt.Fprintf(
+		&buffer,
+		"trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R%s >>\nstartxref\n%d\n%%%%EOF\n",
+		objectCount+1,
+		infoObjectNumber,
+		trailerExtras,
+		xrefOffset,
+	)
+
+	if err := os.WriteFile(pdfPath, buffer.Bytes(), 0644); err != nil {
+		t.Fatalf("write pdf file: %v", err)
+	}
+
+	return pdfPath
+}
+
+// encryptTestPDFObjects 按 PDF 标准安全处理器 R3（RC4）或 R4（AESV2）加密各对象的字符串和流，
+// 返回需要追加到 trailer 的字段
+func encryptTestPDFObjects(objects []string, password string, useAES bool) string {
+	padding := []byte{
+		0x28, 0xBF, 0x4E, 0x5E, 0x4E, 0x75, 0x8A, 0x41, 0x64, 0x00, 0x4E, 0x56, 0xFF, 0xFA, 0x01, 0x08,
+		0x2E, 0x2E, 0x00, 0xB6, 0xD0, 0x68, 0x3E, 0x80, 0x2F, 0x0C, 0xA9, 0xFE, 0x64, 0x53, 0x69, 0x7A,
+	}
+	padded := append([]byte(password), padding...)[:32]
+	rc4XOR := func(key, data []byte) []byte {
+		cipher, _ := rc4.NewCipher(key)
+		result := make([]byte, len(data))
+		cipher.XORKeyStream(result, data)
+		return result
+	}
+	rc4Rounds := func(key, data []byte) []byte {
+		data = rc4XOR(key, data)
+		for round := 1; round <= 19; round++ {
+			roundKey := make([]byte, len(key))
+			for index := range key {
+				roundKey[index] = key[index] ^ byte(round)
+			}
+			data = rc4XOR(roundKey, data)
+		}
+		return data
+	}
+	md5Rounds := func(data []byte) []byte {
+		sum := md5.Sum(data)
+		for round := 0; round < 50; round++ {
+			sum = md5.Sum(sum[:])
+		}
+		return sum[:]
+	}
+
+	id := []byte("moyureader-test-id")
+	permissions := int32(-4)
+	ownerEntry := rc4Rounds(md5Rounds(padded), padded)
+
+	keyInput := append(append(append([]byte{}, padded...), ownerEntry...), byte(permissions), byte(permissions>>8), byte(permissions>>16), byte(permissions>>24))
+	key := md5Rounds(append(keyInput, id...))
+
+	userHash := md5.Sum(append(append([]byte{}, padding...), id...))
+	userEntry := append(rc4Rounds(key, userHash[:]), make([]byte, 16)...)
+
+	stringPattern := regexp.MustCompile(`\((?:\\.|[^\\()])*\)`)
+	for objectNumber := 1; objectNumber < len(objects); objectNumber++ {
+		objectKeyInput := append(append([]byte{}, key...), byte(objectNumber), byte(objectNumber>>8), byte(objectNumber>>16), 0, 0)
+		if useAES {
+			objectKeyInput = append(objectKeyInput, "sAlT"...)
+		}
+		objectKey := md5.Sum(objectKeyInput)
+		encrypt := func(data []byte) []byte { return rc4XOR(objectKey[:], data) }
+		if useAES {
+			encrypt = func(data []byte) []byte {
+				block, _ := aes.NewCipher(objectKey[:])
+				padding := aes.BlockSize - len(data)%aes.BlockSize
+				plain := append(append([]byte{}, data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+				sealed := make([]byte, aes.BlockSize+len(plain))
+				copy(sealed, bytes.Repeat([]byte{byte(objectNumber)}, aes.BlockSize))
+				cipher.NewCBCEncrypter(block, sealed[:aes.BlockSize]).CryptBlocks(sealed[aes.BlockSize:], plain)
+				return sealed
+			}
+		}
+
+		dictionary, stream, isStream := strings.Cut(objects[objectNumber], "\nstream\n")
+		dictionary = stringPattern.ReplaceAllStringFunc(dictionary, func(literal string) string {
+			unescaped := strings.NewReplacer(`\\`, `\`, `\(`, "(", `\)`, ")").Replace(literal[1 : len(literal)-1])
+			return "<" + hex.EncodeToString(encrypt([]byte(unescaped))) + ">"
+		})
+		if isStream {
+			data := strings.TrimSuffix(stream, "\nendstream")
+			encrypted := encrypt([]byte(data))
+			dictionary = regexp.MustCompile(`/Length \d+`).ReplaceAllString(dictionary, fmt.Sprintf("/Length %d", len(encrypted)))
+			objects[objectNumber] = dictionary + "\nstream\n" + string(encrypted) + "\nendstream"
+		} else {
+			objects[objectNumber] = dictionary
+		}
+	}
+
+	handler := "/V 2 /R 3 /Length 128"
+	if useAES {
+		handler = "/V 4 /R 4 /Length 128 /CF << /StdCF << /CFM /AESV2 /Length 16 /AuthEvent /DocOpen >> >> /StmF /StdCF /StrF /StdCF"
+	}
+	return fmt.Sprintf(
+		" /Encrypt << /Filter /Standard %s /P %d /O <%s> /U <%s> >> /ID [<%s> <%s>]",
+		handler,
+		permissions,
+		hex.EncodeToString(ownerEntry),
+		hex.EncodeToString(userEntry),
+		hex.EncodeToString(id),
+		hex.EncodeToString(id),
+	)
+}
+
+func buildTestPDFContentStream(pageText string) string {
+	lines := strings.Split(pageText, "\n")
+	var builder strings.Builder
 	for index, line := range lines {
 		y := 720 - index*24
 		builder.WriteString("BT\n/F1 18 Tf\n")
@@ -405,3 +2218,104 @@ func escapeTestPDFString(value string) string {
 	)
 	return replacer.Replace(value)
 }
+
+func encodeTestUTF16LE(value string) []byte {
+	encoded := make([]byte, 0, len(value)*2)
+	for _, unit := range utf16.Encode([]rune(value)) {
+		encoded = append(encoded, byte(unit), byte(unit>>8))
+	}
+	return encoded
+}
+
+type testMOBIOptions struct {
+	text       string
+	title      string
+	author     string
+	images     [][]byte
+	coverIndex int
+	encryption uint16
+}
+
+// createTestMOBI 生成只含一条 PalmDOC 文本记录的 MOBI6 文件
+func createTestMOBI(t *testing.T, options testMOBIOptions) string {
+	t.Helper()
+
+	// 仅用 PalmDOC 的字面量编码：非 ASCII 字节以 0x01 前缀逐个转义
+	var compressed bytes.Buffer
+	for _, value := range []byte(options.text) {
+		if value == 0 || (value >= 0x09 && value <= 0x7F) {
+			compressed.WriteByte(value)
+		} else {
+			compressed.Write([]byte{0x01, value})
+		}
+	}
+
+	var exth bytes.Buffer
+	exthRecords := 0
+	writeEXTH := func(recordType uint32, value []byte) {
+		binary.Write(&exth, binary.BigEndian, recordType)
+		binary.Write(&exth, binary.BigEndian, uint32(len(value)+8))
+		exth.Write(value)
+		exthRecords++
+	}
+	if options.author != "" {
+		writeEXTH(100, []byte(options.author))
+	}
+	if options.title != "" {
+		writeEXTH(503, []byte(options.title))
+	}
+	if options.coverIndex >= 0 && len(options.images) > 0 {
+		coverOffset := make([]byte, 4)
+		binary.BigEndian.PutUint32(coverOffset, uint32(options.coverIndex))
+		writeEXTH(201, coverOffset)
+	}
+
+	const mobiHeaderLength = 0xE8
+	record0 := make([]byte, 16+mobiHeaderLength)
+	binary.BigEndian.PutUint16(record0[0:], 2)
+	binary.BigEndian.PutUint32(record0[4:], uint32(len(options.text)))
+	binary.BigEndian.PutUint16(record0[8:], 1)
+	binary.BigEndian.PutUint16(record0[10:], 4096)
+	binary.BigEndian.PutUint16(record0[12:], options.encryption)
+	copy(record0[16:], "MOBI")
+	binary.BigEndian.PutUint32(record0[0x14:], mobiHeaderLength)
+	binary.BigEndian.PutUint32(record0[0x18:], 2)
+	binary.BigEndian.PutUint32(record0[0x1C:], 65001)
+	binary.BigEndian.PutUint32(record0[0x24:], 6)
+	binary.BigEndian.PutUint32(record0[0x6C:], 2)
+	binary.BigEndian.PutUint32(record0[0x80:], 0x40)
+	binary.BigEndian.PutUint32(record0[0xF4:], 0xFFFFFFFF)
+
+	record0 = append(record0, "EXTH"...)
+	record0 = binary.BigEndian.AppendUint32(record0, uint32(12+exth.Len()))
+	record0 = binary.BigEndian.AppendUint32(record0, uint32(exthRecords))
+	record0 = append(record0, exth.Bytes()...)
+
+	records := append([][]byte{record0, compressed.Bytes()}, options.images...)
+
+	var file bytes.Buffer
+	name := make([]byte, 32)
+	copy(name, "test-book")
+	file.Write(name)
+	file.Write(make([]byte, 28))
+	file.WriteString("BOOKMOBI")
+	file.Write(make([]byte, 8))
+	binary.Write(&file, binary.BigEndian, uint16(len(records)))
+
+	offset := 78 + len(records)*8 + 2
+	for index, record := range records {
+		binary.Write(&file, binary.BigEndian, uint32(offset))
+		binary.Write(&file, binary.BigEndian, uint32(index))
+		offset += len(record)
+	}
+	file.Write([]byte{0, 0})
+	for _, record := range records {
+		file.Write(record)
+	}
+
+	mobiPath := filepath.Join(t.TempDir(), "sample.mobi")
+	if err := os.WriteFile(mobiPath, file.Bytes(), 0o644); err != nil {
+		t.Fatalf("write mobi file: %v", err)
+	}
+	return mobiPath
+}
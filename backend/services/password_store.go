@@ -0,0 +1,205 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// secretKeyFileName 加密已保存密码所用的本机密钥
+const secretKeyFileName = "secret.key"
+
+// secretKeyDir 密钥所在目录。密钥放在当前用户的配置目录，不和数据目录放在一起，
+// 数据目录被同步或拷走时已保存的密码无法脱离本机解密；测试中替换为临时目录
+var secretKeyDir = func() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "moyureader"), nil
+}
+
+// secretKeyMu 串行化密钥的读取和首次生成，避免并发首次保存各自生成密钥
+var secretKeyMu sync.Mutex
+
+// SaveBookPassword 加密保存某本书的打开密码
+func (s *ProgressService) SaveBookPassword(filePath, password string) error {
+	sealed, err := s.sealSecret(password)
+	if err != nil {
+		return err
+	}
+
+	settings := BookSettings{FilePath: filePath}
+	if saved := s.GetBookSettings(filePath); saved != nil {
+		settings = *saved
+	}
+	settings.Password = sealed
+	return s.SaveBookSettings(settings)
+}
+
+// GetBookPassword 获取某本书已保存的打开密码，未保存或无法解密时返回空
+func (s *ProgressService) GetBookPassword(filePath string) string {
+	settings := s.GetBookSettings(filePath)
+	if settings == nil || settings.Password == "" {
+		return ""
+	}
+
+	password, err := s.openSecret(settings.Password)
+	if err != nil {
+		return ""
+	}
+	return password
+}
+
+// ForgetBookPassword 删除某本书已保存的打开密码
+func (s *ProgressService) ForgetBookPassword(filePath string) error {
+	settings := s.GetBookSettings(filePath)
+	if settings == nil || settings.Password == "" {
+		return nil
+	}
+
+	settings.Password = ""
+	return s.SaveBookSettings(*settings)
+}
+
+// sealSecret 使用 AES-GCM 加密，结果为 base64(nonce + 密文)
+func (s *ProgressService) sealSecret(plain string) (string, error) {
+	aead, err := s.secretCipher(true)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("生成随机数失败: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (s *ProgressService) openSecret(sealed string) (string, error) {
+	aead, err := s.secretCipher(false)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", fmt.Errorf("已保存的密码格式无效")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("解密已保存的密码失败: %w", err)
+	}
+	return string(plain), nil
+}
+
+// secretCipher 读取本机密钥，create 为 true 时在密钥不存在时生成
+func (s *ProgressService) secretCipher(create bool) (cipher.AEAD, error) {
+	adoptLegacySecretKey(s.currentDataDir())
+
+	secretKeyMu.Lock()
+	defer secretKeyMu.Unlock()
+
+	keyPath, err := secretKeyPath()
+	if err != nil {
+		return nil, err
+	}
+	key, err := os.ReadFile(keyPath)
+	if os.IsNotExist(err) && create {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("生成密钥失败: %w", err)
+		}
+		key, err = storeSecretKey(keyPath, key)
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("读取密钥失败: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("密钥无效: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func secretKeyPath() (string, error) {
+	dir, err := secretKeyDir()
+	if err != nil {
+		return "", fmt.Errorf("定位密钥目录失败: %w", err)
+	}
+	return filepath.Join(dir, secretKeyFileName), nil
+}
+
+// storeSecretKey 先写临时文件再以硬链接原子地创建密钥文件；
+// 其他进程已抢先创建时改用已有的密钥，返回实际生效的密钥
+func storeSecretKey(keyPath string, key []byte) ([]byte, error) {
+	dir := filepath.Dir(keyPath)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("创建密钥目录失败: %w", err)
+	}
+
+	tempFile, err := os.CreateTemp(dir, secretKeyFileName+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("保存密钥失败: %w", err)
+	}
+	tempPath := tempFile.Name()
+	defer os.Remove(tempPath)
+
+	_, err = tempFile.Write(key)
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("保存密钥失败: %w", err)
+	}
+
+	if err := os.Link(tempPath, keyPath); err != nil {
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("保存密钥失败: %w", err)
+		}
+		existing, err := os.ReadFile(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("读取密钥失败: %w", err)
+		}
+		return existing, nil
+	}
+	return key, nil
+}
+
+// adoptLegacySecretKey 旧版本把密钥保存在数据目录，首次使用时移到用户配置目录，
+// 之前保存的密码仍可解密；本机已有密钥时保留旧文件不动
+func adoptLegacySecretKey(dataDir string) {
+	legacyPath := filepath.Join(dataDir, secretKeyFileName)
+	key, err := os.ReadFile(legacyPath)
+	if err != nil {
+		return
+	}
+
+	secretKeyMu.Lock()
+	defer secretKeyMu.Unlock()
+
+	keyPath, err := secretKeyPath()
+	if err != nil {
+		return
+	}
+	if _, err := os.Stat(keyPath); err == nil {
+		return
+	}
+	if stored, err := storeSecretKey(keyPath, key); err == nil && string(stored) == string(key) {
+		_ = os.Remove(legacyPath)
+	}
+}
@@ -0,0 +1,802 @@
+//go:build !darwin
+
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+
+	pdf "github.com/ledongthuc/pdf"
+)
+
+// 纯 Go 的图片型 PDF 渲染：不绘制文字与矢量图形，只提取页面上绘制的图片 XObject。
+// 扫描版 PDF 每页通常是一张整页图片（或若干条带），足以阅读。
+
+const (
+	// pdfImageRenderMaxWidth 多张图片拼合为整页时画布的最大宽度
+	pdfImageRenderMaxWidth = 1600
+	// pdfImageMaxPixels 单张图片允许解码的最大像素数，避免损坏的文件耗尽内存
+	pdfImageMaxPixels = 64 << 20
+	// pdfImageMaxStreamBytes 图片流读取和解码后的最大字节数，按最大像素数、每像素 4 个 8 位分量计算
+	pdfImageMaxStreamBytes = pdfImageMaxPixels * 4
+	// pdfFormMaxDepth Form XObject 的最大嵌套层数
+	pdfFormMaxDepth = 8
+)
+
+// pdfRect 页面坐标系（左下角为原点）中的矩形
+type pdfRect struct {
+	minX, minY, maxX, maxY float64
+}
+
+func (r pdfRect) width() float64  { return r.maxX - r.minX }
+func (r pdfRect) height() float64 { return r.maxY - r.minY }
+func (r pdfRect) area() float64   { return r.width() * r.height() }
+
+func (r pdfRect) union(other pdfRect) pdfRect {
+	return pdfRect{
+		minX: min(r.minX, other.minX),
+		minY: min(r.minY, other.minY),
+		maxX: max(r.maxX, other.maxX),
+		maxY: max(r.maxY, other.maxY),
+	}
+}
+
+// pdfPageImage 页面上绘制的一张图片
+type pdfPageImage struct {
+	stream    pdf.Value
+	resources pdf.Value
+	rect      pdfRect
+}
+
+type pdfImageCollector struct {
+	images []pdfPageImage
+}
+
+// collectPDFPageImages 解释页面内容流，按 cm / q / Q 跟踪变换矩阵，记录每个 Do 绘制的图片及其位置
+func collectPDFPageImages(page pdf.Page) []pdfPageImage {
+	collector := &pdfImageCollector{}
+	collector.walk(page.V.Key("Contents"), page.Resources(), pdfIdentityMatrix, 0)
+	return collector.images
+}
+
+func (c *pdfImageCollector) walk(content, resources pdf.Value, ctm pdfMatrix, depth int) {
+	if content.Kind() == pdf.Null {
+		return
+	}
+
+	// 内联图片等无法解析的内容会中断解释，保留已经收集到的图片
+	defer func() {
+		_ = recover()
+	}()
+
+	var saved []pdfMatrix
+	pdf.Interpret(content, func(stk *pdf.Stack, op string) {
+		args := make([]pdf.Value, stk.Len())
+		for i := len(args) - 1; i >= 0; i-- {
+			args[i] = stk.Pop()
+		}
+
+		switch op {
+		case "q":
+			saved = append(saved, ctm)
+		case "Q":
+			if n := len(saved); n > 0 {
+				ctm = saved[n-1]
+				saved = saved[:n-1]
+			}
+		case "cm":
+			if len(args) >= 6 {
+				var matrix pdfMatrix
+				for i := range matrix {
+					matrix[i] = args[len(args)-6+i].Float64()
+				}
+				ctm = matrix.multiply(ctm)
+			}
+		case "Do":
+			if len(args) > 0 {
+				c.draw(args[len(args)-1].Name(), resources, ctm, depth)
+			}
+		}
+	})
+}
+
+func (c *pdfImageCollector) draw(name string, resources pdf.Value, ctm pdfMatrix, depth int) {
+	xobject := resources.Key("XObject").Key(name)
+	switch xobject.Key("Subtype").Name() {
+	case "Image":
+		// 图片绘制在单位正方形内，由当前变换矩阵映射到页面
+		rect := pdfRect{minX: ctm[4], minY: ctm[5], maxX: ctm[4], maxY: ctm[5]}
+		for _, corner := range [][2]float64{{1, 0}, {0, 1}, {1, 1}} {
+			x, y := ctm.apply(corner[0], corner[1])
+			rect = rect.union(pdfRect{minX: x, minY: y, maxX: x, maxY: y})
+		}
+		c.images = append(c.images, pdfPageImage{stream: xobject, resources: resources, rect: rect})
+	case "Form":
+		if depth >= pdfFormMaxDepth {
+			return
+		}
+		formResources := xobject.Key("Resources")
+		if formResources.Kind() == pdf.Null {
+			formResources = resources
+		}
+		matrix := pdfIdentityMatrix
+		if values := xobject.Key("Matrix"); values.Len() == 6 {
+			for i := range matrix {
+				matrix[i] = values.Index(i).Float64()
+			}
+		}
+		c.walk(xobject, formResources, matrix.multiply(ctm), depth+1)
+	}
+}
+
+// pdfImageDecoder 读取并解码图片 XObject
+type pdfImageDecoder struct {
+	file     *os.File
+	fileSize int64
+	// encrypted 文件已加密；fileKey 为空时表示无法取得解密密钥
+	encrypted bool
+	fileKey   []byte
+	useAES    bool
+}
+
+// renderPage 单张图片（或其余只是小装饰）时直接输出主图，JPEG 原样透传；
+// 多张图片拼成的页面（如条带扫描）按位置绘制到同一画布上
+func (d *pdfImageDecoder) renderPage(images []pdfPageImage) (string, error) {
+	primary := images[0]
+	bounds := images[0].rect
+	for _, item := range images[1:] {
+		if item.rect.area() > primary.rect.area() {
+			primary = item
+		}
+		bounds = bounds.union(item.rect)
+	}
+
+	if len(images) == 1 || primary.rect.area() >= bounds.area()*0.9 {
+		return d.imageDataURL(primary)
+	}
+	return d.composeDataURL(images, bounds)
+}
+
+func (d *pdfImageDecoder) imageDataURL(item pdfPageImage) (string, error) {
+	data, filter, err := d.streamData(item.stream)
+	if err != nil {
+		return "", err
+	}
+	if filter == "DCTDecode" {
+		return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(data), nil
+	}
+
+	decoded, err := d.decodeImage(item, data, filter)
+	if err != nil {
+		return "", err
+	}
+	return encodePNGDataURL(decoded)
+}
+
+func (d *pdfImageDecoder) composeDataURL(images []pdfPageImage, bounds pdfRect) (string, error) {
+	if bounds.width() <= 0 || bounds.height() <= 0 {
+		return "", fmt.Errorf("页面图片尺寸无效")
+	}
+
+	type decodedImage struct {
+		image  image.Image
+		rect   pdfRect
+		isMask bool
+	}
+	decodedImages := make([]decodedImage, 0, len(images))
+	scale := 0.0
+	var firstErr error
+	for _, item := range images {
+		if item.rect.width() <= 0 || item.rect.height() <= 0 {
+			continue
+		}
+		data, filter, err := d.streamData(item.stream)
+		if err == nil {
+			var decoded image.Image
+			if decoded, err = d.decodeImage(item, data, filter); err == nil {
+				decodedImages = append(decodedImages, decodedImage{
+					image:  decoded,
+					rect:   item.rect,
+					isMask: item.stream.Key("ImageMask").Bool(),
+				})
+				// 按分辨率最高的图片确定画布缩放比例，尽量不损失清晰度
+				scale = max(scale, float64(decoded.Bounds().Dx())/item.rect.width())
+				continue
+			}
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if len(decodedImages) == 0 {
+		if firstErr == nil {
+			firstErr = fmt.Errorf("页面图片尺寸无效")
+		}
+		return "", firstErr
+	}
+
+	scale = min(scale, pdfImageRenderMaxWidth/bounds.width())
+	canvasWidth := max(1, int(bounds.width()*scale+0.5))
+	canvasHeight := max(1, int(bounds.height()*scale+0.5))
+	canvas := image.NewRGBA(image.Rect(0, 0, canvasWidth, canvasHeight))
+	draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+
+	for _, item := range decodedImages {
+		// PDF 坐标原点在左下角，画布原点在左上角
+		target := image.Rect(
+			int((item.rect.minX-bounds.minX)*scale),
+			int((bounds.maxY-item.rect.maxY)*scale),
+			int((item.rect.maxX-bounds.minX)*scale+0.5),
+			int((bounds.maxY-item.rect.minY)*scale+0.5),
+		)
+		drawPDFImageScaled(canvas, target, item.image, item.isMask)
+	}
+	return encodePNGDataURL(canvas)
+}
+
+// drawPDFImageScaled 最近邻缩放绘制；遮罩图片只绘制着色的像素
+func drawPDFImageScaled(canvas *image.RGBA, target image.Rectangle, source image.Image, isMask bool) {
+	sourceBounds := source.Bounds()
+	if target.Dx() <= 0 || target.Dy() <= 0 || sourceBounds.Empty() {
+		return
+	}
+
+	clipped := target.Intersect(canvas.Bounds())
+	for y := clipped.Min.Y; y < clipped.Max.Y; y++ {
+		sourceY := sourceBounds.Min.Y + (y-target.Min.Y)*sourceBounds.Dy()/target.Dy()
+		for x := clipped.Min.X; x < clipped.Max.X; x++ {
+			sourceX := sourceBounds.Min.X + (x-target.Min.X)*sourceBounds.Dx()/target.Dx()
+			pixel := color.RGBAModel.Convert(source.At(sourceX, sourceY)).(color.RGBA)
+			if isMask && pixel.R > 127 {
+				continue
+			}
+			canvas.SetRGBA(x, y, pixel)
+		}
+	}
+}
+
+func encodePNGDataURL(img image.Image) (string, error) {
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		return "", fmt.Errorf("编码页面图片失败: %w", err)
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buffer.Bytes()), nil
+}
+
+// streamData 读取流的原始数据，加密文件先解密，再解除通用编码，返回剩下的图片编码（目前只有 DCTDecode）
+func (d *pdfImageDecoder) streamData(stream pdf.Value) ([]byte, string, error) {
+	filters, params := pdfStreamFilters(stream)
+
+	offset, ok := pdfStreamOffset(stream)
+	if !ok || offset < 0 || offset >= d.fileSize {
+		return nil, "", fmt.Errorf("无法定位图片数据")
+	}
+	length := stream.Key("Length").Int64()
+	if length <= 0 {
+		return nil, "", fmt.Errorf("图片数据长度无效")
+	}
+	// /Length 来自文件本身，不可信：不超过文件剩余部分，也不超过允许的图片数据大小
+	length = min(length, d.fileSize-offset, pdfImageMaxStreamBytes)
+
+	data := make([]byte, length)
+	n, err := d.file.ReadAt(data, offset)
+	if err != nil && err != io.EOF {
+		return nil, "", fmt.Errorf("读取图片数据失败: %w", err)
+	}
+	data = data[:n]
+
+	if d.encrypted {
+		ref, hasRef := pdfValueRef(stream)
+		if d.fileKey == nil || !hasRef {
+			return nil, "", fmt.Errorf("无法解密加密 PDF 中的图片")
+		}
+		if data, err = decryptPDFStreamData(d.fileKey, d.useAES, ref, data); err != nil {
+			return nil, "", err
+		}
+	}
+	return decodePDFFilters(data, filters, params)
+}
+
+// pdfStreamFilters 展开 Filter / DecodeParms，缩写统一为完整名称
+func pdfStreamFilters(stream pdf.Value) ([]string, []pdf.Value) {
+	filterValue := stream.Key("Filter")
+	paramValue := stream.Key("DecodeParms")
+
+	var filters []string
+	var params []pdf.Value
+	switch filterValue.Kind() {
+	case pdf.Name:
+		filters = []string{filterValue.Name()}
+		params = []pdf.Value{paramValue}
+	case pdf.Array:
+		for i := 0; i < filterValue.Len(); i++ {
+			filters = append(filters, filterValue.Index(i).Name())
+			params = append(params, paramValue.Index(i))
+		}
+	}
+
+	abbreviations := map[string]string{
+		"AHx": "ASCIIHexDecode",
+		"A85": "ASCII85Decode",
+		"Fl":  "FlateDecode",
+		"RL":  "RunLengthDecode",
+		"DCT": "DCTDecode",
+		"LZW": "LZWDecode",
+		"CCF": "CCITTFaxDecode",
+	}
+	for i, filter := range filters {
+		if fullName, ok := abbreviations[filter]; ok {
+			filters[i] = fullName
+		}
+	}
+	return filters, params
+}
+
+func decodePDFFilters(data []byte, filters []string, params []pdf.Value) ([]byte, string, error) {
+	var err error
+	for i, filter := range filters {
+		switch filter {
+		case "ASCIIHexDecode":
+			data = decodePDFASCIIHex(data)
+		case "ASCII85Decode":
+			data, err = decodePDFASCII85(data)
+		case "FlateDecode":
+			if data, err = inflatePDFStream(data, pdfImageMaxStreamBytes); err == nil {
+				data, err = applyPDFPredictor(data, params[i])
+			}
+		case "RunLengthDecode":
+			data = decodePDFRunLength(data)
+		case "DCTDecode":
+			if i != len(filters)-1 {
+				return nil, "", fmt.Errorf("图片编码顺序无效")
+			}
+			return data, filter, nil
+		default:
+			// JPXDecode、JBIG2Decode、CCITTFaxDecode 等
+			return nil, "", fmt.Errorf("暂不支持 %s 编码的图片", filter)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("解码图片数据失败: %w", err)
+		}
+	}
+	return data, "", nil
+}
+
+func decodePDFASCIIHex(data []byte) []byte {
+	decoded := make([]byte, 0, len(data)/2)
+	high, pending := byte(0), false
+	for _, char := range data {
+		var value byte
+		switch {
+		case char >= '0' && char <= '9':
+			value = char - '0'
+		case char >= 'a' && char <= 'f':
+			value = char - 'a' + 10
+		case char >= 'A' && char <= 'F':
+			value = char - 'A' + 10
+		case char == '>':
+			if pending {
+				decoded = append(decoded, high<<4)
+			}
+			return decoded
+		default:
+			continue
+		}
+
+		if pending {
+			decoded = append(decoded, high<<4|value)
+		} else {
+			high = value
+		}
+		pending = !pending
+	}
+	if pending {
+		decoded = append(decoded, high<<4)
+	}
+	return decoded
+}
+
+func decodePDFASCII85(data []byte) ([]byte, error) {
+	cleaned := make([]byte, 0, len(data))
+	for _, char := range data {
+		if char > ' ' {
+			cleaned = append(cleaned, char)
+		}
+	}
+	cleaned = bytes.TrimPrefix(cleaned, []byte("<~"))
+	if end := bytes.Index(cleaned, []byte("~>")); end >= 0 {
+		cleaned = cleaned[:end]
+	}
+	return io.ReadAll(ascii85.NewDecoder(bytes.NewReader(cleaned)))
+}
+
+// inflatePDFStream 截断的压缩流尽量保留已解出的数据，扫描件缺几行像素仍可阅读；
+// 解压结果超过 limit 字节时视为损坏或恶意构造的文件
+func inflatePDFStream(data []byte, limit int64) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	inflated, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if int64(len(inflated)) > limit {
+		return nil, fmt.Errorf("图片数据解压后超过 %d 字节", limit)
+	}
+	if err != nil && len(inflated) == 0 {
+		return nil, err
+	}
+	return inflated, nil
+}
+
+// applyPDFPredictor 还原 Flate 的 TIFF（2）与 PNG（10 及以上）预测
+func applyPDFPredictor(data []byte, params pdf.Value) ([]byte, error) {
+	predictor := params.Key("Predictor").Int64()
+	if predictor <= 1 {
+		return data, nil
+	}
+
+	colors := pdfIntOr(params.Key("Colors"), 1)
+	bitsPerComponent := pdfIntOr(params.Key("BitsPerComponent"), 8)
+	columns := pdfIntOr(params.Key("Columns"), 1)
+	// 每行像素数不超过单张图片的像素上限，避免按损坏的参数分配超大的行缓冲
+	if colors < 1 || colors > 32 || bitsPerComponent < 1 || bitsPerComponent > 16 || columns < 1 || columns > pdfImageMaxPixels {
+		return nil, fmt.Errorf("预测参数无效")
+	}
+	bytesPerPixel := max(1, (colors*bitsPerComponent+7)/8)
+	rowLength := (columns*colors*bitsPerComponent + 7) / 8
+	if rowLength > pdfImageMaxStreamBytes {
+		return nil, fmt.Errorf("预测参数无效")
+	}
+
+	if predictor == 2 {
+		if bitsPerComponent != 8 {
+			return nil, fmt.Errorf("暂不支持 %d 位的 TIFF 预测", bitsPerComponent)
+		}
+		for rowStart := 0; rowStart+rowLength <= len(data); rowStart += rowLength {
+			row := data[rowStart : rowStart+rowLength]
+			for i := bytesPerPixel; i < len(row); i++ {
+				row[i] += row[i-bytesPerPixel]
+			}
+		}
+		return data, nil
+	}
+
+	decoded := make([]byte, 0, len(data)/(rowLength+1)*rowLength)
+	previous := make([]byte, rowLength)
+	for rowStart := 0; rowStart+1 < len(data); rowStart += rowLength + 1 {
+		rowEnd := min(rowStart+1+rowLength, len(data))
+		row := make([]byte, rowLength)
+		copy(row, data[rowStart+1:rowEnd])
+
+		for i := range row {
+			var left, upperLeft byte
+			if i >= bytesPerPixel {
+				left = row[i-bytesPerPixel]
+				upperLeft = previous[i-bytesPerPixel]
+			}
+			up := previous[i]
+			switch data[rowStart] {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paethPredictor(left, up, upperLeft)
+			}
+		}
+		decoded = append(decoded, row...)
+		previous = row
+	}
+	return decoded, nil
+}
+
+func paethPredictor(left, up, upperLeft byte) byte {
+	estimate := int(left) + int(up) - int(upperLeft)
+	distanceLeft := absInt(estimate - int(left))
+	distanceUp := absInt(estimate - int(up))
+	distanceUpperLeft := absInt(estimate - int(upperLeft))
+	switch {
+	case distanceLeft <= distanceUp && distanceLeft <= distanceUpperLeft:
+		return left
+	case distanceUp <= distanceUpperLeft:
+		return up
+	default:
+		return upperLeft
+	}
+}
+
+func absInt(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+func decodePDFRunLength(data []byte) []byte {
+	decoded := make([]byte, 0, len(data))
+	for i := 0; i < len(data) && len(decoded) <= pdfImageMaxStreamBytes; {
+		length := int(data[i])
+		i++
+		switch {
+		case length < 128:
+			end := min(i+length+1, len(data))
+			decoded = append(decoded, data[i:end]...)
+			i = end
+		case length > 128 && i < len(data):
+			decoded = append(decoded, bytes.Repeat(data[i:i+1], 257-length)...)
+			i++
+		default:
+			return decoded
+		}
+	}
+	return decoded
+}
+
+func pdfIntOr(value pdf.Value, fallback int) int {
+	if value.Kind() != pdf.Integer {
+		return fallback
+	}
+	return int(value.Int64())
+}
+
+// pdfColorSpace 解析后的颜色空间
+type pdfColorSpace struct {
+	// components 每个像素的分量数：1 灰度、3 RGB、4 CMYK
+	components int
+	// palette Indexed 颜色空间的调色板
+	palette []color.RGBA
+	// subtractive 分量表示油墨量（Separation），值越大颜色越深
+	subtractive bool
+}
+
+func (space pdfColorSpace) toRGBA(values []byte) color.RGBA {
+	switch space.components {
+	case 3:
+		return color.RGBA{R: values[0], G: values[1], B: values[2], A: 255}
+	case 4:
+		r, g, b := color.CMYKToRGB(values[0], values[1], values[2], values[3])
+		return color.RGBA{R: r, G: g, B: b, A: 255}
+	default:
+		gray := values[0]
+		if space.subtractive {
+			gray = 255 - gray
+		}
+		return color.RGBA{R: gray, G: gray, B: gray, A: 255}
+	}
+}
+
+func (d *pdfImageDecoder) resolveColorSpace(value, resources pdf.Value, depth int) (pdfColorSpace, error) {
+	if depth > 4 {
+		return pdfColorSpace{}, fmt.Errorf("颜色空间嵌套过深")
+	}
+
+	family := value.Name()
+	if value.Kind() == pdf.Array {
+		family = value.Index(0).Name()
+	}
+
+	switch family {
+	case "DeviceGray", "G", "CalGray":
+		return pdfColorSpace{components: 1}, nil
+	case "DeviceRGB", "RGB", "CalRGB":
+		return pdfColorSpace{components: 3}, nil
+	case "DeviceCMYK", "CMYK":
+		return pdfColorSpace{components: 4}, nil
+	case "ICCBased":
+		switch n := value.Index(1).Key("N").Int64(); n {
+		case 1, 3, 4:
+			return pdfColorSpace{components: int(n)}, nil
+		default:
+			return pdfColorSpace{}, fmt.Errorf("ICC 颜色空间分量数无效: %d", n)
+		}
+	case "Separation":
+		return pdfColorSpace{components: 1, subtractive: true}, nil
+	case "DeviceN":
+		if value.Index(1).Len() == 1 {
+			return pdfColorSpace{components: 1, subtractive: true}, nil
+		}
+	case "Indexed", "I":
+		return d.resolveIndexedColorSpace(value, resources, depth)
+	}
+
+	// 页面资源中命名的颜色空间
+	if value.Kind() == pdf.Name {
+		if named := resources.Key("ColorSpace").Key(family); named.Kind() != pdf.Null {
+			return d.resolveColorSpace(named, resources, depth+1)
+		}
+	}
+	return pdfColorSpace{}, fmt.Errorf("暂不支持的颜色空间: %s", family)
+}
+
+func (d *pdfImageDecoder) resolveIndexedColorSpace(value, resources pdf.Value, depth int) (pdfColorSpace, error) {
+	base, err := d.resolveColorSpace(value.Index(1), resources, depth+1)
+	if err != nil {
+		return pdfColorSpace{}, err
+	}
+	if len(base.palette) > 0 {
+		return pdfColorSpace{}, fmt.Errorf("调色板的基础颜色空间无效")
+	}
+
+	lookupValue := value.Index(3)
+	lookup := []byte(lookupValue.RawString())
+	if lookupValue.Kind() == pdf.Stream {
+		if lookup, _, err = d.streamData(lookupValue); err != nil {
+			return pdfColorSpace{}, err
+		}
+	}
+
+	hival := min(int(value.Index(2).Int64()), 255)
+	palette := make([]color.RGBA, 0, hival+1)
+	for i := 0; i <= hival && (i+1)*base.components <= len(lookup); i++ {
+		palette = append(palette, base.toRGBA(lookup[i*base.components:(i+1)*base.components]))
+	}
+	if len(palette) == 0 {
+		return pdfColorSpace{}, fmt.Errorf("调色板为空")
+	}
+	return pdfColorSpace{components: 1, palette: palette}, nil
+}
+
+func (d *pdfImageDecoder) decodeImage(item pdfPageImage, data []byte, filter string) (image.Image, error) {
+	if filter == "DCTDecode" {
+		decoded, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("解码 JPEG 图片失败: %w", err)
+		}
+		return decoded, nil
+	}
+
+	stream := item.stream
+	width := int(stream.Key("Width").Int64())
+	height := int(stream.Key("Height").Int64())
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("图片尺寸无效")
+	}
+	if int64(width)*int64(height) > pdfImageMaxPixels {
+		return nil, fmt.Errorf("图片尺寸过大: %dx%d", width, height)
+	}
+
+	if stream.Key("ImageMask").Bool() {
+		return decodePDFImageMask(data, width, height, stream.Key("Decode")), nil
+	}
+
+	space, err := d.resolveColorSpace(stream.Key("ColorSpace"), item.resources, 0)
+	if err != nil {
+		return nil, err
+	}
+	bitsPerComponent := pdfIntOr(stream.Key("BitsPerComponent"), 8)
+	switch bitsPerComponent {
+	case 1, 2, 4, 8, 16:
+	default:
+		return nil, fmt.Errorf("暂不支持 %d 位色深的图片", bitsPerComponent)
+	}
+
+	samples := newPDFSampleReader(data, width, height, space.components, bitsPerComponent)
+	if len(space.palette) > 0 {
+		decoded := image.NewRGBA(image.Rect(0, 0, width, height))
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				index := min(samples.sample(x, y, 0), len(space.palette)-1)
+				decoded.SetRGBA(x, y, space.palette[index])
+			}
+		}
+		return decoded, nil
+	}
+
+	tables := buildPDFDecodeTables(stream.Key("Decode"), space.components, samples.levels())
+	if space.components == 1 && !space.subtractive {
+		decoded := image.NewGray(image.Rect(0, 0, width, height))
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				decoded.Pix[y*decoded.Stride+x] = tables[0][samples.sample(x, y, 0)]
+			}
+		}
+		return decoded, nil
+	}
+
+	decoded := image.NewRGBA(image.Rect(0, 0, width, height))
+	values := make([]byte, space.components)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			for component := range values {
+				values[component] = tables[component][samples.sample(x, y, component)]
+			}
+			decoded.SetRGBA(x, y, space.toRGBA(values))
+		}
+	}
+	return decoded, nil
+}
+
+// decodePDFImageMask 遮罩图片默认样本 0 表示着色（黑色），Decode 为 [1 0] 时相反
+func decodePDFImageMask(data []byte, width, height int, decode pdf.Value) image.Image {
+	paintValue := 0
+	if decode.Len() == 2 && decode.Index(0).Float64() > decode.Index(1).Float64() {
+		paintValue = 1
+	}
+
+	samples := newPDFSampleReader(data, width, height, 1, 1)
+	decoded := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if samples.sample(x, y, 0) != paintValue {
+				decoded.Pix[y*decoded.Stride+x] = 255
+			}
+		}
+	}
+	return decoded
+}
+
+// buildPDFDecodeTables 按 Decode 数组把每个分量的样本值映射到 0-255
+func buildPDFDecodeTables(decode pdf.Value, components, levels int) [][]byte {
+	tables := make([][]byte, components)
+	for component := range tables {
+		low, high := 0.0, 1.0
+		if decode.Len() == components*2 {
+			low = decode.Index(component * 2).Float64()
+			high = decode.Index(component*2 + 1).Float64()
+		}
+
+		table := make([]byte, levels)
+		for sample := range table {
+			value := low + float64(sample)/float64(levels-1)*(high-low)
+			table[sample] = byte(min(max(value, 0), 1)*255 + 0.5)
+		}
+		tables[component] = table
+	}
+	return tables
+}
+
+// pdfSampleReader 按行读取紧密排列的样本，每行按字节对齐；16 位样本只取高 8 位
+type pdfSampleReader struct {
+	data             []byte
+	rowLength        int
+	components       int
+	bitsPerComponent int
+}
+
+func newPDFSampleReader(data []byte, width, height, components, bitsPerComponent int) pdfSampleReader {
+	rowLength := (width*components*bitsPerComponent + 7) / 8
+	if len(data) < rowLength*height {
+		// 数据不足时补零，避免截断的文件越界
+		padded := make([]byte, rowLength*height)
+		copy(padded, data)
+		data = padded
+	}
+	return pdfSampleReader{
+		data:             data,
+		rowLength:        rowLength,
+		components:       components,
+		bitsPerComponent: bitsPerComponent,
+	}
+}
+
+func (r pdfSampleReader) levels() int {
+	return 1 << min(r.bitsPerComponent, 8)
+}
+
+func (r pdfSampleReader) sample(x, y, component int) int {
+	row := r.data[y*r.rowLength : (y+1)*r.rowLength]
+	index := x*r.components + component
+	switch r.bitsPerComponent {
+	case 8:
+		return int(row[index])
+	case 16:
+		return int(row[index*2])
+	default:
+		bitOffset := index * r.bitsPerComponent
+		shift := 8 - r.bitsPerComponent - bitOffset%8
+		return int(row[bitOffset/8]>>shift) & (1<<r.bitsPerComponent - 1)
+	}
+}
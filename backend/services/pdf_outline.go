@@ -0,0 +1,235 @@
+package services
+
+import (
+	"strings"
+	"unicode"
+
+	pdf "github.com/ledongthuc/pdf"
+	"github.com/nongchen1223/moyureader/backend/models"
+)
+
+const (
+	maxPDFOutlineEntries = 10000
+	maxPDFOutlineDepth   = 16
+)
+
+// pdfOutlineEntry PDF 书签条目
+type pdfOutlineEntry struct {
+	title string
+	level int
+	page  int // 从 0 开始的页码，无法解析目标时为 -1
+}
+
+// pdfOutlineReader 解析 /Outlines 书签树，并把跳转目标解析为页码
+type pdfOutlineReader struct {
+	reader     *pdf.Reader
+	pageIndex  map[pdfObjectRef]int
+	namedDests map[string]pdf.Value
+	entries    []pdfOutlineEntry
+}
+
+// readPDFOutline 读取书签树，没有书签或书签结构损坏时返回空
+func readPDFOutline(reader *pdf.Reader) (entries []pdfOutlineEntry) {
+	root := reader.Trailer().Key("Root").Key("Outlines")
+	if root.Kind() != pdf.Dict {
+		return nil
+	}
+
+	// 第三方解析器遇到损坏的交叉引用会 panic，书签只是锦上添花，出错时退回正则识别
+	defer func() {
+		if recover() != nil {
+			entries = nil
+		}
+	}()
+
+	outline := &pdfOutlineReader{reader: reader}
+	outline.walk(root.Key("First"), 0)
+	return outline.entries
+}
+
+func (r *pdfOutlineReader) walk(item pdf.Value, level int) {
+	for ; item.Kind() == pdf.Dict && len(r.entries) < maxPDFOutlineEntries; item = item.Key("Next") {
+		r.entries = append(r.entries, pdfOutlineEntry{
+			title: strings.Join(strings.Fields(item.Key("Title").Text()), " "),
+			level: level,
+			page:  r.resolveItemPage(item),
+		})
+		if level+1 < maxPDFOutlineDepth {
+			r.walk(item.Key("First"), level+1)
+		}
+	}
+}
+
+// resolveItemPage 书签目标可能是 /Dest，也可能是 /A 中的 GoTo 动作
+func (r *pdfOutlineReader) resolveItemPage(item pdf.Value) int {
+	destination := item.Key("Dest")
+	if destination.IsNull() {
+		if action := item.Key("A"); action.Key("S").Name() == "GoTo" {
+			destination = action.Key("D")
+		}
+	}
+	return r.resolveDestinationPage(destination)
+}
+
+// resolveDestinationPage 解析显式目标数组或命名目标，返回从 0 开始的页码
+func (r *pdfOutlineReader) resolveDestinationPage(destination pdf.Value) int {
+	// 命名目标可能再指向带 /D 的字典，限制解析次数防止循环引用
+	for attempt := 0; attempt < 4; attempt++ {
+		switch destination.Kind() {
+		case pdf.Array:
+			target := destination.Index(0)
+			switch target.Kind() {
+			case pdf.Dict:
+				if ref, ok := pdfValueRef(target); ok {
+					if page, exists := r.pages()[ref]; exists {
+						return page
+					}
+				}
+			case pdf.Integer:
+				// 远程跳转目标使用页码而非页面引用
+				return int(target.Int64())
+			}
+			return -1
+		case pdf.Dict:
+			destination = destination.Key("D")
+		case pdf.Name:
+			destination = r.named()[destination.Name()]
+		case pdf.String:
+			destination = r.named()[destination.RawString()]
+		default:
+			return -1
+		}
+	}
+	return -1
+}
+
+// pages 以页面对象的间接引用作为标识建立页码索引；
+// 内容相同的两个页面字典（如共用内容流的空白页）也能区分开
+func (r *pdfOutlineReader) pages() map[pdfObjectRef]int {
+	if r.pageIndex != nil {
+		return r.pageIndex
+	}
+
+	r.pageIndex = make(map[pdfObjectRef]int)
+	for pageNumber := r.reader.NumPage(); pageNumber >= 1; pageNumber-- {
+		if ref, ok := pdfValueRef(r.reader.Page(pageNumber).V); ok {
+			r.pageIndex[ref] = pageNumber - 1
+		}
+	}
+	return r.pageIndex
+}
+
+// named 收集 /Root /Dests（PDF 1.1）和 /Root /Names /Dests 名称树中的命名目标
+func (r *pdfOutlineReader) named() map[string]pdf.Value {
+	if r.namedDests != nil {
+		return r.namedDests
+	}
+
+	r.namedDests = make(map[string]pdf.Value)
+	root := r.reader.Trailer().Key("Root")
+	dests := root.Key("Dests")
+	for _, key := range dests.Keys() {
+		r.namedDests[key] = dests.Key(key)
+	}
+
+	var walkNameTree func(node pdf.Value, depth int)
+	walkNameTree = func(node pdf.Value, depth int) {
+		if node.Kind() != pdf.Dict || depth > maxPDFOutlineDepth {
+			return
+		}
+		names := node.Key("Names")
+		for index := 0; index+1 < names.Len(); index += 2 {
+			r.namedDests[names.Index(index).RawString()] = names.Index(index + 1)
+		}
+		kids := node.Key("Kids")
+		for index := 0; index < kids.Len(); index++ {
+			walkNameTree(kids.Index(index), depth+1)
+		}
+	}
+	walkNameTree(root.Key("Names").Key("Dests"), 0)
+	return r.namedDests
+}
+
+// buildPDFOutlineChapters 按书签生成章节：书签页码映射到该页在正文中的起始位置，
+// 若能在页内找到书签标题则进一步定位到标题所在行；无法定位或顺序倒退的书签会被跳过
+func buildPDFOutlineChapters(content string, pageOffsets []int, entries []pdfOutlineEntry) []models.Chapter {
+	contentRunes := []rune(content)
+	contentLength := len(contentRunes)
+	chapters := make([]models.Chapter, 0, len(entries))
+	lastStart := 0
+
+	for _, entry := range entries {
+		if entry.title == "" || entry.page < 0 || entry.page >= len(pageOffsets) {
+			continue
+		}
+
+		pageStart := pageOffsets[entry.page]
+		pageEnd := contentLength
+		if entry.page+1 < len(pageOffsets) {
+			pageEnd = pageOffsets[entry.page+1]
+		}
+		if pageEnd < lastStart {
+			continue
+		}
+
+		startPos := maxInt(pageStart, lastStart)
+		if titlePos := findPDFOutlineTitle(contentRunes, startPos, pageEnd, entry.title); titlePos >= 0 {
+			startPos = titlePos
+		}
+
+		if len(chapters) > 0 {
+			previous := &chapters[len(chapters)-1]
+			previous.EndPos = startPos
+			previous.WordCount = previous.EndPos - previous.StartPos
+		}
+		chapters = append(chapters, models.Chapter{
+			Index:    len(chapters),
+			Title:    entry.title,
+			StartPos: startPos,
+			EndPos:   contentLength,
+			Level:    entry.level,
+		})
+		lastStart = startPos
+	}
+
+	if len(chapters) == 0 {
+		return nil
+	}
+
+	lastChapter := &chapters[len(chapters)-1]
+	lastChapter.WordCount = lastChapter.EndPos - lastChapter.StartPos
+	linkChapterHierarchy(chapters)
+	return chapters
+}
+
+// findPDFOutlineTitle 在 [from, to) 范围内按行首查找书签标题，忽略空白与大小写
+func findPDFOutlineTitle(content []rune, from, to int, title string) int {
+	titleRunes := []rune(normalizeComparableEpubText(title))
+	if len(titleRunes) == 0 {
+		return -1
+	}
+
+	to = minInt(to, len(content))
+	for start := from; start < to; start++ {
+		if start > 0 && content[start-1] != '\n' {
+			continue
+		}
+
+		matched := 0
+		for position := start; position < to && matched < len(titleRunes); position++ {
+			char := content[position]
+			// 长标题在 PDF 中可能折行
+			if unicode.IsSpace(char) {
+				continue
+			}
+			if unicode.ToLower(char) != titleRunes[matched] {
+				break
+			}
+			matched++
+		}
+		if matched == len(titleRunes) {
+			return start
+		}
+	}
+	return -1
+}
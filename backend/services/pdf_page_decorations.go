@@ -0,0 +1,148 @@
+package services
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// pdfPageLine 页面上的一行文本，x 为行首横坐标，y 为所在行的纵坐标（自下而上递增）
+type pdfPageLine struct {
+	text string
+	x    float64
+	y    float64
+}
+
+// pdfIndentMinOffset 行首比本页最左侧的行右移超过该距离（pt）即视为段首缩进
+const pdfIndentMinOffset = 8
+
+const (
+	// pdfDecorationDepth 页眉页脚只在每页最前、最后几行中查找
+	pdfDecorationDepth = 2
+	// pdfDecorationWindow 与前后若干页比较，只在一章内重复的章节名页眉也能识别
+	pdfDecorationWindow = 4
+	// pdfDecorationMinRepeats 同一位置的行在窗口内至少还要出现的页数
+	pdfDecorationMinRepeats = 2
+	// pdfDecorationTolerance 判断为同一位置时允许的纵坐标误差（pt）
+	pdfDecorationTolerance = 3
+)
+
+var (
+	// pdfPageNumberPattern 带格式的页码：第 N 页、Page N、N / M、- N -
+	pdfPageNumberPattern = regexp.MustCompile(`^(?:第\s*\d+\s*页(?:\s*[/，,]?\s*共\s*\d+\s*页)?|(?i:page|p\.)\s*\d+(?:\s*(?:/|of)\s*\d+)?|\d+\s*(?:/|of)\s*\d+|[-–—]\s*\d+\s*[-–—])$`)
+	// pdfBarePageNumberPattern 纯数字，需与页序一致才视为页码，避免误删 "1" 这类章节标题
+	pdfBarePageNumberPattern = regexp.MustCompile(`^\d{1,5}$`)
+	pdfDecorationDigits      = regexp.MustCompile(`\d+`)
+)
+
+// pdfEdgeLine 每页最前、最后几行的比较信息
+type pdfEdgeLine struct {
+	lineIndex int
+	text      string
+	key       string
+	y         float64
+	// chapterTitle 形如章节标题，只有文字完全相同才视为重复，避免 "第1章""第2章" 被当成页眉
+	chapterTitle bool
+	// numberOffset 纯数字行的数值减去页序，页码连续时各页相同；非纯数字行为 math.MinInt
+	numberOffset int
+	// explicit 带格式的页码，无需与其他页比较
+	explicit bool
+}
+
+// stripPDFPageDecorations 去掉每页最前、最后几行中的页眉、页脚和页码：
+// 前后几页同一位置重复出现的行（数字视为相同，兼容带页码的页眉）、
+// 带格式的页码，以及与相邻页递增一致的纯数字页码。
+// chapterRules 为该书生效的章节规则，匹配的行按章节标题对待，不会因数字不同被当成同一页眉
+func stripPDFPageDecorations(pages [][]pdfPageLine, chapterRules []compiledChapterRule) [][]pdfPageLine {
+	edges := make([][]pdfEdgeLine, len(pages))
+	for pageIndex, lines := range pages {
+		edges[pageIndex] = collectPDFEdgeLines(lines, pageIndex, chapterRules)
+	}
+
+	stripped := make([][]pdfPageLine, len(pages))
+	for pageIndex, lines := range pages {
+		removed := make(map[int]bool)
+		for _, edge := range edges[pageIndex] {
+			if edge.explicit || isPDFRunningLine(edges, pageIndex, edge) {
+				removed[edge.lineIndex] = true
+			}
+		}
+		if len(removed) == 0 {
+			stripped[pageIndex] = lines
+			continue
+		}
+
+		kept := make([]pdfPageLine, 0, len(lines)-len(removed))
+		for lineIndex, line := range lines {
+			if !removed[lineIndex] {
+				kept = append(kept, line)
+			}
+		}
+		stripped[pageIndex] = kept
+	}
+	return stripped
+}
+
+func collectPDFEdgeLines(lines []pdfPageLine, pageIndex int, chapterRules []compiledChapterRule) []pdfEdgeLine {
+	var edges []pdfEdgeLine
+	for lineIndex, line := range lines {
+		if lineIndex >= pdfDecorationDepth && lineIndex < len(lines)-pdfDecorationDepth {
+			continue
+		}
+
+		text := strings.Join(strings.Fields(line.text), " ")
+		edge := pdfEdgeLine{
+			lineIndex:    lineIndex,
+			text:         text,
+			key:          pdfDecorationKey(text),
+			y:            line.y,
+			chapterTitle: matchChapterRule(chapterRules, text) != nil,
+			numberOffset: math.MinInt,
+			explicit:     pdfPageNumberPattern.MatchString(text),
+		}
+		if pdfBarePageNumberPattern.MatchString(text) {
+			number, _ := strconv.Atoi(text)
+			edge.numberOffset = number - pageIndex
+		}
+		if edge.key != "" {
+			edges = append(edges, edge)
+		}
+	}
+	return edges
+}
+
+// pdfDecorationKey 比较用的行文本：去掉空白并统一大小写，数字统一替换
+func pdfDecorationKey(text string) string {
+	text = pdfDecorationDigits.ReplaceAllString(text, "#")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, text)
+}
+
+func isPDFRunningLine(edges [][]pdfEdgeLine, pageIndex int, edge pdfEdgeLine) bool {
+	repeats := 0
+	for other := pageIndex - pdfDecorationWindow; other <= pageIndex+pdfDecorationWindow; other++ {
+		if other == pageIndex || other < 0 || other >= len(edges) {
+			continue
+		}
+
+		for _, candidate := range edges[other] {
+			if edge.numberOffset != math.MinInt && candidate.numberOffset == edge.numberOffset {
+				return true
+			}
+			if edge.chapterTitle && candidate.text != edge.text {
+				continue
+			}
+			if candidate.key == edge.key && math.Abs(candidate.y-edge.y) <= pdfDecorationTolerance {
+				repeats++
+				break
+			}
+		}
+	}
+	return repeats >= pdfDecorationMinRepeats
+}
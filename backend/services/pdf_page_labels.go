@@ -0,0 +1,131 @@
+package services
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	pdf "github.com/ledongthuc/pdf"
+)
+
+const (
+	// maxPDFPageLabelNumber 页码起始编号（/St）的上限，超过时截断
+	maxPDFPageLabelNumber = 100000
+	// maxPDFSymbolPageLabel 罗马数字与字母页码的上限，超过时改用阿拉伯数字，避免异常文件生成超长的页码
+	maxPDFSymbolPageLabel = 3999
+)
+
+// pdfPageLabelRange /PageLabels 数字树中的一段：从 start 页（从 0 开始）起使用同一编号样式
+type pdfPageLabelRange struct {
+	start  int
+	style  string
+	prefix string
+	first  int
+}
+
+// readPDFPageLabels 读取 /PageLabels 中的印刷页码（如前言的 i、ii 和正文的 1、2），
+// 下标为从 0 开始的页码；没有页码标签或标签与页序完全一致时返回空
+func readPDFPageLabels(reader *pdf.Reader) (labels []string) {
+	root := reader.Trailer().Key("Root").Key("PageLabels")
+	if root.Kind() != pdf.Dict {
+		return nil
+	}
+
+	defer func() {
+		if recover() != nil {
+			labels = nil
+		}
+	}()
+
+	var ranges []pdfPageLabelRange
+	var walk func(node pdf.Value, depth int)
+	walk = func(node pdf.Value, depth int) {
+		if node.Kind() != pdf.Dict || depth > maxPDFOutlineDepth {
+			return
+		}
+		nums := node.Key("Nums")
+		for index := 0; index+1 < nums.Len(); index += 2 {
+			label := nums.Index(index + 1)
+			labelRange := pdfPageLabelRange{
+				start:  int(nums.Index(index).Int64()),
+				style:  label.Key("S").Name(),
+				prefix: label.Key("P").Text(),
+				first:  1,
+			}
+			if start := label.Key("St"); start.Kind() == pdf.Integer && start.Int64() > 0 {
+				labelRange.first = int(min(start.Int64(), maxPDFPageLabelNumber))
+			}
+			ranges = append(ranges, labelRange)
+		}
+		kids := node.Key("Kids")
+		for index := 0; index < kids.Len(); index++ {
+			walk(kids.Index(index), depth+1)
+		}
+	}
+	walk(root, 0)
+	if len(ranges) == 0 {
+		return nil
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].start < ranges[j].start
+	})
+
+	pageCount := reader.NumPage()
+	labels = make([]string, pageCount)
+	identical := true
+	for pageIndex := range labels {
+		// 第一段之前的页面不在数字树中，按页序编号
+		labelRange := pdfPageLabelRange{style: "D", first: 1}
+		if position := sort.Search(len(ranges), func(i int) bool { return ranges[i].start > pageIndex }); position > 0 {
+			labelRange = ranges[position-1]
+		}
+		labels[pageIndex] = labelRange.prefix + formatPDFPageLabel(labelRange.style, labelRange.first+pageIndex-labelRange.start)
+		identical = identical && labels[pageIndex] == strconv.Itoa(pageIndex+1)
+	}
+	if identical {
+		return nil
+	}
+	return labels
+}
+
+// formatPDFPageLabel 按 /S 样式格式化页码：D 阿拉伯数字，R / r 罗马数字，A / a 字母；没有样式时只用前缀
+func formatPDFPageLabel(style string, number int) string {
+	switch style {
+	case "D":
+		return strconv.Itoa(number)
+	case "R", "r":
+		if number > maxPDFSymbolPageLabel {
+			return strconv.Itoa(number)
+		}
+		if style == "r" {
+			return strings.ToLower(formatRomanNumber(number))
+		}
+		return formatRomanNumber(number)
+	case "A", "a":
+		if number < 1 {
+			return ""
+		}
+		if number > maxPDFSymbolPageLabel {
+			return strconv.Itoa(number)
+		}
+		// 26 之后为 AA、BB……，字母重复次数递增
+		letter := rune(style[0]) + rune((number-1)%26)
+		return strings.Repeat(string(letter), (number-1)/26+1)
+	default:
+		return ""
+	}
+}
+
+func formatRomanNumber(number int) string {
+	values := []int{1000, 900, 500, 400, 100, 90, 50, 40, 10, 9, 5, 4, 1}
+	symbols := []string{"M", "CM", "D", "CD", "C", "XC", "L", "XL", "X", "IX", "V", "IV", "I"}
+
+	var builder strings.Builder
+	for index, value := range values {
+		for number >= value {
+			builder.WriteString(symbols[index])
+			number -= value
+		}
+	}
+	return builder.String()
+}
@@ -11,110 +11,138 @@ package services
 #include <math.h>
 #import <Cocoa/Cocoa.h>
 
-static long MoyuReaderPDFPageCount(const char *path) {
-	@autoreleasepool {
-		if (path == NULL) {
-			return 0;
+// MoyuReaderOpenPDFDocument 打开 PDF 并在加密时用密码解锁，失败返回 NULL，调用方负责释放
+static CGPDFDocumentRef MoyuReaderOpenPDFDocument(const char *path, const char *password) {
+	NSString *filePath = [NSString stringWithUTF8String:path];
+	if (filePath == nil) {
+		return NULL;
+	}
+
+	CGPDFDocumentRef document = CGPDFDocumentCreateWithURL((__bridge CFURLRef)[NSURL fileURLWithPath:filePath]);
+	if (document == NULL) {
+		return NULL;
+	}
+
+	if (!CGPDFDocumentIsUnlocked(document)) {
+		if (password == NULL || !CGPDFDocumentUnlockWithPassword(document, password)) {
+			CGPDFDocumentRelease(document);
+			return NULL;
 		}
+	}
 
-		NSString *filePath = [NSString stringWithUTF8String:path];
-		NSData *pdfData = [NSData dataWithContentsOfFile:filePath];
-		if (pdfData == nil) {
+	return document;
+}
+
+static long MoyuReaderPDFPageCount(const char *path, const char *password) {
+	@autoreleasepool {
+		if (path == NULL) {
 			return 0;
 		}
 
-		NSPDFImageRep *pdfImageRep = [NSPDFImageRep imageRepWithData:pdfData];
-		if (pdfImageRep == nil) {
+		CGPDFDocumentRef document = MoyuReaderOpenPDFDocument(path, password);
+		if (document == NULL) {
 			return 0;
 		}
 
-		return (long)[pdfImageRep pageCount];
+		long pageCount = (long)CGPDFDocumentGetNumberOfPages(document);
+		CGPDFDocumentRelease(document);
+		return pageCount;
 	}
 }
 
-static char *MoyuReaderRenderPDFPageDataURL(const char *path, long pageIndex, double targetMaxWidth) {
-	@autoreleasepool {
-		if (path == NULL || pageIndex < 0) {
-			return NULL;
-		}
+static char *MoyuReaderRenderPDFPage(CGPDFDocumentRef document, long pageIndex, double targetMaxWidth) {
+	if (pageIndex >= (long)CGPDFDocumentGetNumberOfPages(document)) {
+		return NULL;
+	}
 
-		NSString *filePath = [NSString stringWithUTF8String:path];
-		NSData *pdfData = [NSData dataWithContentsOfFile:filePath];
-		if (pdfData == nil) {
-			return NULL;
-		}
+	CGPDFPageRef page = CGPDFDocumentGetPage(document, (size_t)pageIndex + 1);
+	if (page == NULL) {
+		return NULL;
+	}
 
-		NSPDFImageRep *pdfImageRep = [NSPDFImageRep imageRepWithData:pdfData];
-		if (pdfImageRep == nil) {
-			return NULL;
-		}
+	CGRect bounds = CGPDFPageGetBoxRect(page, kCGPDFCropBox);
+	CGFloat width = bounds.size.width;
+	CGFloat height = bounds.size.height;
+	if (CGPDFPageGetRotationAngle(page) % 180 != 0) {
+		width = bounds.size.height;
+		height = bounds.size.width;
+	}
+	if (width <= 0 || height <= 0) {
+		return NULL;
+	}
 
-		if (pageIndex >= [pdfImageRep pageCount]) {
-			return NULL;
-		}
+	CGFloat scale = 1.0;
+	if (targetMaxWidth > 0 && width > targetMaxWidth) {
+		scale = targetMaxWidth / width;
+	}
 
-		[pdfImageRep setCurrentPage:pageIndex];
-		NSRect bounds = [pdfImageRep bounds];
-		CGFloat width = bounds.size.width;
-		CGFloat height = bounds.size.height;
-		if (width <= 0 || height <= 0) {
-			return NULL;
-		}
+	NSInteger pixelWidth = MAX((NSInteger) llround(width * scale), 1);
+	NSInteger pixelHeight = MAX((NSInteger) llround(height * scale), 1);
+
+	NSBitmapImageRep *bitmap = [[NSBitmapImageRep alloc]
+		initWithBitmapDataPlanes:NULL
+		              pixelsWide:pixelWidth
+		              pixelsHigh:pixelHeight
+		           bitsPerSample:8
+		         samplesPerPixel:4
+		                hasAlpha:YES
+		                isPlanar:NO
+		          colorSpaceName:NSDeviceRGBColorSpace
+		             bytesPerRow:0
+		            bitsPerPixel:0];
+	if (bitmap == nil) {
+		return NULL;
+	}
 
-		CGFloat scale = 1.0;
-		if (targetMaxWidth > 0 && width > targetMaxWidth) {
-			scale = targetMaxWidth / width;
-		}
+	NSGraphicsContext *graphicsContext = [NSGraphicsContext graphicsContextWithBitmapImageRep:bitmap];
+	if (graphicsContext == nil) {
+		return NULL;
+	}
 
-		NSInteger pixelWidth = MAX((NSInteger) llround(width * scale), 1);
-		NSInteger pixelHeight = MAX((NSInteger) llround(height * scale), 1);
-
-		NSBitmapImageRep *bitmap = [[NSBitmapImageRep alloc]
-			initWithBitmapDataPlanes:NULL
-			              pixelsWide:pixelWidth
-			              pixelsHigh:pixelHeight
-			           bitsPerSample:8
-			         samplesPerPixel:4
-			                hasAlpha:YES
-			                isPlanar:NO
-			          colorSpaceName:NSDeviceRGBColorSpace
-			             bytesPerRow:0
-			            bitsPerPixel:0];
-		if (bitmap == nil) {
-			return NULL;
-		}
+	CGContextRef context = [graphicsContext CGContext];
+	CGContextSetRGBFillColor(context, 1, 1, 1, 1);
+	CGContextFillRect(context, CGRectMake(0, 0, pixelWidth, pixelHeight));
+	CGContextSaveGState(context);
+	CGContextScaleCTM(context, (CGFloat)pixelWidth / width, (CGFloat)pixelHeight / height);
+	CGContextConcatCTM(context, CGPDFPageGetDrawingTransform(page, kCGPDFCropBox, CGRectMake(0, 0, width, height), 0, true));
+	CGContextDrawPDFPage(context, page);
+	CGContextRestoreGState(context);
+	[graphicsContext flushGraphics];
+
+	NSData *pngData = [bitmap representationUsingType:NSBitmapImageFileTypePNG properties:@{}];
+	if (pngData == nil) {
+		return NULL;
+	}
 
-		NSGraphicsContext *graphicsContext = [NSGraphicsContext graphicsContextWithBitmapImageRep:bitmap];
-		if (graphicsContext == nil) {
-			return NULL;
-		}
+	NSString *base64 = [pngData base64EncodedStringWithOptions:0];
+	NSString *dataURL = [NSString stringWithFormat:@"data:image/png;base64,%@", base64];
+	const char *utf8String = [dataURL UTF8String];
+	if (utf8String == NULL) {
+		return NULL;
+	}
 
-		[NSGraphicsContext saveGraphicsState];
-		[NSGraphicsContext setCurrentContext:graphicsContext];
-		[[NSColor whiteColor] setFill];
-		NSRectFill(NSMakeRect(0, 0, pixelWidth, pixelHeight));
-		[pdfImageRep drawInRect:NSMakeRect(0, 0, pixelWidth, pixelHeight)];
-		[graphicsContext flushGraphics];
-		[NSGraphicsContext restoreGraphicsState];
+	char *result = (char *)malloc(strlen(utf8String) + 1);
+	if (result == NULL) {
+		return NULL;
+	}
 
-		NSData *pngData = [bitmap representationUsingType:NSBitmapImageFileTypePNG properties:@{}];
-		if (pngData == nil) {
-			return NULL;
-		}
+	strcpy(result, utf8String);
+	return result;
+}
 
-		NSString *base64 = [pngData base64EncodedStringWithOptions:0];
-		NSString *dataURL = [NSString stringWithFormat:@"data:image/png;base64,%@", base64];
-		const char *utf8String = [dataURL UTF8String];
-		if (utf8String == NULL) {
+static char *MoyuReaderRenderPDFPageDataURL(const char *path, const char *password, long pageIndex, double targetMaxWidth) {
+	@autoreleasepool {
+		if (path == NULL || pageIndex < 0) {
 			return NULL;
 		}
 
-		char *result = (char *)malloc(strlen(utf8String) + 1);
-		if (result == NULL) {
+		CGPDFDocumentRef document = MoyuReaderOpenPDFDocument(path, password);
+		if (document == NULL) {
 			return NULL;
 		}
 
-		strcpy(result, utf8String);
+		char *result = MoyuReaderRenderPDFPage(document, pageIndex, targetMaxWidth);
+		CGPDFDocumentRelease(document);
 		return result;
 	}
 }
@@ -128,15 +156,18 @@ import (
 
 const pdfRenderTargetMaxWidth = 1600
 
-func getPDFPageCount(filePath string) (int, error) {
+// getPDFPageCount 读取 PDF 页数，password 用于解锁加密 PDF，未加密时为空
+func getPDFPageCount(filePath, password string) (int, error) {
 	if filePath == "" {
 		return 0, fmt.Errorf("PDF 路径不能为空")
 	}
 
 	cPath := C.CString(filePath)
 	defer C.free(unsafe.Pointer(cPath))
+	cPassword := C.CString(password)
+	defer C.free(unsafe.Pointer(cPassword))
 
-	pageCount := int(C.MoyuReaderPDFPageCount(cPath))
+	pageCount := int(C.MoyuReaderPDFPageCount(cPath, cPassword))
 	if pageCount <= 0 {
 		return 0, fmt.Errorf("无法读取 PDF 页数")
 	}
@@ -144,7 +175,8 @@ func getPDFPageCount(filePath string) (int, error) {
 	return pageCount, nil
 }
 
-func renderPDFPageDataURL(filePath string, pageIndex int) (string, error) {
+// renderPDFPageDataURL 用系统 PDF 渲染器把一页渲染成 PNG data URL
+func renderPDFPageDataURL(filePath, password string, pageIndex int) (string, error) {
 	if filePath == "" {
 		return "", fmt.Errorf("PDF 路径不能为空")
 	}
@@ -154,8 +186,10 @@ func renderPDFPageDataURL(filePath string, pageIndex int) (string, error) {
 
 	cPath := C.CString(filePath)
 	defer C.free(unsafe.Pointer(cPath))
+	cPassword := C.CString(password)
+	defer C.free(unsafe.Pointer(cPassword))
 
-	result := C.MoyuReaderRenderPDFPageDataURL(cPath, C.long(pageIndex), C.double(pdfRenderTargetMaxWidth))
+	result := C.MoyuReaderRenderPDFPageDataURL(cPath, cPassword, C.long(pageIndex), C.double(pdfRenderTargetMaxWidth))
 	if result == nil {
 		return "", fmt.Errorf("macOS PDF 渲染失败")
 	}
@@ -2,12 +2,82 @@
 
 package services
 
-import "fmt"
+import (
+	"fmt"
 
-func getPDFPageCount(string) (int, error) {
-	return 0, fmt.Errorf("当前平台暂不支持图片型 PDF 按页渲染")
+	pdf "github.com/ledongthuc/pdf"
+)
+
+// 非 macOS 平台没有系统 PDF 渲染器，按页提取扫描版 PDF 中的图片，见 pdf_image_render.go；
+// password 为解锁加密 PDF 所用的密码，未加密时为空
+
+func getPDFPageCount(filePath, password string) (pageCount int, err error) {
+	if filePath == "" {
+		return 0, fmt.Errorf("PDF 路径不能为空")
+	}
+
+	file, reader, err := openPDFReader(filePath, password)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	defer recoverPDFImagePanic(&err)
+
+	pageCount = reader.NumPage()
+	if pageCount <= 0 {
+		return 0, fmt.Errorf("无法读取 PDF 页数")
+	}
+	return pageCount, nil
+}
+
+func renderPDFPageDataURL(filePath, password string, pageIndex int) (dataURL string, err error) {
+	if filePath == "" {
+		return "", fmt.Errorf("PDF 路径不能为空")
+	}
+	if pageIndex < 0 {
+		return "", fmt.Errorf("PDF 页码越界")
+	}
+
+	file, reader, err := openPDFReader(filePath, password)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	defer recoverPDFImagePanic(&err)
+
+	if pageIndex >= reader.NumPage() {
+		return "", fmt.Errorf("PDF 页码越界")
+	}
+	page := reader.Page(pageIndex + 1)
+	if page.V.IsNull() {
+		return "", fmt.Errorf("无法读取 PDF 第 %d 页", pageIndex+1)
+	}
+
+	images := collectPDFPageImages(page)
+	if len(images) == 0 {
+		return "", fmt.Errorf("页面中没有可提取的图片")
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("读取 PDF 文件信息失败: %w", err)
+	}
+	decoder := &pdfImageDecoder{
+		file:      file,
+		fileSize:  info.Size(),
+		encrypted: reader.Trailer().Key("Encrypt").Kind() != pdf.Null,
+	}
+	if decoder.encrypted {
+		if key, useAES, ok := pdfReaderKey(reader); ok && len(key) > 0 {
+			decoder.fileKey, decoder.useAES = key, useAES
+		}
+	}
+	return decoder.renderPage(images)
 }
 
-func renderPDFPageDataURL(string, int) (string, error) {
-	return "", fmt.Errorf("当前平台暂不支持图片型 PDF 按页渲染")
+// recoverPDFImagePanic 第三方解析器遇到损坏或不支持的结构会 panic，转换为普通错误
+func recoverPDFImagePanic(err *error) {
+	if recovered := recover(); recovered != nil {
+		*err = fmt.Errorf("解析 PDF 页面失败: %v", recovered)
+	}
 }
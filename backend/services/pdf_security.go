@@ -0,0 +1,115 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rc4"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	pdf "github.com/ledongthuc/pdf"
+)
+
+// 加密 PDF 的错误提示，前端按文字识别后弹出密码输入框
+var (
+	errPDFPasswordRequired  = errors.New("PDF 已加密，请输入密码")
+	errPDFPasswordIncorrect = errors.New("PDF 密码错误，请重新输入")
+)
+
+// openPDFReader 打开 PDF，加密文件使用标准安全处理器（RC4 / AES-128）以用户密码解密；
+// 空用户密码的加密文件无需输入密码即可打开，密码错误时返回 pdf.ErrInvalidPassword
+func openPDFReader(filePath, password string) (*os.File, *pdf.Reader, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("打开 PDF 文件失败: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("打开 PDF 文件失败: %w", err)
+	}
+
+	attempted := false
+	reader, err := pdf.NewReaderEncrypted(file, info.Size(), func() string {
+		if attempted {
+			return ""
+		}
+		attempted = true
+		return password
+	})
+	if err != nil {
+		file.Close()
+		if errors.Is(err, pdf.ErrInvalidPassword) {
+			return nil, nil, err
+		}
+		if strings.Contains(err.Error(), "unsupported PDF: encryption") {
+			// AES-256（V5 / R6）与非标准安全处理器
+			return nil, nil, fmt.Errorf("暂不支持该 PDF 的加密方式: %w", err)
+		}
+		return nil, nil, fmt.Errorf("打开 PDF 文件失败: %w", err)
+	}
+	return file, reader, nil
+}
+
+// checkPDFPassword 校验密码能否解密 PDF；文件未加密或用户密码为空时返回 required 为 false，
+// 此时密码没有作用，不应保存
+func checkPDFPassword(filePath, password string) (required bool, err error) {
+	file, _, err := openPDFReader(filePath, "")
+	if err == nil {
+		file.Close()
+		return false, nil
+	}
+	if !errors.Is(err, pdf.ErrInvalidPassword) {
+		return false, err
+	}
+
+	file, _, err = openPDFReader(filePath, password)
+	if errors.Is(err, pdf.ErrInvalidPassword) {
+		return true, fmt.Errorf("%w: %s", errPDFPasswordIncorrect, filePath)
+	}
+	if err != nil {
+		return true, err
+	}
+	file.Close()
+	return true, nil
+}
+
+// decryptPDFStreamData 按标准安全处理器解密流的原始数据：对象密钥为
+// MD5(文件密钥 + 对象号低 3 字节 + 生成号低 2 字节 [+ "sAlT"]) 的前 min(n+5, 16) 字节，
+// AES 数据以 16 字节初始向量开头并带 PKCS#5 填充
+func decryptPDFStreamData(fileKey []byte, useAES bool, ref pdfObjectRef, data []byte) ([]byte, error) {
+	hash := md5.New()
+	hash.Write(fileKey)
+	hash.Write([]byte{byte(ref.id), byte(ref.id >> 8), byte(ref.id >> 16), byte(ref.gen), byte(ref.gen >> 8)})
+	if useAES {
+		hash.Write([]byte("sAlT"))
+	}
+	objectKey := hash.Sum(nil)[:min(len(fileKey)+5, md5.Size)]
+
+	if !useAES {
+		stream, err := rc4.NewCipher(objectKey)
+		if err != nil {
+			return nil, fmt.Errorf("解密数据失败: %w", err)
+		}
+		decrypted := make([]byte, len(data))
+		stream.XORKeyStream(decrypted, data)
+		return decrypted, nil
+	}
+
+	if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("解密数据失败: AES 数据长度无效")
+	}
+	block, err := aes.NewCipher(objectKey)
+	if err != nil {
+		return nil, fmt.Errorf("解密数据失败: %w", err)
+	}
+	decrypted := make([]byte, len(data)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(decrypted, data[aes.BlockSize:])
+	if padding := int(decrypted[len(decrypted)-1]); padding >= 1 && padding <= aes.BlockSize {
+		decrypted = decrypted[:len(decrypted)-padding]
+	}
+	return decrypted, nil
+}
@@ -0,0 +1,888 @@
+package services
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// 按字形坐标还原阅读顺序：第三方解析器的 GetTextByRow 只按纵坐标分组，
+// 双栏排版会把左右两栏的同一行拼在一起，竖排页面更是被逐字打散。
+// 这里自行解释内容流，记录每段文字的位置与前进长度，再判断书写方向和栏间空白。
+
+const (
+	// pdfLayoutBinWidth 统计栏间空白时的分箱宽度（pt）
+	pdfLayoutBinWidth = 2
+	// pdfLayoutGutterMinWidth 栏间空白的最小宽度（pt），同时不小于正文字号的 pdfLayoutGutterMinRatio 倍
+	pdfLayoutGutterMinWidth = 8
+	pdfLayoutGutterMinRatio = 0.8
+	// pdfLayoutGutterMaxCover 栏间允许被跨栏文字（如标题）覆盖的文字段比例
+	pdfLayoutGutterMaxCover = 0.1
+	// pdfLayoutColumnMinRows 每栏至少要有的行数
+	pdfLayoutColumnMinRows = 3
+	// pdfLayoutColumnMinFill 每栏的行平均占栏宽的最小比例，目录页左侧标题、右侧页码之间的空白不算分栏
+	pdfLayoutColumnMinFill = 0.4
+	// pdfLayoutMinStackedSteps 横排字体逐字向下摆放至少这么多次才视为竖排
+	pdfLayoutMinStackedSteps = 8
+	// pdfLayoutMajorityRatio 占有文字页面的比例达到该值的版式才作为全书版式，否则为 mixed
+	pdfLayoutMajorityRatio = 0.6
+)
+
+// pdfMatrix PDF 变换矩阵 [a b c d e f]
+type pdfMatrix [6]float64
+
+var pdfIdentityMatrix = pdfMatrix{1, 0, 0, 1, 0, 0}
+
+// multiply 先做 m 变换再做 n 变换
+func (m pdfMatrix) multiply(n pdfMatrix) pdfMatrix {
+	return pdfMatrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func (m pdfMatrix) apply(x, y float64) (float64, float64) {
+	return x*m[0] + y*m[2] + m[4], x*m[1] + y*m[3] + m[5]
+}
+
+func pdfTranslateMatrix(tx, ty float64) pdfMatrix {
+	return pdfMatrix{1, 0, 0, 1, tx, ty}
+}
+
+// pdfTextRun 一次显示操作（Tj、TJ 等）输出的文字
+type pdfTextRun struct {
+	text string
+	// x, y 起点在页面坐标系中的位置；竖排时为列的中线与首字顶端
+	x, y float64
+	// advance 沿书写方向的长度
+	advance  float64
+	size     float64
+	vertical bool
+	// estimated 字体缺少字宽表，长度按字符估算
+	estimated bool
+}
+
+// pdfPageLayout 页面版式，columns 为 0 表示没有文字
+type pdfPageLayout struct {
+	vertical bool
+	columns  int
+}
+
+func (l pdfPageLayout) String() string {
+	if l.columns == 0 {
+		return ""
+	}
+	direction := "horizontal"
+	if l.vertical {
+		direction = "vertical"
+	}
+	if l.columns == 1 {
+		return direction
+	}
+	return fmt.Sprintf("%s-%d-columns", direction, l.columns)
+}
+
+// pdfRunFont 计算文字位置所需的字体信息
+type pdfRunFont struct {
+	encoder pdf.TextEncoding
+	// codeBytes 每个字符编码的字节数，Type0 字体为 2
+	codeBytes int
+	vertical  bool
+	// widths 字宽（千分之一 em），defaultWidth 为 0 时缺失的字宽按字符估算
+	widths       map[int]float64
+	defaultWidth float64
+	// verticalAdvance 竖排时每个字向下前进的长度（千分之一 em）
+	verticalAdvance float64
+}
+
+func loadPDFRunFont(font pdf.Value) *pdfRunFont {
+	runFont := &pdfRunFont{codeBytes: 1, widths: make(map[int]float64), verticalAdvance: 1000}
+	if font.Key("Subtype").Name() != "Type0" {
+		runFont.encoder = pdf.Font{V: font}.Encoder()
+		firstChar := int(font.Key("FirstChar").Float64())
+		widths := font.Key("Widths")
+		for index := 0; index < widths.Len(); index++ {
+			runFont.widths[firstChar+index] = widths.Index(index).Float64()
+		}
+		return runFont
+	}
+
+	runFont.codeBytes = 2
+	encoding := font.Key("Encoding").Name()
+	runFont.vertical = strings.HasSuffix(encoding, "-V")
+	switch {
+	case encoding == "Identity-H":
+		runFont.encoder = pdf.Font{V: font}.Encoder()
+	case font.Key("ToUnicode").Kind() == pdf.Stream:
+		// 第三方解析器只对 Identity-H 读取 ToUnicode，竖排的 Identity-V 等需要自行解析
+		runFont.encoder = readPDFToUnicode(font.Key("ToUnicode"))
+	case strings.Contains(encoding, "UCS2") || strings.Contains(encoding, "UTF16"):
+		runFont.encoder = pdfUTF16Encoding{}
+	default:
+		runFont.encoder = pdf.Font{V: font}.Encoder()
+	}
+
+	descendant := font.Key("DescendantFonts").Index(0)
+	runFont.defaultWidth = 1000
+	if defaultWidth := descendant.Key("DW"); defaultWidth.Kind() != pdf.Null {
+		runFont.defaultWidth = defaultWidth.Float64()
+	}
+	if metrics := descendant.Key("DW2"); metrics.Len() == 2 {
+		runFont.verticalAdvance = math.Abs(metrics.Index(1).Float64())
+	}
+
+	// W 数组的两种写法：c [w1 w2 ...] 与 cFirst cLast w
+	widths := descendant.Key("W")
+	for index := 0; index+1 < widths.Len(); {
+		first := int(widths.Index(index).Float64())
+		if list := widths.Index(index + 1); list.Kind() == pdf.Array {
+			for offset := 0; offset < list.Len(); offset++ {
+				runFont.widths[first+offset] = list.Index(offset).Float64()
+			}
+			index += 2
+			continue
+		}
+		if index+2 >= widths.Len() {
+			break
+		}
+		last := min(int(widths.Index(index+1).Float64()), first+0xFFFF)
+		width := widths.Index(index + 2).Float64()
+		for code := first; code <= last; code++ {
+			runFont.widths[code] = width
+		}
+		index += 3
+	}
+	return runFont
+}
+
+// codes 按编码字节数切分字符串
+func (f *pdfRunFont) codes(raw string) []string {
+	codes := make([]string, 0, len(raw)/f.codeBytes+1)
+	for index := 0; index < len(raw); index += f.codeBytes {
+		codes = append(codes, raw[index:min(index+f.codeBytes, len(raw))])
+	}
+	return codes
+}
+
+// glyphWidth 字宽（千分之一 em），第二个返回值表示是否为估算值
+func (f *pdfRunFont) glyphWidth(code, text string) (float64, bool) {
+	value := 0
+	for index := 0; index < len(code); index++ {
+		value = value<<8 | int(code[index])
+	}
+	if width, exists := f.widths[value]; exists && width > 0 {
+		return width, false
+	}
+	if f.defaultWidth > 0 {
+		return f.defaultWidth, false
+	}
+
+	width := 0.0
+	for _, char := range text {
+		switch {
+		case isReflowCJKRune(char) || unicode.Is(unicode.Hangul, char):
+			width += 1000
+		case char == ' ':
+			width += 250
+		default:
+			width += 500
+		}
+	}
+	return width, true
+}
+
+// pdfTextState 图形状态中与文字位置有关的部分
+type pdfTextState struct {
+	ctm       pdfMatrix
+	font      *pdfRunFont
+	fontSize  float64
+	charSpace float64
+	wordSpace float64
+	// scale 水平缩放，Tz 的百分比除以 100
+	scale   float64
+	leading float64
+	rise    float64
+}
+
+// collectPDFTextRuns 解释页面内容流，按出现顺序返回各段文字及其位置；
+// 遇到无法解析的内容时保留已经收集到的文字
+func collectPDFTextRuns(page pdf.Page) (runs []pdfTextRun) {
+	content := page.V.Key("Contents")
+	if content.Kind() == pdf.Null {
+		return nil
+	}
+	defer func() {
+		_ = recover()
+	}()
+
+	resources := page.Resources()
+	fonts := make(map[string]*pdfRunFont)
+	fallbackFont := &pdfRunFont{codeBytes: 1, encoder: pdf.Font{}.Encoder(), verticalAdvance: 1000}
+	state := pdfTextState{ctm: pdfIdentityMatrix, font: fallbackFont, scale: 1}
+	var saved []pdfTextState
+	textMatrix, lineMatrix := pdfIdentityMatrix, pdfIdentityMatrix
+
+	nextLine := func(tx, ty float64) {
+		lineMatrix = pdfTranslateMatrix(tx, ty).multiply(lineMatrix)
+		textMatrix = lineMatrix
+	}
+	showText := func(items ...pdf.Value) {
+		font := state.font
+		start := textMatrix.multiply(state.ctm)
+		var builder strings.Builder
+		advance := 0.0
+		estimated := false
+		for _, item := range items {
+			switch item.Kind() {
+			case pdf.String:
+				for _, code := range font.codes(item.RawString()) {
+					text := font.encoder.Decode(code)
+					builder.WriteString(text)
+					width, guessed := font.glyphWidth(code, text)
+					estimated = estimated || guessed
+
+					spacing := state.charSpace
+					if font.codeBytes == 1 && code == " " {
+						spacing += state.wordSpace
+					}
+					var step float64
+					if font.vertical {
+						// 竖排时字距让文字向上收紧
+						step = font.verticalAdvance/1000*state.fontSize - spacing
+						textMatrix = pdfTranslateMatrix(0, -step).multiply(textMatrix)
+					} else {
+						step = (width/1000*state.fontSize + spacing) * state.scale
+						textMatrix = pdfTranslateMatrix(step, 0).multiply(textMatrix)
+					}
+					advance += step
+				}
+			case pdf.Integer, pdf.Real:
+				adjust := item.Float64() / 1000 * state.fontSize
+				if font.vertical {
+					textMatrix = pdfTranslateMatrix(0, -adjust).multiply(textMatrix)
+					advance += adjust
+				} else {
+					adjust *= state.scale
+					textMatrix = pdfTranslateMatrix(-adjust, 0).multiply(textMatrix)
+					advance -= adjust
+				}
+				// 较大的字距调整相当于词间空格
+				if adjust <= -0.2*state.fontSize && builder.Len() > 0 && !strings.HasSuffix(builder.String(), " ") {
+					builder.WriteByte(' ')
+				}
+			}
+		}
+
+		text := builder.String()
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+		x, y := start.apply(0, state.rise)
+		lengthScale := math.Hypot(start[0], start[1])
+		if font.vertical {
+			lengthScale = math.Hypot(start[2], start[3])
+		}
+		runs = append(runs, pdfTextRun{
+			text:      text,
+			x:         x,
+			y:         y,
+			advance:   advance * lengthScale,
+			size:      state.fontSize * math.Hypot(start[2], start[3]),
+			vertical:  font.vertical,
+			estimated: estimated,
+		})
+	}
+
+	pdf.Interpret(content, func(stk *pdf.Stack, op string) {
+		args := make([]pdf.Value, stk.Len())
+		for i := len(args) - 1; i >= 0; i-- {
+			args[i] = stk.Pop()
+		}
+		number := func(index int) float64 {
+			if index < 0 || index >= len(args) {
+				return 0
+			}
+			return args[index].Float64()
+		}
+		last := len(args) - 1
+
+		switch op {
+		case "q":
+			saved = append(saved, state)
+		case "Q":
+			if n := len(saved); n > 0 {
+				state = saved[n-1]
+				saved = saved[:n-1]
+			}
+		case "cm":
+			if len(args) >= 6 {
+				var matrix pdfMatrix
+				for i := range matrix {
+					matrix[i] = number(len(args) - 6 + i)
+				}
+				state.ctm = matrix.multiply(state.ctm)
+			}
+		case "BT":
+			textMatrix, lineMatrix = pdfIdentityMatrix, pdfIdentityMatrix
+		case "Tf":
+			if len(args) >= 2 {
+				name := args[last-1].Name()
+				if _, exists := fonts[name]; !exists {
+					fonts[name] = fallbackFont
+					if font := resources.Key("Font").Key(name); font.Kind() == pdf.Dict {
+						fonts[name] = loadPDFRunFont(font)
+					}
+				}
+				state.font = fonts[name]
+				state.fontSize = number(last)
+			}
+		case "Tc":
+			state.charSpace = number(last)
+		case "Tw":
+			state.wordSpace = number(last)
+		case "Tz":
+			state.scale = number(last) / 100
+		case "TL":
+			state.leading = number(last)
+		case "Ts":
+			state.rise = number(last)
+		case "Td":
+			nextLine(number(last-1), number(last))
+		case "TD":
+			state.leading = -number(last)
+			nextLine(number(last-1), number(last))
+		case "Tm":
+			if len(args) >= 6 {
+				for i := range lineMatrix {
+					lineMatrix[i] = number(len(args) - 6 + i)
+				}
+				textMatrix = lineMatrix
+			}
+		case "T*":
+			nextLine(0, -state.leading)
+		case "Tj":
+			if len(args) > 0 {
+				showText(args[last])
+			}
+		case "'":
+			nextLine(0, -state.leading)
+			if len(args) > 0 {
+				showText(args[last])
+			}
+		case "\"":
+			if len(args) >= 3 {
+				state.wordSpace = number(last - 2)
+				state.charSpace = number(last - 1)
+			}
+			nextLine(0, -state.leading)
+			if len(args) > 0 {
+				showText(args[last])
+			}
+		case "TJ":
+			if len(args) > 0 {
+				array := args[last]
+				items := make([]pdf.Value, array.Len())
+				for i := range items {
+					items[i] = array.Index(i)
+				}
+				showText(items...)
+			}
+		}
+	})
+	return runs
+}
+
+// pdfFrameRun 换算到阅读坐标系的文字：u 沿书写方向递增，v 沿换行方向递增。
+// 横排时 u 为横坐标、v 为纵坐标取反；竖排时 u 为纵坐标取反、v 为横坐标取反（列从右往左）
+type pdfFrameRun struct {
+	pdfTextRun
+	u, v float64
+}
+
+func (r pdfFrameRun) end() float64 {
+	return r.u + r.advance
+}
+
+func newPDFFrameRun(run pdfTextRun) pdfFrameRun {
+	if run.vertical {
+		return pdfFrameRun{pdfTextRun: run, u: -run.y, v: -run.x}
+	}
+	return pdfFrameRun{pdfTextRun: run, u: run.x, v: -run.y}
+}
+
+// pdfGutter 栏间空白在 u 轴上的范围
+type pdfGutter struct {
+	start, end float64
+}
+
+// arrangePDFPageLines 按阅读顺序把文字排成行，返回的行坐标 x、y 取自阅读坐标系的 u 与 -v，
+// 横排时即行首横坐标和所在行纵坐标，竖排时行首更靠下的列 x 更大，缩进判断照常可用
+func arrangePDFPageLines(runs []pdfTextRun) ([]pdfPageLine, pdfPageLayout) {
+	if len(runs) == 0 {
+		return nil, pdfPageLayout{}
+	}
+
+	if !detectPDFVerticalRuns(runs) {
+		lines, columns := arrangePDFFrameRuns(runs)
+		return lines, pdfPageLayout{columns: columns}
+	}
+
+	// 竖排页面中横排的文字（页眉、页码）单独成行，位于竖排文字上方的排在前面
+	var verticalRuns, horizontalRuns []pdfTextRun
+	top := math.Inf(-1)
+	for _, run := range runs {
+		if run.vertical {
+			verticalRuns = append(verticalRuns, run)
+			top = math.Max(top, run.y)
+		} else {
+			horizontalRuns = append(horizontalRuns, run)
+		}
+	}
+	verticalLines, columns := arrangePDFFrameRuns(verticalRuns)
+	horizontalLines, _ := arrangePDFFrameRuns(horizontalRuns)
+
+	lines := make([]pdfPageLine, 0, len(verticalLines)+len(horizontalLines))
+	var footer []pdfPageLine
+	for _, line := range horizontalLines {
+		if line.y > top {
+			lines = append(lines, line)
+		} else {
+			footer = append(footer, line)
+		}
+	}
+	lines = append(lines, verticalLines...)
+	return append(lines, footer...), pdfPageLayout{vertical: true, columns: columns}
+}
+
+// detectPDFVerticalRuns 判断页面是否竖排：竖排字体（编码以 -V 结尾）的文字占多数，
+// 或者横排字体逐字自上而下摆放；后一种情况会把这些单字标记为竖排
+func detectPDFVerticalRuns(runs []pdfTextRun) bool {
+	verticalChars, totalChars := 0, 0
+	for _, run := range runs {
+		count := utf8.RuneCountInString(strings.TrimSpace(run.text))
+		totalChars += count
+		if run.vertical {
+			verticalChars += count
+		}
+	}
+	if verticalChars > 0 {
+		return verticalChars*2 >= totalChars
+	}
+
+	downSteps, rightSteps := 0, 0
+	for index := 1; index < len(runs); index++ {
+		previous, current := runs[index-1], runs[index]
+		if !isPDFSingleGlyphRun(previous) || !isPDFSingleGlyphRun(current) {
+			continue
+		}
+		size := math.Max(previous.size, current.size)
+		dx, dy := math.Abs(current.x-previous.x), previous.y-current.y
+		switch {
+		case dx <= 0.3*size && dy > 0.5*size && dy < 2*size:
+			downSteps++
+		case math.Abs(dy) <= 0.3*size && dx > 0.5*size && dx < 2*size:
+			rightSteps++
+		}
+	}
+	if downSteps < pdfLayoutMinStackedSteps || downSteps <= 2*rightSteps {
+		return false
+	}
+
+	for index, run := range runs {
+		if isPDFSingleGlyphRun(run) {
+			runs[index].vertical = true
+			runs[index].x += run.advance / 2
+			runs[index].advance = run.size
+		}
+	}
+	return true
+}
+
+func isPDFSingleGlyphRun(run pdfTextRun) bool {
+	return utf8.RuneCountInString(strings.TrimSpace(run.text)) == 1
+}
+
+// arrangePDFFrameRuns 在阅读坐标系中按栏、按行排列文字，返回行和栏数。
+// 跨过栏间空白的行（通栏标题）把页面分成若干段，每段内先读完左栏再读右栏
+func arrangePDFFrameRuns(runs []pdfTextRun) ([]pdfPageLine, int) {
+	if len(runs) == 0 {
+		return nil, 0
+	}
+
+	frameRuns := make([]pdfFrameRun, len(runs))
+	sizes := make([]float64, len(runs))
+	for index, run := range runs {
+		frameRuns[index] = newPDFFrameRun(run)
+		sizes[index] = run.size
+	}
+	sort.Float64s(sizes)
+	gutters := findPDFGutters(frameRuns, sizes[len(sizes)/2])
+
+	var lines []pdfPageLine
+	sections := make([][]pdfPageLine, len(gutters)+1)
+	flushSections := func() {
+		for index, section := range sections {
+			lines = append(lines, section...)
+			sections[index] = nil
+		}
+	}
+
+	for _, row := range groupPDFFrameRows(frameRuns) {
+		columns := make([][]pdfFrameRun, len(gutters)+1)
+		spanning := false
+		for _, run := range row {
+			column := pdfRunColumn(run, gutters)
+			if column < 0 {
+				spanning = true
+				break
+			}
+			columns[column] = append(columns[column], run)
+		}
+
+		if spanning {
+			flushSections()
+			lines = append(lines, buildPDFFrameLine(row))
+			continue
+		}
+		for column, columnRuns := range columns {
+			if len(columnRuns) > 0 {
+				sections[column] = append(sections[column], buildPDFFrameLine(columnRuns))
+			}
+		}
+	}
+	flushSections()
+
+	return lines, len(gutters) + 1
+}
+
+// groupPDFFrameRows 把 v 相近的文字归为一行，行内按 u 排序
+func groupPDFFrameRows(runs []pdfFrameRun) [][]pdfFrameRun {
+	sorted := slices.Clone(runs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].v < sorted[j].v
+	})
+
+	var rows [][]pdfFrameRun
+	rowV, rowSize := 0.0, 0.0
+	for _, run := range sorted {
+		if len(rows) > 0 && math.Abs(run.v-rowV) <= 0.5*math.Max(run.size, rowSize) {
+			rows[len(rows)-1] = append(rows[len(rows)-1], run)
+			rowSize = math.Max(rowSize, run.size)
+			continue
+		}
+		rows = append(rows, []pdfFrameRun{run})
+		rowV, rowSize = run.v, run.size
+	}
+
+	for _, row := range rows {
+		sort.SliceStable(row, func(i, j int) bool {
+			return row[i].u < row[j].u
+		})
+	}
+	return rows
+}
+
+// pdfRunColumn 文字所在的栏，跨过栏间空白时返回 -1
+func pdfRunColumn(run pdfFrameRun, gutters []pdfGutter) int {
+	column := 0
+	for _, gutter := range gutters {
+		if run.u < gutter.end-1 && run.end() > gutter.start+1 {
+			return -1
+		}
+		if run.u >= gutter.end-1 {
+			column++
+		}
+	}
+	return column
+}
+
+func buildPDFFrameLine(runs []pdfFrameRun) pdfPageLine {
+	var builder strings.Builder
+	for index, run := range runs {
+		if index > 0 && needsPDFRunSpace(runs[index-1], run) {
+			builder.WriteByte(' ')
+		}
+		builder.WriteString(run.text)
+	}
+	return pdfPageLine{text: builder.String(), x: runs[0].u, y: -runs[0].v}
+}
+
+// needsPDFRunSpace 同一行相邻两段文字之间是否补空格：字宽可靠时按间距判断，
+// 否则退回按字符判断；中日文之间不加空格
+func needsPDFRunSpace(previous, next pdfFrameRun) bool {
+	if strings.HasSuffix(previous.text, " ") || strings.HasPrefix(next.text, " ") {
+		return false
+	}
+	if previous.estimated || next.estimated {
+		return shouldInsertSpaceBetweenPDFFragments(previous.text, next.text)
+	}
+
+	last, _ := utf8.DecodeLastRuneInString(previous.text)
+	first, _ := utf8.DecodeRuneInString(next.text)
+	if isReflowCJKRune(last) || isReflowCJKRune(first) {
+		return false
+	}
+	return next.u-previous.end() > 0.2*math.Min(previous.size, next.size)
+}
+
+// findPDFGutters 查找栏间空白：几乎没有文字覆盖、足够宽、位于页面中部，
+// 并且两侧每一栏都有足够的行和足够满的行
+func findPDFGutters(runs []pdfFrameRun, size float64) []pdfGutter {
+	if len(runs) < 2*pdfLayoutColumnMinRows {
+		return nil
+	}
+
+	left, right := math.Inf(1), math.Inf(-1)
+	for _, run := range runs {
+		left = math.Min(left, run.u)
+		right = math.Max(right, run.end())
+	}
+	span := right - left
+	if span <= 0 {
+		return nil
+	}
+
+	bins := make([]int, int(span/pdfLayoutBinWidth)+1)
+	for _, run := range runs {
+		first := int((run.u - left) / pdfLayoutBinWidth)
+		last := min(int(math.Ceil((run.end()-left)/pdfLayoutBinWidth))-1, len(bins)-1)
+		for bin := first; bin <= last; bin++ {
+			bins[bin]++
+		}
+	}
+
+	coverLimit := max(1, int(float64(len(runs))*pdfLayoutGutterMaxCover))
+	minWidth := math.Max(pdfLayoutGutterMinWidth, pdfLayoutGutterMinRatio*size)
+	var gutters []pdfGutter
+	for bin := 0; bin < len(bins); {
+		if bins[bin] > coverLimit {
+			bin++
+			continue
+		}
+		start := bin
+		for bin < len(bins) && bins[bin] <= coverLimit {
+			bin++
+		}
+
+		gutter := pdfGutter{start: left + float64(start)*pdfLayoutBinWidth, end: left + float64(bin)*pdfLayoutBinWidth}
+		center := (gutter.start + gutter.end) / 2
+		if gutter.end-gutter.start >= minWidth && center >= left+0.2*span && center <= left+0.8*span {
+			gutters = append(gutters, gutter)
+		}
+	}
+	if len(gutters) == 0 {
+		return nil
+	}
+
+	bounds := make([]float64, 0, 2*len(gutters)+2)
+	bounds = append(bounds, left)
+	for _, gutter := range gutters {
+		bounds = append(bounds, gutter.start, gutter.end)
+	}
+	bounds = append(bounds, right)
+	for column := 0; column <= len(gutters); column++ {
+		if !isPDFColumnFilled(runs, bounds[2*column], bounds[2*column+1], size) {
+			return nil
+		}
+	}
+	return gutters
+}
+
+func isPDFColumnFilled(runs []pdfFrameRun, start, end, size float64) bool {
+	width := end - start
+	if width <= 0 {
+		return false
+	}
+
+	rowLengths := make(map[int]float64)
+	for _, run := range runs {
+		if run.u >= start-1 && run.end() <= end+1 {
+			rowLengths[int(math.Round(run.v/(0.5*size)))] += run.advance
+		}
+	}
+	if len(rowLengths) < pdfLayoutColumnMinRows {
+		return false
+	}
+
+	total := 0.0
+	for _, length := range rowLengths {
+		total += math.Min(length, width)
+	}
+	return total/float64(len(rowLengths)) >= pdfLayoutColumnMinFill*width
+}
+
+// summarizePDFLayouts 汇总各页版式，占多数的版式作为全书版式，没有明显多数时为 mixed
+func summarizePDFLayouts(pageLayouts []pdfPageLayout) (string, []string) {
+	pages := make([]string, len(pageLayouts))
+	counts := make(map[string]int)
+	summary, textPages := "", 0
+	for index, layout := range pageLayouts {
+		pages[index] = layout.String()
+		if pages[index] == "" {
+			continue
+		}
+		textPages++
+		counts[pages[index]]++
+		if counts[pages[index]] > counts[summary] {
+			summary = pages[index]
+		}
+	}
+	if textPages > 0 && float64(counts[summary]) < float64(textPages)*pdfLayoutMajorityRatio {
+		summary = "mixed"
+	}
+	return summary, pages
+}
+
+var (
+	pdfCMapBlockPattern = regexp.MustCompile(`(?s)begin(bfchar|bfrange)(.*?)end(?:bfchar|bfrange)`)
+	pdfCMapTokenPattern = regexp.MustCompile(`<([0-9A-Fa-f\s]*)>|\[|\]`)
+)
+
+// pdfToUnicodeMap ToUnicode CMap 中的 bfchar 与 bfrange 映射
+type pdfToUnicodeMap struct {
+	chars  map[string]string
+	ranges []pdfToUnicodeRange
+}
+
+type pdfToUnicodeRange struct {
+	low, high []byte
+	// target 首个编码对应的 UTF-16BE 文本，后续编码递增最后一个码元
+	target []uint16
+}
+
+// readPDFToUnicode 解析 ToUnicode CMap，流无法读取时返回空映射
+func readPDFToUnicode(stream pdf.Value) (cmap *pdfToUnicodeMap) {
+	cmap = &pdfToUnicodeMap{chars: make(map[string]string)}
+	defer func() {
+		_ = recover()
+	}()
+
+	data, err := io.ReadAll(stream.Reader())
+	if err != nil {
+		return cmap
+	}
+
+	for _, block := range pdfCMapBlockPattern.FindAllStringSubmatch(string(data), -1) {
+		tokens := pdfCMapTokenPattern.FindAllStringSubmatch(block[2], -1)
+		if block[1] == "bfchar" {
+			for index := 0; index+1 < len(tokens); index += 2 {
+				cmap.chars[string(decodePDFHexToken(tokens[index][1]))] = decodePDFUTF16(decodePDFHexToken(tokens[index+1][1]))
+			}
+			continue
+		}
+
+		for index := 0; index+2 < len(tokens); {
+			low, high := decodePDFHexToken(tokens[index][1]), decodePDFHexToken(tokens[index+1][1])
+			if tokens[index+2][0] != "[" {
+				cmap.ranges = append(cmap.ranges, pdfToUnicodeRange{low: low, high: high, target: pdfUTF16Units(decodePDFHexToken(tokens[index+2][1]))})
+				index += 3
+				continue
+			}
+
+			code := slices.Clone(low)
+			index += 3
+			for ; index < len(tokens) && tokens[index][0] != "]"; index++ {
+				cmap.chars[string(code)] = decodePDFUTF16(decodePDFHexToken(tokens[index][1]))
+				incrementPDFCode(code)
+			}
+			index++
+		}
+	}
+	return cmap
+}
+
+func (m *pdfToUnicodeMap) Decode(raw string) string {
+	var builder strings.Builder
+	for index := 0; index < len(raw); {
+		matched := false
+		for size := min(4, len(raw)-index); size >= 1 && !matched; size-- {
+			if text, ok := m.lookup(raw[index : index+size]); ok {
+				builder.WriteString(text)
+				index += size
+				matched = true
+			}
+		}
+		if !matched {
+			index++
+		}
+	}
+	return builder.String()
+}
+
+func (m *pdfToUnicodeMap) lookup(code string) (string, bool) {
+	if text, exists := m.chars[code]; exists {
+		return text, true
+	}
+	for _, mapping := range m.ranges {
+		if len(mapping.low) != len(code) || len(mapping.target) == 0 {
+			continue
+		}
+		if code < string(mapping.low) || code > string(mapping.high) {
+			continue
+		}
+		offset := pdfCodeValue([]byte(code)) - pdfCodeValue(mapping.low)
+		units := slices.Clone(mapping.target)
+		units[len(units)-1] += uint16(offset)
+		return string(utf16.Decode(units)), true
+	}
+	return "", false
+}
+
+// pdfUTF16Encoding UCS2 / UTF16 编码的 CMap，字符编码即 UTF-16BE
+type pdfUTF16Encoding struct{}
+
+func (pdfUTF16Encoding) Decode(raw string) string {
+	return decodePDFUTF16([]byte(raw))
+}
+
+func decodePDFHexToken(token string) []byte {
+	token = strings.Join(strings.Fields(token), "")
+	if len(token)%2 == 1 {
+		token += "0"
+	}
+	data, _ := hex.DecodeString(token)
+	return data
+}
+
+func pdfUTF16Units(data []byte) []uint16 {
+	units := make([]uint16, len(data)/2)
+	for index := range units {
+		units[index] = uint16(data[2*index])<<8 | uint16(data[2*index+1])
+	}
+	return units
+}
+
+func decodePDFUTF16(data []byte) string {
+	return string(utf16.Decode(pdfUTF16Units(data)))
+}
+
+func pdfCodeValue(code []byte) int {
+	value := 0
+	for _, part := range code {
+		value = value<<8 | int(part)
+	}
+	return value
+}
+
+func incrementPDFCode(code []byte) {
+	for index := len(code) - 1; index >= 0; index-- {
+		code[index]++
+		if code[index] != 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"reflect"
+
+	pdf "github.com/ledongthuc/pdf"
+)
+
+// 第三方解析器不公开对象的间接引用、流数据在文件中的位置和解密密钥。
+// 这里通过反射按字段名和类型只读访问（版本由 go.mod 固定），
+// 字段不存在或类型不符时返回 false，调用方按无法解析处理，不会误读数据
+
+// pdfObjectRef PDF 间接对象引用（对象号与生成号）
+type pdfObjectRef struct {
+	id  uint64
+	gen uint64
+}
+
+// pdfValueRef 读取解析后对象所属的间接引用
+func pdfValueRef(value pdf.Value) (pdfObjectRef, bool) {
+	if value.IsNull() {
+		return pdfObjectRef{}, false
+	}
+	ptr := reflect.ValueOf(value).FieldByName("ptr")
+	if ptr.Kind() != reflect.Struct || ptr.NumField() != 2 {
+		return pdfObjectRef{}, false
+	}
+	id, gen := ptr.Field(0), ptr.Field(1)
+	if !isUnsignedKind(id.Kind()) || !isUnsignedKind(gen.Kind()) || id.Uint() == 0 {
+		return pdfObjectRef{}, false
+	}
+	return pdfObjectRef{id: id.Uint(), gen: gen.Uint()}, true
+}
+
+// pdfStreamOffset 读取流数据（stream 关键字之后）在文件中的起始偏移
+func pdfStreamOffset(value pdf.Value) (int64, bool) {
+	if value.Kind() != pdf.Stream {
+		return 0, false
+	}
+	data := reflect.ValueOf(value).FieldByName("data")
+	if data.Kind() != reflect.Interface || data.IsNil() || data.Elem().Kind() != reflect.Struct {
+		return 0, false
+	}
+	offset := data.Elem().FieldByName("offset")
+	if offset.Kind() != reflect.Int64 {
+		return 0, false
+	}
+	return offset.Int(), true
+}
+
+// pdfReaderKey 读取加密文件的文件密钥，以及流是否使用 AES 加密；未加密的文件密钥为空
+func pdfReaderKey(reader *pdf.Reader) (key []byte, useAES bool, ok bool) {
+	if reader == nil {
+		return nil, false, false
+	}
+	fields := reflect.ValueOf(reader).Elem()
+	keyField, aesField := fields.FieldByName("key"), fields.FieldByName("useAES")
+	if keyField.Kind() != reflect.Slice || keyField.Type().Elem().Kind() != reflect.Uint8 || aesField.Kind() != reflect.Bool {
+		return nil, false, false
+	}
+	return append([]byte(nil), keyField.Bytes()...), aesField.Bool(), true
+}
+
+func isUnsignedKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
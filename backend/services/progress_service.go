@@ -9,6 +9,19 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/nongchen1223/moyureader/backend/models"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const (
+	// progressBackupCount progress.json 保留的备份份数，progress.json.bak1 最新
+	progressBackupCount = 3
+	// progressFlushInterval 阅读进度变化后延迟写盘的时间，期间的多次更新合并为一次写入
+	progressFlushInterval = 2 * time.Second
+	// progressBackupInterval 两次轮换备份的最短间隔。进度每隔几秒就会写盘，
+	// 每次都轮换的话几份备份很快都只差几秒，起不到保留较早状态的作用
+	progressBackupInterval = 10 * time.Minute
 )
 
 // ReadingProgressEntry 单本书的阅读进度
@@ -18,11 +31,33 @@ type ReadingProgressEntry struct {
 	Position       int     `json:"position"`
 	Progress       float64 `json:"progress"`
 	LastReadTime   int64   `json:"last_read_time"`
+	// Page 阅读位置所在的 PDF 页码（从 1 开始），没有页码信息的书为 0
+	Page int `json:"page,omitempty"`
+}
+
+// BookSettings 单本书的解析偏好
+type BookSettings struct {
+	FilePath string `json:"file_path"`
+	// Encoding 手动指定的文本编码，为空表示自动识别
+	Encoding string `json:"encoding,omitempty"`
+	// ChapterRules 该书专用的章节识别规则，为空表示使用全局规则
+	ChapterRules *models.ChapterRuleSet `json:"chapter_rules,omitempty"`
+	// Comic 漫画阅读选项，为空表示按 ComicInfo 默认
+	Comic *models.ComicOptions `json:"comic,omitempty"`
+	// PDF PDF 文本提取选项，为空表示使用默认选项
+	PDF *models.PDFOptions `json:"pdf,omitempty"`
+	// Txt TXT 排版选项，为空表示不重排
+	Txt *models.TxtOptions `json:"txt,omitempty"`
+	// Password 加密保存的 PDF 打开密码，为空表示未保存
+	Password string `json:"password,omitempty"`
 }
 
 // ProgressData 进度文件数据结构
 type ProgressData struct {
 	Novels []ReadingProgressEntry `json:"novels"`
+	Books  []BookSettings         `json:"books,omitempty"`
+	// ChapterRules 全局章节识别规则，为空表示使用内置规则
+	ChapterRules *models.ChapterRuleSet `json:"chapter_rules,omitempty"`
 }
 
 // ProgressService 阅读进度持久化服务
@@ -32,6 +67,17 @@ type ProgressService struct {
 	data     ProgressData
 	dataDir  string
 	filePath string
+	// recovery 最近一次从备份恢复的情况，前端读取后清除
+	recovery *models.ProgressRecovery
+	// dirty 内存中有尚未写盘的阅读进度
+	dirty bool
+	// flushTimer 待执行的延迟写盘，未安排时为 nil
+	flushTimer *time.Timer
+	// loadErr 进度文件存在但读取失败的原因。此时内存中的数据不完整，
+	// 在重新加载成功前拒绝写盘，免得覆盖原文件和备份
+	loadErr error
+	// lastBackup 上次轮换备份的时间
+	lastBackup time.Time
 }
 
 func resolveProgressDataDir(dataDir string) string {
@@ -65,9 +111,46 @@ func (s *ProgressService) Init(ctx context.Context) {
 	s.load()
 }
 
-// Cleanup 清理资源，保存进度
+// Cleanup 清理资源，写入尚未保存的进度
 func (s *ProgressService) Cleanup() {
-	s.save()
+	s.Flush()
+}
+
+// Flush 立即写入尚未保存的阅读进度，没有待写内容时直接返回
+func (s *ProgressService) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+	return s.saveLocked()
+}
+
+// IsDirty 是否有尚未写盘的阅读进度
+func (s *ProgressService) IsDirty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dirty
+}
+
+// markDirtyLocked 标记进度待写盘，并在 progressFlushInterval 后统一写入
+func (s *ProgressService) markDirtyLocked() {
+	s.dirty = true
+	if s.flushTimer == nil {
+		s.flushTimer = time.AfterFunc(progressFlushInterval, s.flushFromTimer)
+	}
+}
+
+// flushFromTimer 延迟写盘到期；写入失败时保留待写状态，稍后重试
+func (s *ProgressService) flushFromTimer() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.flushTimer = nil
+	if s.dirty && s.saveLocked() != nil {
+		s.flushTimer = time.AfterFunc(progressFlushInterval, s.flushFromTimer)
+	}
 }
 
 // ensureDataDir 确保数据目录存在
@@ -77,7 +160,7 @@ func (s *ProgressService) ensureDataDir() {
 	}
 }
 
-// SetDataDir 更新进度存储目录
+// SetDataDir 更新进度存储目录，切换前先把尚未保存的进度写入原目录
 func (s *ProgressService) SetDataDir(dataDir string) error {
 	nextDataDir := resolveProgressDataDir(dataDir)
 	nextFilePath := filepath.Join(nextDataDir, "progress.json")
@@ -87,13 +170,25 @@ func (s *ProgressService) SetDataDir(dataDir string) error {
 		s.mu.Unlock()
 		return nil
 	}
+	// 原目录的进度文件读不出来时写不回去，待写进度随内存数据带到新目录
+	if s.dirty && s.loadErr == nil {
+		if err := s.saveLocked(); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+	}
 
 	currentData := s.data
+	previousDataDir := s.dataDir
 	s.dataDir = nextDataDir
 	s.filePath = nextFilePath
+	s.loadErr = nil
+	s.lastBackup = time.Time{}
 	s.mu.Unlock()
 
 	s.ensureDataDir()
+	// 密钥不随数据目录迁移，切换前把旧版本留在原目录的密钥收进本机
+	adoptLegacySecretKey(previousDataDir)
 
 	if _, err := os.Stat(nextFilePath); err == nil {
 		s.load()
@@ -107,20 +202,117 @@ func (s *ProgressService) SetDataDir(dataDir string) error {
 	return s.save()
 }
 
-// load 从文件加载进度
-func (s *ProgressService) load() {
+// currentDataDir 当前的数据目录
+func (s *ProgressService) currentDataDir() string {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.dataDir
+}
+
+// load 从文件加载进度；文件损坏或在替换途中丢失时，从最新的有效备份恢复并通知前端
+func (s *ProgressService) load() {
+	s.mu.Lock()
+	recovery := s.loadLocked()
+	s.mu.Unlock()
+
+	if recovery != nil && s.ctx != nil {
+		runtime.EventsEmit(s.ctx, "progress:recovered", *recovery)
+	}
+}
+
+func (s *ProgressService) loadLocked() *models.ProgressRecovery {
+	s.data = ProgressData{Novels: []ReadingProgressEntry{}}
+	s.dirty = false
+	s.loadErr = nil
+
+	s.promoteProgressTemp()
 
 	data, err := os.ReadFile(s.filePath)
-	if err != nil {
-		// 文件不存在或读取失败，使用空数据
+	if err == nil {
+		if err = json.Unmarshal(data, &s.data); err == nil {
+			return nil
+		}
 		s.data = ProgressData{Novels: []ReadingProgressEntry{}}
+		// 损坏的文件留给用户排查，不被后续保存覆盖
+		_ = os.Rename(s.filePath, fmt.Sprintf("%s.corrupt-%d", s.filePath, time.Now().Unix()))
+	} else if !os.IsNotExist(err) {
+		// 读取失败（如权限问题）时不动原文件，也不用备份覆盖它，之后的保存也一律拒绝
+		s.loadErr = err
+		return nil
+	}
+
+	recovery := &models.ProgressRecovery{RecoveredAt: time.Now().Unix()}
+	if os.IsNotExist(err) {
+		recovery.Reason = "进度文件缺失"
+	} else {
+		recovery.Reason = fmt.Sprintf("进度文件损坏: %v", err)
+	}
+
+	for index := 1; index <= progressBackupCount; index++ {
+		backupPath := progressBackupPath(s.filePath, index)
+		backup, readErr := os.ReadFile(backupPath)
+		if readErr != nil {
+			continue
+		}
+		var backupData ProgressData
+		if json.Unmarshal(backup, &backupData) != nil {
+			continue
+		}
+		if backupData.Novels == nil {
+			backupData.Novels = []ReadingProgressEntry{}
+		}
+
+		s.data = backupData
+		recovery.Backup = filepath.Base(backupPath)
+		if err := s.saveLocked(); err != nil {
+			recovery.Reason += fmt.Sprintf("；写回进度文件失败: %v", err)
+		}
+		s.recovery = recovery
+		return recovery
+	}
+
+	// 新装或从未保存过时没有任何备份，不算恢复
+	if os.IsNotExist(err) {
+		return nil
+	}
+	s.recovery = recovery
+	return recovery
+}
+
+// promoteProgressTemp 处理上次保存中途退出留下的临时文件：临时文件落盘后才会改名，
+// 完整且不比进度文件旧的那份就是最新的进度，用它替换进度文件，其余的删除
+func (s *ProgressService) promoteProgressTemp() {
+	tempPaths, err := filepath.Glob(s.filePath + ".tmp-*")
+	if err != nil || len(tempPaths) == 0 {
 		return
 	}
 
-	if err := json.Unmarshal(data, &s.data); err != nil {
-		s.data = ProgressData{Novels: []ReadingProgressEntry{}}
+	var newestTime time.Time
+	if info, err := os.Stat(s.filePath); err == nil {
+		newestTime = info.ModTime()
+	}
+	newest := ""
+	for _, tempPath := range tempPaths {
+		info, err := os.Stat(tempPath)
+		if err != nil || info.ModTime().Before(newestTime) {
+			continue
+		}
+		data, err := os.ReadFile(tempPath)
+		if err != nil || !json.Valid(data) {
+			continue
+		}
+		newest = tempPath
+		newestTime = info.ModTime()
+	}
+
+	if newest != "" {
+		rotateProgressBackups(s.filePath)
+		if os.Rename(newest, s.filePath) == nil {
+			syncDir(filepath.Dir(s.filePath))
+		}
+	}
+	for _, tempPath := range tempPaths {
+		os.Remove(tempPath)
 	}
 }
 
@@ -128,7 +320,15 @@ func (s *ProgressService) load() {
 func (s *ProgressService) save() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.saveLocked()
+}
 
+// saveLocked 先写临时文件并落盘，再把现有文件复制一份为备份（每 progressBackupInterval 至多一次）、
+// 将临时文件直接改名覆盖，任何时刻 progress.json 都存在，中途崩溃或磁盘写满时旧文件或备份仍然完整
+func (s *ProgressService) saveLocked() error {
+	if s.loadErr != nil {
+		return fmt.Errorf("进度文件读取失败，暂不保存: %w", s.loadErr)
+	}
 	s.ensureDataDir()
 
 	data, err := json.MarshalIndent(s.data, "", "  ")
@@ -136,16 +336,128 @@ func (s *ProgressService) save() error {
 		return fmt.Errorf("序列化进度数据失败: %w", err)
 	}
 
-	if err := os.WriteFile(s.filePath, data, 0644); err != nil {
+	tempPath, err := writeTempFile(s.filePath, data, 0644)
+	if err != nil {
 		return fmt.Errorf("写入进度文件失败: %w", err)
 	}
 
+	if time.Since(s.lastBackup) >= progressBackupInterval {
+		rotateProgressBackups(s.filePath)
+		s.lastBackup = time.Now()
+	}
+	if err := replaceWithTempFile(tempPath, s.filePath); err != nil {
+		return fmt.Errorf("替换进度文件失败: %w", err)
+	}
+
+	// 整份数据已写盘，待写的进度也随之保存
+	s.dirty = false
+	if s.flushTimer != nil {
+		s.flushTimer.Stop()
+		s.flushTimer = nil
+	}
+	return nil
+}
+
+func progressBackupPath(filePath string, index int) string {
+	return fmt.Sprintf("%s.bak%d", filePath, index)
+}
+
+// rotateProgressBackups 备份依次后移，最旧的一份被覆盖；当前文件复制为 .bak1，自身保持原位，
+// 之后由新文件改名覆盖。不用硬链接，免得原地改坏进度文件时连带改坏备份
+func rotateProgressBackups(filePath string) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return
+	}
+	for index := progressBackupCount; index > 1; index-- {
+		os.Rename(progressBackupPath(filePath, index-1), progressBackupPath(filePath, index))
+	}
+	os.WriteFile(progressBackupPath(filePath, 1), data, 0644)
+}
+
+// writeFileAtomic 先写同目录的临时文件并落盘，再改名替换目标文件；
+// 写入中途崩溃或断电时，目标文件要么是旧内容，要么是完整的新内容
+func writeFileAtomic(filePath string, data []byte, perm os.FileMode) error {
+	tempPath, err := writeTempFile(filePath, data, perm)
+	if err != nil {
+		return err
+	}
+	return replaceWithTempFile(tempPath, filePath)
+}
+
+// writeTempFile 在目标文件所在目录写入并同步临时文件，返回临时文件路径
+func writeTempFile(filePath string, data []byte, perm os.FileMode) (string, error) {
+	tempFile, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	tempPath := tempFile.Name()
+	_, err = tempFile.Write(data)
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tempPath, perm)
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return "", err
+	}
+	return tempPath, nil
+}
+
+// replaceWithTempFile 用临时文件改名替换目标文件并同步目录，失败时删除临时文件
+func replaceWithTempFile(tempPath, filePath string) error {
+	if err := os.Rename(tempPath, filePath); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	syncDir(filepath.Dir(filePath))
 	return nil
 }
 
-// SaveProgress 保存某本书的阅读进度
+// syncDir 落盘目录项，保证改名在断电后仍然生效；部分平台不支持时忽略
+func syncDir(dir string) {
+	handle, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	handle.Sync()
+	handle.Close()
+}
+
+// GetProgressRecovery 获取启动或切换目录时从备份恢复进度的情况，没有发生恢复时返回 nil
+func (s *ProgressService) GetProgressRecovery() *models.ProgressRecovery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.recovery == nil {
+		return nil
+	}
+	recovery := *s.recovery
+	return &recovery
+}
+
+// ClearProgressRecovery 前端提示过恢复情况后清除记录
+func (s *ProgressService) ClearProgressRecovery() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recovery = nil
+}
+
+// SaveProgress 保存某本书的阅读进度。滚动时调用频繁，只更新内存并安排延迟写盘，
+// 关书、退出、切换数据目录时或调用 Flush 会立即写入
 func (s *ProgressService) SaveProgress(filePath string, chapter int, position int, progress float64) error {
+	return s.saveProgress(filePath, chapter, position, 0, progress)
+}
+
+// saveProgress 同 SaveProgress，另记录阅读位置所在的 PDF 页码
+func (s *ProgressService) saveProgress(filePath string, chapter, position, page int, progress float64) error {
 	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	found := false
 	for i, entry := range s.data.Novels {
@@ -153,6 +465,7 @@ func (s *ProgressService) SaveProgress(filePath string, chapter int, position in
 			s.data.Novels[i].CurrentChapter = chapter
 			s.data.Novels[i].Position = position
 			s.data.Novels[i].Progress = progress
+			s.data.Novels[i].Page = page
 			s.data.Novels[i].LastReadTime = time.Now().Unix()
 			found = true
 			break
@@ -166,11 +479,12 @@ func (s *ProgressService) SaveProgress(filePath string, chapter int, position in
 			Position:       position,
 			Progress:       progress,
 			LastReadTime:   time.Now().Unix(),
+			Page:           page,
 		})
 	}
 
-	s.mu.Unlock()
-	return s.save()
+	s.markDirtyLocked()
+	return nil
 }
 
 // GetProgress 获取某本书的阅读进度
@@ -232,3 +546,59 @@ func (s *ProgressService) GetRecentBooks(limit int) []ReadingProgressEntry {
 	}
 	return sorted
 }
+
+// GetBookSettings 获取某本书的解析偏好
+func (s *ProgressService) GetBookSettings(filePath string) *BookSettings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, settings := range s.data.Books {
+		if settings.FilePath == filePath {
+			return &settings
+		}
+	}
+	return nil
+}
+
+// SaveBookSettings 保存某本书的解析偏好
+func (s *ProgressService) SaveBookSettings(settings BookSettings) error {
+	s.mu.Lock()
+
+	found := false
+	for i, entry := range s.data.Books {
+		if entry.FilePath == settings.FilePath {
+			s.data.Books[i] = settings
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		s.data.Books = append(s.data.Books, settings)
+	}
+
+	s.mu.Unlock()
+	return s.save()
+}
+
+// GetGlobalChapterRules 获取全局章节识别规则，未设置时返回 nil
+func (s *ProgressService) GetGlobalChapterRules() *models.ChapterRuleSet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data.ChapterRules == nil {
+		return nil
+	}
+
+	ruleSet := *s.data.ChapterRules
+	ruleSet.Rules = append([]models.ChapterRule(nil), ruleSet.Rules...)
+	return &ruleSet
+}
+
+// SaveGlobalChapterRules 保存全局章节识别规则，传 nil 恢复内置规则
+func (s *ProgressService) SaveGlobalChapterRules(ruleSet *models.ChapterRuleSet) error {
+	s.mu.Lock()
+	s.data.ChapterRules = ruleSet
+	s.mu.Unlock()
+	return s.save()
+}
@@ -0,0 +1,265 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressServiceRecoversFromBackups(t *testing.T) {
+	dataDir := t.TempDir()
+	service := NewProgressService(dataDir)
+	service.load()
+	if service.GetProgressRecovery() != nil {
+		t.Fatalf("a fresh data dir should not report a recovery")
+	}
+	for position := 1; position <= progressBackupCount+2; position++ {
+		if err := service.SaveProgress("/books/a.txt", 0, position*100, 0.1); err != nil {
+			t.Fatalf("SaveProgress returned error: %v", err)
+		}
+		// 模拟两次写盘间隔超过 progressBackupInterval，每次都轮换备份
+		service.lastBackup = time.Time{}
+		if err := service.Flush(); err != nil {
+			t.Fatalf("Flush returned error: %v", err)
+		}
+	}
+
+	progressPath := filepath.Join(dataDir, "progress.json")
+	entries, _ := os.ReadDir(dataDir)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	want := []string{"progress.json", "progress.json.bak1", "progress.json.bak2", "progress.json.bak3"}
+	if !slices.Equal(names, want) {
+		t.Fatalf("expected progress file with %d rotating backups, got %v", progressBackupCount, names)
+	}
+
+	// 主文件写坏、最新备份也坏了时，用下一份有效备份恢复
+	os.WriteFile(progressPath, []byte(`{"novels": [{"file_path": "/books/a.txt", "posi`), 0644)
+	os.WriteFile(progressBackupPath(progressPath, 1), nil, 0644)
+	reloaded := NewProgressService(dataDir)
+	reloaded.load()
+	entry := reloaded.GetProgress("/books/a.txt")
+	if entry == nil || entry.Position != (progressBackupCount)*100 {
+		t.Fatalf("progress should be recovered from progress.json.bak2, got %+v", entry)
+	}
+	recovery := reloaded.GetProgressRecovery()
+	if recovery == nil || recovery.Backup != "progress.json.bak2" || !strings.Contains(recovery.Reason, "损坏") {
+		t.Fatalf("unexpected recovery %+v", recovery)
+	}
+	reloaded.ClearProgressRecovery()
+	if reloaded.GetProgressRecovery() != nil {
+		t.Fatalf("recovery should be cleared")
+	}
+	if corrupt, _ := filepath.Glob(progressPath + ".corrupt-*"); len(corrupt) != 1 {
+		t.Fatalf("the corrupt file should be kept aside, got %v", corrupt)
+	}
+
+	// 改名替换途中退出、主文件缺失时同样从备份恢复
+	os.Remove(progressPath)
+	os.WriteFile(progressPath+".tmp-123", []byte("{"), 0644)
+	reloaded = NewProgressService(dataDir)
+	reloaded.load()
+	if entry := reloaded.GetProgress("/books/a.txt"); entry == nil || reloaded.GetProgressRecovery() == nil {
+		t.Fatalf("missing progress file should be recovered from backups, got %+v", entry)
+	}
+	if _, err := os.Stat(progressPath); err != nil {
+		t.Fatalf("recovered progress should be written back: %v", err)
+	}
+	if temp, _ := filepath.Glob(progressPath + ".tmp-*"); len(temp) != 0 {
+		t.Fatalf("stale temp files should be removed, got %v", temp)
+	}
+
+	// 临时文件已落盘但还没改名就退出时，它是最新的完整进度，不能删掉改用旧备份
+	previous, _ := os.ReadFile(progressPath)
+	data, _ := json.Marshal(ProgressData{Novels: []ReadingProgressEntry{{FilePath: "/books/a.txt", Position: 4321}}})
+	future := time.Now().Add(time.Minute)
+	for _, missingMain := range []bool{false, true} {
+		if missingMain {
+			os.Remove(progressPath)
+		}
+		tempPath := progressPath + ".tmp-456"
+		os.WriteFile(tempPath, data, 0644)
+		os.Chtimes(tempPath, future, future)
+		os.WriteFile(progressPath+".tmp-789", []byte("{"), 0644)
+
+		restored := NewProgressService(dataDir)
+		restored.load()
+		if entry := restored.GetProgress("/books/a.txt"); entry == nil || entry.Position != 4321 {
+			t.Fatalf("complete temp file should be promoted (missing main %v), got %+v", missingMain, entry)
+		}
+		if restored.GetProgressRecovery() != nil {
+			t.Fatalf("promoting a complete temp file is not a recovery")
+		}
+		if temp, _ := filepath.Glob(progressPath + ".tmp-*"); len(temp) != 0 {
+			t.Fatalf("temp files should be cleaned up, got %v", temp)
+		}
+		if !missingMain {
+			if backup, _ := os.ReadFile(progressBackupPath(progressPath, 1)); !bytes.Equal(backup, previous) {
+				t.Fatalf("replaced progress file should become progress.json.bak1, got %q", backup)
+			}
+		}
+	}
+}
+
+func TestProgressBackupsRotateAtMostOncePerInterval(t *testing.T) {
+	dataDir := t.TempDir()
+	service := NewProgressService(dataDir)
+	service.load()
+	progressPath := filepath.Join(dataDir, "progress.json")
+	for position := 1; position <= progressBackupCount+2; position++ {
+		service.SaveProgress("/books/a.txt", 0, position*100, 0.1)
+		if err := service.Flush(); err != nil {
+			t.Fatalf("Flush returned error: %v", err)
+		}
+	}
+
+	// 第一次写盘时还没有进度文件，之后的写盘都在同一个间隔内，不再轮换
+	if backups, _ := filepath.Glob(progressPath + ".bak*"); len(backups) != 0 {
+		t.Fatalf("frequent flushes should not rotate backups, got %v", backups)
+	}
+	previous, _ := os.ReadFile(progressPath)
+	service.lastBackup = time.Now().Add(-progressBackupInterval)
+	service.SaveProgress("/books/a.txt", 0, 900, 0.9)
+	if err := service.Flush(); err != nil {
+		t.Fatalf("Flush returned error: %v", err)
+	}
+	backups, _ := filepath.Glob(progressPath + ".bak*")
+	if backup, _ := os.ReadFile(progressBackupPath(progressPath, 1)); len(backups) != 1 || !bytes.Equal(backup, previous) {
+		t.Fatalf("a flush after the interval should back up the previous file, got %v", backups)
+	}
+}
+
+func TestProgressServiceRefusesToSaveAfterFailedLoad(t *testing.T) {
+	dataDir := t.TempDir()
+	progressPath := filepath.Join(dataDir, "progress.json")
+	data, _ := json.Marshal(ProgressData{Novels: []ReadingProgressEntry{{FilePath: "/books/a.txt", Position: 1234}}})
+	if err := os.WriteFile(progressPath, data, 0644); err != nil {
+		t.Fatalf("write progress file: %v", err)
+	}
+
+	// 读取时进度文件暂时读不出来（这里用同名目录代替），之后又恢复可读
+	asidePath := progressPath + ".aside"
+	os.Rename(progressPath, asidePath)
+	os.Mkdir(progressPath, 0755)
+	service := NewProgressService(dataDir)
+	service.load()
+	os.Remove(progressPath)
+	os.Rename(asidePath, progressPath)
+
+	service.SaveProgress("/books/b.txt", 0, 10, 0.1)
+	if err := service.Flush(); err == nil || !service.IsDirty() {
+		t.Fatalf("saving after a failed load should be refused and stay pending, got %v", err)
+	}
+	if err := service.SaveBookSettings(BookSettings{FilePath: "/books/b.txt", Encoding: "GBK"}); err == nil {
+		t.Fatalf("SaveBookSettings should be refused after a failed load")
+	}
+	if current, _ := os.ReadFile(progressPath); !bytes.Equal(current, data) {
+		t.Fatalf("progress file should be left untouched, got %q", current)
+	}
+	if backups, _ := filepath.Glob(progressPath + ".bak*"); len(backups) != 0 {
+		t.Fatalf("backups should not be overwritten with incomplete data, got %v", backups)
+	}
+
+	// 重新加载成功后恢复写盘
+	service.load()
+	service.SaveProgress("/books/b.txt", 0, 20, 0.2)
+	if err := service.Flush(); err != nil {
+		t.Fatalf("Flush after a successful load returned error: %v", err)
+	}
+	reloaded := NewProgressService(dataDir)
+	reloaded.load()
+	if entry := reloaded.GetProgress("/books/a.txt"); entry == nil || entry.Position != 1234 {
+		t.Fatalf("existing progress should survive, got %+v", entry)
+	}
+	if entry := reloaded.GetProgress("/books/b.txt"); entry == nil || entry.Position != 20 {
+		t.Fatalf("progress saved after reloading should be written, got %+v", entry)
+	}
+}
+
+func TestSaveProgressCoalescesWritesUntilFlush(t *testing.T) {
+	dataDir := t.TempDir()
+	progressService := NewProgressService(dataDir)
+	progressPath := filepath.Join(dataDir, "progress.json")
+	readPosition := func(path string) int {
+		t.Helper()
+		reloaded := NewProgressService(filepath.Dir(path))
+		reloaded.load()
+		if entry := reloaded.GetProgress("/books/a.txt"); entry != nil {
+			return entry.Position
+		}
+		return -1
+	}
+
+	for position := 1; position <= 50; position++ {
+		progressService.SaveProgress("/books/a.txt", 0, position, 0.5)
+	}
+	if _, err := os.Stat(progressPath); !os.IsNotExist(err) || !progressService.IsDirty() {
+		t.Fatalf("progress updates should stay in memory until flushed, stat error: %v", err)
+	}
+	if entry := progressService.GetProgress("/books/a.txt"); entry == nil || entry.Position != 50 {
+		t.Fatalf("GetProgress should see the latest unsaved position, got %+v", entry)
+	}
+
+	// 关书时写盘，多次更新只写一次，不产生备份
+	novelService := NewNovelService(progressService)
+	if err := novelService.CloseNovel("/books/a.txt"); err != nil {
+		t.Fatalf("CloseNovel returned error: %v", err)
+	}
+	if progressService.IsDirty() || readPosition(progressPath) != 50 {
+		t.Fatalf("CloseNovel should flush pending progress")
+	}
+	if backups, _ := filepath.Glob(progressPath + ".bak*"); len(backups) != 0 {
+		t.Fatalf("coalesced updates should be written once, got backups %v", backups)
+	}
+
+	// 到时间后自动写盘
+	progressService.SaveProgress("/books/a.txt", 0, 60, 0.6)
+	deadline := time.Now().Add(progressFlushInterval + 5*time.Second)
+	for progressService.IsDirty() && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if progressService.IsDirty() || readPosition(progressPath) != 60 {
+		t.Fatalf("pending progress should be flushed after %s", progressFlushInterval)
+	}
+
+	// 切换数据目录前把待写进度写入原目录，退出时写入新目录
+	progressService.SaveProgress("/books/a.txt", 0, 70, 0.7)
+	nextDir := t.TempDir()
+	if err := progressService.SetDataDir(nextDir); err != nil {
+		t.Fatalf("SetDataDir returned error: %v", err)
+	}
+	if readPosition(progressPath) != 70 || readPosition(filepath.Join(nextDir, "progress.json")) != 70 {
+		t.Fatalf("SetDataDir should flush pending progress before switching")
+	}
+	progressService.SaveProgress("/books/a.txt", 0, 80, 0.8)
+	progressService.Cleanup()
+	if readPosition(filepath.Join(nextDir, "progress.json")) != 80 {
+		t.Fatalf("Cleanup should flush pending progress")
+	}
+}
+
+func TestCloseNovelReportsProgressFlushFailure(t *testing.T) {
+	// 数据目录落在普通文件下面，建不出目录也写不了进度
+	blocker := filepath.Join(t.TempDir(), "blocker")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatalf("write blocker file: %v", err)
+	}
+	progressService := NewProgressService(filepath.Join(blocker, "data"))
+	novelService := NewNovelService(progressService)
+	progressService.SaveProgress("/books/a.txt", 0, 50, 0.5)
+
+	err := novelService.CloseNovel("/books/a.txt")
+	if err == nil || !strings.Contains(err.Error(), "保存阅读进度失败") {
+		t.Fatalf("CloseNovel should report the failed flush, got %v", err)
+	}
+	if !progressService.IsDirty() {
+		t.Fatalf("progress that failed to save should stay pending")
+	}
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// 模糊搜索：按编辑距离查找拼写相近的西文单词，便于找回记不清拼法的人名、地名。
+
+// findFuzzyMatches 检索词按单词切分，正文中连续同样数量的单词逐个比较，
+// 每个词的编辑距离（插入、删除、替换及相邻字母对调各计 1）不超过按词长允许的次数
+func findFuzzyMatches(content, keyword string, caseSensitive bool, limit int) [][]int {
+	fold := func(text string) []rune {
+		if !caseSensitive {
+			text = strings.ToLower(text)
+		}
+		return []rune(text)
+	}
+
+	var queryWords [][]rune
+	for _, span := range searchWordSpans(keyword) {
+		queryWords = append(queryWords, fold(keyword[span[0]:span[1]]))
+	}
+	if len(queryWords) == 0 {
+		return nil
+	}
+
+	words := searchWordSpans(content)
+	var matches [][]int
+	for index := 0; index+len(queryWords) <= len(words); {
+		matched := true
+		for offset, queryWord := range queryWords {
+			span := words[index+offset]
+			text := content[span[0]:span[1]]
+			maxEdits := fuzzyMaxEdits(len(queryWord))
+			if absInt(utf8.RuneCountInString(text)-len(queryWord)) > maxEdits ||
+				fuzzyEditDistance(fold(text), queryWord, maxEdits) > maxEdits {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			index++
+			continue
+		}
+
+		matches = append(matches, []int{words[index][0], words[index+len(queryWords)-1][1]})
+		if limit > 0 && len(matches) >= limit {
+			break
+		}
+		index += len(queryWords)
+	}
+	return matches
+}
+
+// searchWordSpans 文本中由字母、数字组成的单词的字节区间；中日文不以空格分词，不计入单词
+func searchWordSpans(text string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for index, char := range text {
+		if isSearchWordRune(char) {
+			if start < 0 {
+				start = index
+			}
+			continue
+		}
+		if start >= 0 {
+			spans = append(spans, [2]int{start, index})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+	return spans
+}
+
+// fuzzyMaxEdits 按词长允许的编辑次数：两个字母以内须完全一致，较长的词允许更多拼写差异
+func fuzzyMaxEdits(length int) int {
+	switch {
+	case length <= 2:
+		return 0
+	case length <= 5:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// fuzzyEditDistance 计算两个词的编辑距离（相邻字母对调计 1），超过 maxEdits 时提前返回 maxEdits+1
+func fuzzyEditDistance(left, right []rune, maxEdits int) int {
+	previous2 := make([]int, len(right)+1)
+	previous := make([]int, len(right)+1)
+	current := make([]int, len(right)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(left); i++ {
+		current[0] = i
+		rowMin := current[0]
+		for j := 1; j <= len(right); j++ {
+			cost := 1
+			if left[i-1] == right[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			if i > 1 && j > 1 && left[i-1] == right[j-2] && left[i-2] == right[j-1] {
+				current[j] = min(current[j], previous2[j-2]+1)
+			}
+			rowMin = min(rowMin, current[j])
+		}
+		if rowMin > maxEdits {
+			return maxEdits + 1
+		}
+		previous2, previous, current = previous, current, previous2
+	}
+	return previous[len(right)]
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/nongchen1223/moyureader/backend/models"
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// searchHitClass 高亮元素的公共样式类，第 N 处匹配另带 search-hit-N，便于前端逐个跳转
+const searchHitClass = "search-hit"
+
+// highlightTextNode 参与匹配的文本节点及其在所在文本段中的字节起点
+type highlightTextNode struct {
+	node  *xhtml.Node
+	start int
+}
+
+// highlightSpan 文本节点中需要包裹的一段，index 为匹配序号
+type highlightSpan struct {
+	start, end, index int
+}
+
+// highlightHTML 在 HTML 的文本节点中查找匹配并包裹高亮元素，标签与属性不参与匹配。
+// 同一块级元素内的文本连成一段匹配，匹配跨越 <em>、<span> 等行内元素时按节点拆成几段，各段带相同的序号样式
+func highlightHTML(content string, options models.SearchOptions, highlightTag string) (string, error) {
+	nodes, err := xhtml.ParseFragment(strings.NewReader(content), &xhtml.Node{
+		Type:     xhtml.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	container := &xhtml.Node{Type: xhtml.ElementNode, Data: "body", DataAtom: atom.Body}
+	for _, node := range nodes {
+		container.AppendChild(node)
+	}
+
+	template := parseHighlightTag(highlightTag)
+	spans := make(map[*xhtml.Node][]highlightSpan)
+	count := 0
+	var runErr error
+	for _, run := range collectHighlightRuns(container) {
+		var text strings.Builder
+		for _, item := range run {
+			text.WriteString(item.node.Data)
+		}
+
+		runOptions := options
+		if options.MaxResults > 0 {
+			if count >= options.MaxResults {
+				break
+			}
+			runOptions.MaxResults = options.MaxResults - count
+		}
+		matches, err := findSearchMatches(text.String(), runOptions)
+		if err != nil {
+			runErr = err
+			break
+		}
+		for _, match := range matches {
+			if match[0] == match[1] {
+				continue
+			}
+			for _, item := range run {
+				start := max(match[0], item.start) - item.start
+				end := min(match[1], item.start+len(item.node.Data)) - item.start
+				if start < end {
+					spans[item.node] = append(spans[item.node], highlightSpan{start: start, end: end, index: count})
+				}
+			}
+			count++
+		}
+	}
+	if runErr != nil {
+		return "", runErr
+	}
+
+	for node, nodeSpans := range spans {
+		splitHighlightTextNode(node, nodeSpans, template)
+	}
+
+	var builder strings.Builder
+	for child := container.FirstChild; child != nil; child = child.NextSibling {
+		if err := xhtml.Render(&builder, child); err != nil {
+			return "", err
+		}
+	}
+	return builder.String(), nil
+}
+
+// collectHighlightRuns 按块级边界把文本节点分段；脚本、样式中的文本不参与匹配
+func collectHighlightRuns(root *xhtml.Node) [][]highlightTextNode {
+	var runs [][]highlightTextNode
+	var current []highlightTextNode
+	length := 0
+	flush := func() {
+		if len(current) > 0 {
+			runs = append(runs, current)
+		}
+		current = nil
+		length = 0
+	}
+
+	var walk func(node *xhtml.Node)
+	walk = func(node *xhtml.Node) {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			switch child.Type {
+			case xhtml.TextNode:
+				if child.Data != "" {
+					current = append(current, highlightTextNode{node: child, start: length})
+					length += len(child.Data)
+				}
+			case xhtml.ElementNode:
+				switch child.DataAtom {
+				case atom.Script, atom.Style, atom.Textarea, atom.Title:
+					continue
+				}
+				inline := isHighlightInlineElement(child)
+				if !inline {
+					flush()
+				}
+				walk(child)
+				if !inline {
+					flush()
+				}
+			}
+		}
+	}
+	walk(root)
+	flush()
+	return runs
+}
+
+func isHighlightInlineElement(node *xhtml.Node) bool {
+	switch node.Data {
+	case "a", "abbr", "b", "bdi", "bdo", "cite", "code", "data", "dfn", "em", "font", "i", "kbd", "mark",
+		"q", "ruby", "rb", "s", "samp", "small", "span", "strike", "strong", "sub", "sup", "time", "tt", "u", "var":
+		return true
+	default:
+		return false
+	}
+}
+
+// splitHighlightTextNode 把文本节点拆成普通文本与高亮元素，spans 按位置排列且互不重叠
+func splitHighlightTextNode(node *xhtml.Node, spans []highlightSpan, template *xhtml.Node) {
+	parent := node.Parent
+	text := node.Data
+	offset := 0
+	for _, span := range spans {
+		if span.start > offset {
+			parent.InsertBefore(&xhtml.Node{Type: xhtml.TextNode, Data: text[offset:span.start]}, node)
+		}
+		mark := newHighlightElement(template, span.index)
+		mark.AppendChild(&xhtml.Node{Type: xhtml.TextNode, Data: text[span.start:span.end]})
+		parent.InsertBefore(mark, node)
+		offset = span.end
+	}
+	if offset < len(text) {
+		parent.InsertBefore(&xhtml.Node{Type: xhtml.TextNode, Data: text[offset:]}, node)
+	}
+	parent.RemoveChild(node)
+}
+
+// parseHighlightTag 解析调用方给出的开始标签（如 `<mark>`、`<span class="hl">`），无法解析时使用 <mark>
+func parseHighlightTag(highlightTag string) *xhtml.Node {
+	nodes, err := xhtml.ParseFragment(strings.NewReader(strings.TrimSpace(highlightTag)), &xhtml.Node{
+		Type:     xhtml.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+	if err == nil && len(nodes) > 0 && nodes[0].Type == xhtml.ElementNode {
+		return &xhtml.Node{Type: xhtml.ElementNode, Data: nodes[0].Data, DataAtom: nodes[0].DataAtom, Attr: nodes[0].Attr}
+	}
+	return &xhtml.Node{Type: xhtml.ElementNode, Data: "mark", DataAtom: atom.Mark}
+}
+
+// newHighlightElement 按模板创建第 index 处匹配的高亮元素，在原有样式类后追加 search-hit 与 search-hit-N
+func newHighlightElement(template *xhtml.Node, index int) *xhtml.Node {
+	classes := searchHitClass + " " + searchHitClass + "-" + strconv.Itoa(index)
+	attrs := make([]xhtml.Attribute, 0, len(template.Attr)+2)
+	hasClass := false
+	for _, attr := range template.Attr {
+		if attr.Namespace == "" && attr.Key == "class" {
+			attr.Val = strings.TrimSpace(attr.Val + " " + classes)
+			hasClass = true
+		}
+		attrs = append(attrs, attr)
+	}
+	if !hasClass {
+		attrs = append(attrs, xhtml.Attribute{Key: "class", Val: classes})
+	}
+	attrs = append(attrs, xhtml.Attribute{Key: "data-search-hit", Val: strconv.Itoa(index)})
+
+	return &xhtml.Node{Type: xhtml.ElementNode, Data: template.Data, DataAtom: template.DataAtom, Attr: attrs}
+}
@@ -0,0 +1,322 @@
+package services
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nongchen1223/moyureader/backend/models"
+)
+
+const (
+	searchHistoryFileName = "search_history.json"
+	// searchHistoryLimit 每本书保留的未置顶搜索历史条数，超出时淘汰最久未用的
+	searchHistoryLimit = 20
+)
+
+// searchHistoryData 搜索历史文件数据结构
+type searchHistoryData struct {
+	// Books 按文件路径记录的每本书最近的搜索
+	Books map[string][]models.SearchHistoryEntry `json:"books"`
+	// Saved 收藏的搜索，不区分书籍
+	Saved []models.SearchHistoryEntry `json:"saved"`
+}
+
+// searchHistory 搜索历史与收藏的搜索，存放在数据目录下与 progress.json 并列的 search_history.json
+type searchHistory struct {
+	mu       sync.Mutex
+	filePath string
+	loaded   bool
+	data     searchHistoryData
+}
+
+func newSearchHistory(dataDir string) *searchHistory {
+	return &searchHistory{filePath: filepath.Join(dataDir, searchHistoryFileName)}
+}
+
+// ensureLoaded 首次使用时读取历史文件，文件不存在或损坏时从空记录开始
+func (h *searchHistory) ensureLoaded() {
+	if h.loaded {
+		return
+	}
+	h.loaded = true
+	h.data = searchHistoryData{}
+
+	data, err := os.ReadFile(h.filePath)
+	if err == nil {
+		if err := json.Unmarshal(data, &h.data); err != nil {
+			h.data = searchHistoryData{}
+		}
+	}
+	if h.data.Books == nil {
+		h.data.Books = make(map[string][]models.SearchHistoryEntry)
+	}
+}
+
+func (h *searchHistory) saveLocked() error {
+	if err := os.MkdirAll(filepath.Dir(h.filePath), 0755); err != nil {
+		return fmt.Errorf("创建数据目录失败: %w", err)
+	}
+
+	data, err := json.MarshalIndent(h.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化搜索历史失败: %w", err)
+	}
+	if err := writeFileAtomic(h.filePath, data, 0644); err != nil {
+		return fmt.Errorf("写入搜索历史失败: %w", err)
+	}
+	return nil
+}
+
+// setDataDir 切换存储目录；新目录已有历史文件时读取它，否则把当前记录写过去
+func (h *searchHistory) setDataDir(dataDir string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	nextFilePath := filepath.Join(dataDir, searchHistoryFileName)
+	if nextFilePath == h.filePath {
+		return nil
+	}
+
+	h.ensureLoaded()
+	current := h.data
+	h.filePath = nextFilePath
+	h.loaded = false
+	if _, err := os.Stat(nextFilePath); err == nil {
+		h.ensureLoaded()
+		return nil
+	}
+
+	h.loaded = true
+	h.data = current
+	return h.saveLocked()
+}
+
+// record 记录一次书内搜索：同样的搜索移到最前并更新命中数，收藏中的同一搜索也一并更新
+func (h *searchHistory) record(filePath string, options models.SearchOptions, hitCount int) (models.SearchHistoryEntry, error) {
+	entry, err := newSearchHistoryEntry(options, hitCount)
+	if err != nil {
+		return entry, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ensureLoaded()
+
+	entries := h.data.Books[filePath]
+	if index := findSearchHistoryEntry(entries, entry.ID); index >= 0 {
+		entry.Pinned = entries[index].Pinned
+		entries = append(entries[:index], entries[index+1:]...)
+	}
+	entries = append([]models.SearchHistoryEntry{entry}, entries...)
+	h.data.Books[filePath] = trimSearchHistory(entries)
+
+	if index := findSearchHistoryEntry(h.data.Saved, entry.ID); index >= 0 {
+		h.data.Saved[index].HitCount = entry.HitCount
+		h.data.Saved[index].LastUsed = entry.LastUsed
+	}
+	return entry, h.saveLocked()
+}
+
+// save 收藏一个搜索，已收藏时更新命中数与使用时间
+func (h *searchHistory) save(options models.SearchOptions, hitCount int) (models.SearchHistoryEntry, error) {
+	entry, err := newSearchHistoryEntry(options, hitCount)
+	if err != nil {
+		return entry, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ensureLoaded()
+
+	if index := findSearchHistoryEntry(h.data.Saved, entry.ID); index >= 0 {
+		entry.Pinned = h.data.Saved[index].Pinned
+		h.data.Saved[index] = entry
+	} else {
+		h.data.Saved = append(h.data.Saved, entry)
+	}
+	return entry, h.saveLocked()
+}
+
+// list 返回一本书的搜索历史，saved 为 true 时返回收藏的搜索；置顶的在前，其余按最近使用排列
+func (h *searchHistory) list(filePath string, saved bool) []models.SearchHistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ensureLoaded()
+
+	source := h.data.Books[filePath]
+	if saved {
+		source = h.data.Saved
+	}
+	entries := append([]models.SearchHistoryEntry{}, source...)
+	sortSearchHistory(entries)
+	return entries
+}
+
+// update 修改或删除一条记录；saved 为 true 时操作收藏的搜索，change 返回 false 表示删除
+func (h *searchHistory) update(filePath string, saved bool, id string, change func(entry *models.SearchHistoryEntry) bool) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ensureLoaded()
+
+	entries := h.data.Books[filePath]
+	if saved {
+		entries = h.data.Saved
+	}
+	index := findSearchHistoryEntry(entries, id)
+	if index < 0 {
+		return fmt.Errorf("搜索记录不存在: %s", id)
+	}
+	if !change(&entries[index]) {
+		entries = append(entries[:index], entries[index+1:]...)
+	}
+
+	switch {
+	case saved:
+		h.data.Saved = entries
+	case len(entries) == 0:
+		delete(h.data.Books, filePath)
+	default:
+		h.data.Books[filePath] = trimSearchHistory(entries)
+	}
+	return h.saveLocked()
+}
+
+// clear 清空一本书的搜索历史，置顶的记录保留
+func (h *searchHistory) clear(filePath string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ensureLoaded()
+
+	var pinned []models.SearchHistoryEntry
+	for _, entry := range h.data.Books[filePath] {
+		if entry.Pinned {
+			pinned = append(pinned, entry)
+		}
+	}
+	if len(pinned) == 0 {
+		delete(h.data.Books, filePath)
+	} else {
+		h.data.Books[filePath] = pinned
+	}
+	return h.saveLocked()
+}
+
+func newSearchHistoryEntry(options models.SearchOptions, hitCount int) (models.SearchHistoryEntry, error) {
+	if strings.TrimSpace(options.Keyword) == "" {
+		return models.SearchHistoryEntry{}, fmt.Errorf("检索词为空")
+	}
+
+	return models.SearchHistoryEntry{
+		ID:            searchHistoryID(options),
+		Keyword:       options.Keyword,
+		Mode:          options.Mode,
+		CaseSensitive: options.CaseSensitive,
+		HitCount:      max(hitCount, 0),
+		LastUsed:      time.Now().Unix(),
+	}, nil
+}
+
+// searchHistoryID 由检索词、匹配方式与大小写选项生成的稳定 ID
+func searchHistoryID(options models.SearchOptions) string {
+	mode := options.Mode
+	if mode == models.SearchModeLiteral {
+		mode = ""
+	}
+	sum := sha1.Sum([]byte(mode + "\x00" + strconv.FormatBool(options.CaseSensitive) + "\x00" + options.Keyword))
+	return hex.EncodeToString(sum[:8])
+}
+
+func findSearchHistoryEntry(entries []models.SearchHistoryEntry, id string) int {
+	for index, entry := range entries {
+		if entry.ID == id {
+			return index
+		}
+	}
+	return -1
+}
+
+// trimSearchHistory 保留全部置顶记录与最近使用的 searchHistoryLimit 条其他记录
+func trimSearchHistory(entries []models.SearchHistoryEntry) []models.SearchHistoryEntry {
+	sortSearchHistory(entries)
+	kept := entries[:0]
+	unpinned := 0
+	for _, entry := range entries {
+		if !entry.Pinned {
+			if unpinned >= searchHistoryLimit {
+				continue
+			}
+			unpinned++
+		}
+		kept = append(kept, entry)
+	}
+	return kept
+}
+
+func sortSearchHistory(entries []models.SearchHistoryEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Pinned != entries[j].Pinned {
+			return entries[i].Pinned
+		}
+		return entries[i].LastUsed > entries[j].LastUsed
+	})
+}
+
+// RecordSearch 记录一次书内搜索及其命中数，供下次打开时快速重搜
+func (s *SearchService) RecordSearch(filePath string, options models.SearchOptions, hitCount int) (models.SearchHistoryEntry, error) {
+	return s.history.record(filePath, options, hitCount)
+}
+
+// GetSearchHistory 获取一本书最近的搜索，置顶的在前
+func (s *SearchService) GetSearchHistory(filePath string) []models.SearchHistoryEntry {
+	return s.history.list(filePath, false)
+}
+
+// DeleteSearchHistory 删除一本书的一条搜索历史
+func (s *SearchService) DeleteSearchHistory(filePath, id string) error {
+	return s.history.update(filePath, false, id, func(*models.SearchHistoryEntry) bool { return false })
+}
+
+// ClearSearchHistory 清空一本书未置顶的搜索历史
+func (s *SearchService) ClearSearchHistory(filePath string) error {
+	return s.history.clear(filePath)
+}
+
+// PinSearchHistory 置顶或取消置顶一条搜索历史
+func (s *SearchService) PinSearchHistory(filePath, id string, pinned bool) error {
+	return s.history.update(filePath, false, id, func(entry *models.SearchHistoryEntry) bool {
+		entry.Pinned = pinned
+		return true
+	})
+}
+
+// SaveSearch 收藏一个搜索，所有书共用
+func (s *SearchService) SaveSearch(options models.SearchOptions, hitCount int) (models.SearchHistoryEntry, error) {
+	return s.history.save(options, hitCount)
+}
+
+// GetSavedSearches 获取收藏的搜索，置顶的在前
+func (s *SearchService) GetSavedSearches() []models.SearchHistoryEntry {
+	return s.history.list("", true)
+}
+
+// DeleteSavedSearch 删除一个收藏的搜索
+func (s *SearchService) DeleteSavedSearch(id string) error {
+	return s.history.update("", true, id, func(*models.SearchHistoryEntry) bool { return false })
+}
+
+// PinSavedSearch 置顶或取消置顶一个收藏的搜索
+func (s *SearchService) PinSavedSearch(id string, pinned bool) error {
+	return s.history.update("", true, id, func(entry *models.SearchHistoryEntry) bool {
+		entry.Pinned = pinned
+		return true
+	})
+}
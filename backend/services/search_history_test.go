@@ -0,0 +1,112 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nongchen1223/moyureader/backend/models"
+)
+
+func TestSearchHistoryRecordsPinsAndPersists(t *testing.T) {
+	dataDir := t.TempDir()
+	service := NewSearchService(NewProgressService(dataDir))
+	bookPath := filepath.Join(dataDir, "book.txt")
+
+	for index := 0; index < searchHistoryLimit+2; index++ {
+		if _, err := service.RecordSearch(bookPath, models.SearchOptions{Keyword: fmt.Sprintf("角色%d", index)}, index); err != nil {
+			t.Fatalf("RecordSearch returned error: %v", err)
+		}
+	}
+	history := service.GetSearchHistory(bookPath)
+	if len(history) != searchHistoryLimit || history[0].Keyword != fmt.Sprintf("角色%d", searchHistoryLimit+1) {
+		t.Fatalf("history should keep the %d most recent queries, got %+v", searchHistoryLimit, history)
+	}
+
+	// 置顶的记录排在最前，不会被淘汰；再次搜索时更新命中数
+	oldest := history[len(history)-1]
+	if err := service.PinSearchHistory(bookPath, oldest.ID, true); err != nil {
+		t.Fatalf("PinSearchHistory returned error: %v", err)
+	}
+	for index := 0; index < searchHistoryLimit; index++ {
+		service.RecordSearch(bookPath, models.SearchOptions{Keyword: fmt.Sprintf("地名%d", index)}, 1)
+	}
+	entry, err := service.RecordSearch(bookPath, models.SearchOptions{Keyword: oldest.Keyword}, 42)
+	if err != nil || entry.ID != oldest.ID || !entry.Pinned {
+		t.Fatalf("RecordSearch should keep the pinned entry, got %+v, %v", entry, err)
+	}
+	history = service.GetSearchHistory(bookPath)
+	if len(history) != searchHistoryLimit+1 || history[0].ID != oldest.ID || history[0].HitCount != 42 {
+		t.Fatalf("pinned entry should stay first with the new hit count, got %+v", history[:2])
+	}
+	if err := service.DeleteSearchHistory(bookPath, history[1].ID); err != nil {
+		t.Fatalf("DeleteSearchHistory returned error: %v", err)
+	}
+	if err := service.DeleteSearchHistory(bookPath, "missing"); err == nil {
+		t.Fatalf("deleting an unknown entry should fail")
+	}
+
+	regexSearch := models.SearchOptions{Keyword: `林潇宇|潇宇`, Mode: models.SearchModeRegex}
+	saved, err := service.SaveSearch(regexSearch, 3)
+	if err != nil {
+		t.Fatalf("SaveSearch returned error: %v", err)
+	}
+	service.SaveSearch(models.SearchOptions{Keyword: "lxy", Mode: models.SearchModePinyin}, 5)
+	service.PinSavedSearch(saved.ID, true)
+	service.RecordSearch(filepath.Join(dataDir, "other.txt"), regexSearch, 8)
+	savedSearches := service.GetSavedSearches()
+	if len(savedSearches) != 2 || savedSearches[0].ID != saved.ID || savedSearches[0].HitCount != 8 ||
+		savedSearches[0].Mode != models.SearchModeRegex {
+		t.Fatalf("saved searches should be pinned first and track the last hit count, got %+v", savedSearches)
+	}
+
+	// 历史记在数据目录下，切换目录时带到新目录
+	if _, err := os.Stat(filepath.Join(dataDir, searchHistoryFileName)); err != nil {
+		t.Fatalf("search history should be saved next to progress.json: %v", err)
+	}
+	reloaded := NewSearchService(NewProgressService(dataDir))
+	if len(reloaded.GetSearchHistory(bookPath)) != searchHistoryLimit || len(reloaded.GetSavedSearches()) != 2 {
+		t.Fatalf("search history was not reloaded from disk")
+	}
+	nextDir := t.TempDir()
+	if err := reloaded.SetDataDir(nextDir); err != nil {
+		t.Fatalf("SetDataDir returned error: %v", err)
+	}
+	if err := reloaded.DeleteSavedSearch(saved.ID); err != nil {
+		t.Fatalf("DeleteSavedSearch returned error: %v", err)
+	}
+	moved := NewSearchService(NewProgressService(nextDir))
+	if len(moved.GetSearchHistory(bookPath)) != searchHistoryLimit || len(moved.GetSavedSearches()) != 1 {
+		t.Fatalf("search history should move to the new data dir")
+	}
+}
+
+func TestSearchHistorySaveReplacesInsteadOfOverwriting(t *testing.T) {
+	dataDir := t.TempDir()
+	history := newSearchHistory(dataDir)
+	bookPath := filepath.Join(dataDir, "book.txt")
+	if _, err := history.record(bookPath, models.SearchOptions{Keyword: "灯笼"}, 1); err != nil {
+		t.Fatalf("record returned error: %v", err)
+	}
+	// 原地覆盖写入会改动同一个文件，硬链接能看出旧文件是否被改写
+	keptPath := history.filePath + ".kept"
+	if err := os.Link(history.filePath, keptPath); err != nil {
+		t.Skipf("hard links unsupported: %v", err)
+	}
+
+	if _, err := history.record(bookPath, models.SearchOptions{Keyword: "月亮"}, 2); err != nil {
+		t.Fatalf("record returned error: %v", err)
+	}
+	kept := newSearchHistory(dataDir)
+	kept.filePath = keptPath
+	if entries := kept.list(bookPath, false); len(entries) != 1 || entries[0].Keyword != "灯笼" {
+		t.Fatalf("expected the previous file to stay intact, got %+v", entries)
+	}
+	if entries := newSearchHistory(dataDir).list(bookPath, false); len(entries) != 2 || entries[0].Keyword != "月亮" {
+		t.Fatalf("expected the new history to be in place, got %+v", entries)
+	}
+	if leftovers, _ := filepath.Glob(history.filePath + ".tmp-*"); len(leftovers) != 0 {
+		t.Fatalf("expected no temp files to be left behind, got %v", leftovers)
+	}
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nongchen1223/moyureader/backend/models"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// searchChunkBytes 搜索任务每批处理的正文长度，分块在换行处切开
+const searchChunkBytes = 256 * 1024
+
+// StartSearch 在指定小说中启动搜索任务并返回任务 ID。结果按批通过 search:batch 事件推送，
+// 进度通过 search:progress 事件推送；开始新任务时会取消之前未完成的任务。
+// 正文按行分块搜索，跨越分块处换行的匹配（如含 \n 的正则）可能漏掉
+func (s *NovelService) StartSearch(filePath string, options models.SearchOptions) (string, error) {
+	novel, exists := s.novels[filePath]
+	if !exists || novel == nil {
+		return "", fmt.Errorf("小说未打开")
+	}
+	if err := validateSearchOptions(options); err != nil {
+		return "", err
+	}
+	// 任务在后台运行，期间正文与章节可能被重新切分或替换，启动时取一份快照
+	source := searchJobSource{
+		content:     novel.Content,
+		offsets:     s.novelTextOffsets(filePath, novel),
+		chapters:    novel.Chapters,
+		pageOffsets: novel.PageOffsets,
+	}
+
+	// 用户输入了新的关键字，之前的任务结果已无用
+	s.cancelSearchJobs()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.searchMu.Lock()
+	s.searchSeq++
+	jobID := fmt.Sprintf("search-%d", s.searchSeq)
+	s.searchJobs[jobID] = cancel
+	s.searchMu.Unlock()
+
+	go s.runSearchJob(ctx, jobID, source, options)
+	return jobID, nil
+}
+
+// CancelSearch 取消搜索任务，任务已结束时忽略
+func (s *NovelService) CancelSearch(jobID string) {
+	s.searchMu.Lock()
+	cancel, exists := s.searchJobs[jobID]
+	delete(s.searchJobs, jobID)
+	s.searchMu.Unlock()
+
+	if exists {
+		cancel()
+	}
+}
+
+func (s *NovelService) cancelSearchJobs() {
+	s.searchMu.Lock()
+	defer s.searchMu.Unlock()
+
+	for jobID, cancel := range s.searchJobs {
+		cancel()
+		delete(s.searchJobs, jobID)
+	}
+}
+
+// searchJobSource 启动搜索任务时的正文、位置对照表、章节与页码快照，任务只读这些数据
+type searchJobSource struct {
+	content     string
+	offsets     *textOffsets
+	chapters    []models.Chapter
+	pageOffsets []int
+}
+
+// runSearchJob 逐块搜索正文，每块的结果补充章节信息后推送，取消后推送一次已取消的进度并退出
+func (s *NovelService) runSearchJob(ctx context.Context, jobID string, source searchJobSource, options models.SearchOptions) {
+	defer s.CancelSearch(jobID)
+
+	content := source.content
+	progress := models.SearchProgress{JobID: jobID}
+	for from := 0; from < len(content) && ctx.Err() == nil; {
+		to := nextSearchChunkEnd(content, from)
+		chunkOptions := options
+		if options.MaxResults > 0 {
+			chunkOptions.MaxResults = options.MaxResults - progress.Count
+		}
+		results, err := searchTextRange(content, source.offsets, from, to, chunkOptions)
+		if err != nil {
+			progress.Done = true
+			progress.Error = err.Error()
+			s.emit("search:progress", progress)
+			return
+		}
+		from = to
+		if ctx.Err() != nil {
+			break
+		}
+
+		if len(results) > 0 {
+			annotateNovelSearchResults(results, source.chapters, source.pageOffsets)
+			s.emit("search:batch", models.SearchBatch{JobID: jobID, Results: results})
+			progress.Count += len(results)
+		}
+		if options.MaxResults > 0 && progress.Count >= options.MaxResults {
+			break
+		}
+		if from < len(content) {
+			progress.Progress = float64(from) * 100 / float64(len(content))
+			s.emit("search:progress", progress)
+		}
+	}
+
+	// 取消可能发生在搜索最后一段期间，循环结束后再确认一次
+	if ctx.Err() != nil {
+		progress.Done = true
+		progress.Cancelled = true
+		s.emit("search:progress", progress)
+		return
+	}
+
+	progress.Progress = 100
+	progress.Done = true
+	s.emit("search:progress", progress)
+}
+
+// nextSearchChunkEnd 从 from 起约 searchChunkBytes 字节处的下一个行尾
+func nextSearchChunkEnd(content string, from int) int {
+	end := from + searchChunkBytes
+	if end >= len(content) {
+		return len(content)
+	}
+	lineEnd := strings.IndexByte(content[end:], '\n')
+	if lineEnd < 0 {
+		return len(content)
+	}
+	return end + lineEnd + 1
+}
+
+// validateSearchOptions 启动任务前检查匹配方式与正则表达式，错误直接返回给调用方
+func validateSearchOptions(options models.SearchOptions) error {
+	switch options.Mode {
+	case models.SearchModePinyin, models.SearchModeFuzzy:
+		return nil
+	}
+	_, err := compileSearchPattern(options)
+	return err
+}
+
+// emit 推送事件给前端
+func (s *NovelService) emit(name string, data interface{}) {
+	if s.emitEvent != nil {
+		s.emitEvent(name, data)
+		return
+	}
+	if s.ctx != nil {
+		runtime.EventsEmit(s.ctx, name, data)
+	}
+}
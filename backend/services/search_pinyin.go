@@ -0,0 +1,169 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 拼音搜索：按读音查找汉字。检索词中每个字的拼音可以是全拼，也可以只是开头几个字母，
+// 如 "lxy"、"linxy"、"linxiaoyu" 都能找到"林潇宇"；检索词中的汉字与其他字符按原样匹配。
+
+// pinyinPolyphones 常用多音字在 pinyinSyllableChars 之外的读音，多个读音以空格分隔
+var pinyinPolyphones = map[rune]string{
+	'长': "chang", '重': "chong", '行': "hang", '乐': "yue", '还': "huan", '了': "liao",
+	'的': "di", '得': "dei", '大': "dai", '朝': "zhao", '觉': "jiao", '降': "xiang",
+	'曾': "zeng", '单': "shan chan", '解': "xie", '藏': "zang", '传': "zhuan", '调': "tiao",
+	'都': "du", '和': "huo hu", '会': "kuai", '角': "jue", '给': "ji", '区': "ou",
+	'仇': "qiu", '柏': "bo", '沈': "chen", '尉': "yu", '翟': "zhai", '查': "zha",
+	'朴': "piao po", '盖': "ge", '万': "mo", '折': "she", '参': "shen cen", '率': "shuai",
+	'薄': "bo", '差': "chai ci", '模': "mu", '似': "si", '省': "xing", '宿': "xiu",
+	'数': "shuo", '弹': "tan", '着': "zhao zhuo", '便': "pian", '血': "xie", '露': "lou",
+	'吓': "he", '将': "qiang", '强': "jiang", '奇': "ji", '系': "ji", '种': "chong",
+	'期': "ji", '落': "la lao", '阿': "e", '识': "zhi", '没': "mo", '恶': "wu",
+	'厦': "xia", '称': "chen", '度': "duo", '屏': "bing", '色': "shai", '什': "shi",
+	'刹': "cha", '属': "zhu", '说': "shui", '吁': "yu", '咽': "ye", '择': "zhai",
+	'扎': "za", '粘': "nian", '乘': "sheng", '盛': "cheng", '膀': "pang", '拗': "niu",
+	'贾': "gu", '叶': "xie", '石': "dan", '秘': "bi", '莎': "suo", '茄': "qie",
+	'哪': "nei", '那': "nei", '谁': "shui", '尾': "yi", '拓': "tuo", '般': "pan bo",
+	'咖': "ga", '乾': "gan", '殷': "yan", '番': "pan",
+}
+
+var (
+	pinyinReadingsOnce sync.Once
+	pinyinReadings     map[rune][]string
+)
+
+// pinyinReadingsOf 汉字的全部读音（不带声调），ü 既可写作 v 也可写作 u；不在表中时返回空
+func pinyinReadingsOf(char rune) []string {
+	pinyinReadingsOnce.Do(buildPinyinReadings)
+	return pinyinReadings[char]
+}
+
+func buildPinyinReadings() {
+	pinyinReadings = make(map[rune][]string, 21000)
+	add := func(char rune, syllable string) {
+		for _, reading := range pinyinReadings[char] {
+			if reading == syllable {
+				return
+			}
+		}
+		pinyinReadings[char] = append(pinyinReadings[char], syllable)
+	}
+
+	for syllable, chars := range pinyinSyllableChars {
+		for _, char := range chars {
+			add(char, syllable)
+		}
+	}
+	for char, syllables := range pinyinPolyphones {
+		for _, syllable := range strings.Fields(syllables) {
+			add(char, syllable)
+		}
+	}
+	for char, readings := range pinyinReadings {
+		for _, reading := range readings {
+			if strings.Contains(reading, "v") {
+				add(char, strings.ReplaceAll(reading, "v", "u"))
+			}
+		}
+		// 读音顺序固定，匹配结果才稳定；先试较长的读音
+		readings = pinyinReadings[char]
+		sort.Slice(readings, func(i, j int) bool {
+			if len(readings[i]) != len(readings[j]) {
+				return len(readings[i]) > len(readings[j])
+			}
+			return readings[i] < readings[j]
+		})
+	}
+}
+
+// normalizePinyinQuery 去掉检索词中的空白与隔音符并转为小写
+func normalizePinyinQuery(keyword string) string {
+	return strings.Map(func(char rune) rune {
+		if unicode.IsSpace(char) || char == '\'' || char == '’' {
+			return -1
+		}
+		return unicode.ToLower(char)
+	}, keyword)
+}
+
+// pinyinMatcher 在正文中逐字匹配拼音检索词
+type pinyinMatcher struct {
+	content string
+	query   string
+	// failed 正文各位置上已确认无法匹配的检索词位置（按位记录前 64 个），结果与匹配起点无关，可跨起点复用
+	failed map[int]uint64
+}
+
+// findPinyinMatches 查找读音与检索词相符的连续文字，匹配须从汉字开始并恰好用完整个检索词
+func findPinyinMatches(content, keyword string, limit int) [][]int {
+	matcher := &pinyinMatcher{
+		content: content,
+		query:   normalizePinyinQuery(keyword),
+		failed:  make(map[int]uint64),
+	}
+	if matcher.query == "" {
+		return nil
+	}
+
+	var matches [][]int
+	for start := 0; start < len(content); {
+		char, size := utf8.DecodeRuneInString(content[start:])
+		if unicode.Is(unicode.Han, char) {
+			if end, ok := matcher.matchAt(start, 0); ok {
+				matches = append(matches, []int{start, end})
+				if limit > 0 && len(matches) >= limit {
+					break
+				}
+				start = end
+				continue
+			}
+		}
+		start += size
+	}
+	return matches
+}
+
+// matchAt 从正文 position 处匹配检索词的 queryOffset 之后部分，返回匹配结束的字节位置。
+// 每个汉字消耗其某个读音的非空前缀，其他字符须与检索词中的字符相同（不区分大小写）
+func (m *pinyinMatcher) matchAt(position, queryOffset int) (int, bool) {
+	if queryOffset == len(m.query) {
+		return position, true
+	}
+	if position >= len(m.content) || queryOffset < 64 && m.failed[position]&(1<<queryOffset) != 0 {
+		return 0, false
+	}
+
+	query := m.query[queryOffset:]
+	char, size := utf8.DecodeRuneInString(m.content[position:])
+	queryChar, querySize := utf8.DecodeRuneInString(query)
+	if unicode.ToLower(char) == queryChar {
+		if end, ok := m.matchAt(position+size, queryOffset+querySize); ok {
+			return end, true
+		}
+	}
+	for _, reading := range pinyinReadingsOf(char) {
+		for length := commonPrefixLength(reading, query); length > 0; length-- {
+			if end, ok := m.matchAt(position+size, queryOffset+length); ok {
+				return end, true
+			}
+		}
+	}
+
+	// 匹配起点只会尝试一次，不必记录
+	if queryOffset > 0 && queryOffset < 64 {
+		m.failed[position] |= 1 << queryOffset
+	}
+	return 0, false
+}
+
+func commonPrefixLength(left, right string) int {
+	length := 0
+	for length < len(left) && length < len(right) && left[length] == right[length] {
+		length++
+	}
+	return length
+}
@@ -2,75 +2,272 @@ package services
 
 import (
 	"context"
-	"strings"
+	"fmt"
+	"regexp"
+	"sort"
+	"unicode"
 	"unicode/utf8"
 
 	"github.com/nongchen1223/moyureader/backend/models"
 )
 
+// searchContextRunes 搜索结果上下文在匹配前后各保留的字符数
+const searchContextRunes = 50
+
 // SearchService 搜索服务
 // 提供全文搜索、关键字高亮等功能
 type SearchService struct {
 	ctx           context.Context
 	searchResults []models.SearchResult // 搜索结果缓存
+	libraryIndex  *libraryIndex         // 书库全文索引
+	history       *searchHistory        // 搜索历史与收藏的搜索
 }
 
-// NewSearchService 创建搜索服务实例
-func NewSearchService() *SearchService {
+// NewSearchService 创建搜索服务实例，书库索引与搜索历史存放在进度服务的数据目录下
+func NewSearchService(progressService *ProgressService) *SearchService {
+	dataDir := resolveProgressDataDir("")
+	if progressService != nil {
+		dataDir = progressService.currentDataDir()
+	}
+
 	return &SearchService{
 		searchResults: []models.SearchResult{},
+		libraryIndex:  newLibraryIndex(dataDir, progressService),
+		history:       newSearchHistory(dataDir),
 	}
 }
 
-func searchInText(content, keyword string, caseSensitive bool) []models.SearchResult {
-	if keyword == "" {
-		return []models.SearchResult{}
+// textOffsetStride 正文 rune 位置对照表的采样间隔（字节）
+const textOffsetStride = 1024
+
+// textOffsets 正文的行首位置与 rune 位置对照表，每本书建一次，搜索命中时不必从头统计
+type textOffsets struct {
+	// lineStarts 每行行首的字节位置
+	lineStarts []int
+	// markBytes、markRunes 约每 textOffsetStride 字节取一个字符边界，记录其字节位置与之前的字符数
+	markBytes []int
+	markRunes []int
+}
+
+func newTextOffsets(content string) *textOffsets {
+	offsets := &textOffsets{
+		lineStarts: []int{0},
+		markBytes:  make([]int, 0, len(content)/textOffsetStride+1),
+		markRunes:  make([]int, 0, len(content)/textOffsetStride+1),
+	}
+	runeCount := 0
+	for index, char := range content {
+		if index >= len(offsets.markBytes)*textOffsetStride {
+			offsets.markBytes = append(offsets.markBytes, index)
+			offsets.markRunes = append(offsets.markRunes, runeCount)
+		}
+		if char == '\n' {
+			offsets.lineStarts = append(offsets.lineStarts, index+1)
+		}
+		runeCount++
 	}
+	return offsets
+}
+
+// runeOffset 字节位置 byteOffset 之前的字符数
+func (o *textOffsets) runeOffset(content string, byteOffset int) int {
+	if len(o.markBytes) == 0 {
+		return 0
+	}
+	mark := min(byteOffset/textOffsetStride, len(o.markBytes)-1)
+	// 采样点在字符边界上，可能比整倍数位置靠后几个字节
+	if mark > 0 && o.markBytes[mark] > byteOffset {
+		mark--
+	}
+	return o.markRunes[mark] + utf8.RuneCountInString(content[o.markBytes[mark]:byteOffset])
+}
+
+// lineNumber 字节位置 byteOffset 所在的行号（从 1 开始）
+func (o *textOffsets) lineNumber(byteOffset int) int {
+	return sort.SearchInts(o.lineStarts, byteOffset+1)
+}
+
+// searchInText 按搜索参数查找全部匹配，位置与长度均按 rune 计
+func searchInText(content string, options models.SearchOptions) ([]models.SearchResult, error) {
+	if options.Keyword == "" {
+		return []models.SearchResult{}, nil
+	}
+	return searchTextRange(content, newTextOffsets(content), 0, len(content), options)
+}
 
+// searchTextRange 在 content[from:to] 中查找匹配，结果的位置、行号与上下文均按全文计
+func searchTextRange(content string, offsets *textOffsets, from, to int, options models.SearchOptions) ([]models.SearchResult, error) {
 	results := []models.SearchResult{}
-	searchContent := content
-	searchKeyword := keyword
+	if options.Keyword == "" {
+		return results, nil
+	}
 
-	if !caseSensitive {
-		searchContent = strings.ToLower(content)
-		searchKeyword = strings.ToLower(keyword)
+	matches, err := findSearchMatches(content[from:to], options)
+	if err != nil {
+		return nil, err
 	}
 
-	position := 0
-	for position < len(searchContent) {
-		index := strings.Index(searchContent[position:], searchKeyword)
-		if index == -1 {
+	for _, match := range matches {
+		start, end := from+match[0], from+match[1]
+		if start == end {
+			continue
+		}
+
+		position := offsets.runeOffset(content, start)
+		results = append(results, models.SearchResult{
+			Position: position,
+			Line:     offsets.lineNumber(start),
+			Context:  searchContext(content, start, end),
+			Keyword:  options.Keyword,
+			Length:   utf8.RuneCountInString(content[start:end]),
+			// 只有内容时不知道章节，由调用方按章节列表补充
+			ChapterIndex:  -1,
+			ChapterOffset: position,
+		})
+		if options.MaxResults > 0 && len(results) >= options.MaxResults {
 			break
 		}
+	}
 
-		actualBytePosition := position + index
-		actualPosition := utf8.RuneCountInString(content[:actualBytePosition])
-		keywordLength := utf8.RuneCountInString(keyword)
+	return results, nil
+}
 
-		contextStart := maxInt(actualPosition-50, 0)
-		contextEnd := minInt(actualPosition+keywordLength+50, utf8.RuneCountInString(content))
+// findSearchMatches 按匹配方式查找匹配的字节区间，按位置排序且互不重叠
+func findSearchMatches(content string, options models.SearchOptions) ([][]int, error) {
+	limit := -1
+	if options.MaxResults > 0 {
+		limit = options.MaxResults
+	}
 
-		results = append(results, models.SearchResult{
-			Position: actualPosition,
-			Context:  sliceByRuneRange(content, contextStart, contextEnd),
-			Keyword:  keyword,
-			Line:     getLineNumber(content, actualPosition),
+	switch options.Mode {
+	case models.SearchModePinyin:
+		return findPinyinMatches(content, options.Keyword, limit), nil
+	case models.SearchModeFuzzy:
+		return findFuzzyMatches(content, options.Keyword, options.CaseSensitive, limit), nil
+	}
+
+	pattern, err := compileSearchPattern(options)
+	if err != nil {
+		return nil, err
+	}
+	if options.Mode != models.SearchModeWholeWord {
+		return pattern.FindAllStringIndex(content, limit), nil
+	}
+
+	// 整词匹配要先过滤，不能让正则提前截断
+	var matches [][]int
+	for _, match := range pattern.FindAllStringIndex(content, -1) {
+		if match[0] == match[1] || !isWholeWordMatch(content, match[0], match[1]) {
+			continue
+		}
+		matches = append(matches, match)
+		if limit > 0 && len(matches) >= limit {
+			break
+		}
+	}
+	return matches, nil
+}
+
+// annotateSearchResults 为搜索结果补充所在章节与章内偏移；
+// 章节按阅读顺序首尾相接，取起始位置不超过匹配位置的最后一章
+func annotateSearchResults(results []models.SearchResult, chapters []models.Chapter) {
+	for index := range results {
+		result := &results[index]
+		chapterIndex := sort.Search(len(chapters), func(i int) bool {
+			return chapters[i].StartPos > result.Position
+		}) - 1
+		if chapterIndex < 0 {
+			continue
+		}
+
+		result.ChapterIndex = chapterIndex
+		result.ChapterTitle = chapters[chapterIndex].Title
+		result.ChapterOffset = result.Position - chapters[chapterIndex].StartPos
+	}
+}
+
+// groupSearchResults 把按位置排序的搜索结果按章节分组
+func groupSearchResults(results []models.SearchResult) []models.SearchResultGroup {
+	groups := []models.SearchResultGroup{}
+	for _, result := range results {
+		if last := len(groups) - 1; last >= 0 && groups[last].ChapterIndex == result.ChapterIndex {
+			groups[last].Results = append(groups[last].Results, result)
+			groups[last].Count++
+			continue
+		}
+		groups = append(groups, models.SearchResultGroup{
+			ChapterIndex: result.ChapterIndex,
+			ChapterTitle: result.ChapterTitle,
+			Count:        1,
+			Results:      []models.SearchResult{result},
 		})
+	}
+	return groups
+}
 
-		position = actualBytePosition + len(searchKeyword)
+// compileSearchPattern 把各种匹配方式统一编译为正则；不区分大小写时使用 (?i)，
+// 按 Unicode 大小写折叠在原文上匹配，匹配位置无需再换算
+func compileSearchPattern(options models.SearchOptions) (*regexp.Regexp, error) {
+	expression := regexp.QuoteMeta(options.Keyword)
+	switch options.Mode {
+	case "", models.SearchModeLiteral, models.SearchModeWholeWord:
+	case models.SearchModeRegex:
+		expression = options.Keyword
+	default:
+		return nil, fmt.Errorf("不支持的搜索方式: %s", options.Mode)
 	}
 
-	return results
+	if !options.CaseSensitive {
+		expression = "(?i)" + expression
+	}
+	pattern, err := regexp.Compile(expression)
+	if err != nil {
+		return nil, fmt.Errorf("搜索表达式无效: %w", err)
+	}
+	return pattern, nil
+}
+
+// isWholeWordMatch 匹配两端的字母或数字不能与相邻字符连成一个词；
+// 中日文不以空格分词，紧邻的汉字不算同一个词
+func isWholeWordMatch(content string, start, end int) bool {
+	first, _ := utf8.DecodeRuneInString(content[start:end])
+	before, _ := utf8.DecodeLastRuneInString(content[:start])
+	if start > 0 && isSearchWordRune(first) && isSearchWordRune(before) {
+		return false
+	}
+
+	last, _ := utf8.DecodeLastRuneInString(content[start:end])
+	after, _ := utf8.DecodeRuneInString(content[end:])
+	return end >= len(content) || !isSearchWordRune(last) || !isSearchWordRune(after)
+}
+
+func isSearchWordRune(char rune) bool {
+	return (unicode.IsLetter(char) || unicode.IsDigit(char) || char == '_') && !isReflowCJKRune(char)
+}
+
+// searchContext 截取匹配前后各 searchContextRunes 个字符作为上下文
+func searchContext(content string, start, end int) string {
+	for count := 0; count < searchContextRunes && start > 0; count++ {
+		_, size := utf8.DecodeLastRuneInString(content[:start])
+		start -= size
+	}
+	for count := 0; count < searchContextRunes && end < len(content); count++ {
+		_, size := utf8.DecodeRuneInString(content[end:])
+		end += size
+	}
+	return content[start:end]
 }
 
 // Init 初始化服务
 func (s *SearchService) Init(ctx context.Context) {
 	s.ctx = ctx
+	s.libraryIndex.setNotify(s.emitLibraryIndexStatus)
 }
 
-// Cleanup 清理资源
+// Cleanup 清理资源，等待书库索引任务结束并保存索引
 func (s *SearchService) Cleanup() {
 	s.searchResults = []models.SearchResult{}
+	s.libraryIndex.close()
 }
 
 // SearchInNovel 在小说中搜索关键字
@@ -79,11 +276,23 @@ func (s *SearchService) Cleanup() {
 // @param caseSensitive 是否区分大小写
 // @return 搜索结果列表
 func (s *SearchService) SearchInNovel(content, keyword string, caseSensitive bool) []models.SearchResult {
-	results := searchInText(content, keyword, caseSensitive)
-	s.searchResults = results
+	results, err := s.SearchInNovelWithOptions(content, models.SearchOptions{Keyword: keyword, CaseSensitive: caseSensitive})
+	if err != nil {
+		return []models.SearchResult{}
+	}
 	return results
 }
 
+// SearchInNovelWithOptions 按搜索参数在小说内容中搜索，支持正则、整词匹配与结果数量限制
+func (s *SearchService) SearchInNovelWithOptions(content string, options models.SearchOptions) ([]models.SearchResult, error) {
+	results, err := searchInText(content, options)
+	if err != nil {
+		return nil, err
+	}
+	s.searchResults = results
+	return results, nil
+}
+
 // GetSearchResults 获取搜索结果
 func (s *SearchService) GetSearchResults() []models.SearchResult {
 	return s.searchResults
@@ -94,44 +303,32 @@ func (s *SearchService) ClearSearchResults() {
 	s.searchResults = []models.SearchResult{}
 }
 
-// HighlightKeyword 高亮关键字
-// @param content 内容
+// HighlightKeyword 高亮关键字（字面匹配，不区分大小写）
+// @param content 内容，可以是纯文本或 EPUB/PDF 富文本 HTML
 // @param keyword 关键字
 // @param highlightTag HTML标签，如 "<mark>" 或自定义样式
-// @return 高亮后的内容
+// @return 高亮后的 HTML，无法解析时原样返回
 func (s *SearchService) HighlightKeyword(content, keyword, highlightTag string) string {
-	if keyword == "" {
+	highlighted, err := s.HighlightKeywordWithOptions(content, models.SearchOptions{Keyword: keyword}, highlightTag)
+	if err != nil {
 		return content
 	}
-
-	if highlightTag == "" {
-		highlightTag = "<mark>"
-	}
-
-	closeTag := strings.Replace(highlightTag, "<", "</", 1)
-	highlighted := strings.ReplaceAll(content, keyword, highlightTag+keyword+closeTag)
-
 	return highlighted
 }
 
-// getLineNumber 获取指定位置的行号
-func (s *SearchService) getLineNumber(content string, position int) int {
-	return getLineNumber(content, position)
-}
-
-func getLineNumber(content string, position int) int {
-	runes := []rune(content)
-	if position > len(runes) {
-		position = len(runes)
+// HighlightKeywordWithOptions 按搜索选项高亮内容中的匹配，支持与搜索相同的匹配方式与大小写选项。
+// 只包裹文本节点中的匹配，标签与属性保持不变；第 N 处匹配（从 0 开始）的高亮元素带
+// search-hit 与 search-hit-N 两个样式类及 data-search-hit 属性，前端据此跳到下一处
+func (s *SearchService) HighlightKeywordWithOptions(content string, options models.SearchOptions, highlightTag string) (string, error) {
+	if options.Keyword == "" {
+		return content, nil
 	}
 
-	line := 1
-	for i := 0; i < position; i++ {
-		if runes[i] == '\n' {
-			line++
-		}
+	highlighted, err := highlightHTML(content, options, highlightTag)
+	if err != nil {
+		return "", fmt.Errorf("高亮关键字失败: %w", err)
 	}
-	return line
+	return highlighted, nil
 }
 
 // SearchInChapter 在指定章节中搜索
@@ -152,10 +349,16 @@ func (s *SearchService) SearchInChapter(novel *models.Novel, chapterIndex int, k
 	for index := range results {
 		results[index].Position += chapter.StartPos
 	}
+	annotateSearchResults(results, novel.Chapters)
 
 	return results
 }
 
+// GroupSearchResults 把搜索结果按章节分组，用于可折叠的结果面板
+func (s *SearchService) GroupSearchResults(results []models.SearchResult) []models.SearchResultGroup {
+	return groupSearchResults(results)
+}
+
 // GetSearchStatistics 获取搜索统计信息
 // @return 匹配数量
 func (s *SearchService) GetSearchStatistics() int {
@@ -0,0 +1,367 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nongchen1223/moyureader/backend/models"
+)
+
+func TestSearchNovelWithOptionsSupportsModesAndCaseFolding(t *testing.T) {
+	// Ⱥ 的小写形式比原字符多一个字节，按小写副本的字节位置换算会错位
+	content := "ȺȺȺ Lantern light.\nThe lanterns glowed; a LANTERN swung.\n第一章 灯笼"
+	txtPath := filepath.Join(t.TempDir(), "search.txt")
+	if err := os.WriteFile(txtPath, []byte(content), 0644); err != nil {
+		t.Fatalf("write txt file: %v", err)
+	}
+
+	service := NewNovelService(NewProgressService(t.TempDir()))
+	if _, err := service.OpenNovel(txtPath); err != nil {
+		t.Fatalf("OpenNovel returned error: %v", err)
+	}
+	content = service.novels[txtPath].Content
+
+	search := func(options models.SearchOptions) []models.SearchResult {
+		t.Helper()
+		results, err := service.SearchNovelWithOptions(txtPath, options)
+		if err != nil {
+			t.Fatalf("SearchNovelWithOptions(%+v) returned error: %v", options, err)
+		}
+		return results
+	}
+	positions := func(results []models.SearchResult) []int {
+		values := make([]int, len(results))
+		for index, result := range results {
+			values[index] = result.Position
+		}
+		return values
+	}
+
+	literal := search(models.SearchOptions{Keyword: "lantern"})
+	if len(literal) != 3 || literal[0].Position != 4 || literal[0].Length != 7 {
+		t.Fatalf("unexpected case-insensitive results: %+v", literal)
+	}
+	for _, result := range literal {
+		if matched := sliceByRuneRange(content, result.Position, result.Position+result.Length); !strings.EqualFold(matched, "lantern") {
+			t.Fatalf("result %+v points at %q", result, matched)
+		}
+	}
+
+	if results := search(models.SearchOptions{Keyword: "lantern", CaseSensitive: true}); len(results) != 1 {
+		t.Fatalf("expected one case-sensitive match, got %+v", results)
+	}
+	if results := search(models.SearchOptions{Keyword: "lantern", Mode: models.SearchModeWholeWord}); !slices.Equal(positions(results), []int{literal[0].Position, literal[2].Position}) {
+		t.Fatalf("expected whole-word search to skip \"lanterns\", got %+v", results)
+	}
+	if results := search(models.SearchOptions{Keyword: "灯笼", Mode: models.SearchModeWholeWord}); len(results) != 1 {
+		t.Fatalf("expected CJK keyword to match in whole-word mode, got %+v", results)
+	}
+
+	regexResults := search(models.SearchOptions{Keyword: `lantern\w*`, Mode: models.SearchModeRegex})
+	if len(regexResults) != 3 || regexResults[1].Length != len("lanterns") {
+		t.Fatalf("unexpected regex results: %+v", regexResults)
+	}
+	if results := search(models.SearchOptions{Keyword: "lantern", MaxResults: 2}); len(results) != 2 {
+		t.Fatalf("expected results to be limited to 2, got %+v", results)
+	}
+
+	if _, err := service.SearchNovelWithOptions(txtPath, models.SearchOptions{Keyword: "(", Mode: models.SearchModeRegex}); err == nil {
+		t.Fatal("expected invalid regular expression to return an error")
+	}
+	if results := service.SearchNovel(txtPath, "LANTERN", true); len(results) != 1 || results[0].Length != 7 {
+		t.Fatalf("expected legacy search to keep working, got %+v", results)
+	}
+}
+
+func TestSearchNovelAnnotatesAndGroupsResultsByChapter(t *testing.T) {
+	content := "第一章 出发\n灯笼挂在门口。\n第二章 夜路\n灯笼照着山路，灯笼也照着人。\n第三章 归来\n天亮了。"
+	txtPath := filepath.Join(t.TempDir(), "chapters.txt")
+	if err := os.WriteFile(txtPath, []byte(content), 0644); err != nil {
+		t.Fatalf("write txt file: %v", err)
+	}
+
+	service := NewNovelService(NewProgressService(t.TempDir()))
+	novel, err := service.OpenNovel(txtPath)
+	if err != nil {
+		t.Fatalf("OpenNovel returned error: %v", err)
+	}
+	if len(novel.Chapters) != 3 {
+		t.Fatalf("expected 3 chapters, got %+v", novel.Chapters)
+	}
+
+	results, err := service.SearchNovelWithOptions(txtPath, models.SearchOptions{Keyword: "灯笼"})
+	if err != nil {
+		t.Fatalf("SearchNovelWithOptions returned error: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %+v", results)
+	}
+	for _, result := range results {
+		chapter := novel.Chapters[result.ChapterIndex]
+		if result.ChapterTitle != chapter.Title || result.ChapterOffset != result.Position-chapter.StartPos {
+			t.Fatalf("result %+v is not annotated with chapter %+v", result, chapter)
+		}
+		chapterContent, _ := service.GetChapterContent(txtPath, result.ChapterIndex)
+		if !strings.HasPrefix(string([]rune(chapterContent)[result.ChapterOffset:]), "灯笼") {
+			t.Fatalf("chapter offset of %+v does not point at the keyword", result)
+		}
+	}
+
+	groups, err := service.SearchNovelGrouped(txtPath, models.SearchOptions{Keyword: "灯笼"})
+	if err != nil {
+		t.Fatalf("SearchNovelGrouped returned error: %v", err)
+	}
+	if len(groups) != 2 || groups[0].ChapterTitle != "第一章 出发" || groups[0].Count != 1 ||
+		groups[1].ChapterIndex != 1 || groups[1].Count != 2 || len(groups[1].Results) != 2 {
+		t.Fatalf("unexpected grouped results: %+v", groups)
+	}
+}
+
+func TestSearchInTextSupportsPinyinAndFuzzyModes(t *testing.T) {
+	content := "那天林潇宇回到重庆，长大后穿着绿色外套。Harry Potter met Hermione Granger."
+	search := func(keyword, mode string) []models.SearchResult {
+		t.Helper()
+		results, err := searchInText(content, models.SearchOptions{Keyword: keyword, Mode: mode})
+		if err != nil {
+			t.Fatalf("searchInText(%q, %s) returned error: %v", keyword, mode, err)
+		}
+		return results
+	}
+	matched := func(result models.SearchResult) string {
+		return string([]rune(content)[result.Position : result.Position+result.Length])
+	}
+
+	for _, keyword := range []string{"lxy", "linxiaoyu", "lin xiao y", "LinXY", "林xy"} {
+		results := search(keyword, models.SearchModePinyin)
+		if len(results) != 1 || matched(results[0]) != "林潇宇" || results[0].Position != 2 {
+			t.Fatalf("pinyin %q should match 林潇宇, got %+v", keyword, results)
+		}
+	}
+	// 多音字的其他读音与 ü 的两种写法
+	for keyword, want := range map[string]string{"zhangda": "长大", "changda": "长大", "lvse": "绿色", "luse": "绿色", "cq": "重庆"} {
+		if results := search(keyword, models.SearchModePinyin); len(results) != 1 || matched(results[0]) != want {
+			t.Fatalf("pinyin %q should match %s, got %+v", keyword, want, results)
+		}
+	}
+	if results := search("harry", models.SearchModePinyin); len(results) != 0 {
+		t.Fatalf("pinyin matches should start from Chinese characters, got %+v", results)
+	}
+
+	for keyword, want := range map[string]string{
+		"Hermoine":    "Hermione",
+		"harry poter": "Harry Potter",
+		"grangr":      "Granger",
+		"met":         "met",
+	} {
+		results := search(keyword, models.SearchModeFuzzy)
+		if len(results) != 1 || matched(results[0]) != want {
+			t.Fatalf("fuzzy %q should match %s, got %+v", keyword, want, results)
+		}
+	}
+	if results := search("Hxrmxxne", models.SearchModeFuzzy); len(results) != 0 {
+		t.Fatalf("fuzzy match should be limited by edit distance, got %+v", results)
+	}
+	if results := search("me", models.SearchModeFuzzy); len(results) != 0 {
+		t.Fatalf("short words should match exactly, got %+v", results)
+	}
+}
+
+func TestStartSearchStreamsBatchesAndCancels(t *testing.T) {
+	var builder strings.Builder
+	for chapter := 1; chapter <= 4; chapter++ {
+		fmt.Fprintf(&builder, "第%d章 灯会\n", chapter)
+		for line := 0; line < 3000; line++ {
+			fmt.Fprintf(&builder, "第%d行，街上的灯笼一盏接一盏亮起来，lantern %d。\n", line, line)
+		}
+	}
+	txtPath := filepath.Join(t.TempDir(), "lanterns.txt")
+	if err := os.WriteFile(txtPath, []byte(builder.String()), 0644); err != nil {
+		t.Fatalf("write txt file: %v", err)
+	}
+
+	service := NewNovelService(NewProgressService(t.TempDir()))
+	if _, err := service.OpenNovel(txtPath); err != nil {
+		t.Fatalf("OpenNovel returned error: %v", err)
+	}
+	novel := service.novels[txtPath]
+	if len(novel.Content) <= 2*searchChunkBytes {
+		t.Fatalf("content should span several search chunks, got %d bytes", len(novel.Content))
+	}
+
+	options := models.SearchOptions{Keyword: "灯笼"}
+	want, err := service.SearchNovelWithOptions(txtPath, options)
+	if err != nil {
+		t.Fatalf("SearchNovelWithOptions returned error: %v", err)
+	}
+	if len(want) != 12000 {
+		t.Fatalf("expected 12000 results, got %d", len(want))
+	}
+	// 行号与字符位置由预先计算的偏移表换算，与直接数出来的结果一致
+	runes := []rune(novel.Content)
+	last := want[len(want)-1]
+	if string(runes[last.Position:last.Position+2]) != "灯笼" ||
+		last.Line != strings.Count(string(runes[:last.Position]), "\n")+1 {
+		t.Fatalf("last result has wrong position or line: %+v", last)
+	}
+
+	type event struct {
+		name string
+		data interface{}
+	}
+	events := make(chan event, 1024)
+	service.emitEvent = func(name string, data interface{}) {
+		events <- event{name, data}
+	}
+	collect := func(jobID string) ([]models.SearchResult, models.SearchProgress) {
+		t.Helper()
+		var results []models.SearchResult
+		for {
+			select {
+			case received := <-events:
+				switch data := received.data.(type) {
+				case models.SearchBatch:
+					if data.JobID != jobID {
+						t.Fatalf("batch from unexpected job %s", data.JobID)
+					}
+					results = append(results, data.Results...)
+				case models.SearchProgress:
+					if data.Done {
+						return results, data
+					}
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("search job %s did not finish", jobID)
+			}
+		}
+	}
+
+	jobID, err := service.StartSearch(txtPath, options)
+	if err != nil {
+		t.Fatalf("StartSearch returned error: %v", err)
+	}
+	results, progress := collect(jobID)
+	if progress.Cancelled || progress.Progress != 100 || progress.Count != len(want) || len(results) != len(want) {
+		t.Fatalf("unexpected final progress %+v with %d results", progress, len(results))
+	}
+	for index := range want {
+		if results[index] != want[index] {
+			t.Fatalf("result %d differs: got %+v, want %+v", index, results[index], want[index])
+		}
+	}
+
+	// 收到第一批结果后取消，任务应在下一块之前停下
+	var cancelJob string
+	service.emitEvent = func(name string, data interface{}) {
+		if _, ok := data.(models.SearchBatch); ok && cancelJob != "" {
+			service.CancelSearch(cancelJob)
+		}
+		events <- event{name, data}
+	}
+	service.searchMu.Lock()
+	cancelJob = fmt.Sprintf("search-%d", service.searchSeq+1)
+	service.searchMu.Unlock()
+	jobID, err = service.StartSearch(txtPath, options)
+	if err != nil || jobID != cancelJob {
+		t.Fatalf("StartSearch returned %q, %v", jobID, err)
+	}
+	results, progress = collect(jobID)
+	if !progress.Cancelled || len(results) == 0 || len(results) >= len(want) {
+		t.Fatalf("job should stop after the first batch, got %+v with %d results", progress, len(results))
+	}
+
+	// 任务使用启动时的章节快照，搜索期间重新切分章节不影响已启动的任务
+	service.emitEvent = func(name string, data interface{}) {
+		events <- event{name, data}
+	}
+	jobID, err = service.StartSearch(txtPath, options)
+	if err != nil {
+		t.Fatalf("StartSearch returned error: %v", err)
+	}
+	if _, err := service.ApplyChapterRules(txtPath, models.ChapterRuleSet{Rules: []models.ChapterRule{{Name: "行", Pattern: `^第\d+行`, Enabled: true}}}); err != nil {
+		t.Fatalf("ApplyChapterRules returned error: %v", err)
+	}
+	results, progress = collect(jobID)
+	if progress.Cancelled || len(results) != len(want) || results[len(results)-1] != want[len(want)-1] {
+		t.Fatalf("expected results annotated with the original chapters, got %+v with %d results", progress, len(results))
+	}
+
+	if _, err := service.StartSearch(txtPath, models.SearchOptions{Keyword: "(", Mode: models.SearchModeRegex}); err == nil {
+		t.Fatalf("StartSearch should reject invalid regular expressions")
+	}
+}
+
+func TestHighlightKeywordWrapsTextNodesAcrossInlineElements(t *testing.T) {
+	service := NewSearchService(NewProgressService(t.TempDir()))
+	content := `<p title="Lantern">The <em>Lan</em>tern glows.</p><p class="lantern">lantern<img alt="lantern" src="lantern.png"/></p><script>var lantern = 1</script>`
+
+	highlighted := service.HighlightKeyword(content, "lantern", `<span class="hl">`)
+	want := `<p title="Lantern">The <em><span class="hl search-hit search-hit-0" data-search-hit="0">Lan</span></em>` +
+		`<span class="hl search-hit search-hit-0" data-search-hit="0">tern</span> glows.</p>` +
+		`<p class="lantern"><span class="hl search-hit search-hit-1" data-search-hit="1">lantern</span>` +
+		`<img alt="lantern" src="lantern.png"/></p><script>var lantern = 1</script>`
+	if highlighted != want {
+		t.Fatalf("unexpected highlight:\n got %s\nwant %s", highlighted, want)
+	}
+
+	// 匹配不跨块级元素，正则命中按序号依次编号
+	highlighted, err := service.HighlightKeywordWithOptions("<p>ab</p><p>cd a&amp;b</p>", models.SearchOptions{
+		Keyword: `[bc]|a&b`,
+		Mode:    models.SearchModeRegex,
+	}, "")
+	if err != nil {
+		t.Fatalf("HighlightKeywordWithOptions returned error: %v", err)
+	}
+	want = `<p>a<mark class="search-hit search-hit-0" data-search-hit="0">b</mark></p>` +
+		`<p><mark class="search-hit search-hit-1" data-search-hit="1">c</mark>d ` +
+		`<mark class="search-hit search-hit-2" data-search-hit="2">a&amp;b</mark></p>`
+	if highlighted != want {
+		t.Fatalf("unexpected regex highlight:\n got %s\nwant %s", highlighted, want)
+	}
+
+	if _, err := service.HighlightKeywordWithOptions("text", models.SearchOptions{Keyword: "(", Mode: models.SearchModeRegex}, ""); err == nil {
+		t.Fatalf("invalid regular expressions should be reported")
+	}
+}
+
+// cancelAfterChecksContext 前 remaining 次 Err 返回 nil，之后视为已取消，用来模拟搜索进行中被取消
+type cancelAfterChecksContext struct {
+	context.Context
+	remaining int
+}
+
+func (c *cancelAfterChecksContext) Err() error {
+	if c.remaining > 0 {
+		c.remaining--
+		return nil
+	}
+	return context.Canceled
+}
+
+func TestRunSearchJobReportsCancellationDuringLastChunk(t *testing.T) {
+	service := NewNovelService(NewProgressService(t.TempDir()))
+	var progresses []models.SearchProgress
+	service.emitEvent = func(name string, data interface{}) {
+		if progress, ok := data.(models.SearchProgress); ok {
+			progresses = append(progresses, progress)
+		}
+	}
+
+	content := "第一章 灯会\n街上的灯笼一盏接一盏亮起来。\n"
+	// 正文只有一段，取消发生在搜索这一段期间
+	ctx := &cancelAfterChecksContext{Context: context.Background(), remaining: 1}
+	service.runSearchJob(ctx, "search-1", searchJobSource{content: content, offsets: newTextOffsets(content)}, models.SearchOptions{Keyword: "灯笼"})
+
+	if len(progresses) == 0 {
+		t.Fatal("expected a final progress event")
+	}
+	final := progresses[len(progresses)-1]
+	if !final.Done || !final.Cancelled || final.Progress == 100 {
+		t.Fatalf("cancelled job should not report completion, got %+v", final)
+	}
+}
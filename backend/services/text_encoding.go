@@ -0,0 +1,237 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	xunicode "golang.org/x/text/encoding/unicode"
+)
+
+const (
+	textEncodingAuto    = "auto"
+	textEncodingUTF8    = "UTF-8"
+	textEncodingUTF16LE = "UTF-16LE"
+	textEncodingUTF16BE = "UTF-16BE"
+	textEncodingGBK     = "GBK"
+	textEncodingGB18030 = "GB18030"
+	textEncodingBig5    = "Big5"
+
+	// textEncodingSampleSize 统计打分时最多采样的字节数，避免大文件反复整本解码
+	textEncodingSampleSize = 256 * 1024
+)
+
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+// supportedTextEncodings 可手动指定的文本编码，顺序即前端下拉展示顺序
+var supportedTextEncodings = []string{
+	textEncodingUTF8,
+	textEncodingGBK,
+	textEncodingGB18030,
+	textEncodingBig5,
+	textEncodingUTF16LE,
+	textEncodingUTF16BE,
+}
+
+// commonHanCharacters 简繁体常用汉字，用于给候选编码的解码结果打分
+const commonHanCharacters = "的一是了我不人在他有这个上们来到时大地为子中你说生国年着就那和要她出也得里后自以会家可下而过天去能对小多然于心学么之都好看起发当没成只如事把还用第样道想作种开" +
+	"這個們來時為說國著裡後會過對於學麼發當沒還樣種開見頭聲長問間門氣從現點進無話經讓"
+
+var commonHanCharacterSet = func() map[rune]struct{} {
+	set := make(map[rune]struct{}, utf8.RuneCountInString(commonHanCharacters))
+	for _, char := range commonHanCharacters {
+		set[char] = struct{}{}
+	}
+	return set
+}()
+
+// normalizeTextEncodingName 将用户输入的编码名称归一化为受支持的标准名称
+func normalizeTextEncodingName(name string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(name))
+	normalized = strings.NewReplacer("_", "-", " ", "").Replace(normalized)
+
+	switch normalized {
+	case "", textEncodingAuto:
+		return "", nil
+	case "utf-8", "utf8", "utf-8-bom":
+		return textEncodingUTF8, nil
+	case "gbk", "cp936", "gb2312", "windows-936":
+		return textEncodingGBK, nil
+	case "gb18030":
+		return textEncodingGB18030, nil
+	case "big5", "big-5", "cp950":
+		return textEncodingBig5, nil
+	case "utf-16le", "utf16le", "utf-16":
+		return textEncodingUTF16LE, nil
+	case "utf-16be", "utf16be":
+		return textEncodingUTF16BE, nil
+	default:
+		return "", fmt.Errorf("不支持的文本编码: %s", name)
+	}
+}
+
+func lookupTextEncoding(name string) encoding.Encoding {
+	switch name {
+	case textEncodingGBK:
+		return simplifiedchinese.GBK
+	case textEncodingGB18030:
+		return simplifiedchinese.GB18030
+	case textEncodingBig5:
+		return traditionalchinese.Big5
+	case textEncodingUTF16LE:
+		return xunicode.UTF16(xunicode.LittleEndian, xunicode.IgnoreBOM)
+	case textEncodingUTF16BE:
+		return xunicode.UTF16(xunicode.BigEndian, xunicode.IgnoreBOM)
+	default:
+		return nil
+	}
+}
+
+// decodeNovelText 将原始字节转为 UTF-8 文本
+// preferredEncoding 为空时自动识别，否则按指定编码解码
+// @return 解码后的文本、实际使用的编码和错误
+func decodeNovelText(data []byte, preferredEncoding string) (string, string, error) {
+	encodingName, err := normalizeTextEncodingName(preferredEncoding)
+	if err != nil {
+		return "", "", err
+	}
+
+	if encodingName == "" {
+		encodingName = detectTextEncoding(data)
+	}
+
+	data = stripTextEncodingBOM(data, encodingName)
+	if encodingName == textEncodingUTF8 {
+		return strings.ToValidUTF8(string(data), "�"), encodingName, nil
+	}
+
+	decoded, err := lookupTextEncoding(encodingName).NewDecoder().Bytes(data)
+	if err != nil {
+		return "", "", fmt.Errorf("按 %s 解码失败: %w", encodingName, err)
+	}
+
+	return string(decoded), encodingName, nil
+}
+
+// detectTextEncoding 识别文本编码
+// 先检查 BOM，再检查 UTF-16 零字节分布和 UTF-8 合法性，最后对中文编码候选做统计打分
+func detectTextEncoding(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		return textEncodingUTF8
+	case bytes.HasPrefix(data, utf16LEBOM):
+		return textEncodingUTF16LE
+	case bytes.HasPrefix(data, utf16BEBOM):
+		return textEncodingUTF16BE
+	}
+
+	sample := data
+	if len(sample) > textEncodingSampleSize {
+		sample = sample[:textEncodingSampleSize]
+	}
+
+	if encodingName := detectUTF16WithoutBOM(sample); encodingName != "" {
+		return encodingName
+	}
+
+	if utf8.Valid(data) {
+		return textEncodingUTF8
+	}
+
+	bestEncoding := textEncodingGB18030
+	bestScore := 0.0
+	for index, candidate := range []string{textEncodingGBK, textEncodingGB18030, textEncodingBig5} {
+		decoded, err := lookupTextEncoding(candidate).NewDecoder().Bytes(sample)
+		if err != nil {
+			continue
+		}
+
+		// 采样截断可能切开最后一个多字节字符，末尾的替换符不计入扣分
+		score := scoreDecodedText(strings.TrimRight(string(decoded), "�"))
+		if index == 0 || score > bestScore {
+			bestEncoding = candidate
+			bestScore = score
+		}
+	}
+
+	return bestEncoding
+}
+
+// detectUTF16WithoutBOM 通过奇偶位置上零字节的比例识别无 BOM 的 UTF-16 文本
+func detectUTF16WithoutBOM(sample []byte) string {
+	pairCount := len(sample) / 2
+	if pairCount < 4 {
+		return ""
+	}
+
+	evenZeros := 0
+	oddZeros := 0
+	for index := 0; index+1 < len(sample); index += 2 {
+		if sample[index] == 0 {
+			evenZeros++
+		}
+		if sample[index+1] == 0 {
+			oddZeros++
+		}
+	}
+
+	threshold := pairCount * 3 / 10
+	switch {
+	case oddZeros > threshold && evenZeros <= pairCount/20:
+		return textEncodingUTF16LE
+	case evenZeros > threshold && oddZeros <= pairCount/20:
+		return textEncodingUTF16BE
+	default:
+		return ""
+	}
+}
+
+// scoreDecodedText 对解码结果打分：常用汉字加分，替换符、控制字符和私用区字符扣分
+func scoreDecodedText(text string) float64 {
+	score := 0.0
+	for _, char := range text {
+		switch {
+		case char == utf8.RuneError:
+			score -= 20
+		case char == '\n' || char == '\r' || char == '\t':
+		case unicode.IsControl(char):
+			score -= 10
+		case unicode.Is(unicode.Co, char):
+			score -= 10
+		case isCommonHanCharacter(char):
+			score += 3
+		case unicode.Is(unicode.Han, char):
+			score += 0.2
+		case unicode.IsPunct(char) && char > unicode.MaxASCII:
+			score += 0.5
+		}
+	}
+	return score
+}
+
+func isCommonHanCharacter(char rune) bool {
+	_, exists := commonHanCharacterSet[char]
+	return exists
+}
+
+func stripTextEncodingBOM(data []byte, encodingName string) []byte {
+	switch encodingName {
+	case textEncodingUTF8:
+		return bytes.TrimPrefix(data, utf8BOM)
+	case textEncodingUTF16LE:
+		return bytes.TrimPrefix(data, utf16LEBOM)
+	case textEncodingUTF16BE:
+		return bytes.TrimPrefix(data, utf16BEBOM)
+	default:
+		return data
+	}
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 段落重排：PDF 的每一行、以及不少网上抓取的 TXT 都按排版宽度硬换行，
+// 阅读器里会显示成参差的短行。根据段首缩进、句末标点和行宽统计，把同一段的行重新接起来。
+
+const (
+	// reflowFullLineRatio 行宽达到满行宽度的该比例即视为满行，说明段落还没结束
+	reflowFullLineRatio = 0.8
+	// reflowMinLines 非空行少于该数量时统计不可靠，不重排
+	reflowMinLines = 8
+	// reflowTxtMinLines TXT 判断是否硬换行所需的最少非空行数
+	reflowTxtMinLines = 20
+	// reflowTxtMinFullRatio 满行占比达到该值才认为 TXT 是按固定宽度硬换行的
+	reflowTxtMinFullRatio = 0.35
+)
+
+// reflowLine 参与重排的一行，indent 表示段首缩进（TXT 为行首空白，PDF 为行首横坐标右移）
+type reflowLine struct {
+	text   string
+	indent bool
+}
+
+type paragraphReflower struct {
+	// fullWidth 满行的最小显示宽度（CJK 字符计 2）
+	fullWidth int
+	// useIndent 文中以缩进标记段首；每行都缩进或都不缩进时缩进不提供信息
+	useIndent bool
+	// hardWrapped 行宽集中在满行附近，且没有远超满行的长行
+	hardWrapped  bool
+	chapterRules []compiledChapterRule
+}
+
+// newParagraphReflower 按全文行宽统计满行宽度，样本不足时返回 nil
+func newParagraphReflower(lines []reflowLine, chapterRules []compiledChapterRule) *paragraphReflower {
+	widths := make([]int, 0, len(lines))
+	indentCount := 0
+	for _, line := range lines {
+		text := strings.TrimSpace(line.text)
+		if text == "" {
+			continue
+		}
+		widths = append(widths, reflowDisplayWidth(text))
+		if line.indent {
+			indentCount++
+		}
+	}
+	if len(widths) < reflowMinLines {
+		return nil
+	}
+
+	sort.Ints(widths)
+	typicalWidth := widths[len(widths)*9/10]
+	fullWidth := max(1, int(float64(typicalWidth)*reflowFullLineRatio))
+	fullCount := len(widths) - sort.SearchInts(widths, fullWidth)
+	longestWidth := widths[len(widths)*98/100]
+
+	indentRatio := float64(indentCount) / float64(len(widths))
+	return &paragraphReflower{
+		fullWidth: fullWidth,
+		useIndent: indentRatio > 0.02 && indentRatio < 0.7,
+		hardWrapped: len(widths) >= reflowTxtMinLines &&
+			typicalWidth >= 20 &&
+			float64(fullCount)/float64(len(widths)) >= reflowTxtMinFullRatio &&
+			float64(longestWidth) <= float64(typicalWidth)*1.3,
+		chapterRules: chapterRules,
+	}
+}
+
+// shouldJoin 判断 next 是否与 current 属于同一段
+func (r *paragraphReflower) shouldJoin(current, next reflowLine) bool {
+	currentText := strings.TrimSpace(current.text)
+	nextText := strings.TrimSpace(next.text)
+	if currentText == "" || nextText == "" {
+		return false
+	}
+	if r.useIndent && next.indent {
+		return false
+	}
+	if matchChapterRule(r.chapterRules, currentText) != nil || matchChapterRule(r.chapterRules, nextText) != nil {
+		return false
+	}
+
+	last, _ := utf8.DecodeLastRuneInString(currentText)
+	first, _ := utf8.DecodeRuneInString(nextText)
+	if reflowDisplayWidth(currentText) >= r.fullWidth {
+		if !endsReflowSentence(currentText) {
+			return true
+		}
+		// 满行以句末标点结尾时，下一行以引号开头多半是新的一段对话，
+		// 下一行是不带标点的短行多半是小标题
+		return !strings.ContainsRune("“「『‘\"(（【", first) && !looksLikeReflowHeading(nextText, r.fullWidth)
+	}
+
+	// 短行通常是段落末行，只有明显断在句中时才接上
+	if strings.ContainsRune("，、；：,;", last) || isReflowHyphenated(currentText, nextText) {
+		return true
+	}
+	return unicode.IsLower(first) && (unicode.IsLetter(last) || last == ',')
+}
+
+// reflowLines 依次合并同一段的行，返回合并后的行
+func (r *paragraphReflower) reflowLines(lines []reflowLine) []string {
+	result := make([]string, 0, len(lines))
+	for index, line := range lines {
+		if index > 0 && len(result) > 0 && r.shouldJoin(lines[index-1], line) {
+			result[len(result)-1] = joinReflowText(result[len(result)-1], line.text)
+			continue
+		}
+		result = append(result, strings.TrimRightFunc(line.text, unicode.IsSpace))
+	}
+	return result
+}
+
+// joinReflowText 拼接同一段的两行
+func joinReflowText(current, next string) string {
+	current = strings.TrimRightFunc(current, unicode.IsSpace)
+	next = strings.TrimLeftFunc(next, unicode.IsSpace)
+	trim, separator := reflowJoint(current, next)
+	return current[:len(current)-trim] + separator + next
+}
+
+// reflowJoint 拼接两行时要去掉的行尾字节数和中间的分隔符：
+// CJK 之间直接相连，西文以空格分隔，跨行断词时去掉行尾连字符
+func reflowJoint(current, next string) (int, string) {
+	if isReflowHyphenated(current, next) {
+		_, size := utf8.DecodeLastRuneInString(current)
+		return size, ""
+	}
+
+	last, _ := utf8.DecodeLastRuneInString(current)
+	first, _ := utf8.DecodeRuneInString(next)
+	if isReflowCJKRune(last) || isReflowCJKRune(first) {
+		return 0, ""
+	}
+	return 0, " "
+}
+
+// isReflowHyphenated 行尾是字母加连字符、下一行以小写字母开头，视为跨行断词
+func isReflowHyphenated(current, next string) bool {
+	last, size := utf8.DecodeLastRuneInString(current)
+	if last != '-' && last != '\u00ad' && last != '\u2010' {
+		return false
+	}
+	beforeLast, _ := utf8.DecodeLastRuneInString(current[:len(current)-size])
+	first, _ := utf8.DecodeRuneInString(strings.TrimSpace(next))
+	return unicode.IsLetter(beforeLast) && !isReflowCJKRune(beforeLast) && unicode.IsLower(first)
+}
+
+func looksLikeReflowHeading(text string, fullWidth int) bool {
+	last, _ := utf8.DecodeLastRuneInString(text)
+	first, _ := utf8.DecodeRuneInString(text)
+	return reflowDisplayWidth(text) < fullWidth &&
+		!unicode.IsPunct(last) &&
+		!unicode.IsLower(first)
+}
+
+func endsReflowSentence(text string) bool {
+	text = strings.TrimRight(text, "”’」』）)\"'")
+	last, _ := utf8.DecodeLastRuneInString(text)
+	return strings.ContainsRune("。！？…!?.．", last)
+}
+
+// isReflowCJKRune 中日文字与全角标点，拼接时不加空格；韩文以空格分词，不在此列
+func isReflowCJKRune(char rune) bool {
+	return unicode.In(char, unicode.Han, unicode.Hiragana, unicode.Katakana) ||
+		char >= 0x3000 && char <= 0x303F ||
+		char >= 0xFF00 && char <= 0xFFEF ||
+		char == '—'
+}
+
+// reflowDisplayWidth 显示宽度，全角字符计 2
+func reflowDisplayWidth(text string) int {
+	width := 0
+	for _, char := range text {
+		if isReflowCJKRune(char) || unicode.Is(unicode.Hangul, char) {
+			width += 2
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+// reflowTxtContent 重排按固定宽度硬换行的 TXT，每段一行的文本原样返回；
+// 段首缩进与空行保留，章节位置随后按新正文切分
+func reflowTxtContent(content string, chapterRules []compiledChapterRule) string {
+	rawLines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	lines := make([]reflowLine, len(rawLines))
+	for index, text := range rawLines {
+		lines[index] = reflowLine{
+			text:   text,
+			indent: strings.TrimSpace(text) != "" && leadingWhitespaceCount(text) > 0,
+		}
+	}
+
+	reflower := newParagraphReflower(lines, chapterRules)
+	if reflower == nil || !reflower.hardWrapped {
+		return content
+	}
+	return strings.Join(reflower.reflowLines(lines), "\n")
+}
@@ -0,0 +1,429 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/nongchen1223/moyureader/backend/models"
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	exportBlankLinesPattern     = regexp.MustCompile(`\n{3,}`)
+	markdownLineStartPattern    = regexp.MustCompile(`^(#|>|[-+*] |\d+[.)] )`)
+	markdownInlineEscapeReplace = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`)
+)
+
+// writeNovelText 导出为 UTF-8 纯文本：书名、作者，随后每章一个标题行和正文
+func writeNovelText(outputPath string, novel *models.Novel, chapters []exportChapter) error {
+	var builder strings.Builder
+	builder.WriteString(exportTitle(novel))
+	builder.WriteString("\n")
+	if author := strings.TrimSpace(novel.Author); author != "" {
+		builder.WriteString("作者：" + author + "\n")
+	}
+
+	for _, chapter := range chapters {
+		builder.WriteString("\n\n")
+		builder.WriteString(normalizeExportHeading(chapter.title))
+		builder.WriteString("\n")
+		if text := removeCJKInlineSpaces(normalizeExportText(chapter.text)); text != "" {
+			builder.WriteString("\n")
+			builder.WriteString(text)
+			builder.WriteString("\n")
+		}
+	}
+
+	if err := os.WriteFile(outputPath, []byte(builder.String()), 0o644); err != nil {
+		return fmt.Errorf("保存 TXT 文件失败: %w", err)
+	}
+	return nil
+}
+
+// writeNovelMarkdown 导出为 Markdown，图片写入与 .md 同名的 .assets 目录
+func writeNovelMarkdown(outputPath string, novel *models.Novel, chapters []exportChapter) error {
+	assetsDirName := strings.TrimSuffix(filepath.Base(outputPath), filepath.Ext(outputPath)) + ".assets"
+	assets := newExportAssetCollector()
+
+	var builder strings.Builder
+	builder.WriteString("# " + escapeMarkdownText(exportTitle(novel)) + "\n")
+	if author := strings.TrimSpace(novel.Author); author != "" {
+		builder.WriteString("\n作者：" + escapeMarkdownText(author) + "\n")
+	}
+
+	for _, chapter := range chapters {
+		// 书名占用一级标题，章节从二级开始
+		headingDepth := clampInt(chapter.level+2, 2, 6)
+		builder.WriteString("\n")
+		builder.WriteString(strings.Repeat("#", headingDepth) + " " + escapeMarkdownText(normalizeExportHeading(chapter.title)))
+		builder.WriteString("\n")
+
+		body := convertHTMLToMarkdown(assets.replaceDataURLs(chapter.html, assetsDirName+"/"), headingDepth)
+		if body != "" {
+			builder.WriteString("\n")
+			builder.WriteString(body)
+			builder.WriteString("\n")
+		}
+	}
+
+	if len(assets.assets) > 0 {
+		assetsDir := filepath.Join(filepath.Dir(outputPath), assetsDirName)
+		if err := os.MkdirAll(assetsDir, 0o755); err != nil {
+			return fmt.Errorf("创建图片目录失败: %w", err)
+		}
+		for _, asset := range assets.assets {
+			if err := os.WriteFile(filepath.Join(assetsDir, asset.name), asset.data, 0o644); err != nil {
+				return fmt.Errorf("保存图片失败: %w", err)
+			}
+		}
+	}
+
+	if err := os.WriteFile(outputPath, []byte(builder.String()), 0o644); err != nil {
+		return fmt.Errorf("保存 Markdown 文件失败: %w", err)
+	}
+	return nil
+}
+
+// normalizeExportHeading 章节标题压缩为单行
+func normalizeExportHeading(title string) string {
+	return strings.Join(strings.Fields(title), " ")
+}
+
+// normalizeExportText 统一换行、去掉行尾空白和多余空行，保留行首缩进
+func normalizeExportText(content string) string {
+	content = strings.NewReplacer("\r\n", "\n", "\r", "\n", "\ufeff", "", "\u200b", "").Replace(content)
+	lines := strings.Split(content, "\n")
+	for index, line := range lines {
+		lines[index] = strings.TrimRight(line, " \t\u3000\u00a0")
+	}
+	content = exportBlankLinesPattern.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.Trim(content, "\n")
+}
+
+// removeCJKInlineSpaces 去掉富文本提取时在行内元素两侧留下的、夹在中文字符之间的单个空格
+func removeCJKInlineSpaces(content string) string {
+	runes := []rune(content)
+	kept := runes[:0]
+	for index, char := range runes {
+		if char == ' ' && index > 0 && index+1 < len(runes) && isCJKExportRune(runes[index-1]) && isCJKExportRune(runes[index+1]) {
+			continue
+		}
+		kept = append(kept, char)
+	}
+	return string(kept)
+}
+
+func isCJKExportRune(char rune) bool {
+	return unicode.Is(unicode.Han, char) ||
+		char >= 0x3000 && char <= 0x303F ||
+		char >= 0xFF00 && char <= 0xFFEF
+}
+
+// convertHTMLToMarkdown 将净化后的章节 HTML 转为 Markdown，正文内的标题层级不高于 headingDepth+1
+func convertHTMLToMarkdown(content string, headingDepth int) string {
+	nodes, err := xhtml.ParseFragment(strings.NewReader(content), &xhtml.Node{
+		Type:     xhtml.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+	if err != nil {
+		return normalizeExportText(stripHTMLTags(content))
+	}
+
+	container := &xhtml.Node{Type: xhtml.ElementNode, Data: "body", DataAtom: atom.Body}
+	for _, node := range nodes {
+		container.AppendChild(node)
+	}
+
+	renderer := &markdownRenderer{headingDepth: headingDepth}
+	return strings.Join(renderer.renderBlocks(container), "\n\n")
+}
+
+// markdownRenderer 按块级元素拆分段落，块内元素转换为行内 Markdown
+type markdownRenderer struct {
+	headingDepth int
+}
+
+func isMarkdownBlockElement(node *xhtml.Node) bool {
+	if node.Type != xhtml.ElementNode {
+		return false
+	}
+	switch node.Data {
+	case "p", "div", "section", "article", "header", "footer", "main", "aside", "nav", "figure", "figcaption",
+		"h1", "h2", "h3", "h4", "h5", "h6", "ul", "ol", "li", "blockquote", "pre", "hr", "table", "dl", "dt", "dd":
+		return true
+	default:
+		return false
+	}
+}
+
+// renderBlocks 渲染 parent 的子节点，返回按空行分隔的块
+func (r *markdownRenderer) renderBlocks(parent *xhtml.Node) []string {
+	var blocks []string
+	var pending strings.Builder
+	flush := func() {
+		if paragraph := finishMarkdownParagraph(pending.String()); paragraph != "" {
+			blocks = append(blocks, paragraph)
+		}
+		pending.Reset()
+	}
+
+	for child := parent.FirstChild; child != nil; child = child.NextSibling {
+		if !isMarkdownBlockElement(child) {
+			pending.WriteString(r.renderInline(child))
+			continue
+		}
+
+		flush()
+		if block := r.renderBlock(child); block != "" {
+			blocks = append(blocks, block)
+		}
+	}
+	flush()
+	return blocks
+}
+
+func (r *markdownRenderer) renderBlock(node *xhtml.Node) string {
+	switch node.Data {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		text := strings.Join(strings.Fields(r.renderInlineChildren(node)), " ")
+		if text == "" {
+			return ""
+		}
+		depth := clampInt(maxInt(int(node.Data[1]-'0'), r.headingDepth+1), 1, 6)
+		return strings.Repeat("#", depth) + " " + text
+	case "p", "dt", "dd":
+		return finishMarkdownParagraph(r.renderInlineChildren(node))
+	case "figcaption":
+		if caption := finishMarkdownParagraph(r.renderInlineChildren(node)); caption != "" {
+			return "*" + caption + "*"
+		}
+		return ""
+	case "ul", "ol":
+		return r.renderList(node, node.Data == "ol")
+	case "blockquote":
+		return prefixMarkdownLines(strings.Join(r.renderBlocks(node), "\n\n"), "> ", ">")
+	case "pre":
+		code := strings.Trim(extractNodeText(node), "\n")
+		if code == "" {
+			return ""
+		}
+		return "```\n" + code + "\n```"
+	case "hr":
+		return "---"
+	case "table":
+		return r.renderTable(node)
+	default:
+		return strings.Join(r.renderBlocks(node), "\n\n")
+	}
+}
+
+// renderList 渲染列表，嵌套内容按标记宽度缩进
+func (r *markdownRenderer) renderList(node *xhtml.Node, ordered bool) string {
+	var items []string
+	number := 1
+	if start := getHTMLAttribute(node, "start"); start != "" {
+		fmt.Sscanf(start, "%d", &number)
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != xhtml.ElementNode || child.Data != "li" {
+			continue
+		}
+
+		marker := "- "
+		if ordered {
+			marker = fmt.Sprintf("%d. ", number)
+			number++
+		}
+		content := strings.Join(r.renderBlocks(child), "\n")
+		if content == "" {
+			continue
+		}
+		indent := strings.Repeat(" ", len(marker))
+		items = append(items, marker+prefixMarkdownLines(content, indent, "")[len(indent):])
+	}
+	return strings.Join(items, "\n")
+}
+
+// renderTable 渲染为 GFM 表格，第一行作为表头
+func (r *markdownRenderer) renderTable(node *xhtml.Node) string {
+	var rows [][]string
+	var walk func(*xhtml.Node)
+	walk = func(current *xhtml.Node) {
+		for child := current.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != xhtml.ElementNode {
+				continue
+			}
+			if child.Data != "tr" {
+				walk(child)
+				continue
+			}
+
+			var cells []string
+			for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.Type == xhtml.ElementNode && (cell.Data == "td" || cell.Data == "th") {
+					text := strings.Join(strings.Fields(r.renderInlineChildren(cell)), " ")
+					cells = append(cells, strings.ReplaceAll(text, "|", `\|`))
+				}
+			}
+			if len(cells) > 0 {
+				rows = append(rows, cells)
+			}
+		}
+	}
+	walk(node)
+	if len(rows) == 0 {
+		return ""
+	}
+
+	columns := 0
+	for _, row := range rows {
+		columns = maxInt(columns, len(row))
+	}
+	lines := make([]string, 0, len(rows)+1)
+	for index, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		lines = append(lines, "| "+strings.Join(row, " | ")+" |")
+		if index == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", columns))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *markdownRenderer) renderInlineChildren(node *xhtml.Node) string {
+	var builder strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		builder.WriteString(r.renderInline(child))
+	}
+	return builder.String()
+}
+
+func (r *markdownRenderer) renderInline(node *xhtml.Node) string {
+	switch node.Type {
+	case xhtml.TextNode:
+		return escapeMarkdownText(collapseMarkdownWhitespace(node.Data))
+	case xhtml.ElementNode:
+	default:
+		return ""
+	}
+
+	switch node.Data {
+	case "br":
+		return "  \n"
+	case "img":
+		src := getHTMLAttribute(node, "src")
+		if src == "" || strings.HasPrefix(src, "data:") {
+			return escapeMarkdownText(getHTMLAttribute(node, "alt"))
+		}
+		return "![" + escapeMarkdownText(getHTMLAttribute(node, "alt")) + "](" + formatMarkdownDestination(src) + ")"
+	case "strong", "b":
+		return wrapMarkdownInline(r.renderInlineChildren(node), "**")
+	case "em", "i", "cite":
+		return wrapMarkdownInline(r.renderInlineChildren(node), "*")
+	case "del", "s", "strike":
+		return wrapMarkdownInline(r.renderInlineChildren(node), "~~")
+	case "code":
+		code := strings.ReplaceAll(extractNodeText(node), "`", "'")
+		if strings.TrimSpace(code) == "" {
+			return code
+		}
+		return "`" + code + "`"
+	case "a":
+		text := r.renderInlineChildren(node)
+		href := getHTMLAttribute(node, "href")
+		// 书内锚点在导出后失效，只保留文字
+		if strings.TrimSpace(text) == "" || !strings.Contains(href, "://") && !strings.HasPrefix(href, "mailto:") {
+			return text
+		}
+		return "[" + text + "](" + formatMarkdownDestination(href) + ")"
+	case "script", "style":
+		return ""
+	default:
+		if isMarkdownBlockElement(node) {
+			return " " + r.renderInlineChildren(node) + " "
+		}
+		return r.renderInlineChildren(node)
+	}
+}
+
+// wrapMarkdownInline 用标记包裹内容，首尾空白留在标记外侧
+func wrapMarkdownInline(content, marker string) string {
+	trimmed := strings.TrimSpace(content)
+	if trimmed == "" {
+		return content
+	}
+	start := strings.Index(content, trimmed)
+	return content[:start] + marker + trimmed + marker + content[start+len(trimmed):]
+}
+
+func collapseMarkdownWhitespace(content string) string {
+	fields := strings.Fields(content)
+	if len(fields) == 0 {
+		if content == "" {
+			return ""
+		}
+		return " "
+	}
+
+	collapsed := strings.Join(fields, " ")
+	if strings.TrimLeft(content, " \t\r\n") != content {
+		collapsed = " " + collapsed
+	}
+	if strings.TrimRight(content, " \t\r\n") != content {
+		collapsed += " "
+	}
+	return collapsed
+}
+
+func escapeMarkdownText(content string) string {
+	return markdownInlineEscapeReplace.Replace(content)
+}
+
+// formatMarkdownDestination 含空格或括号的路径用尖括号包裹
+func formatMarkdownDestination(destination string) string {
+	if strings.ContainsAny(destination, " ()<>") {
+		return "<" + strings.NewReplacer("<", "%3C", ">", "%3E").Replace(destination) + ">"
+	}
+	return destination
+}
+
+// finishMarkdownParagraph 整理段落空白，并转义行首会被识别为 Markdown 语法的字符
+func finishMarkdownParagraph(content string) string {
+	lines := strings.Split(content, "\n")
+	kept := lines[:0]
+	for index, line := range lines {
+		line = strings.TrimLeft(line, " ")
+		if index < len(lines)-1 {
+			// 保留硬换行所需的行尾两个空格
+			line = strings.TrimRight(line, " ") + "  "
+		} else {
+			line = strings.TrimRight(line, " ")
+		}
+		if markdownLineStartPattern.MatchString(line) {
+			line = `\` + line
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+func prefixMarkdownLines(content, prefix, emptyPrefix string) string {
+	lines := strings.Split(content, "\n")
+	for index, line := range lines {
+		if line == "" {
+			lines[index] = emptyPrefix
+		} else {
+			lines[index] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
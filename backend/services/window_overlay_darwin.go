@@ -47,6 +47,10 @@ static BOOL moyureaderOverlaySuppressCamouflageCollapseUntilReenter = NO;
 static NSMutableArray<NSDictionary *> *moyureaderOverlayActionQueue = nil;
 static NSArray<NSString *> *moyureaderOverlayChapterTitles = nil;
 static NSMutableArray<NSButton *> *moyureaderOverlayChapterButtons = nil;
+// 目录层级与折叠状态：分卷可折叠，折叠状态仅在本次阅读中保留，与阅读器侧栏一致
+static NSArray<NSNumber *> *moyureaderOverlayChapterLevels = nil;
+static NSMutableSet<NSNumber *> *moyureaderOverlayCollapsedChapterIndexes = nil;
+static NSMutableDictionary<NSNumber *, NSButton *> *moyureaderOverlayChapterToggleButtons = nil;
 static id moyureaderOverlayControlTarget = nil;
 static NSString *moyureaderOverlayCurrentText = @"";
 static int moyureaderOverlayCurrentFontSize = 16;
@@ -112,6 +116,8 @@ static void MoyuReaderRefreshOverlayControls(void);
 static void MoyuReaderRefreshOverlayProgressBar(void);
 static void MoyuReaderRefreshOverlayChapterButtons(void);
 static void MoyuReaderApplyOverlayChapterButtonStyles(void);
+static BOOL MoyuReaderOverlayChapterHasChildren(NSInteger index);
+static NSInteger MoyuReaderOverlayChapterLevel(NSInteger index);
 static void MoyuReaderEnqueueOverlayAction(NSString *type, NSInteger chapterIndex, double value, BOOL coalesce);
 static void MoyuReaderSetOverlayCamouflageEnabled(BOOL enabled);
 static void MoyuReaderSetOverlayCamouflageCollapsed(BOOL collapsed, BOOL animated);
@@ -603,6 +609,19 @@ static void MoyuReaderOverlayDebugLog(NSString *format, ...) {
 	MoyuReaderSetOverlayChapterPanelVisible(NO);
 	MoyuReaderEnqueueOverlayAction(@"chapter", sender.tag, NAN, NO);
 }
+
+- (void)handleToggleChapterCollapsed:(NSButton *)sender {
+	if (moyureaderOverlayCollapsedChapterIndexes == nil) {
+		moyureaderOverlayCollapsedChapterIndexes = [[NSMutableSet alloc] init];
+	}
+	NSNumber *key = @(sender.tag);
+	if ([moyureaderOverlayCollapsedChapterIndexes containsObject:key]) {
+		[moyureaderOverlayCollapsedChapterIndexes removeObject:key];
+	} else {
+		[moyureaderOverlayCollapsedChapterIndexes addObject:key];
+	}
+	MoyuReaderLayoutDesktopReaderOverlayViews();
+}
 @end
 
 @interface MoyuReaderOverlayScrollView : NSScrollView
@@ -1218,14 +1237,45 @@ static void MoyuReaderRefreshOverlayChapterButtons(void) {
 	}
 	[moyureaderOverlayChapterButtons removeAllObjects];
 
+	if (moyureaderOverlayChapterToggleButtons == nil) {
+		moyureaderOverlayChapterToggleButtons = [[NSMutableDictionary alloc] init];
+	}
+	for (NSButton *button in moyureaderOverlayChapterToggleButtons.allValues) {
+		[button removeFromSuperview];
+	}
+	[moyureaderOverlayChapterToggleButtons removeAllObjects];
+
 	for (NSInteger index = 0; index < moyureaderOverlayChapterTitles.count; index++) {
 		NSString *title = moyureaderOverlayChapterTitles[index];
 		NSButton *button = MoyuReaderCreateOverlayChapterButton(title, index);
 		[moyureaderOverlayChapterButtons addObject:button];
 		[moyureaderOverlayChapterListContentView addSubview:button];
+
+		if (MoyuReaderOverlayChapterHasChildren(index)) {
+			NSButton *toggleButton = MoyuReaderCreateOverlayActionButton(@"▾", @selector(handleToggleChapterCollapsed:));
+			[toggleButton setTag:index];
+			[toggleButton setToolTip:@"折叠或展开本卷"];
+			moyureaderOverlayChapterToggleButtons[@(index)] = toggleButton;
+			[moyureaderOverlayChapterListContentView addSubview:toggleButton];
+		}
 	}
 }
 
+// MoyuReaderOverlayChapterHasChildren 下一条目录层级更深时，该条目是可折叠的分卷
+static BOOL MoyuReaderOverlayChapterHasChildren(NSInteger index) {
+	if (index < 0 || index + 1 >= (NSInteger)moyureaderOverlayChapterLevels.count) {
+		return NO;
+	}
+	return moyureaderOverlayChapterLevels[index + 1].integerValue > moyureaderOverlayChapterLevels[index].integerValue;
+}
+
+static NSInteger MoyuReaderOverlayChapterLevel(NSInteger index) {
+	if (index < 0 || index >= (NSInteger)moyureaderOverlayChapterLevels.count) {
+		return 0;
+	}
+	return moyureaderOverlayChapterLevels[index].integerValue;
+}
+
 static void MoyuReaderApplyOverlayChapterButtonStyles(void) {
 	for (NSButton *button in moyureaderOverlayChapterButtons) {
 		BOOL selected = (button.tag == moyureaderOverlayCurrentChapterIndex);
@@ -1259,7 +1309,7 @@ static void MoyuReaderScrollCurrentChapterButtonIntoView(void) {
 	CGFloat maxOffsetY = MAX(0.0, contentHeight - visibleHeight);
 
 	for (NSButton *button in moyureaderOverlayChapterButtons) {
-		if (button.tag == moyureaderOverlayCurrentChapterIndex) {
+		if (button.tag == moyureaderOverlayCurrentChapterIndex && !button.isHidden) {
 			CGFloat targetY = NSMidY(button.frame) - (visibleHeight / 2.0);
 			targetY = MIN(MAX(targetY, 0.0), maxOffsetY);
 			[clipView scrollToPoint:NSMakePoint(0.0, targetY)];
@@ -2466,14 +2516,38 @@ static void MoyuReaderLayoutDesktopReaderOverlayViews(void) {
 		[moyureaderOverlayChapterListScrollView setFrame:NSInsetRect(moyureaderOverlayChapterPanelView.bounds, 8.0, 8.0)];
 
 		CGFloat contentWidth = NSWidth(moyureaderOverlayChapterListScrollView.bounds);
+		CGFloat rowWidth = MAX(60.0, contentWidth - 16.0);
 		CGFloat currentButtonY = 8.0;
+		// 折叠分卷下层级更深的条目隐藏，遇到同级或更浅的条目时恢复显示
+		NSInteger collapsedLevel = -1;
 		for (NSButton *button in moyureaderOverlayChapterButtons) {
-			[button setFrame:NSMakeRect(
-				8.0,
-				currentButtonY,
-				MAX(60.0, contentWidth - 16.0),
-				MoyuReaderOverlayChapterRowHeight
-			)];
+			NSInteger index = button.tag;
+			NSInteger level = MoyuReaderOverlayChapterLevel(index);
+			NSButton *toggleButton = moyureaderOverlayChapterToggleButtons[@(index)];
+			BOOL hidden = collapsedLevel >= 0 && level > collapsedLevel;
+			[button setHidden:hidden];
+			[toggleButton setHidden:hidden];
+			if (hidden) {
+				continue;
+			}
+
+			collapsedLevel = -1;
+			if (toggleButton == nil) {
+				[button setFrame:NSMakeRect(8.0, currentButtonY, rowWidth, MoyuReaderOverlayChapterRowHeight)];
+			} else {
+				BOOL collapsed = [moyureaderOverlayCollapsedChapterIndexes containsObject:@(index)];
+				if (collapsed) {
+					collapsedLevel = level;
+				}
+				[button setFrame:NSMakeRect(8.0, currentButtonY, rowWidth - 34.0, MoyuReaderOverlayChapterRowHeight)];
+				[toggleButton setFrame:NSMakeRect(8.0 + rowWidth - 28.0, currentButtonY, 28.0, MoyuReaderOverlayChapterRowHeight)];
+				MoyuReaderSetOverlayButtonTitle(
+					toggleButton,
+					(collapsed ? @"▸" : @"▾"),
+					[[NSColor whiteColor] colorWithAlphaComponent:0.92],
+					[NSFont systemFontOfSize:12.0 weight:NSFontWeightSemibold]
+				);
+			}
 			currentButtonY += MoyuReaderOverlayChapterRowHeight + MoyuReaderOverlayChapterRowGap;
 		}
 		[moyureaderOverlayChapterListContentView setFrame:NSMakeRect(
@@ -2661,7 +2735,9 @@ static void MoyuReaderEnsureDesktopReaderOverlayWindow(void) {
 	MoyuReaderLayoutDesktopReaderOverlayViews();
 }
 
-static NSArray<NSString *> *MoyuReaderParseOverlayChapterTitles(const char *chaptersJSON) {
+// MoyuReaderParseOverlayChapterTitles 解析目录标题，levels 返回与标题一一对应的层级
+static NSArray<NSString *> *MoyuReaderParseOverlayChapterTitles(const char *chaptersJSON, NSArray<NSNumber *> **levels) {
+	*levels = @[];
 	if (chaptersJSON == NULL) {
 		return @[];
 	}
@@ -2682,17 +2758,33 @@ static NSArray<NSString *> *MoyuReaderParseOverlayChapterTitles(const char *chap
 	}
 
 	NSMutableArray<NSString *> *titles = [NSMutableArray array];
+	NSMutableArray<NSNumber *> *titleLevels = [NSMutableArray array];
 	for (id item in (NSArray *)parsed) {
 		if ([item isKindOfClass:[NSString class]]) {
 			[titles addObject:item];
+			[titleLevels addObject:@0];
+			continue;
+		}
+
+		// 带层级的目录条目：{"title": "...", "level": 1}，按层级缩进展示卷下的章节
+		if ([item isKindOfClass:[NSDictionary class]]) {
+			id title = ((NSDictionary *)item)[@"title"];
+			id level = ((NSDictionary *)item)[@"level"];
+			NSString *titleString = [title isKindOfClass:[NSString class]] ? (NSString *)title : @"";
+			NSInteger levelValue = [level isKindOfClass:[NSNumber class]] ? MAX([(NSNumber *)level integerValue], 0) : 0;
+			NSString *indent = [@"" stringByPaddingToLength:(NSUInteger)MIN(levelValue, 4) * 2 withString:@"\u3000" startingAtIndex:0];
+			[titles addObject:[indent stringByAppendingString:titleString]];
+			[titleLevels addObject:@(levelValue)];
 			continue;
 		}
 
 		if (item != nil) {
 			[titles addObject:[item description]];
+			[titleLevels addObject:@0];
 		}
 	}
 
+	*levels = [titleLevels copy];
 	return [titles copy];
 }
 
@@ -2701,10 +2793,15 @@ static void MoyuReaderUpdateDesktopReaderOverlayControls(const char *chaptersJSO
 	dispatch_async(dispatch_get_main_queue(), ^{
 		MoyuReaderEnsureDesktopReaderOverlayWindow();
 
-		NSArray<NSString *> *nextTitles = MoyuReaderParseOverlayChapterTitles(chaptersJSONCopy);
+		NSArray<NSNumber *> *nextLevels = nil;
+		NSArray<NSString *> *nextTitles = MoyuReaderParseOverlayChapterTitles(chaptersJSONCopy, &nextLevels);
 		BOOL shouldKeepExistingTitles = nextTitles.count == 0 && moyureaderOverlayChapterTitles.count > 0;
-		if (!shouldKeepExistingTitles && ![moyureaderOverlayChapterTitles isEqualToArray:nextTitles]) {
+		if (!shouldKeepExistingTitles && (![moyureaderOverlayChapterTitles isEqualToArray:nextTitles] ||
+		                                  ![moyureaderOverlayChapterLevels isEqualToArray:nextLevels])) {
 			moyureaderOverlayChapterTitles = nextTitles;
+			moyureaderOverlayChapterLevels = nextLevels;
+			// 目录换了（换书或重新分章），之前的折叠状态不再对应
+			[moyureaderOverlayCollapsedChapterIndexes removeAllObjects];
 			MoyuReaderRefreshOverlayChapterButtons();
 		}
 
@@ -1,12 +1,24 @@
 import { RouterProvider } from 'react-router-dom'
 import { router } from './router'
 import { useFixWailsDrag } from './hooks/useFixWailsDrag'
+import { useLibraryIndexSync } from './hooks/useLibraryIndexSync'
+import { useProgressRecoveryNotice } from './hooks/useProgressRecoveryNotice'
+import PasswordModal from './components/features/PasswordModal'
 
 /**
  * App 根组件。
- * 负责挂载全局路由，并在桌面端补上 Wails 窗口拖拽区域修复。
+ * 负责挂载全局路由和全局弹窗，在桌面端补上 Wails 窗口拖拽区域修复，并把书架同步给后端书库索引；
+ * 阅读进度从备份恢复过时给出提示。
  */
 export default function App() {
   useFixWailsDrag()
-  return <RouterProvider router={router} />
+  useLibraryIndexSync()
+  const progressRecoveryNotice = useProgressRecoveryNotice()
+  return (
+    <>
+      {progressRecoveryNotice}
+      <RouterProvider router={router} />
+      <PasswordModal />
+    </>
+  )
 }
@@ -0,0 +1,126 @@
+import { useCallback, useEffect, useRef, useState } from 'react'
+import { LockKeyhole } from 'lucide-react'
+import Button from '@/components/common/Button'
+import Dialog from '@/components/common/Dialog'
+import Input from '@/components/common/Input'
+import Toggle from '@/components/common/Toggle'
+import {
+  setPasswordRequester,
+  type PasswordAnswer,
+  type PasswordRequest,
+} from '@/services/novelBridge'
+import styles from './PasswordModal.module.scss'
+
+interface PendingRequest extends PasswordRequest {
+  resolve: (answer: PasswordAnswer | null) => void
+}
+
+/**
+ * PasswordModal 加密 PDF 密码弹窗
+ * 挂载在应用根部，打开加密 PDF 时由小说桥接层唤起。
+ */
+export default function PasswordModal() {
+  const inputRef = useRef<HTMLInputElement>(null)
+  const [pending, setPending] = useState<PendingRequest | null>(null)
+  const [password, setPassword] = useState('')
+  const [remember, setRemember] = useState(true)
+
+  useEffect(() => {
+    setPasswordRequester(
+      (request) =>
+        new Promise<PasswordAnswer | null>((resolve) => {
+          setPassword('')
+          setPending({ ...request, resolve })
+        })
+    )
+    return () => setPasswordRequester(null)
+  }, [])
+
+  useEffect(() => {
+    if (!pending) {
+      return
+    }
+
+    const timer = window.setTimeout(() => inputRef.current?.focus(), 20)
+    return () => window.clearTimeout(timer)
+  }, [pending])
+
+  const handleClose = useCallback(() => {
+    pending?.resolve(null)
+    setPending(null)
+  }, [pending])
+
+  const handleConfirm = () => {
+    if (!pending || !password) {
+      return
+    }
+
+    pending.resolve({ password, remember })
+    setPending(null)
+  }
+
+  const fileName = pending?.filePath.split(/[\\/]/).pop() || ''
+
+  return (
+    <Dialog
+      open={Boolean(pending)}
+      onClose={handleClose}
+      width={460}
+      variant="brutal"
+      showCloseButton={false}
+      closeOnBackdrop={false}
+    >
+      <div className={styles.content}>
+        <div className={styles.header}>
+          <div className={styles.iconBadge}>
+            <LockKeyhole size={22} />
+          </div>
+          <div className={styles.copy}>
+            <span className={styles.eyebrow}>加密 PDF</span>
+            <h3 className={styles.title}>{fileName}</h3>
+            <p className={styles.description}>该文件受密码保护，输入打开密码后继续阅读。</p>
+          </div>
+        </div>
+
+        <div className={styles.form}>
+          <label className={styles.label} htmlFor="pdf-password-input">
+            打开密码
+          </label>
+          <Input
+            ref={inputRef}
+            fullWidth
+            id="pdf-password-input"
+            type="password"
+            autoComplete="off"
+            value={password}
+            error={pending?.incorrect ? '密码错误，请重新输入' : undefined}
+            onChange={(event) => setPassword(event.target.value)}
+            onKeyDown={(event) => {
+              if (event.key === 'Enter') {
+                handleConfirm()
+              }
+            }}
+          />
+          <div className={styles.remember}>
+            <span>记住密码，下次从书架打开时无需输入</span>
+            <Toggle
+              checked={remember}
+              onChange={setRemember}
+              checkedLabel="记住"
+              uncheckedLabel="不记住"
+            />
+          </div>
+        </div>
+
+        <div className={styles.actions}>
+          <Button variant="secondary" onClick={handleClose}>
+            取消
+          </Button>
+          <Button variant="primary" onClick={handleConfirm} disabled={!password}>
+            打开
+          </Button>
+        </div>
+      </div>
+    </Dialog>
+  )
+}
@@ -0,0 +1,45 @@
+import { useEffect } from 'react'
+import { useLibraryStore } from '@/stores/libraryStore'
+import { syncLibraryIndex } from '@/services/novelBridge'
+import type { Book } from '@/types'
+
+// 书架频繁变动（批量导入、拖动排序）时合并为一次同步
+const SYNC_DELAY_MS = 1000
+
+function collectShelfFilePaths(books: Book[]) {
+  const filePaths: string[] = []
+  books.forEach((book) => {
+    if (book.isDirectory) {
+      book.files?.forEach((file) => filePaths.push(file.filePath))
+    } else if (book.filePath) {
+      filePaths.push(book.filePath)
+    }
+  })
+  return filePaths
+}
+
+/**
+ * useLibraryIndexSync Hook
+ * 书架变化或窗口重新获得焦点时，把书架文件列表同步给后端书库索引，
+ * 后端据此增量索引新增、修改的书并移除已删除的书
+ */
+export function useLibraryIndexSync() {
+  const books = useLibraryStore((state) => state.books)
+
+  useEffect(() => {
+    const filePaths = collectShelfFilePaths(books)
+    const sync = () => {
+      syncLibraryIndex(filePaths).catch((error) => {
+        console.error('同步书库索引失败:', error)
+      })
+    }
+
+    const timer = window.setTimeout(sync, SYNC_DELAY_MS)
+    window.addEventListener('focus', sync)
+
+    return () => {
+      window.clearTimeout(timer)
+      window.removeEventListener('focus', sync)
+    }
+  }, [books])
+}
@@ -0,0 +1,54 @@
+import { useEffect } from 'react'
+import { message } from 'antd'
+import { EventsOn } from '@/wailsjs/runtime/runtime'
+import {
+  clearProgressRecovery,
+  getProgressRecovery,
+  type ProgressRecovery,
+} from '@/services/novelBridge'
+
+function hasWailsRuntimeEvents() {
+  const runtime = (window as Window & { runtime?: { EventsOnMultiple?: unknown } }).runtime
+  return typeof runtime?.EventsOnMultiple === 'function'
+}
+
+function describeRecovery(recovery: ProgressRecovery) {
+  if (recovery.backup) {
+    return `阅读进度文件异常，已从备份 ${recovery.backup} 恢复，最近的少量进度可能丢失`
+  }
+  return '阅读进度文件异常且没有可用备份，阅读进度已重置'
+}
+
+/**
+ * useProgressRecoveryNotice Hook
+ * 后端启动时若从备份恢复了阅读进度，提示用户一次；
+ * 启动阶段发出的事件前端可能还没订阅，所以挂载时再主动查询一次
+ */
+export function useProgressRecoveryNotice() {
+  const [messageApi, contextHolder] = message.useMessage()
+
+  useEffect(() => {
+    const notify = (recovery: ProgressRecovery | null) => {
+      if (!recovery) {
+        return
+      }
+      messageApi.warning({ content: describeRecovery(recovery), duration: 8 })
+      clearProgressRecovery().catch((error) => {
+        console.error('清除进度恢复记录失败:', error)
+      })
+    }
+
+    getProgressRecovery()
+      .then(notify)
+      .catch((error) => {
+        console.error('读取进度恢复记录失败:', error)
+      })
+
+    if (!hasWailsRuntimeEvents()) {
+      return
+    }
+    return EventsOn('progress:recovered', notify)
+  }, [messageApi])
+
+  return contextHolder
+}
@@ -1,4 +1,4 @@
-import { memo, useEffect, useMemo, useRef, useState } from 'react'
+import { memo, useCallback, useEffect, useMemo, useRef, useState } from 'react'
 import type {
   CSSProperties,
   MutableRefObject,
@@ -10,6 +10,7 @@ import type {
   CamouflageWidgetPosition,
   Novel,
   ReaderContentBlock,
+  SearchHistoryEntry,
   SearchResult,
 } from '@/types'
 import { useNovelStore } from '@/stores/novelStore'
@@ -38,11 +39,21 @@ import {
 } from '@/wailsjs/go/services/WindowService'
 import { EventsOn } from '@/wailsjs/runtime/runtime'
 import {
+  cancelSearch,
+  flushProgress,
   getChapterContentPayload,
+  getComicOptions,
+  getSearchHistory,
   openNovel,
+  recordSearch,
   saveReadingProgress,
   searchNovel,
+  setComicOptions,
   setCurrentChapter,
+  startSearch,
+  type ComicOptions,
+  type SearchBatchEvent,
+  type SearchProgressEvent,
 } from '@/services/novelBridge'
 import { useBossMode } from '@/hooks/useBossMode'
 import { useClickOutside } from '@/hooks/useClickOutside'
@@ -55,6 +66,7 @@ import {
   calculateProgressFromPosition,
   CONTENT_CHUNK_CLASS_NAME,
   findChapterIndexByPosition,
+  isChapterCollapsed,
   isRichChapterContent,
   mapNovelToBook,
   normalizeNovel,
@@ -566,10 +578,16 @@ export default function Reader() {
   const { upsertBook, updateProgressByFilePath } = useLibraryStore()
 
   const [showSidebar, setShowSidebar] = useState(false)
+  const [collapsedChapterIndexes, setCollapsedChapterIndexes] = useState<Set<number>>(
+    () => new Set()
+  )
   const [showSearch, setShowSearch] = useState(false)
+  const [comicOptions, setComicOptionsState] = useState<ComicOptions | null>(null)
   const [showAppearancePanel, setShowAppearancePanel] = useState(false)
   const [searchKeyword, setSearchKeyword] = useState('')
   const [searchResults, setSearchResults] = useState<SearchResult[]>([])
+  const [searchProgress, setSearchProgress] = useState<SearchProgressEvent | null>(null)
+  const [searchHistory, setSearchHistory] = useState<SearchHistoryEntry[]>([])
   const [loadedChapters, setLoadedChapters] = useState<LoadedChapter[]>([])
   const [loadingChapterIndexes, setLoadingChapterIndexes] = useState<number[]>([])
   const [supportsDesktopOverlay, setSupportsDesktopOverlay] = useState(false)
@@ -585,6 +603,10 @@ export default function Reader() {
   const scrollTickingRef = useRef(false)
   const chapterWindowMaintainTimerRef = useRef<number | null>(null)
   const appearancePanelRef = useRef<HTMLDivElement>(null)
+  const searchJobIdRef = useRef<string | null>(null)
+  const searchRequestRef = useRef(0)
+  const pendingSearchEventsRef = useRef<Array<SearchBatchEvent | SearchProgressEvent> | null>(null)
+  const searchQueryRef = useRef<{ filePath: string; keyword: string } | null>(null)
   const bossPanelRef = useRef<HTMLDivElement>(null)
   const sidebarRef = useRef<HTMLDivElement>(null)
   const chapterLoadRevisionRef = useRef(0)
@@ -812,9 +834,12 @@ const camouflageWidgetClassName = `${styles.camouflageWidget} ${
       camouflageEnabled: bossCamouflageEnabled,
     })
 
-    const chapterTitles = novel.chapters.map((chapter) => chapter.title)
+    const chapterEntries = novel.chapters.map((chapter) => ({
+      title: chapter.title,
+      level: chapter.level,
+    }))
     await UpdateDesktopReaderOverlayControls(
-      JSON.stringify(chapterTitles),
+      JSON.stringify(chapterEntries),
       novel.currentChapter,
       Number(novel.readProgress || 0),
       nextOpacity,
@@ -822,6 +847,19 @@ const camouflageWidgetClassName = `${styles.camouflageWidget} ${
     )
   }
 
+  // 折叠或展开目录中的分卷，折叠状态仅在本次阅读中保留。
+  const toggleChapterCollapsed = (chapterIndex: number) => {
+    setCollapsedChapterIndexes((previous) => {
+      const next = new Set(previous)
+      if (next.has(chapterIndex)) {
+        next.delete(chapterIndex)
+      } else {
+        next.add(chapterIndex)
+      }
+      return next
+    })
+  }
+
   const clearBossOpacityPersistTimer = () => {
     if (bossOpacityPersistTimerRef.current === null) {
       return
@@ -1767,6 +1805,62 @@ const handleToggleCamouflage = () => {
     await moveToReadingLocation(chapterIndex, 0)
   }
 
+  // 从右到左阅读的漫画，左方向键与左侧按钮翻到下一页
+  const isComicRightToLeft = currentNovel?.format === '.cbz' && Boolean(comicOptions?.rightToLeft)
+
+  useEffect(() => {
+    setComicOptionsState(null)
+    if (!currentNovel?.filePath || currentNovel.format !== '.cbz') {
+      return
+    }
+
+    let disposed = false
+    void getComicOptions(currentNovel.filePath)
+      .then((options) => {
+        if (!disposed) {
+          setComicOptionsState(options)
+        }
+      })
+      .catch((error) => {
+        console.error('读取漫画阅读选项失败:', error)
+      })
+
+    return () => {
+      disposed = true
+    }
+  }, [currentNovel?.filePath, currentNovel?.format])
+
+  // 修改每章页数会重新分章，按后端换算的当前章节重新加载正文
+  const handleComicOptionsChange = async (nextOptions: ComicOptions) => {
+    const novel = currentNovelRef.current
+    if (!novel) {
+      return
+    }
+
+    try {
+      const updatedNovel = normalizeNovel(await setComicOptions(novel.filePath, nextOptions))
+      setComicOptionsState(nextOptions)
+      currentNovelRef.current = updatedNovel
+      setCurrentNovel(updatedNovel)
+
+      const nextRevision = resetLoadedChapterState()
+      pendingChapterScrollRef.current = {
+        chapterIndex: updatedNovel.currentChapter,
+        chapterScrollProgress: 0,
+        behavior: 'auto',
+      }
+      await ensureChapterLoaded(updatedNovel.filePath, updatedNovel.currentChapter, nextRevision)
+      if (nextRevision === chapterLoadRevisionRef.current) {
+        void ensureChapterWindow(updatedNovel.currentChapter, {
+          preserveLocation: true,
+          expectedRevision: nextRevision,
+        })
+      }
+    } catch (error) {
+      console.error('设置漫画阅读选项失败:', error)
+    }
+  }
+
   const handlePrevChapter = () => {
     const novel = currentNovelRef.current
     if (!novel || novel.currentChapter <= 0) {
@@ -1789,16 +1883,105 @@ const handleToggleCamouflage = () => {
     void handleChapterChange(novel.currentChapter + 1)
   }
 
-  const handleSearch = async () => {
-    if (!searchKeyword.trim() || !currentNovel) {
-      setSearchResults([])
+  // 取消正在进行的搜索任务，之后收到的该任务事件都会被忽略
+  const stopSearchJob = useCallback(() => {
+    searchRequestRef.current += 1
+    pendingSearchEventsRef.current = null
+    const jobId = searchJobIdRef.current
+    searchJobIdRef.current = null
+    setSearchProgress(null)
+    if (jobId) {
+      void cancelSearch(jobId).catch((error) => {
+        console.error('取消搜索失败:', error)
+      })
+    }
+  }, [])
+
+  const refreshSearchHistory = useCallback(async (filePath: string) => {
+    try {
+      const entries = await getSearchHistory(filePath)
+      if (currentNovelRef.current?.filePath === filePath) {
+        setSearchHistory(entries)
+      }
+    } catch (error) {
+      console.error('读取搜索历史失败:', error)
+    }
+  }, [])
+
+  // 搜索完成后记下检索词和命中数，下次可以直接从历史里重搜
+  const rememberSearch = useCallback(
+    (filePath: string, keyword: string, hitCount: number) => {
+      void recordSearch(filePath, { keyword, mode: '', caseSensitive: false }, hitCount)
+        .then(() => refreshSearchHistory(filePath))
+        .catch((error) => {
+          console.error('记录搜索历史失败:', error)
+        })
+    },
+    [refreshSearchHistory]
+  )
+
+  const applySearchEvent = useCallback(
+    (event: SearchBatchEvent | SearchProgressEvent) => {
+      if ('results' in event) {
+        const results = event.results || []
+        setSearchResults((previous) => [...previous, ...results])
+        return
+      }
+
+      setSearchProgress(event)
+      if (event.done) {
+        searchJobIdRef.current = null
+        if (event.error) {
+          console.error('搜索失败:', event.error)
+        } else if (!event.cancelled && searchQueryRef.current) {
+          rememberSearch(searchQueryRef.current.filePath, searchQueryRef.current.keyword, event.count)
+        }
+      }
+    },
+    [rememberSearch]
+  )
+
+  const handleSearch = async (keywordOverride?: string) => {
+    stopSearchJob()
+    setSearchResults([])
+    setSearchProgress(null)
+    const keyword = (keywordOverride ?? searchKeyword).trim()
+    if (!keyword || !currentNovel) {
+      searchQueryRef.current = null
+      return
+    }
+    searchQueryRef.current = { filePath: currentNovel.filePath, keyword }
+
+    // 没有 Wails 事件时无法接收分批结果，退回一次性搜索
+    if (!hasWailsRuntimeEvents()) {
+      try {
+        const results = await searchNovel(currentNovel.filePath, keyword, false)
+        setSearchResults(results || [])
+        rememberSearch(currentNovel.filePath, keyword, results?.length || 0)
+      } catch (error) {
+        console.error('搜索失败:', error)
+      }
       return
     }
 
+    const requestId = searchRequestRef.current
+    // 任务 ID 返回之前到达的事件先缓存，拿到 ID 后再按 ID 过滤补上
+    pendingSearchEventsRef.current = []
     try {
-      const results = await searchNovel(currentNovel.filePath, searchKeyword.trim(), false)
-      setSearchResults(results || [])
+      const jobId = await startSearch(currentNovel.filePath, { keyword })
+      if (requestId !== searchRequestRef.current) {
+        void cancelSearch(jobId).catch(() => undefined)
+        return
+      }
+
+      const pendingEvents = pendingSearchEventsRef.current || []
+      pendingSearchEventsRef.current = null
+      searchJobIdRef.current = jobId
+      pendingEvents.filter((event) => event.job_id === jobId).forEach(applySearchEvent)
     } catch (error) {
+      if (requestId === searchRequestRef.current) {
+        pendingSearchEventsRef.current = null
+      }
       console.error('搜索失败:', error)
     }
   }
@@ -1987,6 +2170,7 @@ useEffect(() => {
   useEffect(() => {
     if (!currentNovel) {
       resetLoadedChapterState()
+      stopSearchJob()
       setSearchResults([])
       return
     }
@@ -2037,6 +2221,10 @@ useEffect(() => {
     }
   }, [loadedChapters, fontSize, lineHeight, pageWidth])
 
+  useEffect(() => {
+    setCollapsedChapterIndexes(new Set())
+  }, [currentNovel?.filePath])
+
   useEffect(() => {
     if (!showSidebar || !currentNovel) {
       return
@@ -2379,6 +2567,42 @@ useEffect(() => {
     }
   }, [setOpacity, setStealthMode])
 
+  useEffect(() => {
+    if (!showSearch || !currentNovel?.filePath) {
+      setSearchHistory([])
+      return
+    }
+
+    void refreshSearchHistory(currentNovel.filePath)
+  }, [currentNovel?.filePath, refreshSearchHistory, showSearch])
+
+  useEffect(() => {
+    if (!hasWailsRuntimeEvents()) {
+      return
+    }
+
+    const handleSearchEvent = (event: SearchBatchEvent | SearchProgressEvent) => {
+      if (!event) {
+        return
+      }
+      if (pendingSearchEventsRef.current) {
+        pendingSearchEventsRef.current.push(event)
+        return
+      }
+      if (event.job_id === searchJobIdRef.current) {
+        applySearchEvent(event)
+      }
+    }
+    const offSearchBatch = EventsOn('search:batch', handleSearchEvent)
+    const offSearchProgress = EventsOn('search:progress', handleSearchEvent)
+
+    return () => {
+      offSearchBatch()
+      offSearchProgress()
+      stopSearchJob()
+    }
+  }, [applySearchEvent, stopSearchJob])
+
   useEffect(() => {
     const handleKeyPress = (event: KeyboardEvent) => {
       const target = event.target as HTMLElement | null
@@ -2389,10 +2613,18 @@ useEffect(() => {
 
       if (matchesShortcut(event, keyboardShortcuts.prevChapter) && !isTypingTarget) {
         event.preventDefault()
-        handlePrevChapter()
+        if (isComicRightToLeft) {
+          handleNextChapter()
+        } else {
+          handlePrevChapter()
+        }
       } else if (matchesShortcut(event, keyboardShortcuts.nextChapter) && !isTypingTarget) {
         event.preventDefault()
-        handleNextChapter()
+        if (isComicRightToLeft) {
+          handlePrevChapter()
+        } else {
+          handleNextChapter()
+        }
       } else if (matchesShortcut(event, keyboardShortcuts.openSearch)) {
         event.preventDefault()
         setShowSearch(true)
@@ -2419,7 +2651,15 @@ useEffect(() => {
 
     window.addEventListener('keydown', handleKeyPress)
     return () => window.removeEventListener('keydown', handleKeyPress)
-  }, [bossMode, bossOpacity, currentNovel, handleReturnHome, isStealthMode, keyboardShortcuts])
+  }, [
+    bossMode,
+    bossOpacity,
+    currentNovel,
+    handleReturnHome,
+    isComicRightToLeft,
+    isStealthMode,
+    keyboardShortcuts,
+  ])
 
   useEffect(() => {
     const contentElement = contentRef.current
@@ -2474,6 +2714,19 @@ useEffect(() => {
     }
   }, [currentNovel?.filePath, loadedChapters.length])
 
+  // 后端合并写盘，离开阅读页或换书时立即写入，避免最后的位置只留在内存里
+  useEffect(() => {
+    if (!currentNovel?.filePath) {
+      return
+    }
+
+    return () => {
+      void flushProgress().catch((error) => {
+        console.error('写入阅读进度失败:', error)
+      })
+    }
+  }, [currentNovel?.filePath])
+
   if (!currentNovel && pendingRouteFilePath) {
     return (
       <div className={styles.empty}>
@@ -2546,6 +2799,7 @@ return (
               type="button"
               onClick={handlePrevChapter}
               className={styles.toolbarButton}
+              style={isComicRightToLeft ? { order: 1 } : undefined}
               disabled={currentNovel.currentChapter <= 0}
               title="上一章"
             >
@@ -2560,6 +2814,42 @@ return (
             >
               下一章
             </button>
+            {comicOptions && (
+              <>
+                <button
+                  type="button"
+                  style={{ order: 2 }}
+                  onClick={() =>
+                    void handleComicOptionsChange({
+                      ...comicOptions,
+                      rightToLeft: !comicOptions.rightToLeft,
+                    })
+                  }
+                  className={`${styles.toolbarButton} ${
+                    comicOptions.rightToLeft ? styles.active : ''
+                  }`}
+                  title="切换漫画阅读方向"
+                >
+                  {comicOptions.rightToLeft ? '从右到左' : '从左到右'}
+                </button>
+                <button
+                  type="button"
+                  style={{ order: 2 }}
+                  onClick={() =>
+                    void handleComicOptionsChange({
+                      ...comicOptions,
+                      pagesPerChapter: comicOptions.pagesPerChapter > 1 ? 1 : 2,
+                    })
+                  }
+                  className={`${styles.toolbarButton} ${
+                    comicOptions.pagesPerChapter > 1 ? styles.active : ''
+                  }`}
+                  title="切换单页或双页同屏"
+                >
+                  {comicOptions.pagesPerChapter > 1 ? '双页' : '单页'}
+                </button>
+              </>
+            )}
           </div>
 
           <div className={styles.toolbarRight}>
@@ -2666,21 +2956,46 @@ return (
               </button>
             </div>
             <div ref={chapterListRef} className={styles.chapterList}>
-              {currentNovel.chapters.map((chapter, index) => (
-                <button
-                  key={`${chapter.title}-${chapter.index}`}
-                  ref={(element) => {
-                    chapterItemRefs.current[index] = element
-                  }}
-                  className={`${styles.chapterItem} ${
-                    index === currentNovel.currentChapter ? styles.active : ''
-                  }`}
-                  onClick={() => void handleChapterChange(index)}
-                >
-                  <span className={styles.chapterItemTitle}>{chapter.title}</span>
-                  <span className={styles.chapterItemMeta}>{chapter.wordCount} 字</span>
-                </button>
-              ))}
+              {currentNovel.chapters.map((chapter, index) => {
+                if (isChapterCollapsed(currentNovel.chapters, index, collapsedChapterIndexes)) {
+                  return null
+                }
+
+                const hasChildren = currentNovel.chapters[index + 1]?.parentIndex === index
+                const isCollapsed = collapsedChapterIndexes.has(index)
+
+                return (
+                  <button
+                    key={`${chapter.title}-${chapter.index}`}
+                    ref={(element) => {
+                      chapterItemRefs.current[index] = element
+                    }}
+                    className={`${styles.chapterItem} ${
+                      index === currentNovel.currentChapter ? styles.active : ''
+                    }`}
+                    style={{ paddingLeft: `calc(var(--spacing-md) + ${chapter.level * 16}px)` }}
+                    onClick={() => void handleChapterChange(index)}
+                  >
+                    <span className={styles.chapterItemTitle}>
+                      {hasChildren && (
+                        <span
+                          role="button"
+                          aria-expanded={!isCollapsed}
+                          className={styles.chapterItemToggle}
+                          onClick={(event) => {
+                            event.stopPropagation()
+                            toggleChapterCollapsed(index)
+                          }}
+                        >
+                          {isCollapsed ? '▸' : '▾'}
+                        </span>
+                      )}
+                      {chapter.title}
+                    </span>
+                    <span className={styles.chapterItemMeta}>{chapter.wordCount} 字</span>
+                  </button>
+                )
+              })}
             </div>
           </aside>
         )}
@@ -2701,7 +3016,11 @@ return (
               <input
                 type="text"
                 value={searchKeyword}
-                onChange={(event) => setSearchKeyword(event.target.value)}
+                onChange={(event) => {
+                  // 关键字变了，正在进行的搜索结果已经过时
+                  stopSearchJob()
+                  setSearchKeyword(event.target.value)
+                }}
                 placeholder="输入搜索关键字"
                 onKeyDown={(event) => {
                   if (event.key === 'Enter') {
@@ -2714,7 +3033,34 @@ return (
               </button>
             </div>
             <div className={styles.searchResults}>
-              <p>{searchResults.length > 0 ? `找到 ${searchResults.length} 个匹配` : '暂无结果'}</p>
+              <p>
+                {searchProgress && !searchProgress.done
+                  ? `搜索中 ${Math.floor(searchProgress.progress)}%，已找到 ${searchResults.length} 个匹配`
+                  : searchResults.length > 0
+                    ? `找到 ${searchResults.length} 个匹配`
+                    : '暂无结果'}
+              </p>
+              {!searchProgress && searchResults.length === 0 && searchHistory.length > 0 && (
+                <>
+                  <p>最近搜索</p>
+                  {searchHistory.map((entry) => (
+                    <button
+                      key={entry.id}
+                      type="button"
+                      className={styles.searchResultItem}
+                      onClick={() => {
+                        setSearchKeyword(entry.keyword)
+                        void handleSearch(entry.keyword)
+                      }}
+                    >
+                      <span className={styles.searchResultText}>{entry.keyword}</span>
+                      <span className={styles.searchResultMeta}>
+                        {entry.pinned ? '置顶 · ' : ''}上次 {entry.hitCount} 个匹配
+                      </span>
+                    </button>
+                  ))}
+                </>
+              )}
               {searchResults.map((result, index) => {
                 const chapterIndex = findChapterIndexByPosition(
                   currentNovel.chapters,
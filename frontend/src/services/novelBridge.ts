@@ -1,9 +1,16 @@
 import {
   OpenNovel as rawOpenNovel,
+  OpenNovelWithOptions as rawOpenNovelWithOptions,
   SaveReadingProgress as rawSaveReadingProgress,
   SetCurrentChapter as rawSetCurrentChapter,
 } from '@/wailsjs/go/services/NovelService'
-import type { ChapterContentPayload, SearchResult } from '@/types'
+import { models } from '@/wailsjs/go/models'
+import type {
+  ChapterContentPayload,
+  LibrarySearchResult,
+  SearchHistoryEntry,
+  SearchResult,
+} from '@/types'
 
 const BRIDGE_RETRY_DELAY_MS = 120
 const BRIDGE_RETRY_MAX_ATTEMPTS = 25
@@ -79,9 +86,74 @@ async function callNovelServiceWithRetry<T>(operation: () => Promise<T>): Promis
   throw normalizeNovelServiceError(lastError, '小说服务调用失败')
 }
 
+// 与后端 errPDFPasswordRequired / errPDFPasswordIncorrect 的文案保持一致，错误信息末尾附带文件路径。
+const PDF_PASSWORD_REQUIRED_MESSAGE = 'PDF 已加密，请输入密码: '
+const PDF_PASSWORD_INCORRECT_MESSAGE = 'PDF 密码错误，请重新输入: '
+
+export interface PasswordRequest {
+  filePath: string
+  incorrect: boolean
+}
+
+export interface PasswordAnswer {
+  password: string
+  remember: boolean
+}
+
+type PasswordRequester = (request: PasswordRequest) => Promise<PasswordAnswer | null>
+
+let passwordRequester: PasswordRequester | null = null
+
+// 由全局密码弹窗注册，打开加密 PDF 时向用户索取密码；返回 null 表示用户取消。
+export function setPasswordRequester(requester: PasswordRequester | null) {
+  passwordRequester = requester
+}
+
+function parsePasswordRequest(error: unknown): PasswordRequest | null {
+  const message = getNovelServiceErrorMessage(error)
+  for (const [marker, incorrect] of [
+    [PDF_PASSWORD_REQUIRED_MESSAGE, false],
+    [PDF_PASSWORD_INCORRECT_MESSAGE, true],
+  ] as const) {
+    const markerIndex = message.indexOf(marker)
+    if (markerIndex >= 0) {
+      return { filePath: message.slice(markerIndex + marker.length).trim(), incorrect }
+    }
+  }
+  return null
+}
+
 // 打开小说文件；传空路径时由后端弹出系统文件选择器。
-export function openNovel(filePath: string) {
-  return callNovelServiceWithRetry(() => rawOpenNovel(filePath))
+// 遇到加密 PDF 时弹出密码框，直到打开成功或用户取消。
+export async function openNovel(filePath: string) {
+  try {
+    return await callNovelServiceWithRetry(() => rawOpenNovel(filePath))
+  } catch (error) {
+    let lastError = error
+    let request = parsePasswordRequest(error)
+
+    while (request && request.filePath && passwordRequester) {
+      const answer = await passwordRequester(request)
+      if (!answer) {
+        break
+      }
+
+      try {
+        const { filePath: requestFilePath } = request
+        return await callNovelServiceWithRetry(() =>
+          rawOpenNovelWithOptions(requestFilePath, {
+            password: answer.password,
+            remember_password: answer.remember,
+          })
+        )
+      } catch (retryError) {
+        lastError = retryError
+        request = parsePasswordRequest(retryError)
+      }
+    }
+
+    throw lastError
+  }
 }
 
 // 持久化当前章节和进度，供继续阅读、书架进度展示等场景复用。
@@ -123,6 +195,61 @@ export function searchNovel(filePath: string, keyword: string, caseSensitive = f
   )
 }
 
+type SearchJobWindow = Window & {
+  go?: {
+    services?: {
+      NovelService?: {
+        StartSearch?: (
+          filePath: string,
+          options: { keyword: string; mode: string; case_sensitive: boolean; max_results: number }
+        ) => Promise<string>
+        CancelSearch?: (jobId: string) => Promise<void>
+      }
+    }
+  }
+}
+
+// search:batch 事件：搜索任务推送的一批结果
+export interface SearchBatchEvent {
+  job_id: string
+  results: SearchResult[]
+}
+
+// search:progress 事件：搜索任务进度，progress 为 0-100
+export interface SearchProgressEvent {
+  job_id: string
+  progress: number
+  count: number
+  done: boolean
+  cancelled: boolean
+  error?: string
+}
+
+// 启动后台搜索任务并返回任务 ID，结果和进度通过 search:batch / search:progress 事件推送；
+// 新任务会取消同一本书之前未完成的任务。
+export function startSearch(
+  filePath: string,
+  options: { keyword: string; mode?: string; caseSensitive?: boolean; maxResults?: number }
+) {
+  return callNovelServiceWithRetry(
+    () =>
+      (window as SearchJobWindow).go?.services?.NovelService?.StartSearch?.(filePath, {
+        keyword: options.keyword,
+        mode: options.mode || '',
+        case_sensitive: Boolean(options.caseSensitive),
+        max_results: options.maxResults || 0,
+      }) ?? Promise.reject(new Error('StartSearch 方法不可用'))
+  )
+}
+
+export function cancelSearch(jobId: string) {
+  return callNovelServiceWithRetry(
+    () =>
+      (window as SearchJobWindow).go?.services?.NovelService?.CancelSearch?.(jobId) ??
+      Promise.reject(new Error('CancelSearch 方法不可用'))
+  )
+}
+
 export function getChapterContentPayload(filePath: string, chapterIndex: number) {
   return callNovelServiceWithRetry(
     () =>
@@ -143,3 +270,287 @@ export function getChapterContentPayload(filePath: string, chapterIndex: number)
       Promise.reject(new Error('GetChapterContentPayload 方法不可用'))
   )
 }
+
+// 漫画阅读选项：rightToLeft 为从右到左（日漫），pagesPerChapter 为 1 单页、2 双页同屏。
+export interface ComicOptions {
+  rightToLeft: boolean
+  pagesPerChapter: number
+}
+
+interface RawComicOptions {
+  right_to_left: boolean
+  pages_per_chapter: number
+}
+
+type ComicOptionsWindow = Window & {
+  go?: {
+    services?: {
+      NovelService?: {
+        GetComicOptions?: (filePath: string) => Promise<RawComicOptions>
+        SetComicOptions?: (filePath: string, options: RawComicOptions) => Promise<models.Novel>
+      }
+    }
+  }
+}
+
+// 获取漫画当前生效的阅读方向和每章页数。
+export async function getComicOptions(filePath: string): Promise<ComicOptions> {
+  const options = await callNovelServiceWithRetry(
+    () =>
+      (window as ComicOptionsWindow).go?.services?.NovelService?.GetComicOptions?.(filePath) ??
+      Promise.reject(new Error('GetComicOptions 方法不可用'))
+  )
+  return { rightToLeft: options.right_to_left, pagesPerChapter: options.pages_per_chapter }
+}
+
+// 修改漫画阅读选项并随书保存，返回按新页数重新分章后的书籍信息。
+export function setComicOptions(filePath: string, options: ComicOptions) {
+  return callNovelServiceWithRetry(
+    () =>
+      (window as ComicOptionsWindow).go?.services?.NovelService?.SetComicOptions?.(filePath, {
+        right_to_left: options.rightToLeft,
+        pages_per_chapter: options.pagesPerChapter,
+      }) ?? Promise.reject(new Error('SetComicOptions 方法不可用'))
+  )
+}
+
+interface RawLibrarySearchResult {
+  file_path: string
+  title: string
+  author: string
+  chapter_index: number
+  chapter_title: string
+  position: number
+  chapter_offset: number
+  length: number
+  snippet: string
+}
+
+interface RawSearchOptions {
+  keyword: string
+  mode: string
+  case_sensitive: boolean
+  max_results: number
+}
+
+interface RawSearchHistoryEntry {
+  id: string
+  keyword: string
+  mode: string
+  case_sensitive: boolean
+  hit_count: number
+  last_used: number
+  pinned: boolean
+}
+
+type SearchServiceWindow = Window & {
+  go?: {
+    services?: {
+      SearchService?: {
+        SyncLibraryIndex?: (filePaths: string[]) => Promise<void>
+        SearchLibrary?: (query: string) => Promise<RawLibrarySearchResult[]>
+        RecordSearch?: (
+          filePath: string,
+          options: RawSearchOptions,
+          hitCount: number
+        ) => Promise<RawSearchHistoryEntry>
+        GetSearchHistory?: (filePath: string) => Promise<RawSearchHistoryEntry[]>
+        DeleteSearchHistory?: (filePath: string, id: string) => Promise<void>
+        ClearSearchHistory?: (filePath: string) => Promise<void>
+        PinSearchHistory?: (filePath: string, id: string, pinned: boolean) => Promise<void>
+        SaveSearch?: (options: RawSearchOptions, hitCount: number) => Promise<RawSearchHistoryEntry>
+        GetSavedSearches?: () => Promise<RawSearchHistoryEntry[]>
+        DeleteSavedSearch?: (id: string) => Promise<void>
+        PinSavedSearch?: (id: string, pinned: boolean) => Promise<void>
+      }
+    }
+  }
+}
+
+// 把书架上的文件列表同步给后端，新书和有变化的书在后台建立全文索引。
+export function syncLibraryIndex(filePaths: string[]) {
+  return callNovelServiceWithRetry(
+    () =>
+      (window as SearchServiceWindow).go?.services?.SearchService?.SyncLibraryIndex?.(filePaths) ??
+      Promise.reject(new Error('SyncLibraryIndex 方法不可用'))
+  )
+}
+
+// 在书架上的所有书中检索，返回书、章节与上下文片段。
+export async function searchLibrary(query: string): Promise<LibrarySearchResult[]> {
+  const results = await callNovelServiceWithRetry(
+    () =>
+      (window as SearchServiceWindow).go?.services?.SearchService?.SearchLibrary?.(query) ??
+      Promise.reject(new Error('SearchLibrary 方法不可用'))
+  )
+
+  return (results || []).map((result) => ({
+    filePath: result.file_path,
+    title: result.title,
+    author: result.author,
+    chapterIndex: result.chapter_index,
+    chapterTitle: result.chapter_title,
+    position: result.position,
+    chapterOffset: result.chapter_offset,
+    length: result.length,
+    snippet: result.snippet,
+  }))
+}
+
+function toRawSearchOptions(entry: Pick<SearchHistoryEntry, 'keyword' | 'mode' | 'caseSensitive'>) {
+  return {
+    keyword: entry.keyword,
+    mode: entry.mode || '',
+    case_sensitive: Boolean(entry.caseSensitive),
+    max_results: 0,
+  }
+}
+
+function mapSearchHistoryEntry(entry: RawSearchHistoryEntry): SearchHistoryEntry {
+  return {
+    id: entry.id,
+    keyword: entry.keyword,
+    mode: entry.mode,
+    caseSensitive: entry.case_sensitive,
+    hitCount: entry.hit_count,
+    lastUsed: entry.last_used,
+    pinned: entry.pinned,
+  }
+}
+
+function getSearchService() {
+  return (window as SearchServiceWindow).go?.services?.SearchService
+}
+
+// 记录一次书内搜索及其命中数，返回更新后的历史记录。
+export async function recordSearch(
+  filePath: string,
+  entry: Pick<SearchHistoryEntry, 'keyword' | 'mode' | 'caseSensitive'>,
+  hitCount: number
+) {
+  const recorded = await callNovelServiceWithRetry(
+    () =>
+      getSearchService()?.RecordSearch?.(filePath, toRawSearchOptions(entry), hitCount) ??
+      Promise.reject(new Error('RecordSearch 方法不可用'))
+  )
+  return mapSearchHistoryEntry(recorded)
+}
+
+// 获取一本书最近的搜索，置顶的在前。
+export async function getSearchHistory(filePath: string) {
+  const entries = await callNovelServiceWithRetry(
+    () =>
+      getSearchService()?.GetSearchHistory?.(filePath) ??
+      Promise.reject(new Error('GetSearchHistory 方法不可用'))
+  )
+  return (entries || []).map(mapSearchHistoryEntry)
+}
+
+export function deleteSearchHistory(filePath: string, id: string) {
+  return callNovelServiceWithRetry(
+    () =>
+      getSearchService()?.DeleteSearchHistory?.(filePath, id) ??
+      Promise.reject(new Error('DeleteSearchHistory 方法不可用'))
+  )
+}
+
+// 清空一本书未置顶的搜索历史。
+export function clearSearchHistory(filePath: string) {
+  return callNovelServiceWithRetry(
+    () =>
+      getSearchService()?.ClearSearchHistory?.(filePath) ??
+      Promise.reject(new Error('ClearSearchHistory 方法不可用'))
+  )
+}
+
+export function pinSearchHistory(filePath: string, id: string, pinned: boolean) {
+  return callNovelServiceWithRetry(
+    () =>
+      getSearchService()?.PinSearchHistory?.(filePath, id, pinned) ??
+      Promise.reject(new Error('PinSearchHistory 方法不可用'))
+  )
+}
+
+// 收藏一个搜索，所有书共用。
+export async function saveSearch(
+  entry: Pick<SearchHistoryEntry, 'keyword' | 'mode' | 'caseSensitive'>,
+  hitCount: number
+) {
+  const saved = await callNovelServiceWithRetry(
+    () =>
+      getSearchService()?.SaveSearch?.(toRawSearchOptions(entry), hitCount) ??
+      Promise.reject(new Error('SaveSearch 方法不可用'))
+  )
+  return mapSearchHistoryEntry(saved)
+}
+
+export async function getSavedSearches() {
+  const entries = await callNovelServiceWithRetry(
+    () =>
+      getSearchService()?.GetSavedSearches?.() ??
+      Promise.reject(new Error('GetSavedSearches 方法不可用'))
+  )
+  return (entries || []).map(mapSearchHistoryEntry)
+}
+
+export function deleteSavedSearch(id: string) {
+  return callNovelServiceWithRetry(
+    () =>
+      getSearchService()?.DeleteSavedSearch?.(id) ??
+      Promise.reject(new Error('DeleteSavedSearch 方法不可用'))
+  )
+}
+
+export function pinSavedSearch(id: string, pinned: boolean) {
+  return callNovelServiceWithRetry(
+    () =>
+      getSearchService()?.PinSavedSearch?.(id, pinned) ??
+      Promise.reject(new Error('PinSavedSearch 方法不可用'))
+  )
+}
+
+// ProgressRecovery 进度文件损坏或丢失后的恢复情况
+export interface ProgressRecovery {
+  reason: string
+  // backup 用来恢复的备份文件名，为空表示没有可用备份、进度已重置
+  backup: string
+  recovered_at: number
+}
+
+type ProgressServiceWindow = Window & {
+  go?: {
+    services?: {
+      ProgressService?: {
+        GetProgressRecovery?: () => Promise<ProgressRecovery | null>
+        ClearProgressRecovery?: () => Promise<void>
+        Flush?: () => Promise<void>
+      }
+    }
+  }
+}
+
+// 获取启动时从备份恢复阅读进度的情况，没有发生恢复时返回 null。
+export function getProgressRecovery() {
+  return callNovelServiceWithRetry(
+    () =>
+      (window as ProgressServiceWindow).go?.services?.ProgressService?.GetProgressRecovery?.() ??
+      Promise.reject(new Error('GetProgressRecovery 方法不可用'))
+  )
+}
+
+export function clearProgressRecovery() {
+  return callNovelServiceWithRetry(
+    () =>
+      (window as ProgressServiceWindow).go?.services?.ProgressService?.ClearProgressRecovery?.() ??
+      Promise.reject(new Error('ClearProgressRecovery 方法不可用'))
+  )
+}
+
+// 立即写入后端延迟保存的阅读进度，离开阅读页或切换书籍时调用。
+export function flushProgress() {
+  return callNovelServiceWithRetry(
+    () =>
+      (window as ProgressServiceWindow).go?.services?.ProgressService?.Flush?.() ??
+      Promise.reject(new Error('Flush 方法不可用'))
+  )
+}
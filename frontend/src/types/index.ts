@@ -3,6 +3,9 @@ export interface Novel {
   title: string
   author: string
   filePath: string
+  series?: string
+  seriesIndex?: number
+  annotation?: string
   cover?: string
   format: string
   size: number
@@ -21,6 +24,10 @@ export interface Chapter {
   startPos: number
   endPos: number
   wordCount: number
+  // level 目录层级，0 为顶层
+  level: number
+  // parentIndex 上级章节索引，顶层为 -1
+  parentIndex: number
 }
 
 // SearchResult 搜索结果类型
@@ -29,6 +36,36 @@ export interface SearchResult {
   line: number
   context: string
   keyword: string
+  // length 匹配文本长度，正则搜索时各结果可能不同
+  length?: number
+}
+
+// SearchHistoryEntry 搜索历史或收藏的搜索
+export interface SearchHistoryEntry {
+  id: string
+  keyword: string
+  // mode 匹配方式，为空时按字面匹配
+  mode: string
+  caseSensitive: boolean
+  // hitCount 最近一次搜索的命中数
+  hitCount: number
+  // lastUsed 最近一次搜索的时间（Unix 秒）
+  lastUsed: number
+  pinned: boolean
+}
+
+// LibrarySearchResult 书库检索结果
+export interface LibrarySearchResult {
+  filePath: string
+  title: string
+  author: string
+  // chapterIndex 所在章节，第一章之前的正文为 -1
+  chapterIndex: number
+  chapterTitle: string
+  position: number
+  chapterOffset: number
+  length: number
+  snippet: string
 }
 
 export interface ReaderContentBlock {
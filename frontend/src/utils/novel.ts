@@ -13,6 +13,9 @@ export function normalizeNovel(source: models.Novel | Novel): Novel {
     title: source.title,
     author: ('author' in source && source.author) || DEFAULT_AUTHOR,
     filePath: 'filePath' in source ? source.filePath : source.file_path,
+    series: source.series,
+    seriesIndex: 'seriesIndex' in source ? source.seriesIndex : source.series_index,
+    annotation: source.annotation,
     cover: source.cover,
     format: source.format,
     size: source.size,
@@ -36,6 +39,8 @@ export function normalizeChapter(source: models.Chapter | Chapter): Chapter {
     startPos: 'startPos' in source ? source.startPos : source.start_pos,
     endPos: 'endPos' in source ? source.endPos : source.end_pos,
     wordCount: 'wordCount' in source ? source.wordCount : source.word_count,
+    level: source.level || 0,
+    parentIndex: 'parentIndex' in source ? source.parentIndex : (source.parent_index ?? -1),
   }
 }
 
@@ -360,6 +365,23 @@ export function stripHtmlToText(content: string) {
   return content.replace(/<[^>]+>/g, ' ').replace(/\s+/g, ' ').trim()
 }
 
+// 任一上级章节处于折叠状态时，该章节在目录中隐藏。
+export function isChapterCollapsed(
+  chapters: Chapter[],
+  chapterIndex: number,
+  collapsedIndexes: ReadonlySet<number>
+) {
+  let parentIndex = chapters[chapterIndex]?.parentIndex ?? -1
+  while (parentIndex >= 0) {
+    if (collapsedIndexes.has(parentIndex)) {
+      return true
+    }
+    parentIndex = chapters[parentIndex]?.parentIndex ?? -1
+  }
+
+  return false
+}
+
 export function findChapterIndexByPosition(chapters: Chapter[], position: number) {
   const chapterIndex = chapters.findIndex(
     (chapter) => position >= chapter.startPos && position < chapter.endPos
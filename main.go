@@ -28,7 +28,7 @@ func main() {
 	progressService := services.NewProgressService(cfg.DataDir)
 	novelService := services.NewNovelService(progressService)
 	windowService := services.NewWindowService()
-	searchService := services.NewSearchService()
+	searchService := services.NewSearchService(progressService)
 
 	// 创建应用实例
 	appInstance := app.NewApp(cfg, novelService, windowService, searchService, progressService)